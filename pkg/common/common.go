@@ -3,6 +3,10 @@ package common
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agent-sdk/pkg/util"
 )
 
 const (
@@ -17,6 +21,14 @@ const (
 
 	AttrCredentialID = "kongCredentialID"
 	AttrCredUpdater  = "kongCredentialUpdate"
+	// AttrSuspendedConsumerID - the consumer holding the credential while it is suspended
+	AttrSuspendedConsumerID = "kongSuspendedConsumerID"
+	// AttrRotatedCredentialID - the credential replaced by the last rotation, valid during the rotation grace period
+	AttrRotatedCredentialID = "kongRotatedCredentialID"
+	// AttrCredentialExpiresAt - the time, in RFC3339 format, the credential is deleted from kong at
+	AttrCredentialExpiresAt = "kongCredentialExpiresAt"
+	// AttrSuppliedSecretHash - the sha256 hash of the secret supplied by the consumer, i.e. a key or certificate
+	AttrSuppliedSecretHash = "kongSuppliedSecretHash"
 
 	AclGroup    = "amplify.group"
 	Marketplace = "marketplace"
@@ -30,14 +42,54 @@ const (
 	OAuth2AuthType = "oauth2"
 
 	ApplicationTypeField = "applicationType"
+	// OAuth2 application types, the kong oauth2 credential client types
+	OAuthClientTypeConfidential = "confidential"
+	OAuthClientTypePublic       = "public"
 	// ClientTypeField -
 	ClientTypeField = "clientType"
 	AudienceField   = "audience"
 	OauthScopes     = "oauthScopes"
 
+	// APIKeyField - the api key supplied with an api key credential request
+	APIKeyField = "apiKey"
+
+	// JWTCRD - name of the credential request definition for kong jwt credentials
+	JWTCRD = "jwt"
+	// JWT credential fields
+	JWTAlgorithmField = "algorithm"
+	JWTPublicKeyField = "publicKey"
+	JWTKeyField       = "key"
+	JWTSecretField    = "secret"
+
+	// HMACCRD - name of the credential request definition for kong hmac-auth credentials
+	HMACCRD = "hmac"
+	// HMAC credential fields
+	HMACUsernameField = "username"
+	HMACSecretField   = "secret"
+
+	// MTLS credential fields
+	MTLSCertificateField   = "certificate"
+	MTLSSubjectNameField   = "subjectName"
+	MTLSCACertificateField = "caCertificate"
+
+	// JWT signing algorithms
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+
 	// plugins
 	AclPlugin          = "acl"
 	RateLimitingPlugin = "rate-limiting"
+	// RequestTerminationPlugin - denies the requests of suspended credentials
+	RequestTerminationPlugin = "request-termination"
+
+	// kong credential collections
+	KeyAuthCredentials   = "key-auths"
+	BasicAuthCredentials = "basic-auths"
+	OAuth2Credentials    = "oauth2"
+	JWTCredentials       = "jwts"
+	HMACCredentials      = "hmac-auths"
+	MTLSCredentials      = "mtls-auths"
 
 	// Workspace
 	DefaultWorkspace = "default"
@@ -65,3 +117,17 @@ func GetStringValueFromCtx(ctx context.Context, key ContextKeys) string {
 func WksPrefixName(workspace, name string) string {
 	return fmt.Sprintf("%s-%s", workspace, name)
 }
+
+// IDPCRDName returns the credential request definition name, without the workspace prefix, for an external identity provider
+func IDPCRDName(idpName string) string {
+	return fmt.Sprintf("%s-%s", util.ConvertToDomainNameCompliant(idpName), provisioning.OAuthIDPCRD)
+}
+
+// CredentialTTL returns the ttl, in seconds, of a kong credential expiring at the time, kong requires a positive ttl
+func CredentialTTL(expiresAt, now time.Time) int {
+	ttl := int(expiresAt.Sub(now).Seconds())
+	if ttl < 1 {
+		return 1
+	}
+	return ttl
+}
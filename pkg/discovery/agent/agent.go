@@ -6,13 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi3"
 	klib "github.com/kong/go-kong/kong"
 
 	"github.com/Axway/agent-sdk/pkg/agent"
 	"github.com/Axway/agent-sdk/pkg/apic"
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agent-sdk/pkg/authz/oauth"
 	"github.com/Axway/agent-sdk/pkg/cache"
 	corecfg "github.com/Axway/agent-sdk/pkg/config"
 	"github.com/Axway/agent-sdk/pkg/filter"
@@ -20,22 +25,69 @@ import (
 	"github.com/Axway/agent-sdk/pkg/util/log"
 
 	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
 	"github.com/Axway/agents-kong/pkg/discovery/config"
+	"github.com/Axway/agents-kong/pkg/discovery/drift"
+	"github.com/Axway/agents-kong/pkg/discovery/importer"
 	"github.com/Axway/agents-kong/pkg/discovery/kong"
 	"github.com/Axway/agents-kong/pkg/discovery/subscription"
+	"github.com/Axway/agents-kong/pkg/discovery/subscription/credential"
+	"github.com/Axway/agents-kong/pkg/discovery/sweeper"
+)
+
+const (
+	hmacSchemeName    = "hmacAuth"
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
 )
 
 var kongToCRDMapper = map[string]string{
 	kong.BasicAuthPlugin: provisioning.BasicAuthCRD,
 	kong.KeyAuthPlugin:   provisioning.APIKeyCRD,
 	kong.OAuthPlugin:     provisioning.OAuthSecretCRD,
+	kong.JWTPlugin:       common.JWTCRD,
+	kong.HMACAuthPlugin:  common.HMACCRD,
+	kong.MTLSAuthPlugin:  provisioning.MtlsCRD,
+}
+
+var kongToARDMapper = map[string]string{
+	kong.BasicAuthPlugin: subscription.HttpBasicName,
+	kong.KeyAuthPlugin:   subscription.ApiKeyName,
+	kong.OAuthPlugin:     subscription.Oauth2Name,
+	kong.JWTPlugin:       subscription.JWTName,
+	kong.HMACAuthPlugin:  subscription.HMACName,
+	kong.MTLSAuthPlugin:  subscription.MTLSName,
+	kong.OIDCPlugin:      subscription.Oauth2Name,
+}
+
+// authPluginOrder - the auth plugins in the order kong executes them, highest priority first
+var authPluginOrder = []string{
+	kong.MTLSAuthPlugin,
+	kong.JWTPlugin,
+	kong.OAuthPlugin,
+	kong.KeyAuthPlugin,
+	kong.BasicAuthPlugin,
+	kong.OIDCPlugin,
+	kong.HMACAuthPlugin,
 }
 
 type kongClient interface {
 	// Provisioning
 	CreateConsumer(ctx context.Context, id, name string) (*klib.Consumer, error)
+	EnsureConsumer(ctx context.Context, id, name string, tags []string) (*klib.Consumer, error)
 	AddConsumerACL(ctx context.Context, id string) error
+	AddConsumerACLGroup(ctx context.Context, id, group string) error
 	DeleteConsumer(ctx context.Context, id string) error
+	// Import
+	ListConsumers(ctx context.Context) ([]*klib.Consumer, error)
+	ListConsumerACLGroups(ctx context.Context, id string) ([]string, error)
+	ListConsumerCredentials(ctx context.Context, id string) ([]kong.ConsumerCredential, error)
+	TagConsumer(ctx context.Context, id string, tags []string) error
+	TagCredential(ctx context.Context, collection, credentialID string, tags []string) error
+	// Orphans
+	ListAgentCredentials(ctx context.Context) ([]kong.ConsumerCredential, error)
+	QuarantineEntity(ctx context.Context, collection, id string, since time.Time) error
+	ReleaseEntity(ctx context.Context, collection, id string) error
+	DeleteEntity(ctx context.Context, collection, id string) error
 	// Credential
 	DeleteOauth2(ctx context.Context, consumerID, clientID string) error
 	DeleteHttpBasic(ctx context.Context, consumerID, username string) error
@@ -43,10 +95,32 @@ type kongClient interface {
 	CreateHttpBasic(ctx context.Context, consumerID string, basicAuth *klib.BasicAuth) (*klib.BasicAuth, error)
 	CreateOauth2(ctx context.Context, consumerID string, oauth2 *klib.Oauth2Credential) (*klib.Oauth2Credential, error)
 	CreateAuthKey(ctx context.Context, consumerID string, keyAuth *klib.KeyAuth) (*klib.KeyAuth, error)
+	AuthKeyExists(ctx context.Context, key string) (bool, error)
+	DeleteJWT(ctx context.Context, consumerID, jwtID string) error
+	CreateJWT(ctx context.Context, consumerID string, jwt *klib.JWTAuth) (*klib.JWTAuth, error)
+	DeleteHMAC(ctx context.Context, consumerID, hmacID string) error
+	CreateHMAC(ctx context.Context, consumerID string, hmac *klib.HMACAuth) (*klib.HMACAuth, error)
+	DeleteMTLS(ctx context.Context, consumerID, mtlsID string) error
+	CreateMTLS(ctx context.Context, consumerID string, mtls *klib.MTLSAuth) (*klib.MTLSAuth, error)
+	ListCACertificates(ctx context.Context) ([]*klib.CACertificate, error)
+	EnsureSuspendedConsumer(ctx context.Context, appConsumerID string) (*klib.Consumer, error)
+	DenyConsumer(ctx context.Context, consumerID string) error
+	AllowConsumer(ctx context.Context, consumerID string) error
+	MoveCredential(ctx context.Context, collection, credentialID, consumerID string, credential interface{}) error
+	ExpireCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time) error
+	RenewCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error
+	DeleteExpiredCredentials(ctx context.Context, now time.Time) (int, error)
 	// Access Request
 	AddRouteACL(ctx context.Context, routeID, allowedID string) error
 	RemoveRouteACL(ctx context.Context, routeID, revokedID string) error
 	AddQuota(ctx context.Context, routeID, allowedID, quotaInterval string, quotaLimit int) error
+	QuotaPlugin(ctx context.Context, quotaInterval string) (string, error)
+	RemoveQuota(ctx context.Context, routeID, allowedID string) error
+	// Consumer Groups
+	EnsureConsumerGroup(ctx context.Context, group, quotaInterval string, quotaLimit int) error
+	AddConsumerToGroup(ctx context.Context, group, consumerID string) error
+	RemoveConsumerFromGroup(ctx context.Context, group, consumerID string) error
+	ConsumerGroupsOfConsumer(ctx context.Context, consumerID string) ([]string, error)
 	// Discovery
 	ListServices(ctx context.Context) ([]*klib.Service, error)
 	ListRoutesForService(ctx context.Context, serviceId string) ([]*klib.Route, error)
@@ -61,6 +135,9 @@ type Agent struct {
 	kongClient     kongClient
 	cache          cache.Cache
 	filter         filter.Filter
+	reconciler     *drift.Reconciler
+	importer       *importer.Importer
+	sweeper        *sweeper.Sweeper
 }
 
 func NewAgent(agentConfig config.AgentConfig, agentOpts ...func(a *Agent)) (*Agent, error) {
@@ -103,10 +180,105 @@ func NewAgent(agentConfig config.AgentConfig, agentOpts ...func(a *Agent)) (*Age
 	if agentConfig.KongGatewayCfg.ACL.Disable {
 		opts = append(opts, subscription.WithACLDisable())
 	}
+	consumerGroups := agentConfig.KongGatewayCfg.Provisioning.Mode == config.ProvisioningModeConsumerGroup
+	if consumerGroups {
+		opts = append(opts, subscription.WithConsumerGroups())
+	}
+	if gracePeriod := agentConfig.KongGatewayCfg.Credential.RotationGracePeriod; gracePeriod > 0 {
+		opts = append(opts, subscription.WithRotationGracePeriod(gracePeriod))
+	}
+	apiKeyCfg := agentConfig.KongGatewayCfg.Credential.APIKey
+	opts = append(opts, subscription.WithAPIKeyRules(credential.APIKeyRules{
+		MinLength: apiKeyCfg.MinLength,
+		MaxLength: apiKeyCfg.MaxLength,
+		Charset:   apiKeyCfg.Charset,
+	}))
 	subscription.NewProvisioner(ka.kongClient, ka.centralCfg.GetEnvironmentName(), agentConfig.KongGatewayCfg.Workspaces, opts...)
+
+	if importCfg := agentConfig.KongGatewayCfg.Import; importCfg.Enable {
+		rule, err := importer.NewRule(importCfg)
+		if err != nil {
+			return nil, err
+		}
+		ka.importer = importer.NewImporter(ka.kongClient, agent.GetCacheManager(), agent.GetCentralClient(), rule,
+			ka.centralCfg.GetEnvironmentName(), ka.kongGatewayCfg.Workspaces, importCfg.DryRun)
+	}
+
+	if sweepCfg := agentConfig.KongGatewayCfg.Sweep; sweepCfg.Enable {
+		ka.sweeper = sweeper.NewSweeper(ka.kongClient, agent.GetCacheManager(), ka.kongGatewayCfg.Workspaces, sweepCfg.Quarantine, sweepCfg.ReportOnly)
+		if err := ka.sweeper.Metrics().RegisterHealthcheck(); err != nil {
+			ka.logger.WithError(err).Warn("could not expose the sweep metrics")
+		}
+	}
+
+	driftCfg := agentConfig.KongGatewayCfg.Drift
+	if driftCfg.Interval > 0 {
+		if agentConfig.KongGatewayCfg.ACL.Disable {
+			ka.logger.Warn("ACL and quota drift is not reconciled as the ACL plugin check is disabled")
+			return ka, nil
+		}
+		if consumerGroups {
+			ka.logger.Warn("ACL and quota drift is not reconciled when provisioning access with consumer groups")
+			return ka, nil
+		}
+		ka.reconciler = drift.NewReconciler(ka.kongClient, agent.GetCacheManager(), ka.kongGatewayCfg.Workspaces, driftCfg.ReportOnly)
+		if err := ka.reconciler.Metrics().RegisterHealthcheck(); err != nil {
+			ka.logger.WithError(err).Warn("could not expose the drift metrics")
+		}
+	}
 	return ka, nil
 }
 
+// ReconcileDrift repairs, or reports, the differences between Central and the ACL and quota plugins the agent manages
+func (gc *Agent) ReconcileDrift() {
+	if gc.reconciler == nil {
+		return
+	}
+	drift := gc.reconciler.Reconcile()
+	gc.logger.WithField("drift", len(drift)).Info("reconciled ACL and quota plugins")
+}
+
+// SweepOrphans reports, or deletes after their quarantine, the consumers and credentials the agent created without
+// their Central application or credential
+func (gc *Agent) SweepOrphans() {
+	if gc.sweeper == nil {
+		return
+	}
+	orphans := gc.sweeper.Sweep(time.Now())
+	deleted := 0
+	for _, o := range orphans {
+		if o.Deleted {
+			deleted++
+		}
+	}
+	gc.logger.WithField("orphans", len(orphans)-deleted).WithField("deleted", deleted).Info("swept orphaned consumers and credentials")
+}
+
+// ImportConsumers imports the existing kong consumers and credentials into Central, returns true while the
+// applications of imported consumers are being provisioned and the import has to run again
+func (gc *Agent) ImportConsumers() bool {
+	if gc.importer == nil {
+		return false
+	}
+	report := gc.importer.Import()
+	return report.Pending > 0
+}
+
+// DeleteExpiredCredentials deletes the credentials of every workspace with an expired rotation grace period
+func (gc *Agent) DeleteExpiredCredentials() {
+	for _, workspace := range gc.kongGatewayCfg.Workspaces {
+		log := gc.logger.WithField("workspace", workspace)
+		ctx := context.WithValue(audit.WithRequest(context.Background(), audit.Request{Type: audit.TypeCredentialExpiry}), common.ContextWorkspace, workspace)
+		deleted, err := gc.kongClient.DeleteExpiredCredentials(ctx, time.Now())
+		if err != nil {
+			log.WithError(err).Error("could not delete all expired credentials")
+		}
+		if deleted > 0 {
+			log.WithField("deleted", deleted).Info("deleted expired credentials")
+		}
+	}
+}
+
 func verifyACLPlugin(ctx context.Context, ka *Agent, aclDisable bool) error {
 	pluginLister := ka.kongClient.GetKongPlugins(ctx)
 	if pluginLister == nil {
@@ -223,21 +395,21 @@ func (gc *Agent) processSingleKongService(ctx context.Context, service *klib.Ser
 		return err
 	}
 
-	// don't publish an empty spec
+	// without a spec the routes are only published when a spec can be built from their plugins
+	var specProcessor apic.SpecProcessor
 	if kongServiceSpec == nil {
-		log.Warn("no spec found")
-		return nil
-	}
-
-	// parse the spec file that was found and get the spec processor
-	spec := apic.NewSpecResourceParser(kongServiceSpec, specType(isUnstructured))
-	err = spec.Parse()
-	if err != nil {
-		return err
-	}
-	specProcessor := spec.GetSpecProcessor()
-	if specProcessor == nil {
-		return errors.New("no spec processor")
+		log.Debug("no spec found")
+	} else {
+		// parse the spec file that was found and get the spec processor
+		spec := apic.NewSpecResourceParser(kongServiceSpec, specType(isUnstructured))
+		err = spec.Parse()
+		if err != nil {
+			return err
+		}
+		specProcessor = spec.GetSpecProcessor()
+		if specProcessor == nil {
+			return errors.New("no spec processor")
+		}
 	}
 	wg := sync.WaitGroup{}
 	wg.Add(len(routes))
@@ -266,6 +438,19 @@ func (gc *Agent) specPreparation(ctx context.Context, route *klib.Route, service
 		return
 	}
 
+	if spec == nil {
+		spec, err = requestValidatorSpec(route, service, apiPlugins[kong.RequestValidatorPlugin])
+		if err != nil {
+			log.WithError(err).Warn("could not build spec from request-validator plugin")
+			return
+		}
+		// don't publish an empty spec
+		if spec == nil {
+			log.Warn("no spec found")
+			return
+		}
+	}
+
 	endpoints := gc.processKongRoute(route)
 	if len(endpoints) == 0 {
 		log.Info("not processing route as no enabled endpoints detected")
@@ -314,7 +499,7 @@ func (gc *Agent) processKongAPI(
 	endpoints []apic.EndpointDefinition,
 	apiPlugins map[string]*klib.Plugin,
 ) (*apic.ServiceBody, error) {
-	kongAPI := newKongAPI(ctx, route, service, spec, endpoints, apiPlugins)
+	kongAPI := newKongAPI(ctx, route, service, spec, endpoints, apiPlugins, gc.kongGatewayCfg.Spec.PluginExtensions)
 	isAlreadyPublished, checksum := isPublished(&kongAPI, gc.cache)
 	// If true, then the api is published and there were no changes detected
 	if isAlreadyPublished {
@@ -354,6 +539,7 @@ func newKongAPI(
 	spec apic.SpecProcessor,
 	endpoints []apic.EndpointDefinition,
 	apiPlugins map[string]*klib.Plugin,
+	pluginExtensions []string,
 ) KongAPI {
 	resType := spec.GetResourceType()
 	ka := &KongAPI{
@@ -369,7 +555,10 @@ func newKongAPI(
 		stageName:     *route.Name,
 		stage:         *route.ID,
 	}
+	ka.addPluginExtensions(apiPlugins, pluginExtensions)
 	ka.processSpecSecurity(ctx, spec, apiPlugins)
+	ka.processRequestValidator(route, apiPlugins[kong.RequestValidatorPlugin])
+	ka.processRateLimits(apiPlugins)
 	return *ka
 }
 
@@ -383,23 +572,76 @@ func (ka *KongAPI) processSpecSecurity(ctx context.Context, spec apic.SpecProces
 	oasSpec := spec.(apic.OasSpecProcessor)
 	oasSpec.StripSpecAuth()
 
-	ka.ard = provisioning.APIKeyARD
+	ka.ard = ""
 	ka.crds = []string{}
-	for k, plugin := range apiPlugins {
-		if crd, ok := kongToCRDMapper[k]; ok {
-			ka.crds = append(ka.crds, common.WksPrefixName(workspace, crd))
+	plugins := []authPluginSecurity{}
+	for _, name := range authPluginOrder {
+		plugin, ok := apiPlugins[name]
+		if !ok {
+			continue
+		}
+		authCfg, err := kong.NewAuthPluginConfigFromMap(plugin.Config)
+		if err != nil {
+			continue
 		}
-		switch k {
+
+		recorder := &securityRecorder{OasSpecProcessor: oasSpec}
+		crd := ""
+		if c, ok := kongToCRDMapper[name]; ok {
+			crd = common.WksPrefixName(workspace, c)
+		}
+		switch name {
 		case kong.BasicAuthPlugin:
-			oasSpec.AddSecuritySchemes(oasSpec.GetSecurityBuilder().HTTPBasic().Build())
+			recorder.AddSecuritySchemes(recorder.GetSecurityBuilder().HTTPBasic().Build())
 		case kong.KeyAuthPlugin:
-			ka.apiKeySecurity(oasSpec, plugin.Config)
+			ka.apiKeySecurity(recorder, plugin.Config)
 		case kong.OAuthPlugin:
-			ka.oAuthSecurity(oasSpec, plugin.Config)
+			ka.oAuthSecurity(recorder, plugin.Config)
+		case kong.JWTPlugin:
+			ka.jwtSecurity(recorder, plugin.Config)
+		case kong.HMACAuthPlugin:
+			ka.hmacSecurity(recorder, resType, plugin.Config)
+		case kong.MTLSAuthPlugin:
+			ka.mtlsSecurity(plugin.Config)
+		case kong.OIDCPlugin:
+			crd = ka.oidcSecurity(recorder, workspace, plugin.Config)
 		}
+		plugins = append(plugins, authPluginSecurity{
+			name:      name,
+			crd:       crd,
+			schemes:   recorder.schemes,
+			anonymous: authCfg.AllowsAnonymous(),
+		})
 	}
+	ka.setCredentialDefinitions(plugins)
 
-	ka.spec = oasSpec.(apic.SpecProcessor).GetSpecBytes()
+	specBytes := addSpecExtensions(oasSpec.(apic.SpecProcessor).GetSpecBytes(), ka.specExtensions)
+	ka.spec = setSpecSecurity(specBytes, securityRequirements(plugins))
+}
+
+// setCredentialDefinitions sets the credential request definitions of the plugins a consumer must authenticate
+// with, and the access request definition of the first of those plugins kong executes
+func (ka *KongAPI) setCredentialDefinitions(plugins []authPluginSecurity) {
+	required := []authPluginSecurity{}
+	for _, p := range plugins {
+		if !p.anonymous {
+			required = append(required, p)
+		}
+	}
+	// when every plugin allows anonymous access any of their credentials may be used
+	if len(required) == 0 {
+		required = plugins
+	}
+
+	for _, p := range required {
+		if p.crd == "" {
+			continue
+		}
+		if ka.ard == "" {
+			ka.ard = kongToARDMapper[p.name]
+		}
+		ka.crds = append(ka.crds, p.crd)
+	}
 }
 
 func (ka *KongAPI) apiKeySecurity(spec apic.OasSpecProcessor, config map[string]interface{}) {
@@ -465,6 +707,139 @@ func (ka *KongAPI) oAuthSecurity(spec apic.OasSpecProcessor, config map[string]i
 	spec.AddSecuritySchemes(builder.Build())
 }
 
+func (ka *KongAPI) jwtSecurity(spec apic.OasSpecProcessor, config map[string]interface{}) {
+	if _, err := kong.NewJWTPluginConfigFromMap(config); err != nil {
+		return
+	}
+
+	// kong reads the token from the authorization header as a bearer token by default
+	spec.AddSecuritySchemes(spec.GetSecurityBuilder().Bearer().SetFormat("JWT").Build())
+}
+
+func (ka *KongAPI) hmacSecurity(spec apic.OasSpecProcessor, resType string, config map[string]interface{}) {
+	hmac, err := kong.NewHMACAuthPluginConfigFromMap(config)
+	if err != nil {
+		return
+	}
+
+	// the hmac signature is sent in the authorization header, which oas can only describe as an api key
+	description := "HMAC signature in the Authorization header, e.g. 'hmac username=\"...\", algorithm=\"...\", headers=\"...\", signature=\"...\"'"
+	if len(hmac.Algorithms) > 0 {
+		description = fmt.Sprintf("%s. Supported algorithms: %s", description, strings.Join(hmac.Algorithms, ", "))
+	}
+
+	if resType == apic.Oas2 {
+		spec.AddSecuritySchemes(map[string]interface{}{
+			hmacSchemeName: &openapi2.SecurityScheme{
+				Type:        "apiKey",
+				In:          "header",
+				Name:        "Authorization",
+				Description: description,
+			},
+		})
+		return
+	}
+	spec.AddSecuritySchemes(map[string]interface{}{
+		hmacSchemeName: &openapi3.SecurityScheme{
+			Type:        "apiKey",
+			In:          "header",
+			Name:        "Authorization",
+			Description: description,
+		},
+	})
+}
+
+func (ka *KongAPI) mtlsSecurity(config map[string]interface{}) {
+	mtls, err := kong.NewMTLSAuthPluginConfigFromMap(config)
+	if err != nil {
+		return
+	}
+
+	// oas 3.0 has no mutual tls security scheme, describe it with the axway extension instead
+	ka.addSpecExtension(provisioning.XAxwayMTLS, map[string]interface{}{
+		"description":    "Clients must present a certificate issued by one of the trusted certificate authorities",
+		"caCertificates": mtls.CACertificates,
+		"consumerBy":     mtls.ConsumerBy,
+	})
+}
+
+// oidcSecurity publishes the issuer of the openid-connect plugin. When the issuer is a configured external identity
+// provider the oauth flows are published and the credential request definition for the provider is returned
+func (ka *KongAPI) oidcSecurity(spec apic.OasSpecProcessor, workspace string, config map[string]interface{}) string {
+	oidc, err := kong.NewOIDCPluginConfigFromMap(config)
+	if err != nil || oidc.Issuer == "" {
+		return ""
+	}
+	logger := log.NewFieldLogger().
+		WithComponent("kongAPI").
+		WithPackage("kongAgent").
+		WithField(common.AttrServiceName, ka.name).
+		WithField("issuer", oidc.Issuer)
+
+	issuer := strings.TrimSuffix(strings.TrimSuffix(oidc.Issuer, oidcDiscoveryPath), "/")
+	spec.AddSecuritySchemes(spec.GetSecurityBuilder().OpenID().SetURL(issuer + oidcDiscoveryPath).Build())
+
+	provider := findIDPProvider(oidc.Issuer, issuer)
+	if provider == nil {
+		logger.Warn("the openid-connect issuer is not a configured identity provider, credentials can not be provisioned")
+		return ""
+	}
+	if len(oidc.ConsumerClaim) == 0 {
+		logger.Warn("the openid-connect plugin has no consumer claim, provisioned clients will not be mapped to consumers")
+	}
+
+	scopes := map[string]string{}
+	scopeNames := oidc.ScopesRequired
+	if len(scopeNames) == 0 {
+		scopeNames = oidc.Scopes
+	}
+	for _, n := range scopeNames {
+		scopes[n] = n
+	}
+
+	// kong enables every auth method when none are configured
+	authMethods := oidc.AuthMethods
+	if len(authMethods) == 0 {
+		authMethods = []string{kong.OIDCAuthMethodAuthorizationCode, kong.OIDCAuthMethodClientCredentials, kong.OIDCAuthMethodPassword}
+	}
+
+	builder := spec.GetSecurityBuilder().OAuth()
+	hasFlow := false
+	for _, method := range authMethods {
+		switch method {
+		case kong.OIDCAuthMethodAuthorizationCode:
+			builder = builder.AddFlow(apic.NewOAuthFlowBuilder().SetScopes(scopes).SetAuthorizationURL(provider.GetAuthorizationEndpoint()).SetTokenURL(provider.GetTokenEndpoint()).AuthorizationCode())
+		case kong.OIDCAuthMethodClientCredentials:
+			builder = builder.AddFlow(apic.NewOAuthFlowBuilder().SetScopes(scopes).SetTokenURL(provider.GetTokenEndpoint()).ClientCredentials())
+		case kong.OIDCAuthMethodPassword:
+			builder = builder.AddFlow(apic.NewOAuthFlowBuilder().SetScopes(scopes).SetTokenURL(provider.GetTokenEndpoint()).Password())
+		default:
+			continue
+		}
+		hasFlow = true
+	}
+	if hasFlow {
+		spec.AddSecuritySchemes(builder.Build())
+	}
+
+	return subscription.RegisterIDPCredential(workspace, provider)
+}
+
+// findIDPProvider returns the registered external identity provider for the openid-connect issuer, which kong
+// accepts as either the issuer or the discovery document url
+func findIDPProvider(configuredIssuer, issuer string) oauth.Provider {
+	registry := agent.GetAuthProviderRegistry()
+	for _, i := range []string{issuer, issuer + "/"} {
+		if p, err := registry.GetProviderByIssuer(i); err == nil {
+			return p
+		}
+	}
+	if p, err := registry.GetProviderByMetadataURL(configuredIssuer); err == nil {
+		return p
+	}
+	return nil
+}
+
 func (ka *KongAPI) buildServiceBody() (apic.ServiceBody, error) {
 	tags := map[string]interface{}{}
 	if ka.tags != nil {
@@ -489,6 +864,7 @@ func (ka *KongAPI) buildServiceBody() (apic.ServiceBody, error) {
 		SetResourceType(ka.resourceType).
 		SetServiceAgentDetails(util.MapStringStringToMapStringInterface(ka.agentDetails)).
 		SetServiceAttribute(serviceAttributes).
+		SetInstanceAttribute(rateLimitAttributes(ka.rateLimits)).
 		SetStage(ka.stage).
 		SetStageDisplayName(ka.stageName).
 		SetStageDescriptor("Route").
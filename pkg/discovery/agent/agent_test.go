@@ -2,10 +2,16 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/Axway/agent-sdk/pkg/agent"
+	"github.com/Axway/agent-sdk/pkg/apic"
+	apiv1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
 	"github.com/Axway/agent-sdk/pkg/apic/mock"
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agent-sdk/pkg/authz/oauth"
 	"github.com/Axway/agent-sdk/pkg/cache"
 	corecfg "github.com/Axway/agent-sdk/pkg/config"
 	"github.com/Axway/agent-sdk/pkg/filter"
@@ -143,3 +149,175 @@ func TestDiscovery(t *testing.T) {
 		})
 	}
 }
+
+const testOas3Spec = `{"openapi":"3.0.1","info":{"title":"petstore","version":"1.0.0"},"paths":{"/pets":{"get":{"security":[{"petstoreAuth":[]}],"responses":{"200":{"description":"ok"}}}}}}`
+
+func TestProcessSpecSecurity(t *testing.T) {
+	workspace := common.DefaultWorkspace
+	agent.InitializeForTest(&mock.Client{
+		CreateOrUpdateResourceMock: func(data apiv1.Interface) (*apiv1.ResourceInstance, error) {
+			return data.AsInstance()
+		},
+	}, agent.TestWithMarketplace())
+	idpServer := oauth.NewMockIDPServer()
+	defer idpServer.Close()
+	idpCfg := &corecfg.IDPConfiguration{
+		Name:        "test-idp",
+		Type:        "generic",
+		MetadataURL: idpServer.GetMetadataURL(),
+		AuthConfig: &corecfg.IDPAuthConfiguration{
+			Type:        corecfg.AccessToken,
+			AccessToken: "token",
+		},
+	}
+	err := agent.GetAuthProviderRegistry().RegisterProvider(idpCfg, corecfg.NewTLSConfig(), "", 30*time.Second)
+	assert.Nil(t, err)
+
+	testCases := map[string]struct {
+		plugins          map[string]*klib.Plugin
+		expectCRDs       []string
+		expectARD        string
+		expectSchemes    []string
+		expectSecurity   []interface{}
+		expectExtensions []string
+	}{
+		"jwt plugin publishes bearer security": {
+			plugins: map[string]*klib.Plugin{
+				kong.JWTPlugin: {Name: stringPtr(kong.JWTPlugin), Config: klib.Configuration{}},
+			},
+			expectCRDs:     []string{common.WksPrefixName(workspace, common.JWTCRD)},
+			expectARD:      common.JWTCRD,
+			expectSchemes:  []string{"bearerAuth"},
+			expectSecurity: []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}},
+		},
+		"hmac plugin publishes authorization header security": {
+			plugins: map[string]*klib.Plugin{
+				kong.HMACAuthPlugin: {Name: stringPtr(kong.HMACAuthPlugin), Config: klib.Configuration{"algorithms": []string{"hmac-sha256"}}},
+			},
+			expectCRDs:     []string{common.WksPrefixName(workspace, common.HMACCRD)},
+			expectARD:      common.HMACCRD,
+			expectSchemes:  []string{hmacSchemeName},
+			expectSecurity: []interface{}{map[string]interface{}{hmacSchemeName: []interface{}{}}},
+		},
+		"mtls plugin publishes mtls extension": {
+			plugins: map[string]*klib.Plugin{
+				kong.MTLSAuthPlugin: {Name: stringPtr(kong.MTLSAuthPlugin), Config: klib.Configuration{"ca_certificates": []string{"caID"}}},
+			},
+			expectCRDs:       []string{common.WksPrefixName(workspace, provisioning.MtlsCRD)},
+			expectARD:        provisioning.MtlsCRD,
+			expectExtensions: []string{provisioning.XAxwayMTLS},
+		},
+		"oauth2 plugin without scopes uses the oauth2 access request": {
+			plugins: map[string]*klib.Plugin{
+				kong.OAuthPlugin: {Name: stringPtr(kong.OAuthPlugin), Config: klib.Configuration{}},
+			},
+			expectCRDs: []string{common.WksPrefixName(workspace, provisioning.OAuthSecretCRD)},
+			expectARD:  provisioning.OAuthSecretCRD,
+		},
+		"oauth2 plugin with scopes uses the oauth2 access request": {
+			plugins: map[string]*klib.Plugin{
+				kong.OAuthPlugin: {Name: stringPtr(kong.OAuthPlugin), Config: klib.Configuration{"scopes": []string{"write", "read"}}},
+			},
+			expectCRDs: []string{common.WksPrefixName(workspace, provisioning.OAuthSecretCRD)},
+			expectARD:  provisioning.OAuthSecretCRD,
+		},
+		"openid-connect plugin with a configured identity provider publishes oauth flows": {
+			plugins: map[string]*klib.Plugin{
+				kong.OIDCPlugin: {Name: stringPtr(kong.OIDCPlugin), Config: klib.Configuration{
+					"issuer":         idpServer.GetIssuer() + oidcDiscoveryPath,
+					"auth_methods":   []string{kong.OIDCAuthMethodClientCredentials},
+					"consumer_claim": []string{"client_id"},
+				}},
+			},
+			expectCRDs:    []string{common.WksPrefixName(workspace, common.IDPCRDName("test-idp"))},
+			expectARD:     provisioning.OAuthSecretCRD,
+			expectSchemes: []string{"openId", "oauth2"},
+			expectSecurity: []interface{}{
+				map[string]interface{}{"oauth2": []interface{}{}},
+				map[string]interface{}{"openId": []interface{}{}},
+			},
+		},
+		"openid-connect plugin with an unknown issuer only publishes the discovery url": {
+			plugins: map[string]*klib.Plugin{
+				kong.OIDCPlugin: {Name: stringPtr(kong.OIDCPlugin), Config: klib.Configuration{
+					"issuer": "https://unknown.example.com",
+				}},
+			},
+			expectSchemes:  []string{"openId"},
+			expectSecurity: []interface{}{map[string]interface{}{"openId": []interface{}{}}},
+		},
+		"stacked plugins must all authenticate": {
+			plugins: map[string]*klib.Plugin{
+				kong.BasicAuthPlugin: {Name: stringPtr(kong.BasicAuthPlugin), Config: klib.Configuration{}},
+				kong.KeyAuthPlugin:   {Name: stringPtr(kong.KeyAuthPlugin), Config: klib.Configuration{"key_names": []string{"apikey"}}},
+			},
+			expectCRDs: []string{
+				common.WksPrefixName(workspace, provisioning.APIKeyCRD),
+				common.WksPrefixName(workspace, provisioning.BasicAuthCRD),
+			},
+			expectARD:      provisioning.APIKeyARD,
+			expectSchemes:  []string{"apiKeyHeader", "basicAuth"},
+			expectSecurity: []interface{}{map[string]interface{}{"apiKeyHeader": []interface{}{}, "basicAuth": []interface{}{}}},
+		},
+		"stacked anonymous plugins are alternatives and optional": {
+			plugins: map[string]*klib.Plugin{
+				kong.BasicAuthPlugin: {Name: stringPtr(kong.BasicAuthPlugin), Config: klib.Configuration{"anonymous": "anon"}},
+				kong.KeyAuthPlugin:   {Name: stringPtr(kong.KeyAuthPlugin), Config: klib.Configuration{"key_names": []string{"apikey"}, "anonymous": "anon"}},
+			},
+			expectCRDs: []string{
+				common.WksPrefixName(workspace, provisioning.APIKeyCRD),
+				common.WksPrefixName(workspace, provisioning.BasicAuthCRD),
+			},
+			expectARD:     provisioning.APIKeyARD,
+			expectSchemes: []string{"apiKeyHeader", "basicAuth"},
+			expectSecurity: []interface{}{
+				map[string]interface{}{"apiKeyHeader": []interface{}{}},
+				map[string]interface{}{"basicAuth": []interface{}{}},
+				map[string]interface{}{},
+			},
+		},
+		"anonymous plugin stacked with a required plugin is not offered": {
+			plugins: map[string]*klib.Plugin{
+				kong.BasicAuthPlugin: {Name: stringPtr(kong.BasicAuthPlugin), Config: klib.Configuration{}},
+				kong.KeyAuthPlugin:   {Name: stringPtr(kong.KeyAuthPlugin), Config: klib.Configuration{"key_names": []string{"apikey"}, "anonymous": "anon"}},
+			},
+			expectCRDs:     []string{common.WksPrefixName(workspace, provisioning.BasicAuthCRD)},
+			expectARD:      provisioning.BasicAuthARD,
+			expectSchemes:  []string{"apiKeyHeader", "basicAuth"},
+			expectSecurity: []interface{}{map[string]interface{}{"basicAuth": []interface{}{}}},
+		},
+		"no auth plugins removes the security": {
+			plugins: map[string]*klib.Plugin{},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), common.ContextWorkspace, workspace)
+			parser := apic.NewSpecResourceParser([]byte(testOas3Spec), "")
+			assert.Nil(t, parser.Parse())
+
+			ka := &KongAPI{}
+			ka.processSpecSecurity(ctx, parser.GetSpecProcessor(), tc.plugins)
+			assert.ElementsMatch(t, tc.expectCRDs, ka.crds)
+			assert.Equal(t, tc.expectARD, ka.ard)
+
+			doc := map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal(ka.spec, &doc))
+			if tc.expectSecurity == nil {
+				assert.NotContains(t, doc, securityKey)
+			} else {
+				assert.ElementsMatch(t, tc.expectSecurity, doc[securityKey])
+			}
+			operation := doc["paths"].(map[string]interface{})["/pets"].(map[string]interface{})["get"].(map[string]interface{})
+			assert.NotContains(t, operation, securityKey)
+			for _, scheme := range tc.expectSchemes {
+				components, _ := doc["components"].(map[string]interface{})
+				schemes, _ := components["securitySchemes"].(map[string]interface{})
+				assert.Contains(t, schemes, scheme)
+			}
+			for _, ext := range tc.expectExtensions {
+				assert.Contains(t, doc, ext)
+			}
+		})
+	}
+}
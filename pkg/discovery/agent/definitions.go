@@ -2,6 +2,8 @@ package agent
 
 import (
 	"github.com/Axway/agent-sdk/pkg/apic"
+
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
 )
 
 type KongAPI struct {
@@ -23,4 +25,6 @@ type KongAPI struct {
 	stage             string
 	stageName         string
 	ard               string
+	specExtensions    map[string]interface{}
+	rateLimits        []kong.RateLimit
 }
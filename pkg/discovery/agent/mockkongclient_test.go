@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/Axway/agents-kong/pkg/discovery/kong"
 	klib "github.com/kong/go-kong/kong"
@@ -10,9 +11,22 @@ import (
 
 type mockKongClient struct {
 	// Provisioning
-	CreateConsumerMock func(context.Context, string, string) (*klib.Consumer, error)
-	AddConsumerACLMock func(context.Context, string) error
-	DeleteConsumerMock func(context.Context, string) error
+	CreateConsumerMock      func(context.Context, string, string) (*klib.Consumer, error)
+	EnsureConsumerMock      func(context.Context, string, string, []string) (*klib.Consumer, error)
+	AddConsumerACLMock      func(context.Context, string) error
+	AddConsumerACLGroupMock func(context.Context, string, string) error
+	DeleteConsumerMock      func(context.Context, string) error
+	// Import
+	ListConsumersMock           func(context.Context) ([]*klib.Consumer, error)
+	ListConsumerACLGroupsMock   func(context.Context, string) ([]string, error)
+	ListConsumerCredentialsMock func(context.Context, string) ([]kong.ConsumerCredential, error)
+	TagConsumerMock             func(context.Context, string, []string) error
+	TagCredentialMock           func(context.Context, string, string, []string) error
+	// Orphans
+	ListAgentCredentialsMock func(context.Context) ([]kong.ConsumerCredential, error)
+	QuarantineEntityMock     func(context.Context, string, string, time.Time) error
+	ReleaseEntityMock        func(context.Context, string, string) error
+	DeleteEntityMock         func(context.Context, string, string) error
 	// Credential
 	DeleteOauth2Mock    func(context.Context, string, string) error
 	DeleteHttpBasicMock func(context.Context, string, string) error
@@ -20,10 +34,34 @@ type mockKongClient struct {
 	CreateHttpBasicMock func(context.Context, string, *klib.BasicAuth) (*klib.BasicAuth, error)
 	CreateOauth2Mock    func(context.Context, string, *klib.Oauth2Credential) (*klib.Oauth2Credential, error)
 	CreateAuthKeyMock   func(context.Context, string, *klib.KeyAuth) (*klib.KeyAuth, error)
+	AuthKeyExistsMock   func(context.Context, string) (bool, error)
+	DeleteJWTMock       func(context.Context, string, string) error
+	CreateJWTMock       func(context.Context, string, *klib.JWTAuth) (*klib.JWTAuth, error)
+	DeleteHMACMock      func(context.Context, string, string) error
+	CreateHMACMock      func(context.Context, string, *klib.HMACAuth) (*klib.HMACAuth, error)
+	DeleteMTLSMock      func(context.Context, string, string) error
+	CreateMTLSMock      func(context.Context, string, *klib.MTLSAuth) (*klib.MTLSAuth, error)
+	ListCACertsMock     func(context.Context) ([]*klib.CACertificate, error)
+	// Suspension
+	EnsureSuspendedConsumerMock func(context.Context, string) (*klib.Consumer, error)
+	DenyConsumerMock            func(context.Context, string) error
+	AllowConsumerMock           func(context.Context, string) error
+	MoveCredentialMock          func(context.Context, string, string, string, interface{}) error
+	// Expiry
+	ExpireCredentialMock         func(context.Context, string, string, time.Time) error
+	RenewCredentialMock          func(context.Context, string, string, time.Time, interface{}) error
+	DeleteExpiredCredentialsMock func(context.Context, time.Time) (int, error)
 	// Access Request
 	AddRouteACLMock    func(context.Context, string, string) error
 	RemoveRouteACLMock func(context.Context, string, string) error
 	AddQuotaMock       func(context.Context, string, string, string, int) error
+	RemoveQuotaMock    func(context.Context, string, string) error
+	QuotaPluginMock    func(context.Context, string) (string, error)
+	// Consumer Groups
+	EnsureConsumerGroupMock      func(context.Context, string, string, int) error
+	AddConsumerToGroupMock       func(context.Context, string, string) error
+	RemoveConsumerFromGroupMock  func(context.Context, string, string) error
+	ConsumerGroupsOfConsumerMock func(context.Context, string) ([]string, error)
 	// Discovery
 	ListServicesMock         func(context.Context) ([]*klib.Service, error)
 	ListRoutesForServiceMock func(context.Context, string) ([]*klib.Route, error)
@@ -38,6 +76,13 @@ func (m *mockKongClient) CreateConsumer(ctx context.Context, id, name string) (*
 	return nil, fmt.Errorf("unimplemented test func")
 }
 
+func (m *mockKongClient) EnsureConsumer(ctx context.Context, id, name string, tags []string) (*klib.Consumer, error) {
+	if m.EnsureConsumerMock != nil {
+		return m.EnsureConsumerMock(ctx, id, name, tags)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
 func (m *mockKongClient) AddConsumerACL(ctx context.Context, id string) error {
 	if m.AddConsumerACLMock != nil {
 		return m.AddConsumerACLMock(ctx, id)
@@ -45,6 +90,76 @@ func (m *mockKongClient) AddConsumerACL(ctx context.Context, id string) error {
 	return fmt.Errorf("unimplemented test func")
 }
 
+func (m *mockKongClient) AddConsumerACLGroup(ctx context.Context, id, group string) error {
+	if m.AddConsumerACLGroupMock != nil {
+		return m.AddConsumerACLGroupMock(ctx, id, group)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ListConsumers(ctx context.Context) ([]*klib.Consumer, error) {
+	if m.ListConsumersMock != nil {
+		return m.ListConsumersMock(ctx)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ListConsumerACLGroups(ctx context.Context, id string) ([]string, error) {
+	if m.ListConsumerACLGroupsMock != nil {
+		return m.ListConsumerACLGroupsMock(ctx, id)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ListConsumerCredentials(ctx context.Context, id string) ([]kong.ConsumerCredential, error) {
+	if m.ListConsumerCredentialsMock != nil {
+		return m.ListConsumerCredentialsMock(ctx, id)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) TagConsumer(ctx context.Context, id string, tags []string) error {
+	if m.TagConsumerMock != nil {
+		return m.TagConsumerMock(ctx, id, tags)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) TagCredential(ctx context.Context, collection, credentialID string, tags []string) error {
+	if m.TagCredentialMock != nil {
+		return m.TagCredentialMock(ctx, collection, credentialID, tags)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ListAgentCredentials(ctx context.Context) ([]kong.ConsumerCredential, error) {
+	if m.ListAgentCredentialsMock != nil {
+		return m.ListAgentCredentialsMock(ctx)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) QuarantineEntity(ctx context.Context, collection, id string, since time.Time) error {
+	if m.QuarantineEntityMock != nil {
+		return m.QuarantineEntityMock(ctx, collection, id, since)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ReleaseEntity(ctx context.Context, collection, id string) error {
+	if m.ReleaseEntityMock != nil {
+		return m.ReleaseEntityMock(ctx, collection, id)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) DeleteEntity(ctx context.Context, collection, id string) error {
+	if m.DeleteEntityMock != nil {
+		return m.DeleteEntityMock(ctx, collection, id)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
 func (m *mockKongClient) DeleteConsumer(ctx context.Context, id string) error {
 	if m.DeleteConsumerMock != nil {
 		return m.DeleteConsumerMock(ctx, id)
@@ -94,6 +209,111 @@ func (m *mockKongClient) CreateAuthKey(ctx context.Context, consumerID string, k
 	return nil, fmt.Errorf("unimplemented test func")
 }
 
+func (m *mockKongClient) AuthKeyExists(ctx context.Context, key string) (bool, error) {
+	if m.AuthKeyExistsMock != nil {
+		return m.AuthKeyExistsMock(ctx, key)
+	}
+	return false, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) DeleteJWT(ctx context.Context, consumerID, jwtID string) error {
+	if m.DeleteJWTMock != nil {
+		return m.DeleteJWTMock(ctx, consumerID, jwtID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) CreateJWT(ctx context.Context, consumerID string, jwt *klib.JWTAuth) (*klib.JWTAuth, error) {
+	if m.CreateJWTMock != nil {
+		return m.CreateJWTMock(ctx, consumerID, jwt)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) DeleteHMAC(ctx context.Context, consumerID, hmacID string) error {
+	if m.DeleteHMACMock != nil {
+		return m.DeleteHMACMock(ctx, consumerID, hmacID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) CreateHMAC(ctx context.Context, consumerID string, hmac *klib.HMACAuth) (*klib.HMACAuth, error) {
+	if m.CreateHMACMock != nil {
+		return m.CreateHMACMock(ctx, consumerID, hmac)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) DeleteMTLS(ctx context.Context, consumerID, mtlsID string) error {
+	if m.DeleteMTLSMock != nil {
+		return m.DeleteMTLSMock(ctx, consumerID, mtlsID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) CreateMTLS(ctx context.Context, consumerID string, mtls *klib.MTLSAuth) (*klib.MTLSAuth, error) {
+	if m.CreateMTLSMock != nil {
+		return m.CreateMTLSMock(ctx, consumerID, mtls)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ListCACertificates(ctx context.Context) ([]*klib.CACertificate, error) {
+	if m.ListCACertsMock != nil {
+		return m.ListCACertsMock(ctx)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) EnsureSuspendedConsumer(ctx context.Context, appConsumerID string) (*klib.Consumer, error) {
+	if m.EnsureSuspendedConsumerMock != nil {
+		return m.EnsureSuspendedConsumerMock(ctx, appConsumerID)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) DenyConsumer(ctx context.Context, consumerID string) error {
+	if m.DenyConsumerMock != nil {
+		return m.DenyConsumerMock(ctx, consumerID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) AllowConsumer(ctx context.Context, consumerID string) error {
+	if m.AllowConsumerMock != nil {
+		return m.AllowConsumerMock(ctx, consumerID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) MoveCredential(ctx context.Context, collection, credentialID, consumerID string, credential interface{}) error {
+	if m.MoveCredentialMock != nil {
+		return m.MoveCredentialMock(ctx, collection, credentialID, consumerID, credential)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ExpireCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time) error {
+	if m.ExpireCredentialMock != nil {
+		return m.ExpireCredentialMock(ctx, collection, credentialID, expiresAt)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) RenewCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error {
+	if m.RenewCredentialMock != nil {
+		return m.RenewCredentialMock(ctx, collection, credentialID, expiresAt, credential)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) DeleteExpiredCredentials(ctx context.Context, now time.Time) (int, error) {
+	if m.DeleteExpiredCredentialsMock != nil {
+		return m.DeleteExpiredCredentialsMock(ctx, now)
+	}
+	return 0, fmt.Errorf("unimplemented test func")
+}
+
 func (m *mockKongClient) AddRouteACL(ctx context.Context, routeID, allowedID string) error {
 	if m.AddRouteACLMock != nil {
 		return m.AddRouteACLMock(ctx, routeID, allowedID)
@@ -115,6 +335,48 @@ func (m *mockKongClient) AddQuota(ctx context.Context, routeID, allowedID, quota
 	return fmt.Errorf("unimplemented test func")
 }
 
+func (m *mockKongClient) RemoveQuota(ctx context.Context, routeID, allowedID string) error {
+	if m.RemoveQuotaMock != nil {
+		return m.RemoveQuotaMock(ctx, routeID, allowedID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) QuotaPlugin(ctx context.Context, quotaInterval string) (string, error) {
+	if m.QuotaPluginMock != nil {
+		return m.QuotaPluginMock(ctx, quotaInterval)
+	}
+	return "", fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) EnsureConsumerGroup(ctx context.Context, group, quotaInterval string, quotaLimit int) error {
+	if m.EnsureConsumerGroupMock != nil {
+		return m.EnsureConsumerGroupMock(ctx, group, quotaInterval, quotaLimit)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) AddConsumerToGroup(ctx context.Context, group, consumerID string) error {
+	if m.AddConsumerToGroupMock != nil {
+		return m.AddConsumerToGroupMock(ctx, group, consumerID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) RemoveConsumerFromGroup(ctx context.Context, group, consumerID string) error {
+	if m.RemoveConsumerFromGroupMock != nil {
+		return m.RemoveConsumerFromGroupMock(ctx, group, consumerID)
+	}
+	return fmt.Errorf("unimplemented test func")
+}
+
+func (m *mockKongClient) ConsumerGroupsOfConsumer(ctx context.Context, consumerID string) ([]string, error) {
+	if m.ConsumerGroupsOfConsumerMock != nil {
+		return m.ConsumerGroupsOfConsumerMock(ctx, consumerID)
+	}
+	return nil, fmt.Errorf("unimplemented test func")
+}
+
 func (m *mockKongClient) ListServices(ctx context.Context) ([]*klib.Service, error) {
 	if m.ListServicesMock != nil {
 		return m.ListServicesMock(ctx)
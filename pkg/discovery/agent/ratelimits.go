@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+// processRateLimits collects the limits of the effective rate limiting plugins and documents them
+func (ka *KongAPI) processRateLimits(apiPlugins map[string]*klib.Plugin) {
+	ka.rateLimits = []kong.RateLimit{}
+	for _, name := range kong.RateLimitPlugins {
+		plugin, ok := apiPlugins[name]
+		if !ok {
+			continue
+		}
+		limits, err := kong.NewRateLimitsFromPlugin(name, plugin.Config)
+		if err != nil {
+			continue
+		}
+		ka.rateLimits = append(ka.rateLimits, limits...)
+	}
+	ka.documentation = append(ka.documentation, rateLimitDocumentation(ka.rateLimits)...)
+}
+
+func rateLimitKey(rl kong.RateLimit) string {
+	if rl.Name != "" {
+		return rl.Plugin + "." + rl.Name
+	}
+	return rl.Plugin
+}
+
+// rateLimitAttributes returns the limits as instance attributes, i.e. rate-limiting.minute: 100
+func rateLimitAttributes(limits []kong.RateLimit) map[string]string {
+	attributes := map[string]string{}
+	for _, rl := range limits {
+		key := rateLimitKey(rl)
+		attributes[key+"."+rl.Period] = fmt.Sprint(rl.Limit)
+		if rl.Policy != "" {
+			attributes[rl.Plugin+".policy"] = rl.Policy
+		}
+		if rl.LimitBy != "" {
+			attributes[rl.Plugin+".limitBy"] = rl.LimitBy
+		}
+		if rl.WindowType != "" {
+			attributes[rl.Plugin+".windowType"] = rl.WindowType
+		}
+	}
+	return attributes
+}
+
+// rateLimitDocumentation returns a markdown table of the limits
+func rateLimitDocumentation(limits []kong.RateLimit) []byte {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	doc := &strings.Builder{}
+	doc.WriteString("\n\n## Rate limits\n\n")
+	doc.WriteString("| Plugin | Limit | Period | Policy | Limit by |\n")
+	doc.WriteString("|---|---|---|---|---|\n")
+	for _, rl := range limits {
+		fmt.Fprintf(doc, "| %s | %d | %s | %s | %s |\n", rateLimitKey(rl), rl.Limit, rl.Period, rl.Policy, rl.LimitBy)
+	}
+	return []byte(doc.String())
+}
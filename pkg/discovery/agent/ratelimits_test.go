@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+func TestProcessRateLimits(t *testing.T) {
+	testCases := map[string]struct {
+		plugins          map[string]*klib.Plugin
+		expectAttributes map[string]string
+		expectDocs       []string
+	}{
+		"no rate limiting plugins": {
+			plugins: map[string]*klib.Plugin{
+				kong.KeyAuthPlugin: {Config: klib.Configuration{}},
+			},
+			expectAttributes: map[string]string{},
+		},
+		"invalid plugin config is skipped": {
+			plugins: map[string]*klib.Plugin{
+				kong.RateLimitingAdvancedPlugin: {Config: klib.Configuration{"limit": []int{1}}},
+			},
+			expectAttributes: map[string]string{},
+		},
+		"all rate limiting plugins": {
+			plugins: map[string]*klib.Plugin{
+				common.RateLimitingPlugin: {Config: klib.Configuration{"minute": 100, "policy": "local", "limit_by": "consumer"}},
+				kong.RateLimitingAdvancedPlugin: {Config: klib.Configuration{
+					"limit":       []int{1000},
+					"window_size": []int{3600},
+					"window_type": "sliding",
+					"strategy":    "redis",
+				}},
+				kong.ResponseRateLimitingPlugin: {Config: klib.Configuration{
+					"limits": map[string]interface{}{"videos": map[string]interface{}{"day": 10}},
+				}},
+			},
+			expectAttributes: map[string]string{
+				"rate-limiting.minute":              "100",
+				"rate-limiting.policy":              "local",
+				"rate-limiting.limitBy":             "consumer",
+				"rate-limiting-advanced.hour":       "1000",
+				"rate-limiting-advanced.policy":     "redis",
+				"rate-limiting-advanced.windowType": "sliding",
+				"response-ratelimiting.videos.day":  "10",
+			},
+			expectDocs: []string{
+				"## Rate limits",
+				"| rate-limiting | 100 | minute | local | consumer |",
+				"| rate-limiting-advanced | 1000 | hour | redis |  |",
+				"| response-ratelimiting.videos | 10 | day |  |  |",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ka := &KongAPI{documentation: []byte("service")}
+			ka.processRateLimits(tc.plugins)
+
+			assert.Equal(t, tc.expectAttributes, rateLimitAttributes(ka.rateLimits))
+			if len(tc.expectDocs) == 0 {
+				assert.Equal(t, "service", string(ka.documentation))
+			}
+			for _, doc := range tc.expectDocs {
+				assert.Contains(t, string(ka.documentation), doc)
+			}
+		})
+	}
+}
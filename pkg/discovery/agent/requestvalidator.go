@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agent-sdk/pkg/apic"
+	"github.com/Axway/agent-sdk/pkg/util/log"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+const (
+	parametersKey  = "parameters"
+	requestBodyKey = "requestBody"
+)
+
+// the operations of a generated spec when the route does not restrict the methods
+var defaultValidatorMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// the operations that request-validator body schemas apply to
+var bodyMethods = []string{"post", "put", "patch"}
+
+var oasMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+func routeMethods(route *klib.Route) []string {
+	methods := []string{}
+	for _, m := range route.Methods {
+		if m != nil {
+			methods = append(methods, strings.ToLower(*m))
+		}
+	}
+	return methods
+}
+
+// processRequestValidator merges the request-validator schemas into the oas spec of the route
+func (ka *KongAPI) processRequestValidator(route *klib.Route, plugin *klib.Plugin) {
+	if plugin == nil || (ka.resourceType != apic.Oas2 && ka.resourceType != apic.Oas3) {
+		return
+	}
+	spec, err := mergeRequestValidator(ka.spec, ka.resourceType, routeMethods(route), plugin)
+	if err != nil {
+		log.NewFieldLogger().WithComponent("agent").WithPackage("kongAgent").
+			WithError(err).WithField(common.AttrRouteID, *route.ID).Warn("could not merge request-validator schemas into spec")
+		return
+	}
+	ka.spec = spec
+}
+
+// requestValidatorSpec builds an oas3 spec for a route of a service without a spec from its request-validator plugin
+func requestValidatorSpec(route *klib.Route, service *klib.Service, plugin *klib.Plugin) (apic.SpecProcessor, error) {
+	if plugin == nil {
+		return nil, nil
+	}
+
+	methods := routeMethods(route)
+	if len(methods) == 0 {
+		methods = defaultValidatorMethods
+	}
+	operations := map[string]interface{}{}
+	for _, method := range methods {
+		operations[method] = map[string]interface{}{
+			"responses": map[string]interface{}{
+				"default": map[string]interface{}{"description": "default response"},
+			},
+		}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.1",
+		"info": map[string]interface{}{
+			"title":   *service.Name,
+			"version": "1.0.0",
+		},
+		// route paths are the base paths of the endpoints
+		"paths": map[string]interface{}{"/": operations},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	data, err = mergeRequestValidator(data, apic.Oas3, methods, plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := apic.NewSpecResourceParser(data, apic.Oas3)
+	if err := parser.Parse(); err != nil {
+		return nil, err
+	}
+	return parser.GetSpecProcessor(), nil
+}
+
+// mergeRequestValidator sets the request-validator body and parameter schemas on the operations of the json oas
+// document the route accepts, replacing the schemas of the spec
+func mergeRequestValidator(spec []byte, resType string, methods []string, plugin *klib.Plugin) ([]byte, error) {
+	config, err := kong.NewRequestValidatorPluginConfigFromMap(plugin.Config)
+	if err != nil {
+		return nil, err
+	}
+	bodySchema, err := config.BodyJSONSchema()
+	if err != nil {
+		return nil, err
+	}
+	parameters := map[string]map[string]interface{}{}
+	for _, p := range config.ParameterSchema {
+		schema, err := p.JSONSchema()
+		if err != nil {
+			return nil, err
+		}
+		parameters[p.In+":"+p.Name] = schema
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("spec is not a json document: %w", err)
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	for path, item := range paths {
+		pathItem, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for method, o := range pathItem {
+			operation, ok := o.(map[string]interface{})
+			if !ok || !slices.Contains(oasMethods, method) {
+				continue
+			}
+			if len(methods) > 0 && !slices.Contains(methods, method) {
+				continue
+			}
+			for _, p := range config.ParameterSchema {
+				// path parameters must be part of the path template
+				if p.In == "path" && !strings.Contains(path, "{"+p.Name+"}") {
+					continue
+				}
+				setOperationParameter(operation, validatorParameter(resType, p, parameters[p.In+":"+p.Name]))
+			}
+			if bodySchema != nil && slices.Contains(bodyMethods, method) {
+				setOperationBody(operation, resType, bodySchema, config.ContentTypes())
+			}
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func validatorParameter(resType string, p kong.RequestValidatorParameter, schema map[string]interface{}) map[string]interface{} {
+	param := map[string]interface{}{
+		"name":     p.Name,
+		"in":       p.In,
+		"required": p.Required || p.In == "path",
+	}
+	if resType == apic.Oas2 {
+		// oas2 parameters hold the schema properties themselves
+		for k, v := range schema {
+			param[k] = v
+		}
+		return param
+	}
+
+	param["schema"] = schema
+	if p.Style != "" {
+		param["style"] = p.Style
+		param["explode"] = p.Explode
+	}
+	return param
+}
+
+// setOperationParameter replaces the operation parameter with the same name and location, or adds it
+func setOperationParameter(operation map[string]interface{}, param map[string]interface{}) {
+	params, _ := operation[parametersKey].([]interface{})
+	for i, existing := range params {
+		e, ok := existing.(map[string]interface{})
+		if ok && e["name"] == param["name"] && e["in"] == param["in"] {
+			params[i] = param
+			return
+		}
+	}
+	operation[parametersKey] = append(params, param)
+}
+
+func setOperationBody(operation map[string]interface{}, resType string, schema map[string]interface{}, contentTypes []string) {
+	if resType == apic.Oas2 {
+		body := map[string]interface{}{
+			"name":     "body",
+			"in":       "body",
+			"required": true,
+			"schema":   schema,
+		}
+		params, _ := operation[parametersKey].([]interface{})
+		for i, existing := range params {
+			if e, ok := existing.(map[string]interface{}); ok && e["in"] == "body" {
+				body["name"] = e["name"]
+				params = slices.Delete(params, i, i+1)
+				break
+			}
+		}
+		operation[parametersKey] = append(params, body)
+		operation["consumes"] = contentTypes
+		return
+	}
+
+	requestBody, ok := operation[requestBodyKey].(map[string]interface{})
+	if !ok {
+		requestBody = map[string]interface{}{}
+		operation[requestBodyKey] = requestBody
+	}
+	requestBody["required"] = true
+	content := map[string]interface{}{}
+	for _, contentType := range contentTypes {
+		content[contentType] = map[string]interface{}{"schema": schema}
+	}
+	requestBody["content"] = content
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agent-sdk/pkg/apic"
+)
+
+const (
+	testValidatorBodySchema = `{"type":"object","properties":{"name":{"type":"string"}}}`
+	testValidatorIDSchema   = `{"type":"integer"}`
+	testValidatorLimit      = `{"type":"integer","maximum":100}`
+)
+
+func testValidatorPlugin() *klib.Plugin {
+	return &klib.Plugin{
+		Config: klib.Configuration{
+			"version":               "draft4",
+			"body_schema":           testValidatorBodySchema,
+			"allowed_content_types": []string{"application/json"},
+			"parameter_schema": []interface{}{
+				map[string]interface{}{"in": "path", "name": "id", "required": true, "schema": testValidatorIDSchema},
+				map[string]interface{}{"in": "query", "name": "limit", "schema": testValidatorLimit},
+			},
+		},
+	}
+}
+
+func TestMergeRequestValidator(t *testing.T) {
+	testCases := map[string]struct {
+		spec      string
+		resType   string
+		methods   []string
+		expectErr bool
+		expect    string
+	}{
+		"oas3 schemas replace the spec schemas": {
+			spec:    `{"openapi":"3.0.1","paths":{"/pets/{id}":{"get":{"parameters":[{"name":"limit","in":"query","schema":{"type":"string"}}]},"post":{"requestBody":{"description":"pet","content":{"application/json":{"schema":{"type":"string"}}}}}}}}`,
+			resType: apic.Oas3,
+			expect:  `{"openapi":"3.0.1","paths":{"/pets/{id}":{"get":{"parameters":[{"name":"limit","in":"query","required":false,"schema":` + testValidatorLimit + `},{"name":"id","in":"path","required":true,"schema":` + testValidatorIDSchema + `}]},"post":{"parameters":[{"name":"id","in":"path","required":true,"schema":` + testValidatorIDSchema + `},{"name":"limit","in":"query","required":false,"schema":` + testValidatorLimit + `}],"requestBody":{"description":"pet","required":true,"content":{"application/json":{"schema":` + testValidatorBodySchema + `}}}}}}}`,
+		},
+		"path parameters not in the path are skipped": {
+			spec:    `{"openapi":"3.0.1","paths":{"/pets":{"put":{}}}}`,
+			resType: apic.Oas3,
+			expect:  `{"openapi":"3.0.1","paths":{"/pets":{"put":{"parameters":[{"name":"limit","in":"query","required":false,"schema":` + testValidatorLimit + `}],"requestBody":{"required":true,"content":{"application/json":{"schema":` + testValidatorBodySchema + `}}}}}}}`,
+		},
+		"only route methods are changed": {
+			spec:    `{"openapi":"3.0.1","paths":{"/pets":{"get":{},"post":{}}}}`,
+			resType: apic.Oas3,
+			methods: []string{"get"},
+			expect:  `{"openapi":"3.0.1","paths":{"/pets":{"get":{"parameters":[{"name":"limit","in":"query","required":false,"schema":` + testValidatorLimit + `}]},"post":{}}}}`,
+		},
+		"oas2 body parameter and flattened parameters": {
+			spec:    `{"swagger":"2.0","paths":{"/pets":{"post":{"parameters":[{"name":"pet","in":"body","schema":{"type":"string"}}]}}}}`,
+			resType: apic.Oas2,
+			expect:  `{"swagger":"2.0","paths":{"/pets":{"post":{"consumes":["application/json"],"parameters":[{"name":"limit","in":"query","required":false,"type":"integer","maximum":100},{"name":"pet","in":"body","required":true,"schema":` + testValidatorBodySchema + `}]}}}}`,
+		},
+		"spec is not json": {
+			spec:      "openapi: 3.0.1",
+			resType:   apic.Oas3,
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			spec, err := mergeRequestValidator([]byte(tc.spec), tc.resType, tc.methods, testValidatorPlugin())
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.JSONEq(t, tc.expect, string(spec))
+		})
+	}
+}
+
+func TestRequestValidatorSpec(t *testing.T) {
+	service := &klib.Service{Name: klib.String("petstore")}
+
+	spec, err := requestValidatorSpec(&klib.Route{}, service, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, spec)
+
+	route := &klib.Route{Methods: []*string{klib.String("GET"), klib.String("POST")}}
+	spec, err = requestValidatorSpec(route, service, testValidatorPlugin())
+	assert.Nil(t, err)
+	assert.NotNil(t, spec)
+	assert.Equal(t, apic.Oas3, spec.GetResourceType())
+
+	doc := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(spec.GetSpecBytes(), &doc))
+	operations := doc["paths"].(map[string]interface{})["/"].(map[string]interface{})
+	assert.Len(t, operations, 2)
+	assert.Contains(t, operations["get"], parametersKey)
+	assert.NotContains(t, operations["get"], requestBodyKey)
+	assert.Contains(t, operations["post"], requestBodyKey)
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"encoding/json"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+const pluginExtensionPrefix = "x-kong-plugin-"
+
+func (ka *KongAPI) addSpecExtension(name string, value interface{}) {
+	if ka.specExtensions == nil {
+		ka.specExtensions = map[string]interface{}{}
+	}
+	ka.specExtensions[name] = value
+}
+
+// addPluginExtensions adds the redacted config of the allowed effective plugins as extensions
+func (ka *KongAPI) addPluginExtensions(apiPlugins map[string]*klib.Plugin, allowed []string) {
+	for _, name := range allowed {
+		plugin, ok := apiPlugins[name]
+		if !ok {
+			continue
+		}
+		ka.addSpecExtension(pluginExtensionPrefix+name, kong.RedactPluginConfig(plugin.Config))
+	}
+}
+
+// addSpecExtensions adds the vendor extensions to the root of the json oas document
+func addSpecExtensions(spec []byte, extensions map[string]interface{}) []byte {
+	if len(extensions) == 0 {
+		return spec
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return spec
+	}
+	for name, value := range extensions {
+		doc[name] = value
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return spec
+	}
+	return data
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+func TestAddPluginExtensions(t *testing.T) {
+	plugins := map[string]*klib.Plugin{
+		"cors": {Config: klib.Configuration{"origins": []interface{}{"*"}, "max_age": nil}},
+		"request-transformer": {Config: klib.Configuration{
+			"add": map[string]interface{}{"headers": []interface{}{"Authorization:Basic abc"}},
+		}},
+		kong.KeyAuthPlugin: {Config: klib.Configuration{"key_names": []interface{}{"apikey"}}},
+	}
+
+	testCases := map[string]struct {
+		allowed []string
+		expect  map[string]interface{}
+	}{
+		"no plugins allowed": {
+			expect: map[string]interface{}{},
+		},
+		"allowed plugins are added redacted": {
+			allowed: []string{"cors", "request-transformer", "proxy-cache"},
+			expect: map[string]interface{}{
+				"x-kong-plugin-cors": map[string]interface{}{"origins": []interface{}{"*"}},
+				"x-kong-plugin-request-transformer": map[string]interface{}{
+					"add": map[string]interface{}{"headers": []interface{}{"Authorization:" + kong.RedactedValue}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ka := &KongAPI{}
+			ka.addPluginExtensions(plugins, tc.allowed)
+			spec := addSpecExtensions([]byte(testOas3Spec), ka.specExtensions)
+
+			doc := map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal(spec, &doc))
+			extensions := map[string]interface{}{}
+			for key, value := range doc {
+				if strings.HasPrefix(key, pluginExtensionPrefix) {
+					extensions[key] = value
+				}
+			}
+			assert.Equal(t, tc.expect, extensions)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"github.com/Axway/agent-sdk/pkg/apic"
+)
+
+const securityKey = "security"
+
+// authPluginSecurity - the security an auth plugin adds to the api
+type authPluginSecurity struct {
+	name string
+	crd  string
+	// schemes are alternatives, kong accepts a credential for any of them
+	schemes   []string
+	anonymous bool
+}
+
+// securityRecorder records the names of the security schemes added to the spec
+type securityRecorder struct {
+	apic.OasSpecProcessor
+	schemes []string
+}
+
+func (r *securityRecorder) AddSecuritySchemes(schemes map[string]interface{}) {
+	for name := range schemes {
+		if !slices.Contains(r.schemes, name) {
+			r.schemes = append(r.schemes, name)
+		}
+	}
+	sort.Strings(r.schemes)
+	r.OasSpecProcessor.AddSecuritySchemes(schemes)
+}
+
+// securityRequirements combines the auth plugins the way kong does. Every plugin without an anonymous consumer must
+// authenticate the request. When all plugins allow anonymous access any one of them may, or none at all
+func securityRequirements(plugins []authPluginSecurity) []map[string][]string {
+	required := [][]string{}
+	alternatives := []string{}
+	allAnonymous := true
+	for _, p := range plugins {
+		if !p.anonymous {
+			allAnonymous = false
+		}
+		// plugins without a security scheme, i.e. mtls-auth, can not be part of a requirement
+		if len(p.schemes) == 0 {
+			continue
+		}
+		if !p.anonymous {
+			required = append(required, p.schemes)
+		}
+		alternatives = append(alternatives, p.schemes...)
+	}
+
+	requirements := []map[string][]string{}
+	if len(required) > 0 {
+		// one scheme of each required plugin
+		requirements = append(requirements, map[string][]string{})
+		for _, schemes := range required {
+			combined := []map[string][]string{}
+			for _, requirement := range requirements {
+				for _, scheme := range schemes {
+					r := map[string][]string{scheme: {}}
+					for k, v := range requirement {
+						r[k] = v
+					}
+					combined = append(combined, r)
+				}
+			}
+			requirements = combined
+		}
+		return requirements
+	}
+	if !allAnonymous {
+		return requirements
+	}
+
+	for _, scheme := range alternatives {
+		requirements = append(requirements, map[string][]string{scheme: {}})
+	}
+	if len(requirements) > 0 {
+		// an empty requirement makes the authentication optional
+		requirements = append(requirements, map[string][]string{})
+	}
+	return requirements
+}
+
+// setSpecSecurity replaces the security requirements of the json oas document, operation level requirements
+// refer to the security schemes removed from the original spec and are removed
+func setSpecSecurity(spec []byte, requirements []map[string][]string) []byte {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return spec
+	}
+
+	delete(doc, securityKey)
+	if len(requirements) > 0 {
+		doc[securityKey] = requirements
+	}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	for _, pathItem := range paths {
+		operations, ok := pathItem.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, operation := range operations {
+			if op, ok := operation.(map[string]interface{}); ok {
+				delete(op, securityKey)
+			}
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return spec
+	}
+	return data
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityRequirements(t *testing.T) {
+	testCases := map[string]struct {
+		plugins      []authPluginSecurity
+		expectResult []map[string][]string
+	}{
+		"no plugins": {
+			expectResult: []map[string][]string{},
+		},
+		"plugin schemes are alternatives": {
+			plugins: []authPluginSecurity{
+				{schemes: []string{"apiKeyHeader", "apiKeyQuery"}},
+			},
+			expectResult: []map[string][]string{
+				{"apiKeyHeader": {}},
+				{"apiKeyQuery": {}},
+			},
+		},
+		"required plugins combine one scheme of each": {
+			plugins: []authPluginSecurity{
+				{schemes: []string{"apiKeyHeader", "apiKeyQuery"}},
+				{schemes: []string{"basicAuth"}},
+			},
+			expectResult: []map[string][]string{
+				{"apiKeyHeader": {}, "basicAuth": {}},
+				{"apiKeyQuery": {}, "basicAuth": {}},
+			},
+		},
+		"anonymous plugins are optional alternatives": {
+			plugins: []authPluginSecurity{
+				{schemes: []string{"apiKeyHeader"}, anonymous: true},
+				{schemes: []string{"basicAuth"}, anonymous: true},
+			},
+			expectResult: []map[string][]string{
+				{"apiKeyHeader": {}},
+				{"basicAuth": {}},
+				{},
+			},
+		},
+		"required plugin without a scheme is not made optional": {
+			plugins: []authPluginSecurity{
+				{name: "mtls-auth"},
+				{schemes: []string{"apiKeyHeader"}, anonymous: true},
+			},
+			expectResult: []map[string][]string{},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := securityRequirements(tc.plugins)
+			assert.ElementsMatch(t, tc.expectResult, result)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/Axway/agent-sdk/pkg/util/log"
+
+	"github.com/Axway/agents-kong/pkg/discovery/config"
+)
+
+const (
+	// ActionProvision - the provisioning of a Central resource
+	ActionProvision = "provision"
+	// ActionDeprovision - the removal of a Central resource
+	ActionDeprovision = "deprovision"
+	// ActionUpdate - the update of a Central credential, i.e. a rotation or suspension
+	ActionUpdate = "update"
+
+	// TypeDrift - the ACL and quota drift reconciliation of the agent
+	TypeDrift = "drift"
+	// TypeSweep - the sweep of orphaned consumers and credentials
+	TypeSweep = "sweep"
+	// TypeImport - the import of the consumers and credentials created before the agent
+	TypeImport = "import"
+	// TypeCredentialExpiry - the deletion of expired credentials
+	TypeCredentialExpiry = "credentialExpiry"
+
+	// OutcomeSuccess - kong applied the mutation
+	OutcomeSuccess = "success"
+	// OutcomeFailure - kong rejected the mutation, or could not be reached
+	OutcomeFailure = "failure"
+
+	webhookQueueSize = 1000
+)
+
+// Request - the Central request, or agent job, causing kong mutations
+type Request struct {
+	// ID - the id of the Central resource, empty for the jobs of the agent
+	ID string
+	// Type - the kind of the Central resource, i.e. ManagedApplication, or the agent job, i.e. drift
+	Type string
+	// Action - provision, deprovision or update, empty for the jobs of the agent
+	Action string
+}
+
+type requestKey struct{}
+
+// WithRequest returns a context of the mutations caused by the request
+func WithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFromContext returns the request of the context, empty when the context has no request
+func RequestFromContext(ctx context.Context) Request {
+	request, _ := ctx.Value(requestKey{}).(Request)
+	return request
+}
+
+// Record - a single mutation of a kong entity, secrets in its state are redacted
+type Record struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"requestID,omitempty"`
+	RequestType   string    `json:"requestType,omitempty"`
+	RequestAction string    `json:"requestAction,omitempty"`
+	Workspace     string    `json:"workspace"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	// Entity - the kong collection of the entity, i.e. consumers, acls, plugins or key-auths
+	Entity   string                 `json:"entity"`
+	EntityID string                 `json:"entityID,omitempty"`
+	Before   map[string]interface{} `json:"before,omitempty"`
+	After    map[string]interface{} `json:"after,omitempty"`
+	Outcome  string                 `json:"outcome"`
+	Status   int                    `json:"status,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	// LatencyMs - the duration of the mutation, in milliseconds
+	LatencyMs int64 `json:"latencyMs"`
+}
+
+// Auditor writes the records to a rotating jsonl file and, when configured, posts them to a webhook
+type Auditor struct {
+	logger  log.FieldLogger
+	mutex   sync.Mutex
+	file    io.Writer
+	url     string
+	client  *http.Client
+	webhook chan []byte
+}
+
+func NewAuditor(cfg config.KongAuditConfig) *Auditor {
+	a := &Auditor{
+		logger: log.NewFieldLogger().WithComponent("Auditor").WithPackage("audit"),
+		file: &lumberjack.Logger{
+			Filename:   cfg.Path,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+		},
+	}
+	if cfg.Webhook.URL != "" {
+		a.url = cfg.Webhook.URL
+		a.client = &http.Client{Timeout: cfg.Webhook.Timeout}
+		a.webhook = make(chan []byte, webhookQueueSize)
+		go a.post()
+	}
+	return a
+}
+
+// Record writes the record, the webhook is posted in the background so that kong mutations are not delayed
+func (a *Auditor) Record(record Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		a.logger.WithError(err).Error("could not marshal audit record")
+		return
+	}
+
+	a.mutex.Lock()
+	_, err = a.file.Write(append(data, '\n'))
+	a.mutex.Unlock()
+	if err != nil {
+		a.logger.WithError(err).Error("could not write audit record")
+	}
+
+	if a.webhook == nil {
+		return
+	}
+	select {
+	case a.webhook <- data:
+	default:
+		a.logger.WithField("path", record.Path).Warn("audit webhook queue is full, record not posted")
+	}
+}
+
+func (a *Auditor) post() {
+	for data := range a.webhook {
+		resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			a.logger.WithError(err).Error("could not post audit record")
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			a.logger.WithField("status", resp.StatusCode).Error("audit webhook rejected the record")
+		}
+	}
+}
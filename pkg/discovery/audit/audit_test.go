@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/discovery/config"
+)
+
+func TestRequestContext(t *testing.T) {
+	assert.Equal(t, Request{}, RequestFromContext(context.Background()))
+
+	request := Request{ID: "appID", Type: "ManagedApplication", Action: ActionProvision}
+	ctx := WithRequest(context.Background(), request)
+	assert.Equal(t, request, RequestFromContext(ctx))
+}
+
+func TestAuditor(t *testing.T) {
+	posted := make(chan Record, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		record := Record{}
+		json.Unmarshal(data, &record)
+		posted <- record
+	}))
+	defer server.Close()
+
+	testCases := map[string]struct {
+		webhook bool
+	}{
+		"file": {},
+		"file and webhook": {
+			webhook: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "kong_audit.jsonl")
+			cfg := config.KongAuditConfig{Enable: true, Path: path, MaxSize: 1}
+			if tc.webhook {
+				cfg.Webhook = config.KongAuditWebhookConfig{URL: server.URL, Timeout: time.Second}
+			}
+			auditor := NewAuditor(cfg)
+
+			record := Record{RequestID: "appID", Method: http.MethodPost, Path: "/consumers", Entity: "consumers", EntityID: "consumerID", Outcome: OutcomeSuccess}
+			auditor.Record(record)
+			auditor.Record(record)
+
+			data, err := os.ReadFile(path)
+			assert.Nil(t, err)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			assert.Len(t, lines, 2)
+			written := Record{}
+			assert.Nil(t, json.Unmarshal([]byte(lines[0]), &written))
+			assert.Equal(t, record, written)
+
+			if !tc.webhook {
+				return
+			}
+			select {
+			case p := <-posted:
+				assert.Equal(t, record, p)
+			case <-time.After(5 * time.Second):
+				t.Fatal("record not posted to the webhook")
+			}
+		})
+	}
+}
@@ -44,6 +44,46 @@ func run() error {
 		return err
 	}
 
+	if agentConfig.KongGatewayCfg.Import.Enable {
+		go func() {
+			// the access requests and credentials of new applications are imported once the applications are provisioned
+			for kongAgent.ImportConsumers() {
+				time.Sleep(agentConfig.CentralCfg.GetPollInterval())
+			}
+		}()
+	}
+
+	if sweepCfg := agentConfig.KongGatewayCfg.Sweep; sweepCfg.Enable {
+		go func() {
+			// without an interval the orphans are only swept once, at startup
+			for {
+				kongAgent.SweepOrphans()
+				if sweepCfg.Interval <= 0 {
+					return
+				}
+				time.Sleep(sweepCfg.Interval)
+			}
+		}()
+	}
+
+	if interval := agentConfig.KongGatewayCfg.Drift.Interval; interval > 0 {
+		go func() {
+			for {
+				time.Sleep(interval)
+				kongAgent.ReconcileDrift()
+			}
+		}()
+	}
+
+	if interval := agentConfig.KongGatewayCfg.Credential.ExpiryInterval; interval > 0 {
+		go func() {
+			for {
+				kongAgent.DeleteExpiredCredentials()
+				time.Sleep(interval)
+			}
+		}()
+	}
+
 	go func() {
 		for {
 			err = kongAgent.DiscoverAPIs()
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Axway/agent-sdk/pkg/cmd/properties"
 	corecfg "github.com/Axway/agent-sdk/pkg/config"
@@ -16,10 +18,12 @@ type props interface {
 	AddStringSliceProperty(name string, defaultVal []string, description string)
 	AddIntProperty(name string, defaultVal int, description string, options ...properties.IntOpt)
 	AddBoolProperty(name string, defaultVal bool, description string)
+	AddDurationProperty(name string, defaultVal time.Duration, description string, options ...properties.DurationOpt)
 	StringPropertyValue(name string) string
 	StringSlicePropertyValue(name string) []string
 	IntPropertyValue(name string) int
 	BoolPropertyValue(name string) bool
+	DurationPropertyValue(name string) time.Duration
 }
 
 // Methods for adding yaml properties and command flag
@@ -48,6 +52,64 @@ const (
 	cfgKongSpecFilter                 = "kong.spec.filter"
 	cfgKongSpecDevPortal              = "kong.spec.devPortalEnabled"
 	cfgKongSpecCreateUnstructuredAPI  = "kong.spec.createUnstructuredAPI"
+	cfgKongSpecPluginExtensions       = "kong.spec.pluginExtensions"
+	cfgKongDriftInterval              = "kong.drift.interval"
+	cfgKongDriftReportOnly            = "kong.drift.reportOnly"
+	cfgKongProvisioningMode           = "kong.provisioning.mode"
+	cfgKongQuotaPolicy                = "kong.quota.policy"
+	cfgKongQuotaFaultTolerant         = "kong.quota.faultTolerant"
+	cfgKongQuotaHideClientHeaders     = "kong.quota.hideClientHeaders"
+	cfgKongQuotaRedisHost             = "kong.quota.redis.host"
+	cfgKongQuotaRedisPort             = "kong.quota.redis.port"
+	cfgKongQuotaRedisUsername         = "kong.quota.redis.username"
+	cfgKongQuotaRedisPassword         = "kong.quota.redis.password"
+	cfgKongQuotaRedisDatabase         = "kong.quota.redis.database"
+	cfgKongQuotaRedisTimeout          = "kong.quota.redis.timeout"
+	cfgKongQuotaRedisSSL              = "kong.quota.redis.ssl"
+	cfgKongQuotaRedisSSLVerify        = "kong.quota.redis.sslVerify"
+	cfgKongQuotaRedisServerName       = "kong.quota.redis.serverName"
+	cfgKongQuotaOverrides             = "kong.quota.overrides"
+	cfgKongCredentialGracePeriod      = "kong.credential.rotationGracePeriod"
+	cfgKongCredentialExpiryInterval   = "kong.credential.expiryInterval"
+	cfgKongCredentialAPIKeyMinLength  = "kong.credential.apiKey.minLength"
+	cfgKongCredentialAPIKeyMaxLength  = "kong.credential.apiKey.maxLength"
+	cfgKongCredentialAPIKeyCharset    = "kong.credential.apiKey.charset"
+	cfgKongImportEnable               = "kong.import.enable"
+	cfgKongImportDryRun               = "kong.import.dryRun"
+	cfgKongImportRule                 = "kong.import.rule"
+	cfgKongImportTagPrefix            = "kong.import.tagPrefix"
+	cfgKongImportUsernamePattern      = "kong.import.usernamePattern"
+	cfgKongImportCSVFile              = "kong.import.csvFile"
+	cfgKongSweepEnable                = "kong.sweep.enable"
+	cfgKongSweepInterval              = "kong.sweep.interval"
+	cfgKongSweepQuarantine            = "kong.sweep.quarantine"
+	cfgKongSweepReportOnly            = "kong.sweep.reportOnly"
+	cfgKongAuditEnable                = "kong.audit.enable"
+	cfgKongAuditPath                  = "kong.audit.path"
+	cfgKongAuditMaxSize               = "kong.audit.maxSize"
+	cfgKongAuditMaxBackups            = "kong.audit.maxBackups"
+	cfgKongAuditMaxAge                = "kong.audit.maxAge"
+	cfgKongAuditWebhookURL            = "kong.audit.webhook.url"
+	cfgKongAuditWebhookTimeout        = "kong.audit.webhook.timeout"
+)
+
+// provisioning modes
+const (
+	// ProvisioningModeConsumer - route acls allow each consumer and quotas are rate-limiting plugins per consumer and route
+	ProvisioningModeConsumer = "consumer"
+	// ProvisioningModeConsumerGroup - route acls allow consumer groups, one per product plan or access tier, and
+	// quotas are rate-limiting-advanced plugins per consumer group
+	ProvisioningModeConsumerGroup = "consumerGroup"
+)
+
+// import rules, mapping existing kong consumers to Central applications
+const (
+	// ImportRuleTag - the application is the value of the consumer tag with the tag prefix, i.e. app:billing
+	ImportRuleTag = "tag"
+	// ImportRuleUsername - the application is the first group of the username pattern matching the consumer username
+	ImportRuleUsername = "username"
+	// ImportRuleCSV - the application is listed in a csv file of workspace, consumer username or id and application
+	ImportRuleCSV = "csv"
 )
 
 func AddKongProperties(rootProps props) {
@@ -74,6 +136,45 @@ func AddKongProperties(rootProps props) {
 	rootProps.AddStringProperty(cfgKongSpecFilter, "", "SDK Filter format. Empty means filters are ignored.")
 	rootProps.AddBoolProperty(cfgKongSpecDevPortal, false, "Set to true to enable gathering specs from the Kong's dev portal.")
 	rootProps.AddBoolProperty(cfgKongSpecCreateUnstructuredAPI, false, "Set to true to publish unstructured API if spec is not found.")
+	rootProps.AddStringSliceProperty(cfgKongSpecPluginExtensions, []string{}, "List of plugin names to add to the spec as x-kong-plugin-<name> extensions")
+	rootProps.AddDurationProperty(cfgKongDriftInterval, 0, "The interval to reconcile the agent managed ACL and quota plugins with Central, 0 disables the reconciliation")
+	rootProps.AddBoolProperty(cfgKongDriftReportOnly, false, "Set to true to only report ACL and quota drift, without repairing it")
+	rootProps.AddStringProperty(cfgKongProvisioningMode, ProvisioningModeConsumer, "How access is provisioned, consumer or consumerGroup (Kong Enterprise 3.x)")
+	rootProps.AddStringProperty(cfgKongQuotaPolicy, QuotaPolicyLocal, "The policy of the rate limiting plugins enforcing quotas, local, cluster or redis")
+	rootProps.AddBoolProperty(cfgKongQuotaFaultTolerant, true, "Set to false to reject requests when the quota counters can not be reached")
+	rootProps.AddBoolProperty(cfgKongQuotaHideClientHeaders, false, "Set to true to hide the rate limit headers from clients")
+	rootProps.AddStringProperty(cfgKongQuotaRedisHost, "", "The redis host of the redis quota policy")
+	rootProps.AddIntProperty(cfgKongQuotaRedisPort, 6379, "The redis port of the redis quota policy")
+	rootProps.AddStringProperty(cfgKongQuotaRedisUsername, "", "The redis username of the redis quota policy")
+	rootProps.AddStringProperty(cfgKongQuotaRedisPassword, "", "The redis password of the redis quota policy")
+	rootProps.AddIntProperty(cfgKongQuotaRedisDatabase, 0, "The redis database of the redis quota policy")
+	rootProps.AddIntProperty(cfgKongQuotaRedisTimeout, 2000, "The redis timeout, in milliseconds, of the redis quota policy")
+	rootProps.AddBoolProperty(cfgKongQuotaRedisSSL, false, "Set to true to connect to redis with TLS")
+	rootProps.AddBoolProperty(cfgKongQuotaRedisSSLVerify, false, "Set to true to verify the redis server certificate")
+	rootProps.AddStringProperty(cfgKongQuotaRedisServerName, "", "The server name indication of the redis TLS connection")
+	rootProps.AddStringProperty(cfgKongQuotaOverrides, "", "JSON formatted quota settings per workspace and kong service tag, overriding the global quota settings")
+	rootProps.AddDurationProperty(cfgKongCredentialGracePeriod, time.Hour, "The time a rotated credential stays valid after its replacement has been created, 0 deletes it right away")
+	rootProps.AddDurationProperty(cfgKongCredentialExpiryInterval, 5*time.Minute, "The interval to delete the rotated credentials with an expired grace period")
+	rootProps.AddIntProperty(cfgKongCredentialAPIKeyMinLength, 16, "The minimum length of a consumer supplied api key")
+	rootProps.AddIntProperty(cfgKongCredentialAPIKeyMaxLength, 128, "The maximum length of a consumer supplied api key")
+	rootProps.AddStringProperty(cfgKongCredentialAPIKeyCharset, DefaultAPIKeyCharset, "The characters allowed in a consumer supplied api key, as the content of a regular expression character class")
+	rootProps.AddBoolProperty(cfgKongImportEnable, false, "Set to true to import the existing Kong consumers and credentials into Central at startup")
+	rootProps.AddBoolProperty(cfgKongImportDryRun, false, "Set to true to only report the applications, access requests and credentials the import would create")
+	rootProps.AddStringProperty(cfgKongImportRule, ImportRuleTag, "How consumers are mapped to Central applications, tag, username or csv")
+	rootProps.AddStringProperty(cfgKongImportTagPrefix, "app:", "The prefix of the consumer tag holding the application name, for the tag import rule")
+	rootProps.AddStringProperty(cfgKongImportUsernamePattern, "", "The regular expression matching consumer usernames, its first group is the application name, for the username import rule")
+	rootProps.AddStringProperty(cfgKongImportCSVFile, "", "The csv file of workspace, consumer username or id and application name lines, for the csv import rule")
+	rootProps.AddBoolProperty(cfgKongSweepEnable, false, "Set to true to look for agent created consumers and credentials without their Central application or credential")
+	rootProps.AddDurationProperty(cfgKongSweepInterval, 0, "The interval to look for orphaned consumers and credentials, 0 only looks once at startup")
+	rootProps.AddDurationProperty(cfgKongSweepQuarantine, 24*time.Hour, "The time a consumer or credential stays orphaned before it is deleted")
+	rootProps.AddBoolProperty(cfgKongSweepReportOnly, true, "Set to false to delete the consumers and credentials orphaned longer than the quarantine")
+	rootProps.AddBoolProperty(cfgKongAuditEnable, false, "Set to true to write an audit record of every change the agent makes in Kong")
+	rootProps.AddStringProperty(cfgKongAuditPath, "logs/kong_audit.jsonl", "The jsonl file of the audit records")
+	rootProps.AddIntProperty(cfgKongAuditMaxSize, 100, "The size, in megabytes, of the audit file before it is rotated")
+	rootProps.AddIntProperty(cfgKongAuditMaxBackups, 10, "The number of rotated audit files to keep, 0 keeps all of them")
+	rootProps.AddIntProperty(cfgKongAuditMaxAge, 0, "The days to keep rotated audit files, 0 does not remove them by age")
+	rootProps.AddStringProperty(cfgKongAuditWebhookURL, "", "The url the audit records are posted to, empty does not post them")
+	rootProps.AddDurationProperty(cfgKongAuditWebhookTimeout, 5*time.Second, "The timeout of the audit webhook requests")
 }
 
 // AgentConfig - represents the config for agent
@@ -125,20 +226,88 @@ type KongSpecConfig struct {
 	DevPortalEnabled      bool     `config:"devPortalEnabled"`
 	Filter                string   `config:"filter"`
 	CreateUnstructuredAPI bool     `config:"createUnstructuredAPI"`
+	PluginExtensions      []string `config:"pluginExtensions"`
 }
 
 type KongACLConfig struct {
 	Disable bool `config:"disable"`
 }
 
+type KongProvisioningConfig struct {
+	Mode string `config:"mode"`
+}
+
+// KongCredentialConfig - the settings of the credentials the agent provisions
+type KongCredentialConfig struct {
+	RotationGracePeriod time.Duration    `config:"rotationGracePeriod"`
+	ExpiryInterval      time.Duration    `config:"expiryInterval"`
+	APIKey              KongAPIKeyConfig `config:"apiKey"`
+}
+
+// DefaultAPIKeyCharset - the characters allowed in a consumer supplied api key by default, unreserved url characters
+const DefaultAPIKeyCharset = "A-Za-z0-9._~-"
+
+// KongAPIKeyConfig - the rules a consumer supplied api key must follow
+type KongAPIKeyConfig struct {
+	MinLength int    `config:"minLength"`
+	MaxLength int    `config:"maxLength"`
+	Charset   string `config:"charset"`
+}
+
+// KongImportConfig - the import of the consumers and credentials created in kong before the agent
+type KongImportConfig struct {
+	Enable          bool   `config:"enable"`
+	DryRun          bool   `config:"dryRun"`
+	Rule            string `config:"rule"`
+	TagPrefix       string `config:"tagPrefix"`
+	UsernamePattern string `config:"usernamePattern"`
+	CSVFile         string `config:"csvFile"`
+}
+
+// KongSweepConfig - the garbage collection of the consumers and credentials the agent created, once their Central
+// application or credential is gone
+type KongSweepConfig struct {
+	Enable     bool          `config:"enable"`
+	Interval   time.Duration `config:"interval"`
+	Quarantine time.Duration `config:"quarantine"`
+	ReportOnly bool          `config:"reportOnly"`
+}
+
+// KongAuditConfig - the audit records of the changes the agent makes in kong
+type KongAuditConfig struct {
+	Enable     bool                   `config:"enable"`
+	Path       string                 `config:"path"`
+	MaxSize    int                    `config:"maxSize"`
+	MaxBackups int                    `config:"maxBackups"`
+	MaxAge     int                    `config:"maxAge"`
+	Webhook    KongAuditWebhookConfig `config:"webhook"`
+}
+
+type KongAuditWebhookConfig struct {
+	URL     string        `config:"url"`
+	Timeout time.Duration `config:"timeout"`
+}
+
+type KongDriftConfig struct {
+	Interval   time.Duration `config:"interval"`
+	ReportOnly bool          `config:"reportOnly"`
+}
+
 // KongGatewayConfig - represents the config for gateway
 type KongGatewayConfig struct {
 	corecfg.IConfigValidator
-	Workspaces []string        `config:"workspaces"`
-	Admin      KongAdminConfig `config:"admin"`
-	Proxy      KongProxyConfig `config:"proxy"`
-	Spec       KongSpecConfig  `config:"spec"`
-	ACL        KongACLConfig   `config:"acl"`
+	Workspaces   []string               `config:"workspaces"`
+	Admin        KongAdminConfig        `config:"admin"`
+	Proxy        KongProxyConfig        `config:"proxy"`
+	Spec         KongSpecConfig         `config:"spec"`
+	ACL          KongACLConfig          `config:"acl"`
+	Drift        KongDriftConfig        `config:"drift"`
+	Provisioning KongProvisioningConfig `config:"provisioning"`
+	Quota        KongQuotaConfig        `config:"quota"`
+	Credential   KongCredentialConfig   `config:"credential"`
+	Import       KongImportConfig       `config:"import"`
+	Sweep        KongSweepConfig        `config:"sweep"`
+	Audit        KongAuditConfig        `config:"audit"`
 }
 
 const (
@@ -152,6 +321,20 @@ const (
 		"Examples: <http://kong.com:8001>, <https://kong.com:8444>"
 	credentialConfigErr = "invalid authorization configuration provided. " +
 		"If provided, (Username and Password) or (ClientID and ClientSecret) must be non-empty"
+	provisioningModeErr = "invalid provisioning mode provided, must be consumer or consumerGroup"
+	gracePeriodErr      = "the credential rotation grace period can not be negative"
+	expiryIntervalErr   = "a positive credential expiry interval is required to delete rotated credentials"
+	apiKeyLengthErr     = "the api key minimum length can not be negative or exceed the maximum length"
+	apiKeyCharsetErr    = "the api key charset must be the content of a valid regular expression character class"
+	importRuleErr       = "invalid import rule provided, must be tag, username or csv"
+	importTagPrefixErr  = "a tag prefix is required by the tag import rule"
+	importPatternErr    = "a valid username pattern is required by the username import rule"
+	importCSVFileErr    = "a csv file is required by the csv import rule"
+	sweepIntervalErr    = "the sweep interval can not be negative"
+	sweepQuarantineErr  = "the sweep quarantine can not be negative"
+	auditPathErr        = "an audit file path is required to audit kong changes"
+	auditRotationErr    = "the audit file size, backups and age can not be negative"
+	auditWebhookErr     = "invalid audit webhook url provided, must contain protocol and hostname"
 )
 
 // ValidateCfg - Validates the gateway config
@@ -184,6 +367,33 @@ func (c *KongGatewayConfig) ValidateCfg() error {
 	if invalidCredentialConfig(c) {
 		return errors.New(credentialConfigErr)
 	}
+	if c.Provisioning.Mode != "" && c.Provisioning.Mode != ProvisioningModeConsumer && c.Provisioning.Mode != ProvisioningModeConsumerGroup {
+		return errors.New(provisioningModeErr)
+	}
+	if c.Credential.RotationGracePeriod < 0 {
+		return errors.New(gracePeriodErr)
+	}
+	if c.Credential.RotationGracePeriod > 0 && c.Credential.ExpiryInterval <= 0 {
+		return errors.New(expiryIntervalErr)
+	}
+	if err := c.Credential.APIKey.validate(); err != nil {
+		return err
+	}
+	if err := c.Import.validate(); err != nil {
+		return err
+	}
+	if c.Sweep.Interval < 0 {
+		return errors.New(sweepIntervalErr)
+	}
+	if c.Sweep.Quarantine < 0 {
+		return errors.New(sweepQuarantineErr)
+	}
+	if err := c.Audit.validate(); err != nil {
+		return err
+	}
+	if err := c.Quota.validate(); err != nil {
+		return fmt.Errorf("kong.quota: %s", err.Error())
+	}
 	if tlsValidate, validator := c.Admin.TLS.(corecfg.IConfigValidator); validator {
 		if err := tlsValidate.ValidateCfg(); err != nil {
 			return fmt.Errorf("kong.admin.%s", err.Error())
@@ -280,6 +490,120 @@ func ParseProperties(rootProps props) *KongGatewayConfig {
 			LocalPath:             rootProps.StringPropertyValue(cfgKongSpecLocalPath),
 			Filter:                rootProps.StringPropertyValue(cfgKongSpecFilter),
 			CreateUnstructuredAPI: rootProps.BoolPropertyValue(cfgKongSpecCreateUnstructuredAPI),
+			PluginExtensions:      rootProps.StringSlicePropertyValue(cfgKongSpecPluginExtensions),
 		},
+		Drift: KongDriftConfig{
+			Interval:   rootProps.DurationPropertyValue(cfgKongDriftInterval),
+			ReportOnly: rootProps.BoolPropertyValue(cfgKongDriftReportOnly),
+		},
+		Provisioning: KongProvisioningConfig{
+			Mode: rootProps.StringPropertyValue(cfgKongProvisioningMode),
+		},
+		Quota: KongQuotaConfig{
+			Policy:            rootProps.StringPropertyValue(cfgKongQuotaPolicy),
+			FaultTolerant:     rootProps.BoolPropertyValue(cfgKongQuotaFaultTolerant),
+			HideClientHeaders: rootProps.BoolPropertyValue(cfgKongQuotaHideClientHeaders),
+			Redis: KongQuotaRedisConfig{
+				Host:       rootProps.StringPropertyValue(cfgKongQuotaRedisHost),
+				Port:       rootProps.IntPropertyValue(cfgKongQuotaRedisPort),
+				Username:   rootProps.StringPropertyValue(cfgKongQuotaRedisUsername),
+				Password:   rootProps.StringPropertyValue(cfgKongQuotaRedisPassword),
+				Database:   rootProps.IntPropertyValue(cfgKongQuotaRedisDatabase),
+				Timeout:    rootProps.IntPropertyValue(cfgKongQuotaRedisTimeout),
+				SSL:        rootProps.BoolPropertyValue(cfgKongQuotaRedisSSL),
+				SSLVerify:  rootProps.BoolPropertyValue(cfgKongQuotaRedisSSLVerify),
+				ServerName: rootProps.StringPropertyValue(cfgKongQuotaRedisServerName),
+			},
+			Overrides: rootProps.StringPropertyValue(cfgKongQuotaOverrides),
+		},
+		Credential: KongCredentialConfig{
+			RotationGracePeriod: rootProps.DurationPropertyValue(cfgKongCredentialGracePeriod),
+			ExpiryInterval:      rootProps.DurationPropertyValue(cfgKongCredentialExpiryInterval),
+			APIKey: KongAPIKeyConfig{
+				MinLength: rootProps.IntPropertyValue(cfgKongCredentialAPIKeyMinLength),
+				MaxLength: rootProps.IntPropertyValue(cfgKongCredentialAPIKeyMaxLength),
+				Charset:   rootProps.StringPropertyValue(cfgKongCredentialAPIKeyCharset),
+			},
+		},
+		Import: KongImportConfig{
+			Enable:          rootProps.BoolPropertyValue(cfgKongImportEnable),
+			DryRun:          rootProps.BoolPropertyValue(cfgKongImportDryRun),
+			Rule:            rootProps.StringPropertyValue(cfgKongImportRule),
+			TagPrefix:       rootProps.StringPropertyValue(cfgKongImportTagPrefix),
+			UsernamePattern: rootProps.StringPropertyValue(cfgKongImportUsernamePattern),
+			CSVFile:         rootProps.StringPropertyValue(cfgKongImportCSVFile),
+		},
+		Sweep: KongSweepConfig{
+			Enable:     rootProps.BoolPropertyValue(cfgKongSweepEnable),
+			Interval:   rootProps.DurationPropertyValue(cfgKongSweepInterval),
+			Quarantine: rootProps.DurationPropertyValue(cfgKongSweepQuarantine),
+			ReportOnly: rootProps.BoolPropertyValue(cfgKongSweepReportOnly),
+		},
+		Audit: KongAuditConfig{
+			Enable:     rootProps.BoolPropertyValue(cfgKongAuditEnable),
+			Path:       rootProps.StringPropertyValue(cfgKongAuditPath),
+			MaxSize:    rootProps.IntPropertyValue(cfgKongAuditMaxSize),
+			MaxBackups: rootProps.IntPropertyValue(cfgKongAuditMaxBackups),
+			MaxAge:     rootProps.IntPropertyValue(cfgKongAuditMaxAge),
+			Webhook: KongAuditWebhookConfig{
+				URL:     rootProps.StringPropertyValue(cfgKongAuditWebhookURL),
+				Timeout: rootProps.DurationPropertyValue(cfgKongAuditWebhookTimeout),
+			},
+		},
+	}
+}
+
+// validate checks the api key rules, a zero maximum length or an empty charset does not restrict the api key
+func (c KongAPIKeyConfig) validate() error {
+	if c.MinLength < 0 || (c.MaxLength > 0 && c.MaxLength < c.MinLength) {
+		return errors.New(apiKeyLengthErr)
+	}
+	if c.Charset == "" {
+		return nil
 	}
+	if _, err := regexp.Compile(fmt.Sprintf("^[%s]+$", c.Charset)); err != nil {
+		return errors.New(apiKeyCharsetErr)
+	}
+	return nil
+}
+
+// validate checks the settings of the import rule, the settings are not checked when the import is disabled
+func (c KongImportConfig) validate() error {
+	if !c.Enable {
+		return nil
+	}
+	switch c.Rule {
+	case ImportRuleTag:
+		if c.TagPrefix == "" {
+			return errors.New(importTagPrefixErr)
+		}
+	case ImportRuleUsername:
+		if _, err := regexp.Compile(c.UsernamePattern); err != nil || c.UsernamePattern == "" {
+			return errors.New(importPatternErr)
+		}
+	case ImportRuleCSV:
+		if c.CSVFile == "" {
+			return errors.New(importCSVFileErr)
+		}
+	default:
+		return errors.New(importRuleErr)
+	}
+	return nil
+}
+
+// validate checks the audit file and webhook, when kong changes are audited
+func (c KongAuditConfig) validate() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.Path == "" {
+		return errors.New(auditPathErr)
+	}
+	if c.MaxSize < 0 || c.MaxBackups < 0 || c.MaxAge < 0 {
+		return errors.New(auditRotationErr)
+	}
+	if c.Webhook.URL != "" && invalidAdminUrl(c.Webhook.URL) {
+		return errors.New(auditWebhookErr)
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Axway/agent-sdk/pkg/cmd/properties"
 	"github.com/stretchr/testify/assert"
@@ -65,6 +66,102 @@ func TestKongGatewayCfg(t *testing.T) {
 	err = cfg.ValidateCfg()
 	assert.Equal(t, nil, err)
 
+	cfg.Provisioning.Mode = "plan"
+	err = cfg.ValidateCfg()
+	assert.Equal(t, provisioningModeErr, err.Error())
+
+	cfg.Provisioning.Mode = ProvisioningModeConsumerGroup
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
+	cfg.Credential.RotationGracePeriod = -time.Minute
+	err = cfg.ValidateCfg()
+	assert.Equal(t, gracePeriodErr, err.Error())
+
+	cfg.Credential.RotationGracePeriod = time.Hour
+	err = cfg.ValidateCfg()
+	assert.Equal(t, expiryIntervalErr, err.Error())
+
+	cfg.Credential.ExpiryInterval = 5 * time.Minute
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
+	cfg.Credential.APIKey = KongAPIKeyConfig{MinLength: 32, MaxLength: 16}
+	err = cfg.ValidateCfg()
+	assert.Equal(t, apiKeyLengthErr, err.Error())
+
+	cfg.Credential.APIKey = KongAPIKeyConfig{MinLength: 16, MaxLength: 32, Charset: "a-"}
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
+	cfg.Credential.APIKey.Charset = "z-a"
+	err = cfg.ValidateCfg()
+	assert.Equal(t, apiKeyCharsetErr, err.Error())
+
+	cfg.Credential.APIKey.Charset = DefaultAPIKeyCharset
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
+	cfg.Import = KongImportConfig{Enable: true, Rule: "owner"}
+	err = cfg.ValidateCfg()
+	assert.Equal(t, importRuleErr, err.Error())
+
+	cfg.Import.Rule = ImportRuleTag
+	err = cfg.ValidateCfg()
+	assert.Equal(t, importTagPrefixErr, err.Error())
+
+	cfg.Import.Rule = ImportRuleUsername
+	cfg.Import.UsernamePattern = "^(.+"
+	err = cfg.ValidateCfg()
+	assert.Equal(t, importPatternErr, err.Error())
+
+	cfg.Import.Rule = ImportRuleCSV
+	err = cfg.ValidateCfg()
+	assert.Equal(t, importCSVFileErr, err.Error())
+
+	cfg.Import = KongImportConfig{Rule: "owner"}
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
+	cfg.Sweep.Interval = -time.Minute
+	err = cfg.ValidateCfg()
+	assert.Equal(t, sweepIntervalErr, err.Error())
+
+	cfg.Sweep.Interval = time.Hour
+	cfg.Sweep.Quarantine = -time.Hour
+	err = cfg.ValidateCfg()
+	assert.Equal(t, sweepQuarantineErr, err.Error())
+
+	cfg.Sweep.Quarantine = 0
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
+	cfg.Audit = KongAuditConfig{Enable: true}
+	err = cfg.ValidateCfg()
+	assert.Equal(t, auditPathErr, err.Error())
+
+	cfg.Audit.Path = "logs/kong_audit.jsonl"
+	cfg.Audit.MaxBackups = -1
+	err = cfg.ValidateCfg()
+	assert.Equal(t, auditRotationErr, err.Error())
+
+	cfg.Audit.MaxBackups = 0
+	cfg.Audit.Webhook.URL = "audit.example.com"
+	err = cfg.ValidateCfg()
+	assert.Equal(t, auditWebhookErr, err.Error())
+
+	cfg.Audit.Webhook.URL = "https://audit.example.com/kong"
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
+	cfg.Quota.Policy = QuotaPolicyRedis
+	err = cfg.ValidateCfg()
+	assert.Equal(t, "kong.quota: "+quotaRedisErr, err.Error())
+
+	cfg.Quota.Redis.Host = "redis"
+	err = cfg.ValidateCfg()
+	assert.Equal(t, nil, err)
+
 }
 
 type propData struct {
@@ -93,6 +190,10 @@ func (f *fakeProps) AddBoolProperty(name string, defaultVal bool, description st
 	f.props[name] = propData{"bool", description, defaultVal}
 }
 
+func (f *fakeProps) AddDurationProperty(name string, defaultVal time.Duration, description string, options ...properties.DurationOpt) {
+	f.props[name] = propData{"duration", description, defaultVal}
+}
+
 func (f *fakeProps) StringPropertyValue(name string) string {
 	if prop, ok := f.props[name]; ok {
 		return prop.val.(string)
@@ -121,6 +222,13 @@ func (f *fakeProps) BoolPropertyValue(name string) bool {
 	return false
 }
 
+func (f *fakeProps) DurationPropertyValue(name string) time.Duration {
+	if prop, ok := f.props[name]; ok {
+		return prop.val.(time.Duration)
+	}
+	return 0
+}
+
 func TestKongProperties(t *testing.T) {
 	newProps := &fakeProps{props: map[string]propData{}}
 
@@ -143,6 +251,45 @@ func TestKongProperties(t *testing.T) {
 	assert.Contains(t, newProps.props, cfgKongSpecFilter)
 	assert.Contains(t, newProps.props, cfgKongSpecDevPortal)
 	assert.Contains(t, newProps.props, cfgKongSpecCreateUnstructuredAPI)
+	assert.Contains(t, newProps.props, cfgKongSpecPluginExtensions)
+	assert.Contains(t, newProps.props, cfgKongDriftInterval)
+	assert.Contains(t, newProps.props, cfgKongDriftReportOnly)
+	assert.Contains(t, newProps.props, cfgKongProvisioningMode)
+	assert.Contains(t, newProps.props, cfgKongQuotaPolicy)
+	assert.Contains(t, newProps.props, cfgKongQuotaFaultTolerant)
+	assert.Contains(t, newProps.props, cfgKongQuotaHideClientHeaders)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisHost)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisPort)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisUsername)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisPassword)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisDatabase)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisTimeout)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisSSL)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisSSLVerify)
+	assert.Contains(t, newProps.props, cfgKongQuotaRedisServerName)
+	assert.Contains(t, newProps.props, cfgKongQuotaOverrides)
+	assert.Contains(t, newProps.props, cfgKongCredentialGracePeriod)
+	assert.Contains(t, newProps.props, cfgKongCredentialExpiryInterval)
+	assert.Contains(t, newProps.props, cfgKongCredentialAPIKeyMinLength)
+	assert.Contains(t, newProps.props, cfgKongCredentialAPIKeyMaxLength)
+	assert.Contains(t, newProps.props, cfgKongCredentialAPIKeyCharset)
+	assert.Contains(t, newProps.props, cfgKongImportEnable)
+	assert.Contains(t, newProps.props, cfgKongImportDryRun)
+	assert.Contains(t, newProps.props, cfgKongImportRule)
+	assert.Contains(t, newProps.props, cfgKongImportTagPrefix)
+	assert.Contains(t, newProps.props, cfgKongImportUsernamePattern)
+	assert.Contains(t, newProps.props, cfgKongImportCSVFile)
+	assert.Contains(t, newProps.props, cfgKongSweepEnable)
+	assert.Contains(t, newProps.props, cfgKongSweepInterval)
+	assert.Contains(t, newProps.props, cfgKongSweepQuarantine)
+	assert.Contains(t, newProps.props, cfgKongSweepReportOnly)
+	assert.Contains(t, newProps.props, cfgKongAuditEnable)
+	assert.Contains(t, newProps.props, cfgKongAuditPath)
+	assert.Contains(t, newProps.props, cfgKongAuditMaxSize)
+	assert.Contains(t, newProps.props, cfgKongAuditMaxBackups)
+	assert.Contains(t, newProps.props, cfgKongAuditMaxAge)
+	assert.Contains(t, newProps.props, cfgKongAuditWebhookURL)
+	assert.Contains(t, newProps.props, cfgKongAuditWebhookTimeout)
 
 	// validate defaults
 	cfg := ParseProperties(newProps)
@@ -163,6 +310,28 @@ func TestKongProperties(t *testing.T) {
 	assert.Equal(t, "", cfg.Spec.Filter)
 	assert.Equal(t, false, cfg.Spec.DevPortalEnabled)
 	assert.Equal(t, false, cfg.Spec.CreateUnstructuredAPI)
+	assert.Equal(t, []string{}, cfg.Spec.PluginExtensions)
+	assert.Equal(t, time.Duration(0), cfg.Drift.Interval)
+	assert.Equal(t, false, cfg.Drift.ReportOnly)
+	assert.Equal(t, ProvisioningModeConsumer, cfg.Provisioning.Mode)
+	assert.Equal(t, QuotaPolicyLocal, cfg.Quota.Policy)
+	assert.Equal(t, true, cfg.Quota.FaultTolerant)
+	assert.Equal(t, false, cfg.Quota.HideClientHeaders)
+	assert.Equal(t, "", cfg.Quota.Redis.Host)
+	assert.Equal(t, 6379, cfg.Quota.Redis.Port)
+	assert.Equal(t, 2000, cfg.Quota.Redis.Timeout)
+	assert.Equal(t, "", cfg.Quota.Overrides)
+	assert.Equal(t, time.Hour, cfg.Credential.RotationGracePeriod)
+	assert.Equal(t, 5*time.Minute, cfg.Credential.ExpiryInterval)
+	assert.Equal(t, KongAPIKeyConfig{MinLength: 16, MaxLength: 128, Charset: DefaultAPIKeyCharset}, cfg.Credential.APIKey)
+	assert.Equal(t, KongImportConfig{Rule: ImportRuleTag, TagPrefix: "app:"}, cfg.Import)
+	assert.Equal(t, KongSweepConfig{Quarantine: 24 * time.Hour, ReportOnly: true}, cfg.Sweep)
+	assert.Equal(t, KongAuditConfig{
+		Path:       "logs/kong_audit.jsonl",
+		MaxSize:    100,
+		MaxBackups: 10,
+		Webhook:    KongAuditWebhookConfig{Timeout: 5 * time.Second},
+	}, cfg.Audit)
 
 	// validate changed values
 	newProps.props[cfgKongACLDisable] = propData{"bool", "", true}
@@ -180,6 +349,38 @@ func TestKongProperties(t *testing.T) {
 	newProps.props[cfgKongSpecFilter] = propData{"string", "", "tag_filter"}
 	newProps.props[cfgKongSpecDevPortal] = propData{"bool", "", true}
 	newProps.props[cfgKongSpecCreateUnstructuredAPI] = propData{"bool", "", true}
+	newProps.props[cfgKongSpecPluginExtensions] = propData{"string", "", []string{"cors", "proxy-cache"}}
+	newProps.props[cfgKongDriftInterval] = propData{"duration", "", 10 * time.Minute}
+	newProps.props[cfgKongDriftReportOnly] = propData{"bool", "", true}
+	newProps.props[cfgKongProvisioningMode] = propData{"string", "", ProvisioningModeConsumerGroup}
+	newProps.props[cfgKongQuotaPolicy] = propData{"string", "", QuotaPolicyRedis}
+	newProps.props[cfgKongQuotaFaultTolerant] = propData{"bool", "", false}
+	newProps.props[cfgKongQuotaHideClientHeaders] = propData{"bool", "", true}
+	newProps.props[cfgKongQuotaRedisHost] = propData{"string", "", "redis"}
+	newProps.props[cfgKongQuotaRedisPort] = propData{"int", "", 6380}
+	newProps.props[cfgKongQuotaRedisUsername] = propData{"string", "", "user"}
+	newProps.props[cfgKongQuotaRedisPassword] = propData{"string", "", "secret"}
+	newProps.props[cfgKongQuotaRedisDatabase] = propData{"int", "", 2}
+	newProps.props[cfgKongQuotaRedisTimeout] = propData{"int", "", 500}
+	newProps.props[cfgKongQuotaRedisSSL] = propData{"bool", "", true}
+	newProps.props[cfgKongQuotaRedisSSLVerify] = propData{"bool", "", true}
+	newProps.props[cfgKongQuotaRedisServerName] = propData{"string", "", "redis.local"}
+	newProps.props[cfgKongQuotaOverrides] = propData{"string", "", `{"workspaces":{"team":{"policy":"local"}}}`}
+	newProps.props[cfgKongCredentialGracePeriod] = propData{"duration", "", 30 * time.Minute}
+	newProps.props[cfgKongCredentialExpiryInterval] = propData{"duration", "", time.Minute}
+	newProps.props[cfgKongCredentialAPIKeyMinLength] = propData{"int", "", 8}
+	newProps.props[cfgKongCredentialAPIKeyMaxLength] = propData{"int", "", 64}
+	newProps.props[cfgKongCredentialAPIKeyCharset] = propData{"string", "", "A-F0-9"}
+	newProps.props[cfgKongImportEnable] = propData{"bool", "", true}
+	newProps.props[cfgKongImportDryRun] = propData{"bool", "", true}
+	newProps.props[cfgKongImportRule] = propData{"string", "", ImportRuleUsername}
+	newProps.props[cfgKongImportUsernamePattern] = propData{"string", "", "^(.+)-consumer$"}
+	newProps.props[cfgKongSweepEnable] = propData{"bool", "", true}
+	newProps.props[cfgKongSweepInterval] = propData{"duration", "", 6 * time.Hour}
+	newProps.props[cfgKongSweepQuarantine] = propData{"duration", "", 72 * time.Hour}
+	newProps.props[cfgKongSweepReportOnly] = propData{"bool", "", false}
+	newProps.props[cfgKongAuditEnable] = propData{"bool", "", true}
+	newProps.props[cfgKongAuditWebhookURL] = propData{"string", "", "https://audit.example.com/kong"}
 	cfg = ParseProperties(newProps)
 	assert.Equal(t, true, cfg.ACL.Disable)
 	assert.Equal(t, "http://host:port/path", cfg.Admin.Url)
@@ -198,6 +399,42 @@ func TestKongProperties(t *testing.T) {
 	assert.Equal(t, "tag_filter", cfg.Spec.Filter)
 	assert.Equal(t, true, cfg.Spec.DevPortalEnabled)
 	assert.Equal(t, true, cfg.Spec.CreateUnstructuredAPI)
+	assert.Equal(t, []string{"cors", "proxy-cache"}, cfg.Spec.PluginExtensions)
+	assert.Equal(t, 10*time.Minute, cfg.Drift.Interval)
+	assert.Equal(t, true, cfg.Drift.ReportOnly)
+	assert.Equal(t, ProvisioningModeConsumerGroup, cfg.Provisioning.Mode)
+	assert.Equal(t, KongQuotaConfig{
+		Policy:            QuotaPolicyRedis,
+		FaultTolerant:     false,
+		HideClientHeaders: true,
+		Redis: KongQuotaRedisConfig{
+			Host:       "redis",
+			Port:       6380,
+			Username:   "user",
+			Password:   "secret",
+			Database:   2,
+			Timeout:    500,
+			SSL:        true,
+			SSLVerify:  true,
+			ServerName: "redis.local",
+		},
+		Overrides: `{"workspaces":{"team":{"policy":"local"}}}`,
+	}, cfg.Quota)
+	assert.Equal(t, KongCredentialConfig{
+		RotationGracePeriod: 30 * time.Minute,
+		ExpiryInterval:      time.Minute,
+		APIKey:              KongAPIKeyConfig{MinLength: 8, MaxLength: 64, Charset: "A-F0-9"},
+	}, cfg.Credential)
+	assert.Equal(t, KongImportConfig{
+		Enable:          true,
+		DryRun:          true,
+		Rule:            ImportRuleUsername,
+		TagPrefix:       "app:",
+		UsernamePattern: "^(.+)-consumer$",
+	}, cfg.Import)
+	assert.Equal(t, KongSweepConfig{Enable: true, Interval: 6 * time.Hour, Quarantine: 72 * time.Hour}, cfg.Sweep)
+	assert.Equal(t, true, cfg.Audit.Enable)
+	assert.Equal(t, "https://audit.example.com/kong", cfg.Audit.Webhook.URL)
 
 	// validate no port configured when port type disabled
 	newProps.props[cfgKongProxyPortHttpDisable] = propData{"bool", "", true}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// quota enforcement policies
+const (
+	QuotaPolicyLocal   = "local"
+	QuotaPolicyCluster = "cluster"
+	QuotaPolicyRedis   = "redis"
+)
+
+const (
+	quotaPolicyErr    = "invalid quota policy %q, must be local, cluster or redis"
+	quotaRedisErr     = "a redis host is required for the redis quota policy"
+	quotaOverridesErr = "invalid quota overrides"
+)
+
+// KongQuotaRedisConfig - the redis connection of the redis quota policy
+type KongQuotaRedisConfig struct {
+	Host       string `config:"host" json:"host,omitempty"`
+	Port       int    `config:"port" json:"port,omitempty"`
+	Username   string `config:"username" json:"username,omitempty"`
+	Password   string `config:"password" json:"password,omitempty"`
+	Database   int    `config:"database" json:"database,omitempty"`
+	Timeout    int    `config:"timeout" json:"timeout,omitempty"`
+	SSL        bool   `config:"ssl" json:"ssl,omitempty"`
+	SSLVerify  bool   `config:"sslVerify" json:"sslVerify,omitempty"`
+	ServerName string `config:"serverName" json:"serverName,omitempty"`
+}
+
+// KongQuotaOverrides - the quota settings of workspaces and kong service tags, overriding the global settings
+type KongQuotaOverrides struct {
+	Workspaces map[string]json.RawMessage `json:"workspaces,omitempty"`
+	Tags       map[string]json.RawMessage `json:"tags,omitempty"`
+}
+
+// KongQuotaConfig - the settings of the rate limiting plugins the agent creates
+type KongQuotaConfig struct {
+	Policy            string               `config:"policy" json:"policy,omitempty"`
+	FaultTolerant     bool                 `config:"faultTolerant" json:"faultTolerant"`
+	HideClientHeaders bool                 `config:"hideClientHeaders" json:"hideClientHeaders"`
+	Redis             KongQuotaRedisConfig `config:"redis" json:"redis"`
+	// Overrides - json formatted KongQuotaOverrides
+	Overrides string `config:"overrides" json:"-"`
+}
+
+func (c KongQuotaConfig) overrides() (*KongQuotaOverrides, error) {
+	overrides := &KongQuotaOverrides{}
+	if c.Overrides == "" {
+		return overrides, nil
+	}
+	if err := json.Unmarshal([]byte(c.Overrides), overrides); err != nil {
+		return nil, fmt.Errorf("%s: %w", quotaOverridesErr, err)
+	}
+	return overrides, nil
+}
+
+// HasTagOverrides - true when the settings depend on the tags of the kong service
+func (c KongQuotaConfig) HasTagOverrides() bool {
+	overrides, err := c.overrides()
+	return err == nil && len(overrides.Tags) > 0
+}
+
+// Settings returns the settings for a service of the workspace, the workspace overrides the global settings and the
+// service tags, in alphabetical order, override the workspace settings
+func (c KongQuotaConfig) Settings(workspace string, tags []string) (KongQuotaConfig, error) {
+	overrides, err := c.overrides()
+	if err != nil {
+		return c, err
+	}
+
+	settings := c
+	settings.Overrides = ""
+	apply := func(override json.RawMessage) error {
+		return json.Unmarshal(override, &settings)
+	}
+
+	if override, ok := overrides.Workspaces[workspace]; ok {
+		if err := apply(override); err != nil {
+			return c, fmt.Errorf("%s for workspace %s: %w", quotaOverridesErr, workspace, err)
+		}
+	}
+	sorted := append([]string{}, tags...)
+	sort.Strings(sorted)
+	for _, tag := range sorted {
+		if override, ok := overrides.Tags[tag]; ok {
+			if err := apply(override); err != nil {
+				return c, fmt.Errorf("%s for tag %s: %w", quotaOverridesErr, tag, err)
+			}
+		}
+	}
+	return settings, nil
+}
+
+func (c KongQuotaConfig) validate() error {
+	overrides, err := c.overrides()
+	if err != nil {
+		return err
+	}
+	if err := c.validatePolicy(); err != nil {
+		return err
+	}
+
+	for workspace := range overrides.Workspaces {
+		settings, err := c.Settings(workspace, nil)
+		if err != nil {
+			return err
+		}
+		if err := settings.validatePolicy(); err != nil {
+			return fmt.Errorf("workspace %s: %w", workspace, err)
+		}
+	}
+	for tag := range overrides.Tags {
+		settings, err := c.Settings("", []string{tag})
+		if err != nil {
+			return err
+		}
+		if err := settings.validatePolicy(); err != nil {
+			return fmt.Errorf("tag %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+func (c KongQuotaConfig) validatePolicy() error {
+	switch c.Policy {
+	case "", QuotaPolicyLocal, QuotaPolicyCluster:
+	case QuotaPolicyRedis:
+		if c.Redis.Host == "" {
+			return errors.New(quotaRedisErr)
+		}
+	default:
+		return fmt.Errorf(quotaPolicyErr, c.Policy)
+	}
+	return nil
+}
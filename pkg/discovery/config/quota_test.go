@@ -0,0 +1,111 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKongQuotaSettings(t *testing.T) {
+	quota := KongQuotaConfig{
+		Policy:        QuotaPolicyLocal,
+		FaultTolerant: true,
+		Redis:         KongQuotaRedisConfig{Port: 6379, Timeout: 2000},
+		Overrides: `{
+			"workspaces": {"team": {"policy": "cluster", "hideClientHeaders": true}},
+			"tags": {
+				"a-shared": {"policy": "redis", "redis": {"host": "redis-a"}},
+				"b-shared": {"redis": {"host": "redis-b", "database": 1}}
+			}
+		}`,
+	}
+	testCases := map[string]struct {
+		workspace string
+		tags      []string
+		expected  KongQuotaConfig
+	}{
+		"global settings": {
+			workspace: "default",
+			tags:      []string{"other"},
+			expected: KongQuotaConfig{
+				Policy:        QuotaPolicyLocal,
+				FaultTolerant: true,
+				Redis:         KongQuotaRedisConfig{Port: 6379, Timeout: 2000},
+			},
+		},
+		"workspace override": {
+			workspace: "team",
+			expected: KongQuotaConfig{
+				Policy:            QuotaPolicyCluster,
+				FaultTolerant:     true,
+				HideClientHeaders: true,
+				Redis:             KongQuotaRedisConfig{Port: 6379, Timeout: 2000},
+			},
+		},
+		"tag overrides workspace": {
+			workspace: "team",
+			tags:      []string{"b-shared", "a-shared"},
+			expected: KongQuotaConfig{
+				Policy:            QuotaPolicyRedis,
+				FaultTolerant:     true,
+				HideClientHeaders: true,
+				Redis:             KongQuotaRedisConfig{Host: "redis-b", Port: 6379, Timeout: 2000, Database: 1},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			settings, err := quota.Settings(tc.workspace, tc.tags)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, settings)
+		})
+	}
+	assert.True(t, quota.HasTagOverrides())
+}
+
+func TestKongQuotaValidate(t *testing.T) {
+	testCases := map[string]struct {
+		quota     KongQuotaConfig
+		expectErr bool
+	}{
+		"default policy": {
+			quota: KongQuotaConfig{},
+		},
+		"cluster policy": {
+			quota: KongQuotaConfig{Policy: QuotaPolicyCluster},
+		},
+		"unknown policy": {
+			quota:     KongQuotaConfig{Policy: "memory"},
+			expectErr: true,
+		},
+		"redis policy without host": {
+			quota:     KongQuotaConfig{Policy: QuotaPolicyRedis},
+			expectErr: true,
+		},
+		"invalid overrides": {
+			quota:     KongQuotaConfig{Overrides: "{"},
+			expectErr: true,
+		},
+		"workspace redis override without host": {
+			quota:     KongQuotaConfig{Overrides: `{"workspaces":{"team":{"policy":"redis"}}}`},
+			expectErr: true,
+		},
+		"tag redis override": {
+			quota: KongQuotaConfig{Overrides: `{"tags":{"shared":{"policy":"redis","redis":{"host":"redis"}}}}`},
+		},
+		"tag unknown policy override": {
+			quota:     KongQuotaConfig{Overrides: `{"tags":{"shared":{"policy":"memory"}}}`},
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.quota.validate()
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
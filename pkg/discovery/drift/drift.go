@@ -0,0 +1,331 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	klib "github.com/kong/go-kong/kong"
+
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	sdkUtil "github.com/Axway/agent-sdk/pkg/util"
+	"github.com/Axway/agent-sdk/pkg/util/log"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+// Kind - the kind of difference between Central and the Kong plugins the agent manages
+type Kind string
+
+const (
+	// MissingACL - an access request is provisioned but the route acl does not allow the consumer
+	MissingACL Kind = "missingACL"
+	// UnexpectedACL - the route acl allows an agent managed consumer without a provisioned access request
+	UnexpectedACL Kind = "unexpectedACL"
+	// MissingQuota - the quota of a provisioned access request has no enabled rate-limiting, or rate-limiting-advanced, plugin
+	MissingQuota Kind = "missingQuota"
+	// MismatchedQuota - the quota plugin limit differs from the access request quota
+	MismatchedQuota Kind = "mismatchedQuota"
+	// UnexpectedQuota - an agent managed consumer has an enabled quota plugin without a quota in Central
+	UnexpectedQuota Kind = "unexpectedQuota"
+)
+
+// Kinds - all kinds of drift
+var Kinds = []Kind{MissingACL, UnexpectedACL, MissingQuota, MismatchedQuota, UnexpectedQuota}
+
+// Drift - a single difference between Central and Kong
+type Drift struct {
+	Kind       Kind
+	Workspace  string
+	RouteID    string
+	ConsumerID string
+}
+
+type kongClient interface {
+	AddRouteACL(ctx context.Context, routeID, allowedID string) error
+	RemoveRouteACL(ctx context.Context, routeID, revokedID string) error
+	AddQuota(ctx context.Context, routeID, allowedID, quotaInterval string, quotaLimit int) error
+	RemoveQuota(ctx context.Context, routeID, allowedID string) error
+	GetKongPlugins(ctx context.Context) *kong.Plugins
+}
+
+// centralCache - the Central resources the agent has cached
+type centralCache interface {
+	ListAccessRequests() []*v1.ResourceInstance
+	GetAPIServiceInstanceByName(name string) (*v1.ResourceInstance, error)
+	GetManagedApplicationByName(name string) *v1.ResourceInstance
+	GetManagedApplicationCacheKeys() []string
+	GetManagedApplication(id string) *v1.ResourceInstance
+}
+
+// grant - the access of a consumer to a route
+type grant struct {
+	routeID    string
+	consumerID string
+}
+
+type quota struct {
+	interval string
+	limit    int
+}
+
+// desiredState - the access the agent provisioned in a workspace according to Central
+type desiredState struct {
+	access map[grant]*quota
+	// grants with access requests being provisioned or removed are left alone
+	pending map[grant]bool
+	// the consumers of the managed applications, only their acl entries and quotas are managed by the agent
+	consumers map[string]bool
+}
+
+func newDesiredState() *desiredState {
+	return &desiredState{
+		access:    map[grant]*quota{},
+		pending:   map[grant]bool{},
+		consumers: map[string]bool{},
+	}
+}
+
+type Reconciler struct {
+	logger     log.FieldLogger
+	client     kongClient
+	cache      centralCache
+	workspaces []string
+	reportOnly bool
+	metrics    *Metrics
+	mutex      sync.Mutex
+}
+
+func NewReconciler(client kongClient, cache centralCache, workspaces []string, reportOnly bool) *Reconciler {
+	return &Reconciler{
+		logger:     log.NewFieldLogger().WithComponent("Reconciler").WithPackage("drift"),
+		client:     client,
+		cache:      cache,
+		workspaces: workspaces,
+		reportOnly: reportOnly,
+		metrics:    NewMetrics(),
+	}
+}
+
+// Metrics - the drift detected and repaired by the reconciler
+func (r *Reconciler) Metrics() *Metrics {
+	return r.metrics
+}
+
+// Reconcile compares the agent managed acl and rate-limiting plugins with the access requests provisioned in Central,
+// repairing the differences unless the reconciler only reports them
+func (r *Reconciler) Reconcile() []Drift {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	desired := r.desiredState()
+	drift := []Drift{}
+	for _, workspace := range r.workspaces {
+		ctx := context.WithValue(audit.WithRequest(context.Background(), audit.Request{Type: audit.TypeDrift}), common.ContextWorkspace, workspace)
+		state, ok := desired[workspace]
+		if !ok {
+			state = newDesiredState()
+		}
+
+		plugins, err := r.client.GetKongPlugins(ctx).ListAll(ctx)
+		if err != nil {
+			r.logger.WithError(err).WithField(common.AttrWorkspaceName, workspace).Error("could not list plugins")
+			r.metrics.failed()
+			continue
+		}
+		wsDrift := compare(workspace, state, plugins)
+		for _, d := range wsDrift {
+			r.handle(ctx, d, state)
+		}
+		drift = append(drift, wsDrift...)
+	}
+
+	r.metrics.reconciled(drift)
+	return drift
+}
+
+func (r *Reconciler) handle(ctx context.Context, d Drift, state *desiredState) {
+	logger := r.logger.
+		WithField(common.AttrWorkspaceName, d.Workspace).
+		WithField(common.AttrRouteID, d.RouteID).
+		WithField("consumerID", d.ConsumerID).
+		WithField("drift", d.Kind)
+	logger.Warn("kong differs from central")
+	if r.reportOnly {
+		return
+	}
+
+	var err error
+	switch d.Kind {
+	case MissingACL:
+		err = r.client.AddRouteACL(ctx, d.RouteID, d.ConsumerID)
+	case UnexpectedACL:
+		err = r.client.RemoveRouteACL(ctx, d.RouteID, d.ConsumerID)
+	case MissingQuota, MismatchedQuota:
+		// the plugin is created, or updated, with the quota of the access request
+		q := state.access[grant{routeID: d.RouteID, consumerID: d.ConsumerID}]
+		err = r.client.AddQuota(ctx, d.RouteID, d.ConsumerID, q.interval, q.limit)
+	case UnexpectedQuota:
+		err = r.client.RemoveQuota(ctx, d.RouteID, d.ConsumerID)
+	}
+	if err != nil {
+		logger.WithError(err).Error("could not repair drift")
+		r.metrics.repairFailed(d.Kind)
+		return
+	}
+	logger.Info("repaired drift")
+	r.metrics.repaired(d.Kind)
+}
+
+// desiredState computes, per workspace, the access of the provisioned access requests
+func (r *Reconciler) desiredState() map[string]*desiredState {
+	states := map[string]*desiredState{}
+	state := func(workspace string) *desiredState {
+		if _, ok := states[workspace]; !ok {
+			states[workspace] = newDesiredState()
+		}
+		return states[workspace]
+	}
+
+	for _, key := range r.cache.GetManagedApplicationCacheKeys() {
+		app := r.cache.GetManagedApplication(key)
+		if app == nil {
+			continue
+		}
+		details := sdkUtil.GetAgentDetails(app)
+		for _, workspace := range r.workspaces {
+			if consumerID := sdkUtil.ToString(details[common.WksPrefixName(workspace, common.AttrAppID)]); consumerID != "" {
+				state(workspace).consumers[consumerID] = true
+			}
+		}
+	}
+
+	for _, ri := range r.cache.ListAccessRequests() {
+		ar := management.NewAccessRequest("", "")
+		if err := ar.FromInstance(ri); err != nil {
+			continue
+		}
+		app := r.cache.GetManagedApplicationByName(ar.Spec.ManagedApplication)
+		if app == nil {
+			continue
+		}
+		appDetails := sdkUtil.GetAgentDetails(app)
+
+		var instDetails map[string]interface{}
+		if instance, err := r.cache.GetAPIServiceInstanceByName(ar.Spec.ApiServiceInstance); err == nil && instance != nil {
+			instDetails = sdkUtil.GetAgentDetails(instance)
+		}
+		workspace := sdkUtil.ToString(instDetails[common.AttrWorkspaceName])
+		routeID := sdkUtil.ToString(instDetails[common.AttrRouteID])
+		if workspace == "" || routeID == "" {
+			// without the route the access of the application is unknown, leave all of its consumers alone
+			for ws, wsState := range states {
+				delete(wsState.consumers, sdkUtil.ToString(appDetails[common.WksPrefixName(ws, common.AttrAppID)]))
+			}
+			continue
+		}
+		consumerID := sdkUtil.ToString(appDetails[common.WksPrefixName(workspace, common.AttrAppID)])
+		if consumerID == "" {
+			continue
+		}
+
+		g := grant{routeID: routeID, consumerID: consumerID}
+		ws := state(workspace)
+		if ar.Metadata.State == v1.ResourceDeleting || ar.Status == nil || ar.Status.Level != provisioning.Success.String() {
+			ws.pending[g] = true
+			continue
+		}
+
+		var q *quota
+		if arQuota := provisioning.NewQuotaFromAccessRequest(ar); arQuota != nil {
+			q = &quota{interval: arQuota.GetIntervalString(), limit: int(arQuota.GetLimit())}
+		}
+		ws.access[g] = q
+	}
+	return states
+}
+
+// compare returns the differences between the desired state and the agent managed plugins of a workspace
+func compare(workspace string, state *desiredState, plugins []*klib.Plugin) []Drift {
+	allowed := map[grant]bool{}
+	quotas := map[grant]*klib.Plugin{}
+	for _, plugin := range plugins {
+		if plugin.Name == nil || plugin.Route == nil || plugin.Route.ID == nil || plugin.Service != nil {
+			continue
+		}
+		enabled := plugin.Enabled == nil || *plugin.Enabled
+		switch {
+		case *plugin.Name == common.AclPlugin && plugin.Consumer == nil && enabled:
+			for _, group := range stringSlice(plugin.Config["allow"]) {
+				allowed[grant{routeID: *plugin.Route.ID, consumerID: group}] = true
+			}
+		case (*plugin.Name == common.RateLimitingPlugin || *plugin.Name == kong.RateLimitingAdvancedPlugin) &&
+			plugin.Consumer != nil && plugin.Consumer.ID != nil:
+			quotas[grant{routeID: *plugin.Route.ID, consumerID: *plugin.Consumer.ID}] = plugin
+		}
+	}
+
+	drift := []Drift{}
+	add := func(kind Kind, g grant) {
+		drift = append(drift, Drift{Kind: kind, Workspace: workspace, RouteID: g.routeID, ConsumerID: g.consumerID})
+	}
+
+	for g, q := range state.access {
+		if !allowed[g] {
+			add(MissingACL, g)
+		}
+		plugin, hasPlugin := quotas[g]
+		switch {
+		case q == nil:
+			if hasPlugin && (plugin.Enabled == nil || *plugin.Enabled) {
+				add(UnexpectedQuota, g)
+			}
+		case !hasPlugin || (plugin.Enabled != nil && !*plugin.Enabled):
+			add(MissingQuota, g)
+		case !kong.QuotaMatches(plugin, q.interval, q.limit):
+			add(MismatchedQuota, g)
+		}
+	}
+
+	for g := range allowed {
+		if _, ok := state.access[g]; ok || state.pending[g] || !state.consumers[g.consumerID] {
+			continue
+		}
+		add(UnexpectedACL, g)
+	}
+	for g, plugin := range quotas {
+		if _, ok := state.access[g]; ok || state.pending[g] || !state.consumers[g.consumerID] || allowed[g] {
+			// unexpected access is repaired with its quota
+			continue
+		}
+		if plugin.Enabled == nil || *plugin.Enabled {
+			add(UnexpectedQuota, g)
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		return fmt.Sprint(drift[i]) < fmt.Sprint(drift[j])
+	})
+	return drift
+}
+
+func stringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/definitions"
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+const (
+	workspace = common.DefaultWorkspace
+	envName   = "env"
+)
+
+type mockCache struct {
+	accessRequests []*v1.ResourceInstance
+	instances      map[string]*v1.ResourceInstance
+	apps           map[string]*v1.ResourceInstance
+}
+
+func (c *mockCache) ListAccessRequests() []*v1.ResourceInstance {
+	return c.accessRequests
+}
+
+func (c *mockCache) GetAPIServiceInstanceByName(name string) (*v1.ResourceInstance, error) {
+	if instance, ok := c.instances[name]; ok {
+		return instance, nil
+	}
+	return nil, fmt.Errorf("instance %s not found", name)
+}
+
+func (c *mockCache) GetManagedApplicationByName(name string) *v1.ResourceInstance {
+	return c.apps[name]
+}
+
+func (c *mockCache) GetManagedApplicationCacheKeys() []string {
+	keys := []string{}
+	for name := range c.apps {
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+func (c *mockCache) GetManagedApplication(id string) *v1.ResourceInstance {
+	return c.apps[id]
+}
+
+type call struct {
+	method     string
+	routeID    string
+	consumerID string
+}
+
+type mockClient struct {
+	plugins []*klib.Plugin
+	listErr error
+	calls   *[]call
+}
+
+func (m mockClient) ListAll(_ context.Context) ([]*klib.Plugin, error) {
+	return m.plugins, m.listErr
+}
+
+func (m mockClient) GetKongPlugins(_ context.Context) *kong.Plugins {
+	return &kong.Plugins{PluginLister: m}
+}
+
+func (m mockClient) AddRouteACL(_ context.Context, routeID, allowedID string) error {
+	*m.calls = append(*m.calls, call{"AddRouteACL", routeID, allowedID})
+	return nil
+}
+
+func (m mockClient) RemoveRouteACL(_ context.Context, routeID, revokedID string) error {
+	*m.calls = append(*m.calls, call{"RemoveRouteACL", routeID, revokedID})
+	return nil
+}
+
+func (m mockClient) AddQuota(_ context.Context, routeID, allowedID, _ string, _ int) error {
+	*m.calls = append(*m.calls, call{"AddQuota", routeID, allowedID})
+	return nil
+}
+
+func (m mockClient) RemoveQuota(_ context.Context, routeID, allowedID string) error {
+	*m.calls = append(*m.calls, call{"RemoveQuota", routeID, allowedID})
+	return nil
+}
+
+func withAgentDetails(ri *v1.ResourceInstance, details map[string]interface{}) *v1.ResourceInstance {
+	ri.SetSubResource(definitions.XAgentDetails, details)
+	return ri
+}
+
+func app(name, consumerID string) *v1.ResourceInstance {
+	ri, _ := management.NewManagedApplication(name, envName).AsInstance()
+	return withAgentDetails(ri, map[string]interface{}{common.WksPrefixName(workspace, common.AttrAppID): consumerID})
+}
+
+func instance(name, routeID string) *v1.ResourceInstance {
+	ri, _ := management.NewAPIServiceInstance(name, envName).AsInstance()
+	return withAgentDetails(ri, map[string]interface{}{
+		common.AttrWorkspaceName: workspace,
+		common.AttrRouteID:       routeID,
+	})
+}
+
+func accessRequest(appName, instanceName, level string, quota *management.AccessRequestSpecQuota) *v1.ResourceInstance {
+	ar := management.NewAccessRequest(appName+"-"+instanceName, envName)
+	ar.Spec.ManagedApplication = appName
+	ar.Spec.ApiServiceInstance = instanceName
+	ar.Spec.Quota = quota
+	ar.Status = &v1.ResourceStatus{Level: level}
+	ri, _ := ar.AsInstance()
+	return ri
+}
+
+func aclPlugin(routeID string, allow ...string) *klib.Plugin {
+	return &klib.Plugin{
+		Name:    klib.String(common.AclPlugin),
+		Route:   &klib.Route{ID: klib.String(routeID)},
+		Enabled: klib.Bool(true),
+		Config:  klib.Configuration{"allow": allow},
+	}
+}
+
+func rateLimitingPlugin(routeID, consumerID string, enabled bool, config klib.Configuration) *klib.Plugin {
+	return &klib.Plugin{
+		Name:     klib.String(common.RateLimitingPlugin),
+		Route:    &klib.Route{ID: klib.String(routeID)},
+		Consumer: &klib.Consumer{ID: klib.String(consumerID)},
+		Enabled:  klib.Bool(enabled),
+		Config:   config,
+	}
+}
+
+func rateLimitingAdvancedPlugin(routeID, consumerID string, limit, windowSize float64) *klib.Plugin {
+	return &klib.Plugin{
+		Name:     klib.String(kong.RateLimitingAdvancedPlugin),
+		Route:    &klib.Route{ID: klib.String(routeID)},
+		Consumer: &klib.Consumer{ID: klib.String(consumerID)},
+		Enabled:  klib.Bool(true),
+		Config:   klib.Configuration{"limit": []interface{}{limit}, "window_size": []interface{}{windowSize}},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	daily := &management.AccessRequestSpecQuota{Interval: provisioning.Daily.String(), Limit: 10}
+	weekly := &management.AccessRequestSpecQuota{Interval: provisioning.Weekly.String(), Limit: 10}
+	cache := &mockCache{
+		instances: map[string]*v1.ResourceInstance{
+			"instance1": instance("instance1", "route1"),
+			"instance2": instance("instance2", "route2"),
+		},
+		apps: map[string]*v1.ResourceInstance{
+			"app1": app("app1", "consumer1"),
+			"app2": app("app2", "consumer2"),
+		},
+	}
+
+	testCases := map[string]struct {
+		accessRequests []*v1.ResourceInstance
+		plugins        []*klib.Plugin
+		listErr        error
+		reportOnly     bool
+		expectDrift    []Drift
+		expectCalls    []call
+	}{
+		"no drift": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Success.String(), daily),
+				accessRequest("app2", "instance1", provisioning.Success.String(), nil),
+			},
+			plugins: []*klib.Plugin{
+				aclPlugin("route1", "consumer1", "consumer2", "operators"),
+				rateLimitingPlugin("route1", "consumer1", true, klib.Configuration{"day": float64(10)}),
+			},
+			expectDrift: []Drift{},
+		},
+		"missing acl and quota are repaired": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Success.String(), daily),
+				accessRequest("app1", "instance2", provisioning.Success.String(), daily),
+			},
+			plugins: []*klib.Plugin{
+				aclPlugin("route2", "consumer1"),
+				rateLimitingPlugin("route2", "consumer1", false, klib.Configuration{"day": float64(10)}),
+			},
+			expectDrift: []Drift{
+				{Kind: MissingACL, Workspace: workspace, RouteID: "route1", ConsumerID: "consumer1"},
+				{Kind: MissingQuota, Workspace: workspace, RouteID: "route1", ConsumerID: "consumer1"},
+				{Kind: MissingQuota, Workspace: workspace, RouteID: "route2", ConsumerID: "consumer1"},
+			},
+			expectCalls: []call{
+				{"AddRouteACL", "route1", "consumer1"},
+				{"AddQuota", "route1", "consumer1"},
+				{"AddQuota", "route2", "consumer1"},
+			},
+		},
+		"mismatched quota is updated": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Success.String(), daily),
+			},
+			plugins: []*klib.Plugin{
+				aclPlugin("route1", "consumer1"),
+				rateLimitingPlugin("route1", "consumer1", true, klib.Configuration{"day": float64(100)}),
+			},
+			expectDrift: []Drift{
+				{Kind: MismatchedQuota, Workspace: workspace, RouteID: "route1", ConsumerID: "consumer1"},
+			},
+			expectCalls: []call{
+				{"AddQuota", "route1", "consumer1"},
+			},
+		},
+		"weekly quota of the rate-limiting-advanced plugin": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Success.String(), weekly),
+				accessRequest("app2", "instance1", provisioning.Success.String(), weekly),
+			},
+			plugins: []*klib.Plugin{
+				aclPlugin("route1", "consumer1", "consumer2"),
+				rateLimitingAdvancedPlugin("route1", "consumer1", 10, 604800),
+				rateLimitingAdvancedPlugin("route1", "consumer2", 10, 86400),
+			},
+			expectDrift: []Drift{
+				{Kind: MismatchedQuota, Workspace: workspace, RouteID: "route1", ConsumerID: "consumer2"},
+			},
+			expectCalls: []call{
+				{"AddQuota", "route1", "consumer2"},
+			},
+		},
+		"unexpected access and quota are removed": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Success.String(), nil),
+			},
+			plugins: []*klib.Plugin{
+				aclPlugin("route1", "consumer1", "consumer2"),
+				rateLimitingPlugin("route1", "consumer1", true, klib.Configuration{"day": float64(10)}),
+				rateLimitingPlugin("route2", "consumer2", true, klib.Configuration{"day": float64(10)}),
+			},
+			expectDrift: []Drift{
+				{Kind: UnexpectedACL, Workspace: workspace, RouteID: "route1", ConsumerID: "consumer2"},
+				{Kind: UnexpectedQuota, Workspace: workspace, RouteID: "route1", ConsumerID: "consumer1"},
+				{Kind: UnexpectedQuota, Workspace: workspace, RouteID: "route2", ConsumerID: "consumer2"},
+			},
+			expectCalls: []call{
+				{"RemoveRouteACL", "route1", "consumer2"},
+				{"RemoveQuota", "route1", "consumer1"},
+				{"RemoveQuota", "route2", "consumer2"},
+			},
+		},
+		"pending and unresolved access requests are left alone": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Pending.String(), nil),
+				accessRequest("app2", "unknown", provisioning.Success.String(), nil),
+			},
+			plugins: []*klib.Plugin{
+				aclPlugin("route1", "consumer1", "consumer2"),
+			},
+			expectDrift: []Drift{},
+		},
+		"report only": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Success.String(), nil),
+			},
+			reportOnly: true,
+			expectDrift: []Drift{
+				{Kind: MissingACL, Workspace: workspace, RouteID: "route1", ConsumerID: "consumer1"},
+			},
+		},
+		"plugins can not be listed": {
+			accessRequests: []*v1.ResourceInstance{
+				accessRequest("app1", "instance1", provisioning.Success.String(), nil),
+			},
+			listErr:     fmt.Errorf("error"),
+			expectDrift: []Drift{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cache.accessRequests = tc.accessRequests
+			calls := []call{}
+			client := mockClient{plugins: tc.plugins, listErr: tc.listErr, calls: &calls}
+
+			r := NewReconciler(client, cache, []string{workspace}, tc.reportOnly)
+			drift := r.Reconcile()
+			assert.Equal(t, tc.expectDrift, drift)
+			assert.ElementsMatch(t, tc.expectCalls, calls)
+
+			metrics := r.Metrics()
+			assert.Equal(t, int64(1), metrics.Runs)
+			for _, d := range tc.expectDrift {
+				assert.NotZero(t, metrics.Current[d.Kind])
+				if tc.reportOnly {
+					assert.Zero(t, metrics.Repaired[d.Kind])
+				} else {
+					assert.NotZero(t, metrics.Repaired[d.Kind])
+				}
+			}
+			if tc.listErr != nil {
+				assert.Equal(t, int64(1), metrics.Failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package drift
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Axway/agent-sdk/pkg/util/healthcheck"
+)
+
+const healthcheckEndpoint = "kong-drift"
+
+// Metrics - counters of the drift the reconciler detected and repaired
+type Metrics struct {
+	mutex sync.Mutex
+	// Runs - the number of reconciliations
+	Runs int64 `json:"runs"`
+	// Failures - the number of workspaces that could not be reconciled
+	Failures int64 `json:"failures"`
+	// LastRun - the time of the last reconciliation
+	LastRun time.Time `json:"lastRun"`
+	// Current - the drift detected by the last reconciliation
+	Current map[Kind]int64 `json:"current"`
+	// Detected - the drift detected by all reconciliations
+	Detected map[Kind]int64 `json:"detected"`
+	// Repaired - the drift repaired by all reconciliations
+	Repaired map[Kind]int64 `json:"repaired"`
+	// RepairFailures - the drift that could not be repaired
+	RepairFailures map[Kind]int64 `json:"repairFailures"`
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Current:        map[Kind]int64{},
+		Detected:       map[Kind]int64{},
+		Repaired:       map[Kind]int64{},
+		RepairFailures: map[Kind]int64{},
+	}
+	for _, kind := range Kinds {
+		m.Current[kind] = 0
+		m.Detected[kind] = 0
+		m.Repaired[kind] = 0
+		m.RepairFailures[kind] = 0
+	}
+	return m
+}
+
+func (m *Metrics) reconciled(drift []Drift) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Runs++
+	m.LastRun = time.Now()
+	for _, kind := range Kinds {
+		m.Current[kind] = 0
+	}
+	for _, d := range drift {
+		m.Current[d.Kind]++
+		m.Detected[d.Kind]++
+	}
+}
+
+func (m *Metrics) failed() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Failures++
+}
+
+func (m *Metrics) repaired(kind Kind) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Repaired[kind]++
+}
+
+func (m *Metrics) repairFailed(kind Kind) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.RepairFailures[kind]++
+}
+
+// MarshalJSON - the metrics as json, safe for concurrent use
+func (m *Metrics) MarshalJSON() ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	type metrics Metrics
+	return json.Marshal((*metrics)(m))
+}
+
+// status reports the metrics as the details of a passing health check, drift does not make the agent unhealthy
+func (m *Metrics) status(_ string) *healthcheck.Status {
+	details, err := json.Marshal(m)
+	if err != nil {
+		return &healthcheck.Status{Result: healthcheck.FAIL, Details: err.Error()}
+	}
+	return &healthcheck.Status{Result: healthcheck.OK, Details: string(details)}
+}
+
+// RegisterHealthcheck exposes the metrics on the status endpoint of the agent, i.e. /status/kong-drift
+func (m *Metrics) RegisterHealthcheck() error {
+	_, err := healthcheck.RegisterHealthcheck("Kong ACL and quota drift", healthcheckEndpoint, m.status)
+	return err
+}
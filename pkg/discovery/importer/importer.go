@@ -0,0 +1,468 @@
+package importer
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/definitions"
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	sdkUtil "github.com/Axway/agent-sdk/pkg/util"
+	"github.com/Axway/agent-sdk/pkg/util/log"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+const (
+	// credentialFinalizer - the finalizer of provisioned credentials, the agent does not provision credentials with it
+	credentialFinalizer = "agent.credential.provisioned"
+	importedDetail      = "imported from kong"
+)
+
+type kongClient interface {
+	ListConsumers(ctx context.Context) ([]*klib.Consumer, error)
+	ListConsumerACLGroups(ctx context.Context, id string) ([]string, error)
+	ListConsumerCredentials(ctx context.Context, id string) ([]kong.ConsumerCredential, error)
+	TagConsumer(ctx context.Context, id string, tags []string) error
+	TagCredential(ctx context.Context, collection, credentialID string, tags []string) error
+	GetKongPlugins(ctx context.Context) *kong.Plugins
+}
+
+// centralCache - the Central resources the agent has cached
+type centralCache interface {
+	ListAPIServiceInstances() []*v1.ResourceInstance
+	ListAccessRequests() []*v1.ResourceInstance
+	GetManagedApplicationByName(name string) *v1.ResourceInstance
+}
+
+type centralClient interface {
+	CreateResourceInstance(ri v1.Interface) (*v1.ResourceInstance, error)
+	CreateSubResource(rm v1.ResourceMeta, subs map[string]interface{}) error
+}
+
+// Report - the result of an import, in a dry run the resources that would be created
+type Report struct {
+	// Consumers - the consumers mapped to an application
+	Consumers int
+	// Skipped - the consumers created by the agent or not mapped to an application
+	Skipped        int
+	Applications   int
+	AccessRequests int
+	Credentials    int
+	// Pending - the consumers whose application is not provisioned yet, imported by a later run
+	Pending int
+	// Conflicts - the consumers whose application is provisioned with another consumer
+	Conflicts int
+	Failed    int
+}
+
+type Importer struct {
+	logger     log.FieldLogger
+	client     kongClient
+	cache      centralCache
+	central    centralClient
+	rule       Rule
+	envName    string
+	workspaces []string
+	dryRun     bool
+	mutex      sync.Mutex
+}
+
+func NewImporter(client kongClient, cache centralCache, central centralClient, rule Rule, envName string, workspaces []string, dryRun bool) *Importer {
+	return &Importer{
+		logger:     log.NewFieldLogger().WithComponent("Importer").WithPackage("importer"),
+		client:     client,
+		cache:      cache,
+		central:    central,
+		rule:       rule,
+		envName:    envName,
+		workspaces: workspaces,
+		dryRun:     dryRun,
+	}
+}
+
+// Import creates the Central applications, access requests and credentials of the existing kong consumers mapped by
+// the rule. The existing consumers and credentials are linked to the Central resources, no secrets are generated.
+// Resources already in Central are not created again, an application is created first and its access requests and
+// credentials are imported once the agent provisioned it, by a later run
+func (i *Importer) Import() Report {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	report := Report{}
+	// applications created by this run, not yet in the cache
+	created := map[string]bool{}
+	for _, workspace := range i.workspaces {
+		log := i.logger.WithField(common.AttrWorkspaceName, workspace)
+		ctx := context.WithValue(audit.WithRequest(context.Background(), audit.Request{Type: audit.TypeImport}), common.ContextWorkspace, workspace)
+
+		consumers, err := i.client.ListConsumers(ctx)
+		if err != nil {
+			log.WithError(err).Error("could not list consumers")
+			report.Failed++
+			continue
+		}
+		plugins, err := i.client.GetKongPlugins(ctx).ListAll(ctx)
+		if err != nil {
+			log.WithError(err).Error("could not list plugins")
+			report.Failed++
+			continue
+		}
+		ws := &workspaceImport{
+			Importer:  i,
+			ctx:       ctx,
+			logger:    log,
+			workspace: workspace,
+			routeACLs: routeACLs(plugins),
+			instances: i.routeInstances(workspace),
+			report:    &report,
+			created:   created,
+		}
+		for _, consumer := range consumers {
+			ws.importConsumer(consumer)
+		}
+	}
+
+	i.logger.
+		WithField("consumers", report.Consumers).
+		WithField("skipped", report.Skipped).
+		WithField("applications", report.Applications).
+		WithField("accessRequests", report.AccessRequests).
+		WithField("credentials", report.Credentials).
+		WithField("pending", report.Pending).
+		WithField("conflicts", report.Conflicts).
+		WithField("failed", report.Failed).
+		WithField("dryRun", i.dryRun).
+		Info("imported kong consumers")
+	return report
+}
+
+// routeACLs returns the groups allowed by the enabled acl plugin of each route
+func routeACLs(plugins []*klib.Plugin) map[string][]string {
+	acls := map[string][]string{}
+	for _, plugin := range plugins {
+		if plugin.Name == nil || *plugin.Name != common.AclPlugin || plugin.Route == nil || plugin.Route.ID == nil {
+			continue
+		}
+		if plugin.Enabled != nil && !*plugin.Enabled {
+			continue
+		}
+		acls[*plugin.Route.ID] = append(acls[*plugin.Route.ID], stringSlice(plugin.Config["allow"])...)
+	}
+	return acls
+}
+
+// routeInstances returns the names of the api service instances of each route of the workspace
+func (i *Importer) routeInstances(workspace string) map[string][]string {
+	instances := map[string][]string{}
+	for _, instance := range i.cache.ListAPIServiceInstances() {
+		details := sdkUtil.GetAgentDetails(instance)
+		if sdkUtil.ToString(details[common.AttrWorkspaceName]) != workspace {
+			continue
+		}
+		routeID := sdkUtil.ToString(details[common.AttrRouteID])
+		if routeID == "" {
+			continue
+		}
+		instances[routeID] = append(instances[routeID], instance.Name)
+	}
+	return instances
+}
+
+// workspaceImport - the import of the consumers of a workspace
+type workspaceImport struct {
+	*Importer
+	ctx       context.Context
+	logger    log.FieldLogger
+	workspace string
+	routeACLs map[string][]string
+	instances map[string][]string
+	report    *Report
+	created   map[string]bool
+}
+
+func (w *workspaceImport) importConsumer(consumer *klib.Consumer) {
+	if kong.IsAgentConsumer(consumer) {
+		w.report.Skipped++
+		return
+	}
+	title := w.rule.Application(w.workspace, consumer)
+	if title == "" {
+		w.report.Skipped++
+		return
+	}
+	w.report.Consumers++
+	appName := sdkUtil.ConvertToDomainNameCompliant(title)
+	log := w.logger.WithField("consumerID", *consumer.ID).WithField("appName", appName)
+
+	if !w.dryRun {
+		// the agent provisions the application with the tagged consumer, instead of creating a new one
+		if err := w.client.TagConsumer(w.ctx, *consumer.ID, []string{kong.ImportTag(appName)}); err != nil {
+			log.WithError(err).Error("could not tag consumer")
+			w.report.Failed++
+			return
+		}
+	}
+
+	app := w.cache.GetManagedApplicationByName(appName)
+	if app == nil && w.created[appName] {
+		if w.dryRun {
+			log.Warn("another consumer is mapped to the application, not importing the consumer")
+			w.report.Conflicts++
+			return
+		}
+		w.report.Pending++
+		return
+	}
+	if app == nil {
+		w.createApplication(log, appName, title)
+		if w.dryRun {
+			// the access requests and credentials of an application that does not exist yet
+			w.importAccess(log, consumer, appName)
+			w.importCredentials(log, consumer, appName)
+		}
+		return
+	}
+
+	consumerID := sdkUtil.ToString(sdkUtil.GetAgentDetails(app)[common.WksPrefixName(w.workspace, common.AttrAppID)])
+	switch {
+	case consumerID == "":
+		log.Debug("application not provisioned yet")
+		w.report.Pending++
+		return
+	case consumerID != *consumer.ID:
+		log.WithField("appConsumerID", consumerID).Warn("application is provisioned with another consumer, not importing the consumer")
+		w.report.Conflicts++
+		return
+	}
+	w.importAccess(log, consumer, appName)
+	w.importCredentials(log, consumer, appName)
+}
+
+func (w *workspaceImport) createApplication(log log.FieldLogger, appName, title string) {
+	w.report.Applications++
+	w.created[appName] = true
+	if w.dryRun {
+		log.Info("would create application")
+		return
+	}
+	app := management.NewManagedApplication(appName, w.envName)
+	app.Title = title
+	if _, err := w.central.CreateResourceInstance(app); err != nil {
+		log.WithError(err).Error("could not create application")
+		w.report.Applications--
+		w.report.Failed++
+		return
+	}
+	log.Info("created application")
+	w.report.Pending++
+}
+
+// importAccess creates an access request for every api service instance of the routes whose acl allows a group of the consumer
+func (w *workspaceImport) importAccess(log log.FieldLogger, consumer *klib.Consumer, appName string) {
+	groups, err := w.client.ListConsumerACLGroups(w.ctx, *consumer.ID)
+	if err != nil {
+		log.WithError(err).Error("could not list consumer acl groups")
+		w.report.Failed++
+		return
+	}
+	member := map[string]bool{}
+	for _, group := range groups {
+		member[group] = true
+	}
+
+	existing := w.accessRequests(appName)
+	for _, routeID := range sortedKeys(w.routeACLs) {
+		allowed := false
+		for _, group := range w.routeACLs[routeID] {
+			allowed = allowed || member[group]
+		}
+		if !allowed {
+			continue
+		}
+		for _, instance := range w.instances[routeID] {
+			if existing[instance] {
+				continue
+			}
+			w.createAccessRequest(log.WithField("instance", instance), appName, instance)
+		}
+	}
+}
+
+// accessRequests returns the api service instances the application has an access request for
+func (w *workspaceImport) accessRequests(appName string) map[string]bool {
+	instances := map[string]bool{}
+	for _, ri := range w.cache.ListAccessRequests() {
+		ar := management.NewAccessRequest("", "")
+		if err := ar.FromInstance(ri); err != nil || ar.Spec.ManagedApplication != appName {
+			continue
+		}
+		instances[ar.Spec.ApiServiceInstance] = true
+	}
+	return instances
+}
+
+func (w *workspaceImport) createAccessRequest(log log.FieldLogger, appName, instance string) {
+	w.report.AccessRequests++
+	if w.dryRun {
+		log.Info("would create access request")
+		return
+	}
+	ar := management.NewAccessRequest(sdkUtil.ConvertToDomainNameCompliant(appName+"-"+instance), w.envName)
+	ar.Spec = management.AccessRequestSpec{
+		ManagedApplication: appName,
+		ApiServiceInstance: instance,
+		Data:               map[string]interface{}{},
+	}
+	if _, err := w.central.CreateResourceInstance(ar); err != nil {
+		log.WithError(err).Error("could not create access request")
+		w.report.AccessRequests--
+		w.report.Failed++
+		return
+	}
+	log.Info("created access request")
+}
+
+// importCredentials links the credentials of the consumer not created, nor imported, by the agent to Central credentials
+func (w *workspaceImport) importCredentials(log log.FieldLogger, consumer *klib.Consumer, appName string) {
+	credentials, err := w.client.ListConsumerCredentials(w.ctx, *consumer.ID)
+	if err != nil {
+		log.WithError(err).Error("could not list consumer credentials")
+		w.report.Failed++
+		return
+	}
+	for _, credential := range credentials {
+		if credential.ID == nil || credential.HasTag(kong.AgentCredentialTag) || credential.HasTag(kong.ImportedCredentialTag) {
+			continue
+		}
+		log := log.WithField("credentialID", *credential.ID).WithField("collection", credential.Collection)
+		crd, data, updater := credentialRequest(credential)
+		if crd == "" {
+			log.Warn("credential type can not be imported")
+			continue
+		}
+		w.report.Credentials++
+		if w.dryRun {
+			log.Info("would create credential")
+			continue
+		}
+		if err := w.createCredential(*consumer.ID, appName, common.WksPrefixName(w.workspace, crd), data, credential, updater); err != nil {
+			log.WithError(err).Error("could not create credential")
+			w.report.Credentials--
+			w.report.Failed++
+			continue
+		}
+		log.Info("created credential")
+	}
+}
+
+// createCredential creates the Central credential as already provisioned, with the agent details of the kong
+// credential, and tags the kong credential as imported
+func (w *workspaceImport) createCredential(consumerID, appName, crd string, data map[string]interface{}, credential kong.ConsumerCredential, updater string) error {
+	cred := management.NewCredential(sdkUtil.ConvertToDomainNameCompliant(appName+"-"+*credential.ID), w.envName)
+	cred.Finalizers = []v1.Finalizer{{Name: credentialFinalizer}}
+	cred.Spec = management.CredentialSpec{
+		CredentialRequestDefinition: crd,
+		ManagedApplication:          appName,
+		Data:                        data,
+	}
+	ri, err := w.central.CreateResourceInstance(cred)
+	if err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{
+		common.AttrWorkspaceName: w.workspace,
+		common.AttrAppID:         consumerID,
+		common.AttrCredentialID:  *credential.ID,
+	}
+	if updater != "" {
+		details[common.AttrCredUpdater] = updater
+	}
+	status := v1.ResourceStatus{
+		Level: provisioning.Success.String(),
+		Reasons: []v1.ResourceStatusReason{{
+			Type:      provisioning.Success.String(),
+			Detail:    importedDetail,
+			Timestamp: v1.Time(time.Now()),
+		}},
+	}
+	err = w.central.CreateSubResource(ri.ResourceMeta, map[string]interface{}{
+		definitions.XAgentDetails: details,
+		"status":                  status,
+	})
+	if err != nil {
+		return err
+	}
+	return w.client.TagCredential(w.ctx, credential.Collection, *credential.ID, []string{kong.ImportedCredentialTag})
+}
+
+// credentialRequest returns the credential request definition, without the workspace prefix, the request data and
+// the agent detail updating the credential of the kong credential. Mutual TLS credentials are not imported, their
+// requests require the client certificate kong does not keep
+func credentialRequest(credential kong.ConsumerCredential) (string, map[string]interface{}, string) {
+	data := map[string]interface{}{}
+	switch credential.Collection {
+	case common.KeyAuthCredentials:
+		return provisioning.APIKeyCRD, data, ""
+	case common.BasicAuthCredentials:
+		return provisioning.BasicAuthCRD, data, value(credential.Username)
+	case common.OAuth2Credentials:
+		data[common.ApplicationTypeField] = common.OAuthClientTypeConfidential
+		if credential.ClientType != nil && strings.EqualFold(*credential.ClientType, common.OAuthClientTypePublic) {
+			data[common.ApplicationTypeField] = common.OAuthClientTypePublic
+		}
+		return provisioning.OAuthSecretCRD, data, value(credential.ClientID)
+	case common.JWTCredentials:
+		if credential.Algorithm != nil {
+			data[common.JWTAlgorithmField] = *credential.Algorithm
+		}
+		if credential.PublicKey != nil {
+			data[common.JWTPublicKeyField] = *credential.PublicKey
+		}
+		return common.JWTCRD, data, value(credential.Key)
+	case common.HMACCredentials:
+		return common.HMACCRD, data, value(credential.Username)
+	}
+	return "", nil, ""
+}
+
+func stringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,282 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/definitions"
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+const (
+	workspace = common.DefaultWorkspace
+	envName   = "env"
+)
+
+type mockCache struct {
+	instances      []*v1.ResourceInstance
+	accessRequests []*v1.ResourceInstance
+	apps           map[string]*v1.ResourceInstance
+}
+
+func (c *mockCache) ListAPIServiceInstances() []*v1.ResourceInstance {
+	return c.instances
+}
+
+func (c *mockCache) ListAccessRequests() []*v1.ResourceInstance {
+	return c.accessRequests
+}
+
+func (c *mockCache) GetManagedApplicationByName(name string) *v1.ResourceInstance {
+	return c.apps[name]
+}
+
+type mockCentral struct {
+	created   []v1.Interface
+	subs      map[string]map[string]interface{}
+	createErr error
+}
+
+func (m *mockCentral) CreateResourceInstance(ri v1.Interface) (*v1.ResourceInstance, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	m.created = append(m.created, ri)
+	return ri.AsInstance()
+}
+
+func (m *mockCentral) CreateSubResource(rm v1.ResourceMeta, subs map[string]interface{}) error {
+	m.subs[rm.Name] = subs
+	return nil
+}
+
+type mockClient struct {
+	consumers      []*klib.Consumer
+	groups         map[string][]string
+	credentials    map[string][]kong.ConsumerCredential
+	plugins        []*klib.Plugin
+	listErr        error
+	taggedConsumer map[string][]string
+	taggedCreds    map[string][]string
+}
+
+func (m mockClient) ListConsumers(_ context.Context) ([]*klib.Consumer, error) {
+	return m.consumers, m.listErr
+}
+
+func (m mockClient) ListConsumerACLGroups(_ context.Context, id string) ([]string, error) {
+	return m.groups[id], nil
+}
+
+func (m mockClient) ListConsumerCredentials(_ context.Context, id string) ([]kong.ConsumerCredential, error) {
+	return m.credentials[id], nil
+}
+
+func (m mockClient) TagConsumer(_ context.Context, id string, tags []string) error {
+	m.taggedConsumer[id] = tags
+	return nil
+}
+
+func (m mockClient) TagCredential(_ context.Context, _, credentialID string, tags []string) error {
+	m.taggedCreds[credentialID] = tags
+	return nil
+}
+
+func (m mockClient) ListAll(_ context.Context) ([]*klib.Plugin, error) {
+	return m.plugins, nil
+}
+
+func (m mockClient) GetKongPlugins(_ context.Context) *kong.Plugins {
+	return &kong.Plugins{PluginLister: m}
+}
+
+func app(name, consumerID string) *v1.ResourceInstance {
+	ri, _ := management.NewManagedApplication(name, envName).AsInstance()
+	if consumerID != "" {
+		ri.SetSubResource(definitions.XAgentDetails, map[string]interface{}{common.WksPrefixName(workspace, common.AttrAppID): consumerID})
+	}
+	return ri
+}
+
+func instance(name, routeID string) *v1.ResourceInstance {
+	ri, _ := management.NewAPIServiceInstance(name, envName).AsInstance()
+	ri.SetSubResource(definitions.XAgentDetails, map[string]interface{}{
+		common.AttrWorkspaceName: workspace,
+		common.AttrRouteID:       routeID,
+	})
+	return ri
+}
+
+func accessRequest(appName, instanceName string) *v1.ResourceInstance {
+	ar := management.NewAccessRequest(appName+"-"+instanceName, envName)
+	ar.Spec.ManagedApplication = appName
+	ar.Spec.ApiServiceInstance = instanceName
+	ri, _ := ar.AsInstance()
+	return ri
+}
+
+func aclPlugin(routeID string, allow ...string) *klib.Plugin {
+	return &klib.Plugin{
+		Name:    klib.String(common.AclPlugin),
+		Route:   &klib.Route{ID: klib.String(routeID)},
+		Enabled: klib.Bool(true),
+		Config:  klib.Configuration{"allow": allow},
+	}
+}
+
+func consumer(id string, tags ...string) *klib.Consumer {
+	return &klib.Consumer{ID: klib.String(id), Username: klib.String(id), Tags: klib.StringSlice(tags...)}
+}
+
+func TestImport(t *testing.T) {
+	credentials := []kong.ConsumerCredential{
+		{Collection: common.KeyAuthCredentials, ID: klib.String("keyID")},
+		{Collection: common.OAuth2Credentials, ID: klib.String("oauthID"), ClientID: klib.String("client"), ClientType: klib.String("public")},
+		{Collection: common.MTLSCredentials, ID: klib.String("mtlsID")},
+		{Collection: common.BasicAuthCredentials, ID: klib.String("agentID"), Tags: klib.StringSlice(kong.AgentCredentialTag)},
+		{Collection: common.BasicAuthCredentials, ID: klib.String("importedID"), Tags: klib.StringSlice(kong.ImportedCredentialTag)},
+	}
+	testCases := map[string]struct {
+		consumers      []*klib.Consumer
+		apps           map[string]*v1.ResourceInstance
+		accessRequests []*v1.ResourceInstance
+		dryRun         bool
+		createErr      error
+		listErr        error
+		expected       Report
+		expectCreated  []string
+		expectTagged   bool
+	}{
+		"creates the application of a mapped consumer": {
+			consumers:     []*klib.Consumer{consumer("billingID", "app:billing"), consumer("otherID")},
+			expected:      Report{Consumers: 1, Skipped: 1, Applications: 1, Pending: 1},
+			expectCreated: []string{"billing"},
+			expectTagged:  true,
+		},
+		"skips agent consumers": {
+			consumers: []*klib.Consumer{
+				consumer("appConsumerID", append(kong.ConsumerTags("", "billing", envName), "app:billing")...),
+			},
+			expected: Report{Skipped: 1},
+		},
+		"application not provisioned yet": {
+			consumers:    []*klib.Consumer{consumer("billingID", "app:billing")},
+			apps:         map[string]*v1.ResourceInstance{"billing": app("billing", "")},
+			expected:     Report{Consumers: 1, Pending: 1},
+			expectTagged: true,
+		},
+		"imports the access requests and credentials of a provisioned application": {
+			consumers:      []*klib.Consumer{consumer("billingID", "app:billing")},
+			apps:           map[string]*v1.ResourceInstance{"billing": app("billing", "billingID")},
+			accessRequests: []*v1.ResourceInstance{accessRequest("billing", "existing")},
+			expected:       Report{Consumers: 1, AccessRequests: 1, Credentials: 2},
+			expectCreated:  []string{"billing-orders", "billing-keyid", "billing-oauthid"},
+			expectTagged:   true,
+		},
+		"application provisioned with another consumer": {
+			consumers:    []*klib.Consumer{consumer("billingID", "app:billing")},
+			apps:         map[string]*v1.ResourceInstance{"billing": app("billing", "otherID")},
+			expected:     Report{Consumers: 1, Conflicts: 1},
+			expectTagged: true,
+		},
+		"consumers mapped to the same application": {
+			consumers:     []*klib.Consumer{consumer("billingID", "app:billing"), consumer("otherID", "app:billing")},
+			expected:      Report{Consumers: 2, Applications: 1, Pending: 2},
+			expectCreated: []string{"billing"},
+			expectTagged:  true,
+		},
+		"dry run": {
+			consumers: []*klib.Consumer{consumer("billingID", "app:billing"), consumer("otherID", "app:billing")},
+			dryRun:    true,
+			expected:  Report{Consumers: 2, Applications: 1, AccessRequests: 2, Credentials: 2, Conflicts: 1},
+		},
+		"error creating the application": {
+			consumers:    []*klib.Consumer{consumer("billingID", "app:billing")},
+			createErr:    fmt.Errorf("error"),
+			expected:     Report{Consumers: 1, Failed: 1},
+			expectTagged: true,
+		},
+		"error listing consumers": {
+			listErr:  fmt.Errorf("error"),
+			expected: Report{Failed: 1},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := mockClient{
+				consumers:      tc.consumers,
+				listErr:        tc.listErr,
+				groups:         map[string][]string{"billingID": {"billingID", "partners"}},
+				credentials:    map[string][]kong.ConsumerCredential{"billingID": credentials},
+				plugins:        []*klib.Plugin{aclPlugin("ordersRoute", "partners"), aclPlugin("existingRoute", "billingID"), aclPlugin("otherRoute", "otherID")},
+				taggedConsumer: map[string][]string{},
+				taggedCreds:    map[string][]string{},
+			}
+			cache := &mockCache{
+				instances:      []*v1.ResourceInstance{instance("orders", "ordersRoute"), instance("existing", "existingRoute"), instance("other", "otherRoute")},
+				accessRequests: tc.accessRequests,
+				apps:           tc.apps,
+			}
+			central := &mockCentral{subs: map[string]map[string]interface{}{}, createErr: tc.createErr}
+
+			importer := NewImporter(client, cache, central, tagRule{prefix: "app:"}, envName, []string{workspace}, tc.dryRun)
+			report := importer.Import()
+			assert.Equal(t, tc.expected, report)
+
+			created := []string{}
+			for _, ri := range central.created {
+				inst, _ := ri.AsInstance()
+				created = append(created, inst.Name)
+			}
+			assert.ElementsMatch(t, tc.expectCreated, created)
+			if tc.expectTagged {
+				assert.Equal(t, []string{kong.ImportTag("billing")}, client.taggedConsumer["billingID"])
+			} else {
+				assert.Empty(t, client.taggedConsumer)
+			}
+		})
+	}
+}
+
+func TestImportCredentials(t *testing.T) {
+	client := mockClient{
+		consumers: []*klib.Consumer{consumer("billingID", "app:billing")},
+		credentials: map[string][]kong.ConsumerCredential{"billingID": {
+			{Collection: common.OAuth2Credentials, ID: klib.String("oauthID"), ClientID: klib.String("client"), ClientType: klib.String("public")},
+		}},
+		taggedConsumer: map[string][]string{},
+		taggedCreds:    map[string][]string{},
+	}
+	cache := &mockCache{apps: map[string]*v1.ResourceInstance{"billing": app("billing", "billingID")}}
+	central := &mockCentral{subs: map[string]map[string]interface{}{}}
+
+	report := NewImporter(client, cache, central, tagRule{prefix: "app:"}, envName, []string{workspace}, false).Import()
+	assert.Equal(t, 1, report.Credentials)
+	assert.Len(t, central.created, 1)
+
+	cred := central.created[0].(*management.Credential)
+	assert.Equal(t, "billing-oauthid", cred.Name)
+	assert.Equal(t, []v1.Finalizer{{Name: credentialFinalizer}}, cred.Finalizers)
+	assert.Equal(t, common.WksPrefixName(workspace, provisioning.OAuthSecretCRD), cred.Spec.CredentialRequestDefinition)
+	assert.Equal(t, "billing", cred.Spec.ManagedApplication)
+	assert.Equal(t, map[string]interface{}{common.ApplicationTypeField: common.OAuthClientTypePublic}, cred.Spec.Data)
+
+	subs := central.subs["billing-oauthid"]
+	assert.Equal(t, map[string]interface{}{
+		common.AttrWorkspaceName: workspace,
+		common.AttrAppID:         "billingID",
+		common.AttrCredentialID:  "oauthID",
+		common.AttrCredUpdater:   "client",
+	}, subs[definitions.XAgentDetails])
+	assert.Equal(t, provisioning.Success.String(), subs["status"].(v1.ResourceStatus).Level)
+	assert.Equal(t, []string{kong.ImportedCredentialTag}, client.taggedCreds["oauthID"])
+}
@@ -0,0 +1,118 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agents-kong/pkg/discovery/config"
+)
+
+// Rule - maps an existing kong consumer to the name of a Central application
+type Rule interface {
+	// Application returns the name of the application of the consumer in the workspace, empty when the consumer is not imported
+	Application(workspace string, consumer *klib.Consumer) string
+}
+
+// NewRule returns the rule of the import config
+func NewRule(cfg config.KongImportConfig) (Rule, error) {
+	switch cfg.Rule {
+	case config.ImportRuleTag:
+		return tagRule{prefix: cfg.TagPrefix}, nil
+	case config.ImportRuleUsername:
+		pattern, err := regexp.Compile(cfg.UsernamePattern)
+		if err != nil {
+			return nil, err
+		}
+		return usernameRule{pattern: pattern}, nil
+	case config.ImportRuleCSV:
+		file, err := os.Open(cfg.CSVFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return newCSVRule(file)
+	}
+	return nil, fmt.Errorf("unknown import rule %s", cfg.Rule)
+}
+
+// tagRule - the application is the value of the first consumer tag with the prefix, i.e. app:billing
+type tagRule struct {
+	prefix string
+}
+
+func (r tagRule) Application(_ string, consumer *klib.Consumer) string {
+	for _, tag := range consumer.Tags {
+		if tag != nil && strings.HasPrefix(*tag, r.prefix) {
+			return strings.TrimPrefix(*tag, r.prefix)
+		}
+	}
+	return ""
+}
+
+// usernameRule - the application is the first group of the pattern matching the username, or the whole username
+// when the pattern has no groups
+type usernameRule struct {
+	pattern *regexp.Regexp
+}
+
+func (r usernameRule) Application(_ string, consumer *klib.Consumer) string {
+	if consumer.Username == nil {
+		return ""
+	}
+	match := r.pattern.FindStringSubmatch(*consumer.Username)
+	switch {
+	case match == nil:
+		return ""
+	case len(match) > 1:
+		return match[1]
+	}
+	return *consumer.Username
+}
+
+// csvRule - the applications of the consumers listed in a csv file, one consumer per line of workspace, consumer
+// username or id and application. Empty lines and lines starting with # are skipped
+type csvRule struct {
+	apps map[string]string
+}
+
+func newCSVRule(reader io.Reader) (csvRule, error) {
+	r := csv.NewReader(reader)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+
+	rule := csvRule{apps: map[string]string{}}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rule, nil
+		}
+		if err != nil {
+			return csvRule{}, err
+		}
+		rule.apps[csvKey(record[0], record[1])] = record[2]
+	}
+}
+
+func csvKey(workspace, consumer string) string {
+	return workspace + "/" + consumer
+}
+
+func (r csvRule) Application(workspace string, consumer *klib.Consumer) string {
+	for _, key := range []*string{consumer.Username, consumer.ID} {
+		if key == nil {
+			continue
+		}
+		if app, ok := r.apps[csvKey(workspace, *key)]; ok {
+			return app
+		}
+	}
+	return ""
+}
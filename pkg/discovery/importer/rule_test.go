@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/discovery/config"
+)
+
+func TestRules(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "consumers.csv")
+	os.WriteFile(csvFile, []byte("# workspace, consumer, application\ndefault, billing-user, billing\n\nteam, consumerID, orders\n"), 0600)
+
+	billing := &klib.Consumer{ID: klib.String("billingID"), Username: klib.String("billing-user"), Tags: klib.StringSlice("team:finance", "app:billing")}
+	orders := &klib.Consumer{ID: klib.String("consumerID"), Tags: klib.StringSlice("app:")}
+	testCases := map[string]struct {
+		cfg       config.KongImportConfig
+		workspace string
+		consumer  *klib.Consumer
+		expected  string
+		expectErr bool
+	}{
+		"tag rule": {
+			cfg:       config.KongImportConfig{Rule: config.ImportRuleTag, TagPrefix: "app:"},
+			workspace: "default",
+			consumer:  billing,
+			expected:  "billing",
+		},
+		"tag rule without the tag": {
+			cfg:      config.KongImportConfig{Rule: config.ImportRuleTag, TagPrefix: "owner:"},
+			consumer: billing,
+		},
+		"username rule with a group": {
+			cfg:      config.KongImportConfig{Rule: config.ImportRuleUsername, UsernamePattern: "^(.+)-user$"},
+			consumer: billing,
+			expected: "billing",
+		},
+		"username rule without a group": {
+			cfg:      config.KongImportConfig{Rule: config.ImportRuleUsername, UsernamePattern: "^billing-"},
+			consumer: billing,
+			expected: "billing-user",
+		},
+		"username rule without a username": {
+			cfg:      config.KongImportConfig{Rule: config.ImportRuleUsername, UsernamePattern: ".*"},
+			consumer: orders,
+		},
+		"csv rule by username": {
+			cfg:       config.KongImportConfig{Rule: config.ImportRuleCSV, CSVFile: csvFile},
+			workspace: "default",
+			consumer:  billing,
+			expected:  "billing",
+		},
+		"csv rule by id": {
+			cfg:       config.KongImportConfig{Rule: config.ImportRuleCSV, CSVFile: csvFile},
+			workspace: "team",
+			consumer:  orders,
+			expected:  "orders",
+		},
+		"csv rule of another workspace": {
+			cfg:       config.KongImportConfig{Rule: config.ImportRuleCSV, CSVFile: csvFile},
+			workspace: "team",
+			consumer:  billing,
+		},
+		"csv file not found": {
+			cfg:       config.KongImportConfig{Rule: config.ImportRuleCSV, CSVFile: filepath.Join(t.TempDir(), "missing.csv")},
+			expectErr: true,
+		},
+		"unknown rule": {
+			cfg:       config.KongImportConfig{Rule: "owner"},
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rule, err := NewRule(tc.cfg)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, rule.Application(tc.workspace, tc.consumer))
+		})
+	}
+}
+
+func TestCSVRuleInvalid(t *testing.T) {
+	_, err := newCSVRule(strings.NewReader("default, billing-user\n"))
+	assert.NotNil(t, err)
+}
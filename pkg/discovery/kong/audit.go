@@ -0,0 +1,148 @@
+package kong
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
+)
+
+type auditRecorder interface {
+	Record(record audit.Record)
+}
+
+// auditTransport records every change of the admin api requests, reads pass through untouched. The state of the
+// entity before an update or delete is read right before the change, its state after is the kong response
+type auditTransport struct {
+	next     http.RoundTripper
+	recorder auditRecorder
+	// basePath - the path of the admin api url, removed from the recorded paths
+	basePath string
+}
+
+func newAuditTransport(next http.RoundTripper, recorder auditRecorder, basePath string) auditTransport {
+	return auditTransport{next: next, recorder: recorder, basePath: strings.TrimSuffix(basePath, "/")}
+}
+
+func (t auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.next.RoundTrip(req)
+	}
+
+	request := audit.RequestFromContext(req.Context())
+	workspace := common.GetStringValueFromCtx(req.Context(), common.ContextWorkspace)
+	if workspace == "" {
+		workspace = common.DefaultWorkspace
+	}
+	path := strings.TrimPrefix(req.URL.Path, t.basePath)
+	if strings.HasPrefix(path, "/"+workspace+"/") {
+		path = strings.TrimPrefix(path, "/"+workspace)
+	}
+	entity, entityID := auditEntity(path)
+
+	record := audit.Record{
+		RequestID:     request.ID,
+		RequestType:   request.Type,
+		RequestAction: request.Action,
+		Workspace:     workspace,
+		Method:        req.Method,
+		Path:          path,
+		Entity:        entity,
+		EntityID:      entityID,
+	}
+	if entityID != "" && req.Method != http.MethodPost {
+		record.Before = t.currentState(req)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	record.Time = start
+	record.LatencyMs = time.Since(start).Milliseconds()
+
+	switch {
+	case err != nil:
+		record.Outcome = audit.OutcomeFailure
+		record.Error = err.Error()
+	case resp.StatusCode >= http.StatusBadRequest:
+		record.Outcome = audit.OutcomeFailure
+		record.Status = resp.StatusCode
+		record.Error = responseError(resp)
+	default:
+		record.Outcome = audit.OutcomeSuccess
+		record.Status = resp.StatusCode
+		if req.Method != http.MethodDelete {
+			record.After = responseState(resp)
+		}
+		if record.EntityID == "" && record.After != nil {
+			record.EntityID, _ = record.After["id"].(string)
+		}
+	}
+	t.recorder.Record(record)
+	return resp, err
+}
+
+// auditEntity returns the kong collection and id of the entity of the admin api path, collections and ids
+// alternate, i.e. acls and aclID for /consumers/consumerID/acls/aclID
+func auditEntity(path string) (string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments)%2 == 1 {
+		return segments[len(segments)-1], ""
+	}
+	return segments[len(segments)-2], segments[len(segments)-1]
+}
+
+// currentState reads the redacted state of the entity the request changes, nil when it can not be read
+func (t auditTransport) currentState(req *http.Request) map[string]interface{} {
+	get, err := http.NewRequestWithContext(req.Context(), http.MethodGet, req.URL.String(), nil)
+	if err != nil {
+		return nil
+	}
+	get.Header = req.Header.Clone()
+	get.Header.Del("Content-Type")
+	resp, err := t.next.RoundTrip(get)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return responseState(resp)
+}
+
+// responseState returns the redacted entity of the response, the body is kept for the caller
+func responseState(resp *http.Response) map[string]interface{} {
+	data := readBody(resp)
+	state := map[string]interface{}{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	return RedactPluginConfig(state)
+}
+
+// responseError returns the name of the kong error, its message may hold the secret values of the request
+func responseError(resp *http.Response) string {
+	kongErr := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(readBody(resp), &kongErr); err != nil || kongErr.Name == "" {
+		return http.StatusText(resp.StatusCode)
+	}
+	return kongErr.Name
+}
+
+func readBody(resp *http.Response) []byte {
+	if resp.Body == nil {
+		return nil
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return data
+}
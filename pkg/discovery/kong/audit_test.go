@@ -0,0 +1,139 @@
+package kong
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
+)
+
+type mockRecorder struct {
+	mutex   sync.Mutex
+	records []audit.Record
+}
+
+func (m *mockRecorder) Record(record audit.Record) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.records = append(m.records, record)
+}
+
+func TestAuditEntity(t *testing.T) {
+	testCases := map[string]struct {
+		path           string
+		expectEntity   string
+		expectEntityID string
+	}{
+		"collection": {
+			path:         "/consumers",
+			expectEntity: "consumers",
+		},
+		"entity": {
+			path:           "/key-auths/keyID",
+			expectEntity:   "key-auths",
+			expectEntityID: "keyID",
+		},
+		"nested collection": {
+			path:         "/consumers/consumerID/acls",
+			expectEntity: "acls",
+		},
+		"nested entity": {
+			path:           "/consumers/consumerID/acls/group",
+			expectEntity:   "acls",
+			expectEntityID: "group",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			entity, entityID := auditEntity(tc.path)
+			assert.Equal(t, tc.expectEntity, entity)
+			assert.Equal(t, tc.expectEntityID, entityID)
+		})
+	}
+}
+
+func TestAuditTransport(t *testing.T) {
+	key := map[string]interface{}{"id": "keyID", "key": "secret", "consumer": map[string]interface{}{"id": "consumerID"}}
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/admin/team/consumers/consumerID/key-auth" && req.Method == http.MethodPost:
+			resp.WriteHeader(http.StatusCreated)
+			json.NewEncoder(resp).Encode(key)
+		case req.URL.Path == "/admin/team/key-auths" && req.Method == http.MethodGet:
+			json.NewEncoder(resp).Encode(map[string]interface{}{"data": []interface{}{key}})
+		case req.URL.Path == "/admin/team/key-auths/keyID" && req.Method == http.MethodGet:
+			json.NewEncoder(resp).Encode(key)
+		case req.URL.Path == "/admin/team/consumers/consumerID/key-auth/keyID" && req.Method == http.MethodGet:
+			json.NewEncoder(resp).Encode(key)
+		case req.URL.Path == "/admin/team/consumers/consumerID/key-auth/keyID" && req.Method == http.MethodDelete:
+			resp.WriteHeader(http.StatusNoContent)
+		case req.URL.Path == "/admin/team/key-auths/keyID" && req.Method == http.MethodPatch:
+			resp.WriteHeader(http.StatusConflict)
+			json.NewEncoder(resp).Encode(map[string]interface{}{"name": "unique constraint violation", "message": "key='secret' already exists"})
+		default:
+			resp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	recorder := &mockRecorder{}
+	baseClient := &http.Client{Transport: newAuditTransport(http.DefaultTransport, recorder, "/admin/")}
+	endpoint := server.URL + "/admin"
+	client, _ := klib.NewClient(&endpoint, baseClient)
+	client.SetWorkspace("team")
+
+	ctx := audit.WithRequest(context.Background(), audit.Request{ID: "credID", Type: "Credential", Action: audit.ActionProvision})
+	ctx = context.WithValue(ctx, common.ContextWorkspace, "team")
+
+	created, err := client.KeyAuths.Create(ctx, klib.String("consumerID"), &klib.KeyAuth{Key: klib.String("secret")})
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", *created.Key, "the response is kept for the client")
+	_, _, err = client.KeyAuths.List(ctx, nil)
+	assert.Nil(t, err)
+	req, _ := client.NewRequest(http.MethodPatch, "/key-auths/keyID", nil, map[string]string{"key": "secret"})
+	_, err = client.Do(ctx, req, nil)
+	assert.NotNil(t, err)
+	err = client.KeyAuths.Delete(ctx, klib.String("consumerID"), klib.String("keyID"))
+	assert.Nil(t, err)
+
+	// reads are not audited
+	assert.Len(t, recorder.records, 3)
+
+	create := recorder.records[0]
+	assert.Equal(t, "credID", create.RequestID)
+	assert.Equal(t, "Credential", create.RequestType)
+	assert.Equal(t, audit.ActionProvision, create.RequestAction)
+	assert.Equal(t, "team", create.Workspace)
+	assert.Equal(t, http.MethodPost, create.Method)
+	assert.Equal(t, "/consumers/consumerID/key-auth", create.Path)
+	assert.Equal(t, "key-auth", create.Entity)
+	assert.Equal(t, "keyID", create.EntityID)
+	assert.Nil(t, create.Before)
+	assert.Equal(t, RedactedValue, create.After["key"])
+	assert.Equal(t, audit.OutcomeSuccess, create.Outcome)
+	assert.Equal(t, http.StatusCreated, create.Status)
+
+	update := recorder.records[1]
+	assert.Equal(t, "keyID", update.EntityID)
+	assert.Equal(t, RedactedValue, update.Before["key"])
+	assert.Nil(t, update.After)
+	assert.Equal(t, audit.OutcomeFailure, update.Outcome)
+	assert.Equal(t, http.StatusConflict, update.Status)
+	assert.Equal(t, "unique constraint violation", update.Error)
+
+	deleted := recorder.records[2]
+	assert.Equal(t, http.MethodDelete, deleted.Method)
+	assert.Equal(t, "/consumers/consumerID/key-auth/keyID", deleted.Path)
+	assert.Equal(t, "consumerID", deleted.Before["consumer"].(map[string]interface{})["id"])
+	assert.Equal(t, RedactedValue, deleted.Before["key"])
+	assert.Nil(t, deleted.After)
+	assert.Equal(t, audit.OutcomeSuccess, deleted.Outcome)
+}
@@ -8,8 +8,47 @@ const (
 	BasicAuthPlugin = "basic-auth"
 	KeyAuthPlugin   = "key-auth"
 	OAuthPlugin     = "oauth2"
+	JWTPlugin       = "jwt"
+	HMACAuthPlugin  = "hmac-auth"
+	MTLSAuthPlugin  = "mtls-auth"
+	OIDCPlugin      = "openid-connect"
 )
 
+// openid-connect auth methods that map to oauth flows
+const (
+	OIDCAuthMethodAuthorizationCode = "authorization_code"
+	OIDCAuthMethodClientCredentials = "client_credentials"
+	OIDCAuthMethodPassword          = "password"
+)
+
+// OIDCConsumerByCustomID - openid-connect consumer_by value to map the consumer claim to the consumer custom_id
+const OIDCConsumerByCustomID = "custom_id"
+
+// AuthPluginConfig - the configuration common to the kong auth plugins
+type AuthPluginConfig struct {
+	Anonymous string `json:"anonymous,omitempty"`
+}
+
+func NewAuthPluginConfigFromMap(mapData map[string]interface{}) (*AuthPluginConfig, error) {
+	// Convert map to json string
+	jsonStr, err := json.Marshal(mapData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &AuthPluginConfig{}
+	if err := json.Unmarshal(jsonStr, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// AllowsAnonymous - kong uses the anonymous consumer for requests the plugin did not authenticate
+func (c *AuthPluginConfig) AllowsAnonymous() bool {
+	return c.Anonymous != ""
+}
+
 type OAuthPluginConfig struct {
 	HideCredentials               bool     `json:"hide_credentials,omitempty"`
 	PersistentRefreshToken        bool     `json:"persistent_refresh_token,omitempty"`
@@ -89,3 +128,106 @@ func NewBasicAuthPluginConfigFromMap(mapData map[string]interface{}) (*BasicAuth
 
 	return config, nil
 }
+
+type JWTPluginConfig struct {
+	URIParamNames     []string `json:"uri_param_names,omitempty"`
+	CookieNames       []string `json:"cookie_names,omitempty"`
+	HeaderNames       []string `json:"header_names,omitempty"`
+	ClaimsToVerify    []string `json:"claims_to_verify,omitempty"`
+	KeyClaimName      string   `json:"key_claim_name,omitempty"`
+	SecretIsBase64    bool     `json:"secret_is_base64,omitempty"`
+	Anonymous         string   `json:"anonymous,omitempty"`
+	RunOnPreflight    bool     `json:"run_on_preflight,omitempty"`
+	MaximumExpiration int64    `json:"maximum_expiration,omitempty"`
+}
+
+func NewJWTPluginConfigFromMap(mapData map[string]interface{}) (*JWTPluginConfig, error) {
+	// Convert map to json string
+	jsonStr, err := json.Marshal(mapData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &JWTPluginConfig{}
+	if err := json.Unmarshal(jsonStr, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+type HMACAuthPluginConfig struct {
+	HideCredentials     bool     `json:"hide_credentials,omitempty"`
+	ClockSkew           int64    `json:"clock_skew,omitempty"`
+	Anonymous           string   `json:"anonymous,omitempty"`
+	ValidateRequestBody bool     `json:"validate_request_body,omitempty"`
+	EnforceHeaders      []string `json:"enforce_headers,omitempty"`
+	Algorithms          []string `json:"algorithms,omitempty"`
+}
+
+func NewHMACAuthPluginConfigFromMap(mapData map[string]interface{}) (*HMACAuthPluginConfig, error) {
+	// Convert map to json string
+	jsonStr, err := json.Marshal(mapData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &HMACAuthPluginConfig{}
+	if err := json.Unmarshal(jsonStr, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+type MTLSAuthPluginConfig struct {
+	CACertificates       []string `json:"ca_certificates,omitempty"`
+	SkipConsumerLookup   bool     `json:"skip_consumer_lookup,omitempty"`
+	Anonymous            string   `json:"anonymous,omitempty"`
+	AuthenticatedGroupBy string   `json:"authenticated_group_by,omitempty"`
+	RevocationCheckMode  string   `json:"revocation_check_mode,omitempty"`
+	ConsumerBy           []string `json:"consumer_by,omitempty"`
+	AllowPartialChain    bool     `json:"allow_partial_chain,omitempty"`
+}
+
+func NewMTLSAuthPluginConfigFromMap(mapData map[string]interface{}) (*MTLSAuthPluginConfig, error) {
+	// Convert map to json string
+	jsonStr, err := json.Marshal(mapData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &MTLSAuthPluginConfig{}
+	if err := json.Unmarshal(jsonStr, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+type OIDCPluginConfig struct {
+	Issuer           string   `json:"issuer,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+	ScopesRequired   []string `json:"scopes_required,omitempty"`
+	AuthMethods      []string `json:"auth_methods,omitempty"`
+	ConsumerClaim    []string `json:"consumer_claim,omitempty"`
+	ConsumerBy       []string `json:"consumer_by,omitempty"`
+	ConsumerOptional bool     `json:"consumer_optional,omitempty"`
+	Anonymous        string   `json:"anonymous,omitempty"`
+	AudienceRequired []string `json:"audience_required,omitempty"`
+}
+
+func NewOIDCPluginConfigFromMap(mapData map[string]interface{}) (*OIDCPluginConfig, error) {
+	// Convert map to json string
+	jsonStr, err := json.Marshal(mapData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &OIDCPluginConfig{}
+	if err := json.Unmarshal(jsonStr, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
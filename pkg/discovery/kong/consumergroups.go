@@ -0,0 +1,210 @@
+package kong
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	klib "github.com/kong/go-kong/kong"
+)
+
+const consumerGroupPrefix = "axway"
+
+// the settings of consumer group quota plugins that are kept when updating the quota
+var groupPluginKeptSettings = map[string]bool{
+	"window_type": true,
+	"identifier":  true,
+	"namespace":   true,
+}
+
+// ConsumerGroupName returns the consumer group of a product plan or, without a plan, of the access tier the quota
+// defines, i.e. axway-gold-daily-1000 or axway-daily-1000
+func ConsumerGroupName(planName, quotaInterval string, quotaLimit int) string {
+	parts := []string{consumerGroupPrefix}
+	if planName != "" {
+		parts = append(parts, planName)
+	}
+	if quotaInterval != "" {
+		parts = append(parts, strings.ToLower(quotaInterval), fmt.Sprint(quotaLimit))
+	}
+	if len(parts) == 1 {
+		parts = append(parts, "unlimited")
+	}
+	return strings.Join(parts, "-")
+}
+
+// EnsureConsumerGroup creates the consumer group, when it does not exist, and applies the quota to the group with a
+// rate-limiting-advanced plugin scoped to the group, an empty quotaInterval leaves the group without limits
+func (k KongClient) EnsureConsumerGroup(ctx context.Context, group, quotaInterval string, quotaLimit int) error {
+	log := k.logger.WithField("consumerGroup", group)
+	consumerGroup, err := k.getOrCreateConsumerGroup(ctx, group)
+	if err != nil {
+		log.WithError(err).Error("failed to create consumer group")
+		return err
+	}
+	if quotaInterval == "" {
+		return nil
+	}
+
+	period, seconds := quotaWindow(quotaInterval)
+	if seconds == 0 {
+		return fmt.Errorf("%s quota interval is not supported", quotaInterval)
+	}
+	windowType := "fixed"
+	if QuotaPeriod(quotaInterval) == "" {
+		// windows the rate-limiting plugin does not have slide, as for quotas of single consumers
+		windowType = "sliding"
+	}
+	settings, err := k.quotaSettings(ctx, "")
+	if err != nil {
+		log.WithError(err).Error("failed to get quota settings")
+		return err
+	}
+	config := rateLimitingAdvancedSettings(settings)
+	config["limit"] = []interface{}{quotaLimit}
+	config["window_size"] = []interface{}{seconds}
+	config["window_type"] = windowType
+	config["identifier"] = "consumer"
+	config["namespace"] = group
+
+	log = log.WithField("plugin", RateLimitingAdvancedPlugin)
+	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAll(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to get plugins")
+		return err
+	}
+	plugin := getConsumerGroupPlugin(plugins, *consumerGroup.ID, RateLimitingAdvancedPlugin)
+	if plugin == nil {
+		_, err = k.getWorkspaceClient(ctx).Plugins.Create(ctx, &klib.Plugin{
+			Name:          klib.String(RateLimitingAdvancedPlugin),
+			Config:        config,
+			ConsumerGroup: &klib.ConsumerGroup{ID: consumerGroup.ID},
+		})
+		if err != nil {
+			log.WithError(err).Error("failed to add quota to consumer group")
+			return err
+		}
+		log.Info("added quota to consumer group")
+		return nil
+	}
+
+	limits, err := NewRateLimitsFromPlugin(RateLimitingAdvancedPlugin, plugin.Config)
+	enabled := plugin.Enabled == nil || *plugin.Enabled
+	if err == nil && enabled && len(limits) == 1 && limits[0].Limit == int64(quotaLimit) && limits[0].Period == period &&
+		policyMatches(plugin.Config, settings) {
+		return nil
+	}
+
+	if plugin.Config == nil {
+		plugin.Config = klib.Configuration{}
+	}
+	// keep the settings of the plugin the quota does not define
+	for key, value := range config {
+		if _, ok := plugin.Config[key]; !ok || !groupPluginKeptSettings[key] {
+			plugin.Config[key] = value
+		}
+	}
+	plugin.Enabled = klib.Bool(true)
+	if _, err = k.getWorkspaceClient(ctx).Plugins.Update(ctx, plugin); err != nil {
+		log.WithError(err).Error("failed to update consumer group quota")
+		return err
+	}
+	log.Info("updated consumer group quota")
+	return nil
+}
+
+// AddConsumerToGroup adds the consumer to the consumer group, consumers already in the group are left alone
+func (k KongClient) AddConsumerToGroup(ctx context.Context, group, consumerID string) error {
+	log := k.logger.WithField("consumerGroup", group).WithField("consumerID", consumerID)
+	members, err := k.getWorkspaceClient(ctx).ConsumerGroupConsumers.ListAll(ctx, klib.String(group))
+	if err != nil {
+		log.WithError(err).Error("failed to get consumer group members")
+		return err
+	}
+	for _, consumer := range members.Consumers {
+		if consumer != nil && consumer.ID != nil && *consumer.ID == consumerID {
+			log.Info("consumer already in group")
+			return nil
+		}
+	}
+
+	if _, err = k.getWorkspaceClient(ctx).ConsumerGroupConsumers.Create(ctx, klib.String(group), klib.String(consumerID)); err != nil {
+		log.WithError(err).Error("failed to add consumer to group")
+		return err
+	}
+	log.Info("added consumer to group")
+	return nil
+}
+
+// RemoveConsumerFromGroup removes the consumer from the consumer group
+func (k KongClient) RemoveConsumerFromGroup(ctx context.Context, group, consumerID string) error {
+	log := k.logger.WithField("consumerGroup", group).WithField("consumerID", consumerID)
+	err := k.getWorkspaceClient(ctx).ConsumerGroupConsumers.Delete(ctx, klib.String(group), klib.String(consumerID))
+	if err != nil && !klib.IsNotFoundErr(err) {
+		log.WithError(err).Error("failed to remove consumer from group")
+		return err
+	}
+	log.Info("removed consumer from group")
+	return nil
+}
+
+// ConsumerGroupsOfConsumer returns the agent managed consumer groups, named axway-*, the consumer is a member of
+func (k KongClient) ConsumerGroupsOfConsumer(ctx context.Context, consumerID string) ([]string, error) {
+	log := k.logger.WithField("consumerID", consumerID)
+	groups, err := k.getWorkspaceClient(ctx).ConsumerGroups.ListAll(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to get consumer groups")
+		return nil, err
+	}
+
+	memberOf := []string{}
+	for _, group := range groups {
+		if group == nil || group.Name == nil || !strings.HasPrefix(*group.Name, consumerGroupPrefix+"-") {
+			continue
+		}
+		members, err := k.getWorkspaceClient(ctx).ConsumerGroupConsumers.ListAll(ctx, group.Name)
+		if err != nil {
+			log.WithError(err).WithField("consumerGroup", *group.Name).Error("failed to get consumer group members")
+			return nil, err
+		}
+		for _, consumer := range members.Consumers {
+			if consumer != nil && consumer.ID != nil && *consumer.ID == consumerID {
+				memberOf = append(memberOf, *group.Name)
+				break
+			}
+		}
+	}
+	return memberOf, nil
+}
+
+func (k KongClient) getOrCreateConsumerGroup(ctx context.Context, group string) (*klib.ConsumerGroup, error) {
+	existing, err := k.getWorkspaceClient(ctx).ConsumerGroups.Get(ctx, klib.String(group))
+	if err == nil && existing.ConsumerGroup != nil && existing.ConsumerGroup.ID != nil {
+		return existing.ConsumerGroup, nil
+	}
+	if err != nil && !klib.IsNotFoundErr(err) {
+		return nil, err
+	}
+
+	k.logger.WithField("consumerGroup", group).Debug("creating consumer group")
+	consumerGroup, err := k.getWorkspaceClient(ctx).ConsumerGroups.Create(ctx, &klib.ConsumerGroup{Name: klib.String(group)})
+	if err != nil {
+		return nil, err
+	}
+	if consumerGroup.ID == nil {
+		return nil, fmt.Errorf("consumer group %s was created without an id", group)
+	}
+	return consumerGroup, nil
+}
+
+func getConsumerGroupPlugin(plugins []*klib.Plugin, consumerGroupID, pluginName string) *klib.Plugin {
+	for _, plugin := range plugins {
+		if plugin.Name == nil || *plugin.Name != pluginName || plugin.Route != nil || plugin.Service != nil || plugin.Consumer != nil {
+			continue
+		}
+		if plugin.ConsumerGroup != nil && plugin.ConsumerGroup.ID != nil && *plugin.ConsumerGroup.ID == consumerGroupID {
+			return plugin
+		}
+	}
+	return nil
+}
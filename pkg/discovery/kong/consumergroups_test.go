@@ -0,0 +1,405 @@
+package kong
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+
+	"github.com/Axway/agents-kong/pkg/discovery/config"
+)
+
+func TestConsumerGroupName(t *testing.T) {
+	testCases := map[string]struct {
+		planName      string
+		quotaInterval string
+		quotaLimit    int
+		expected      string
+	}{
+		"plan with quota": {
+			planName:      "gold",
+			quotaInterval: provisioning.Daily.String(),
+			quotaLimit:    1000,
+			expected:      "axway-gold-daily-1000",
+		},
+		"plan without quota": {
+			planName: "gold",
+			expected: "axway-gold",
+		},
+		"access tier": {
+			quotaInterval: provisioning.Monthly.String(),
+			quotaLimit:    50,
+			expected:      "axway-monthly-50",
+		},
+		"unlimited": {
+			expected: "axway-unlimited",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ConsumerGroupName(tc.planName, tc.quotaInterval, tc.quotaLimit))
+		})
+	}
+}
+
+func TestEnsureConsumerGroup(t *testing.T) {
+	group := "axway-gold-daily-7"
+	existingGroup := &klib.ConsumerGroupObject{
+		ConsumerGroup: &klib.ConsumerGroup{ID: klib.String("groupID"), Name: klib.String(group)},
+	}
+	groupPlugins := func(limit, windowSize float64, enabled bool) map[string]interface{} {
+		return map[string]interface{}{
+			"data": []*klib.Plugin{
+				{
+					ID:            klib.String("rlaID"),
+					Name:          klib.String(RateLimitingAdvancedPlugin),
+					ConsumerGroup: &klib.ConsumerGroup{ID: klib.String("groupID")},
+					Enabled:       klib.Bool(enabled),
+					Config: klib.Configuration{
+						"limit":               []float64{limit},
+						"window_size":         []float64{windowSize},
+						"strategy":            "local",
+						"sync_rate":           float64(-1),
+						"hide_client_headers": false,
+					},
+				},
+			},
+			"next": "null",
+		}
+	}
+	testCases := map[string]struct {
+		expectErr     bool
+		quotaInterval string
+		quota         config.KongQuotaConfig
+		responses     map[string]response
+	}{
+		"create group without quota": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code: http.StatusNotFound,
+				},
+				formatRequestKey(http.MethodPost, "/consumer_groups"): {
+					code:      http.StatusCreated,
+					dataIface: existingGroup.ConsumerGroup,
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"error creating group": {
+			expectErr:     true,
+			quotaInterval: provisioning.Daily.String(),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code: http.StatusNotFound,
+				},
+				formatRequestKey(http.MethodPost, "/consumer_groups"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"unsupported quota interval": {
+			expectErr:     true,
+			quotaInterval: provisioning.Weekly.String(),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code:      http.StatusOK,
+					dataIface: existingGroup,
+				},
+			},
+		},
+		"add quota to group": {
+			quotaInterval: provisioning.Daily.String(),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code:      http.StatusOK,
+					dataIface: existingGroup,
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code: http.StatusOK,
+					dataIface: map[string]interface{}{
+						"data": []*klib.Plugin{},
+						"next": "null",
+					},
+				},
+				formatRequestKey(http.MethodPost, "/plugins"): {
+					code: http.StatusCreated,
+					dataIface: &klib.Plugin{
+						ID:   klib.String("rlaID"),
+						Name: klib.String(RateLimitingAdvancedPlugin),
+					},
+				},
+			},
+		},
+		"error adding quota to group": {
+			expectErr:     true,
+			quotaInterval: provisioning.Daily.String(),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code:      http.StatusOK,
+					dataIface: existingGroup,
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code: http.StatusOK,
+					dataIface: map[string]interface{}{
+						"data": []*klib.Plugin{},
+						"next": "null",
+					},
+				},
+				formatRequestKey(http.MethodPost, "/plugins"): {
+					code: http.StatusBadRequest,
+				},
+			},
+		},
+		"group quota unchanged": {
+			quotaInterval: provisioning.Daily.String(),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code:      http.StatusOK,
+					dataIface: existingGroup,
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: groupPlugins(7, 86400, true),
+				},
+				formatRequestKey(http.MethodPatch, "/plugins/rlaID"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"group quota limit changed": {
+			expectErr:     true,
+			quotaInterval: provisioning.Daily.String(),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code:      http.StatusOK,
+					dataIface: existingGroup,
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: groupPlugins(10, 86400, true),
+				},
+				formatRequestKey(http.MethodPatch, "/plugins/rlaID"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"group quota policy changed": {
+			expectErr:     true,
+			quotaInterval: provisioning.Daily.String(),
+			quota:         config.KongQuotaConfig{Policy: config.QuotaPolicyCluster},
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code:      http.StatusOK,
+					dataIface: existingGroup,
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: groupPlugins(7, 86400, true),
+				},
+				formatRequestKey(http.MethodPatch, "/plugins/rlaID"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"group quota disabled": {
+			quotaInterval: provisioning.Daily.String(),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/"+group): {
+					code:      http.StatusOK,
+					dataIface: existingGroup,
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: groupPlugins(7, 86400, false),
+				},
+				formatRequestKey(http.MethodPatch, "/plugins/rlaID"): {
+					code: http.StatusOK,
+					dataIface: &klib.Plugin{
+						ID:   klib.String("rlaID"),
+						Name: klib.String(RateLimitingAdvancedPlugin),
+					},
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses).(*KongClient)
+			client.quota = tc.quota
+			err := client.EnsureConsumerGroup(context.TODO(), group, tc.quotaInterval, 7)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestAddConsumerToGroup(t *testing.T) {
+	testCases := map[string]struct {
+		expectErr bool
+		responses map[string]response
+	}{
+		"consumer already in group": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/group/consumers"): {
+					code: http.StatusOK,
+					dataIface: &klib.ConsumerGroupObject{
+						Consumers: []*klib.Consumer{{ID: klib.String("consumerID")}},
+					},
+				},
+				formatRequestKey(http.MethodPost, "/consumer_groups/group/consumers"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"add consumer to group": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/group/consumers"): {
+					code:      http.StatusOK,
+					dataIface: &klib.ConsumerGroupObject{},
+				},
+				formatRequestKey(http.MethodPost, "/consumer_groups/group/consumers"): {
+					code:      http.StatusCreated,
+					dataIface: &klib.ConsumerGroupObject{},
+				},
+			},
+		},
+		"error adding consumer to group": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/group/consumers"): {
+					code:      http.StatusOK,
+					dataIface: &klib.ConsumerGroupObject{},
+				},
+				formatRequestKey(http.MethodPost, "/consumer_groups/group/consumers"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"group not found": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups/group/consumers"): {
+					code: http.StatusNotFound,
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			err := client.AddConsumerToGroup(context.TODO(), "group", "consumerID")
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestRemoveConsumerFromGroup(t *testing.T) {
+	testCases := map[string]struct {
+		expectErr bool
+		code      int
+	}{
+		"removed consumer from group": {
+			code: http.StatusNoContent,
+		},
+		"consumer not in group": {
+			code: http.StatusNotFound,
+		},
+		"error removing consumer from group": {
+			expectErr: true,
+			code:      http.StatusInternalServerError,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(map[string]response{
+				formatRequestKey(http.MethodDelete, "/consumer_groups/group/consumers/consumerID"): {
+					code: tc.code,
+				},
+			})
+			err := client.RemoveConsumerFromGroup(context.TODO(), "group", "consumerID")
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConsumerGroupsOfConsumer(t *testing.T) {
+	groups := map[string]interface{}{"data": []*klib.ConsumerGroup{
+		{ID: klib.String("goldID"), Name: klib.String("axway-gold-daily-7")},
+		{ID: klib.String("silverID"), Name: klib.String("axway-silver-daily-100")},
+		{ID: klib.String("ownID"), Name: klib.String("partners")},
+	}}
+	testCases := map[string]struct {
+		expectErr    bool
+		responses    map[string]response
+		expectGroups []string
+	}{
+		"member of an agent group": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups"): {
+					code:      http.StatusOK,
+					dataIface: groups,
+				},
+				formatRequestKey(http.MethodGet, "/consumer_groups/axway-gold-daily-7/consumers"): {
+					code: http.StatusOK,
+					dataIface: &klib.ConsumerGroupObject{
+						Consumers: []*klib.Consumer{{ID: klib.String("otherID")}, {ID: klib.String("consumerID")}},
+					},
+				},
+				formatRequestKey(http.MethodGet, "/consumer_groups/axway-silver-daily-100/consumers"): {
+					code:      http.StatusOK,
+					dataIface: &klib.ConsumerGroupObject{Consumers: []*klib.Consumer{{ID: klib.String("otherID")}}},
+				},
+			},
+			expectGroups: []string{"axway-gold-daily-7"},
+		},
+		"error getting consumer groups": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"error getting consumer group members": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumer_groups"): {
+					code:      http.StatusOK,
+					dataIface: groups,
+				},
+				formatRequestKey(http.MethodGet, "/consumer_groups/axway-gold-daily-7/consumers"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			groups, err := client.ConsumerGroupsOfConsumer(context.TODO(), "consumerID")
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectGroups, groups)
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package kong
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+const (
+	// importTagPrefix - prefix of the tag linking a consumer created before the agent to a Central application
+	importTagPrefix = consumerTagPrefix + "import:"
+	// ImportedCredentialTag - tags the credentials created before the agent once they are linked to a Central credential
+	ImportedCredentialTag = consumerTagPrefix + "imported"
+	// AgentCredentialTag - tags the credentials the agent creates
+	AgentCredentialTag = "amplify-agent"
+	consumerPageSize   = 1000
+)
+
+// consumerCredentialCollections - the kong credential collections of a consumer, in the order they are listed
+var consumerCredentialCollections = []string{
+	common.KeyAuthCredentials,
+	common.BasicAuthCredentials,
+	common.OAuth2Credentials,
+	common.JWTCredentials,
+	common.HMACCredentials,
+	common.MTLSCredentials,
+}
+
+// ImportTag returns the tag linking an existing consumer to the Central application, i.e. axway-import:billing. The
+// consumer with the tag is used by the application, instead of creating a new consumer
+func ImportTag(appName string) string {
+	return importTagPrefix + tagValue(appName)
+}
+
+// IsAgentConsumer returns true for the consumers created by the agent, the consumers of applications and the
+// consumers holding suspended credentials. Consumers linked to an application by an import are not created by the agent
+func IsAgentConsumer(consumer *klib.Consumer) bool {
+	if consumer.CustomID != nil && strings.HasSuffix(*consumer.CustomID, suspendedConsumerSuffix) {
+		return true
+	}
+	agentTagged := false
+	for _, tag := range consumer.Tags {
+		if tag == nil {
+			continue
+		}
+		if strings.HasPrefix(*tag, importTagPrefix) {
+			return false
+		}
+		if strings.HasPrefix(*tag, consumerTagPrefix+"app:") {
+			agentTagged = true
+		}
+	}
+	return agentTagged
+}
+
+// centralIDPattern - the ids of the Central resources, the custom id of the consumer of a managed application
+var centralIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// IsUntaggedAgentConsumer returns true for a consumer without the agent tags that may have been created by the agent,
+// its custom id being the id of a Central application. Earlier agent versions, and the consumers created when
+// granting access to an application without one, do not tag the consumer. Consumers linked by an import are excluded
+func IsUntaggedAgentConsumer(consumer *klib.Consumer) bool {
+	if consumer.CustomID == nil || !centralIDPattern.MatchString(*consumer.CustomID) {
+		return false
+	}
+	for _, tag := range consumer.Tags {
+		if tag != nil && strings.HasPrefix(*tag, consumerTagPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// ConsumerCredential - the fields of a credential, of any kong credential collection, identifying it without its secrets
+type ConsumerCredential struct {
+	// Collection - the kong credential collection, i.e. key-auths
+	Collection string    `json:"-"`
+	ID         *string   `json:"id,omitempty"`
+	Username   *string   `json:"username,omitempty"`
+	ClientID   *string   `json:"client_id,omitempty"`
+	ClientType *string   `json:"client_type,omitempty"`
+	Algorithm  *string   `json:"algorithm,omitempty"`
+	Key        *string   `json:"key,omitempty"`
+	PublicKey  *string   `json:"rsa_public_key,omitempty"`
+	Tags       []*string `json:"tags"`
+	// Consumer - the consumer of the credential, only its id is set
+	Consumer *klib.Consumer `json:"consumer,omitempty"`
+}
+
+// HasTag returns true when the credential has the tag
+func (c ConsumerCredential) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t != nil && *t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ListConsumers returns all consumers of the workspace
+func (k KongClient) ListConsumers(ctx context.Context) ([]*klib.Consumer, error) {
+	consumers, err := k.getWorkspaceClient(ctx).Consumers.ListAll(ctx)
+	if err != nil {
+		k.logger.WithError(err).Error("failed to list consumers")
+		return nil, err
+	}
+	return consumers, nil
+}
+
+// ListConsumerACLGroups returns the acl groups of the consumer
+func (k KongClient) ListConsumerACLGroups(ctx context.Context, id string) ([]string, error) {
+	log := k.logger.WithField("consumerID", id)
+	client := k.getWorkspaceClient(ctx)
+
+	groups := []string{}
+	opt := &klib.ListOpt{Size: consumerPageSize}
+	for opt != nil {
+		acls, next, err := client.ACLs.ListForConsumer(ctx, klib.String(id), opt)
+		if err != nil {
+			log.WithError(err).Error("listing consumer acls")
+			return nil, err
+		}
+		for _, acl := range acls {
+			if acl.Group != nil {
+				groups = append(groups, *acl.Group)
+			}
+		}
+		opt = next
+	}
+	return groups, nil
+}
+
+// ListConsumerCredentials returns the credentials of the consumer in every credential collection. Collections of
+// credential plugins not available on the gateway are skipped
+func (k KongClient) ListConsumerCredentials(ctx context.Context, id string) ([]ConsumerCredential, error) {
+	client := k.getWorkspaceClient(ctx)
+	credentials := []ConsumerCredential{}
+	for _, collection := range consumerCredentialCollections {
+		log := k.logger.WithField("consumerID", id).WithField("collection", collection)
+		query := &credentialListQuery{Size: consumerPageSize}
+		for {
+			req, err := client.NewRequest(http.MethodGet, fmt.Sprintf("/consumers/%s/%s", id, collection), query, nil)
+			if err != nil {
+				return nil, err
+			}
+			page := struct {
+				Data   []ConsumerCredential `json:"data"`
+				Offset string               `json:"offset"`
+			}{}
+			_, err = client.Do(ctx, req, &page)
+			if klib.IsNotFoundErr(err) {
+				log.Trace("credential collection not available")
+				break
+			}
+			if err != nil {
+				log.WithError(err).Error("failed to list consumer credentials")
+				return nil, err
+			}
+			for _, credential := range page.Data {
+				credential.Collection = collection
+				credentials = append(credentials, credential)
+			}
+			if page.Offset == "" {
+				break
+			}
+			query.Offset = page.Offset
+		}
+	}
+	return credentials, nil
+}
+
+// TagConsumer adds the missing tags to the consumer
+func (k KongClient) TagConsumer(ctx context.Context, id string, tags []string) error {
+	log := k.logger.WithField("consumerID", id)
+	client := k.getWorkspaceClient(ctx)
+	consumer, err := client.Consumers.Get(ctx, klib.String(id))
+	if err != nil {
+		log.WithError(err).Error("failed to get consumer")
+		return err
+	}
+	missing := missingTags(consumer.Tags, tags)
+	if len(missing) == 0 {
+		return nil
+	}
+	log.WithField("tags", missing).Debug("tagging consumer")
+	consumer.Tags = append(consumer.Tags, klib.StringSlice(missing...)...)
+	if _, err := client.Consumers.Update(ctx, consumer); err != nil {
+		log.WithError(err).Error("tagging consumer")
+		return err
+	}
+	return nil
+}
+
+// TagCredential adds the missing tags to the credential of the kong credential collection, i.e. key-auths
+func (k KongClient) TagCredential(ctx context.Context, collection, credentialID string, tags []string) error {
+	log := k.logger.WithField("credentialID", credentialID).WithField("collection", collection)
+	client := k.getWorkspaceClient(ctx)
+	endpoint := fmt.Sprintf("/%s/%s", collection, credentialID)
+
+	req, err := client.NewRequest(http.MethodGet, endpoint, nil, nil)
+	if err != nil {
+		return err
+	}
+	tagged := taggedCredential{}
+	if _, err := client.Do(ctx, req, &tagged); err != nil {
+		log.WithError(err).Error("failed to get credential")
+		return err
+	}
+	missing := missingTags(tagged.Tags, tags)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	req, err = client.NewRequest(http.MethodPatch, endpoint, nil,
+		taggedCredential{Tags: append(tagged.Tags, klib.StringSlice(missing...)...)})
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, nil); err != nil {
+		log.WithError(err).Error("failed to tag credential")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package kong
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+func TestImportTag(t *testing.T) {
+	assert.Equal(t, "axway-import:billing", ImportTag("billing"))
+	assert.Equal(t, "axway-import:billing-app", ImportTag("billing app"))
+}
+
+func TestIsAgentConsumer(t *testing.T) {
+	testCases := map[string]struct {
+		consumer *klib.Consumer
+		expected bool
+	}{
+		"consumer created before the agent": {
+			consumer: &klib.Consumer{CustomID: klib.String("customer"), Tags: klib.StringSlice("app:billing")},
+		},
+		"application consumer": {
+			consumer: &klib.Consumer{CustomID: klib.String("appID"), Tags: klib.StringSlice(ConsumerTags("", "billing", "env")...)},
+			expected: true,
+		},
+		"suspended credentials consumer": {
+			consumer: &klib.Consumer{CustomID: klib.String("consumerID" + suspendedConsumerSuffix)},
+			expected: true,
+		},
+		"imported consumer": {
+			consumer: &klib.Consumer{Tags: klib.StringSlice(append(ConsumerTags("", "billing", "env"), ImportTag("billing"))...)},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsAgentConsumer(tc.consumer))
+		})
+	}
+}
+
+func TestIsUntaggedAgentConsumer(t *testing.T) {
+	appID := "8a2e8c8e8b6f4d2a018b7f3c2e1d0001"
+	testCases := map[string]struct {
+		consumer *klib.Consumer
+		expected bool
+	}{
+		"untagged consumer of a central application": {
+			consumer: &klib.Consumer{CustomID: klib.String(appID), Username: klib.String("billing")},
+			expected: true,
+		},
+		"consumer with another custom id": {
+			consumer: &klib.Consumer{CustomID: klib.String("customer"), Username: klib.String("billing")},
+		},
+		"consumer without a custom id": {
+			consumer: &klib.Consumer{Username: klib.String("billing")},
+		},
+		"tagged application consumer": {
+			consumer: &klib.Consumer{CustomID: klib.String(appID), Tags: klib.StringSlice(ConsumerTags("", "billing", "env")...)},
+		},
+		"imported consumer": {
+			consumer: &klib.Consumer{CustomID: klib.String(appID), Tags: klib.StringSlice(ImportTag("billing"))},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsUntaggedAgentConsumer(tc.consumer))
+		})
+	}
+}
+
+func TestEnsureImportedConsumer(t *testing.T) {
+	imported := &klib.Consumer{ID: klib.String("importedID"), Username: klib.String("billing-user"), Tags: klib.StringSlice(ImportTag("billing"))}
+	testCases := map[string]struct {
+		imported   []*klib.Consumer
+		listCode   int
+		expectID   string
+		expectErr  bool
+		expectPost bool
+	}{
+		"links the imported consumer": {
+			imported: []*klib.Consumer{imported},
+			listCode: http.StatusOK,
+			expectID: "importedID",
+		},
+		"creates a consumer without an imported consumer": {
+			listCode:   http.StatusOK,
+			expectID:   "consumerID",
+			expectPost: true,
+		},
+		"error listing the imported consumers": {
+			listCode:  http.StatusInternalServerError,
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			posted := false
+			var patched *klib.Consumer
+			client := createHandlerClient(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				var data interface{}
+				switch {
+				case req.Method == http.MethodGet && req.URL.Query().Get("custom_id") != "":
+					data = map[string]interface{}{"data": []*klib.Consumer{}}
+				case req.Method == http.MethodGet:
+					assert.Equal(t, ImportTag("billing"), req.URL.Query().Get("tags"))
+					resp.WriteHeader(tc.listCode)
+					data = map[string]interface{}{"data": tc.imported}
+				case req.Method == http.MethodPost:
+					posted = true
+					resp.WriteHeader(http.StatusCreated)
+					data = &klib.Consumer{ID: klib.String("consumerID")}
+				case req.Method == http.MethodPatch:
+					patched = &klib.Consumer{}
+					body, _ := io.ReadAll(req.Body)
+					json.Unmarshal(body, patched)
+					data = patched
+				}
+				body, _ := json.Marshal(data)
+				resp.Write(body)
+			}))
+
+			consumer, err := client.EnsureConsumer(context.Background(), "appID", "billing", []string{"axway-app:billing"})
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectID, *consumer.ID)
+			assert.Equal(t, tc.expectPost, posted)
+			if !tc.expectPost {
+				// the custom id of the imported consumer is kept, only the tags are added
+				assert.NotNil(t, patched)
+				assert.Nil(t, patched.CustomID)
+				assert.ElementsMatch(t, []string{ImportTag("billing"), "axway-app:billing"}, tagValues(patched.Tags))
+			}
+		})
+	}
+}
+
+func TestListConsumerCredentials(t *testing.T) {
+	client := createClient(map[string]response{
+		formatRequestKey(http.MethodGet, "/consumers/consumerID/key-auths"): {
+			code: http.StatusOK,
+			dataIface: map[string]interface{}{"data": []map[string]interface{}{
+				{"id": "keyID", "key": "secret", "tags": []string{AgentCredentialTag}},
+			}},
+		},
+		formatRequestKey(http.MethodGet, "/consumers/consumerID/basic-auths"): {
+			code:      http.StatusOK,
+			dataIface: map[string]interface{}{"data": []map[string]interface{}{{"id": "basicID", "username": "user"}}},
+		},
+		formatRequestKey(http.MethodGet, "/consumers/consumerID/oauth2"): {
+			code:      http.StatusOK,
+			dataIface: map[string]interface{}{"data": []map[string]interface{}{{"id": "oauthID", "client_id": "client", "client_type": "public"}}},
+		},
+		formatRequestKey(http.MethodGet, "/consumers/consumerID/jwts"): {
+			code:      http.StatusOK,
+			dataIface: map[string]interface{}{"data": []map[string]interface{}{{"id": "jwtID", "key": "iss", "algorithm": "HS256"}}},
+		},
+		formatRequestKey(http.MethodGet, "/consumers/consumerID/hmac-auths"): {
+			code:      http.StatusOK,
+			dataIface: map[string]interface{}{"data": []map[string]interface{}{}},
+		},
+		// the mtls-auth plugin is not available on the gateway
+		formatRequestKey(http.MethodGet, "/consumers/consumerID/mtls-auths"): {code: http.StatusNotFound},
+	})
+
+	credentials, err := client.ListConsumerCredentials(context.Background(), "consumerID")
+	assert.Nil(t, err)
+	assert.Len(t, credentials, 4)
+	assert.Equal(t, common.KeyAuthCredentials, credentials[0].Collection)
+	assert.True(t, credentials[0].HasTag(AgentCredentialTag))
+	assert.Equal(t, common.BasicAuthCredentials, credentials[1].Collection)
+	assert.Equal(t, "user", *credentials[1].Username)
+	assert.Equal(t, "public", *credentials[2].ClientType)
+	assert.Equal(t, "HS256", *credentials[3].Algorithm)
+	assert.False(t, credentials[3].HasTag(ImportedCredentialTag))
+
+	client = createClient(map[string]response{
+		formatRequestKey(http.MethodGet, "/consumers/consumerID/key-auths"): {code: http.StatusInternalServerError},
+	})
+	_, err = client.ListConsumerCredentials(context.Background(), "consumerID")
+	assert.NotNil(t, err)
+}
+
+func TestTagCredential(t *testing.T) {
+	testCases := map[string]struct {
+		tags        []string
+		patchCode   int
+		expectPatch []string
+		expectErr   bool
+	}{
+		"adds the tag": {
+			tags:        []string{"team"},
+			patchCode:   http.StatusOK,
+			expectPatch: []string{"team", ImportedCredentialTag},
+		},
+		"already tagged": {
+			tags: []string{ImportedCredentialTag},
+		},
+		"error tagging": {
+			patchCode:   http.StatusInternalServerError,
+			expectPatch: []string{ImportedCredentialTag},
+			expectErr:   true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var patched []string
+			client := createHandlerClient(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/key-auths/keyID", req.URL.Path)
+				if req.Method == http.MethodPatch {
+					body := taggedCredential{}
+					data, _ := io.ReadAll(req.Body)
+					json.Unmarshal(data, &body)
+					patched = tagValues(body.Tags)
+					resp.WriteHeader(tc.patchCode)
+					return
+				}
+				data, _ := json.Marshal(taggedCredential{ID: klib.String("keyID"), Tags: klib.StringSlice(tc.tags...)})
+				resp.Write(data)
+			}))
+
+			err := client.TagCredential(context.Background(), common.KeyAuthCredentials, "keyID", []string{ImportedCredentialTag})
+			if tc.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tc.expectPatch, patched)
+		})
+	}
+}
+
+func tagValues(tags []*string) []string {
+	values := []string{}
+	for _, tag := range tags {
+		values = append(values, *tag)
+	}
+	return values
+}
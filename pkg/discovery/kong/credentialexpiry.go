@@ -0,0 +1,208 @@
+package kong
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+const (
+	// credentialExpiringTag - tags the credentials the agent deletes once expired
+	credentialExpiringTag = consumerTagPrefix + "expiring"
+	// credentialExpiresTagPrefix - prefix of the tag holding the unix time a credential expires at
+	credentialExpiresTagPrefix = consumerTagPrefix + "expires:"
+	expiredCredentialsPageSize = 1000
+)
+
+// expiringCredentialCollections - the kong credential collections the expiry job looks in
+var expiringCredentialCollections = []string{
+	common.KeyAuthCredentials,
+	common.BasicAuthCredentials,
+	common.OAuth2Credentials,
+	common.JWTCredentials,
+	common.HMACCredentials,
+	common.MTLSCredentials,
+}
+
+// taggedCredential - the fields of a credential, of any kong credential collection, the expiry job uses
+type taggedCredential struct {
+	ID       *string        `json:"id,omitempty"`
+	Consumer *klib.Consumer `json:"consumer,omitempty"`
+	Tags     []*string      `json:"tags"`
+}
+
+// credentialListQuery - the query of a credential collection page
+type credentialListQuery struct {
+	Size   int    `url:"size,omitempty"`
+	Offset string `url:"offset,omitempty"`
+	Tags   string `url:"tags,omitempty"`
+}
+
+// Expiring returns true for the credentials the expiry job deletes once expired
+func (c ConsumerCredential) Expiring() bool {
+	return c.HasTag(credentialExpiringTag)
+}
+
+// expiresAt returns the time the credential expires at, false when the credential does not expire
+func (c taggedCredential) expiresAt() (time.Time, bool) {
+	for _, tag := range c.Tags {
+		if tag == nil || !strings.HasPrefix(*tag, credentialExpiresTagPrefix) {
+			continue
+		}
+		unix, err := strconv.ParseInt(strings.TrimPrefix(*tag, credentialExpiresTagPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		return time.Unix(unix, 0), true
+	}
+	return time.Time{}, false
+}
+
+// expiryTags returns the tags of the credential with the expiry tags set to the time
+func expiryTags(tags []*string, expiresAt time.Time) []*string {
+	updated := []*string{}
+	for _, tag := range tags {
+		if tag == nil || *tag == credentialExpiringTag || strings.HasPrefix(*tag, credentialExpiresTagPrefix) {
+			continue
+		}
+		updated = append(updated, tag)
+	}
+	return append(updated,
+		klib.String(credentialExpiringTag),
+		klib.String(fmt.Sprintf("%s%d", credentialExpiresTagPrefix, expiresAt.Unix())),
+	)
+}
+
+// ExpireCredential tags the credential, of the kong credential collection i.e. key-auths, to be deleted by the
+// credential expiry job once the time has passed. The tags are kept in kong, so pending deletions survive restarts
+func (k KongClient) ExpireCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time) error {
+	return k.tagCredentialExpiry(ctx, collection, credentialID, expiresAt, nil)
+}
+
+// RenewCredential extends the lifetime of the credential, of the kong credential collection, to the time without
+// changing its secret and decodes the renewed credential. Key auth credentials get a new ttl, kong deletes them
+// itself, the credentials of the other collections are tagged to be deleted by the credential expiry job
+func (k KongClient) RenewCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error {
+	if collection != common.KeyAuthCredentials {
+		return k.tagCredentialExpiry(ctx, collection, credentialID, expiresAt, credential)
+	}
+
+	log := k.logger.WithField("credentialID", credentialID).WithField("expiresAt", expiresAt.UTC().Format(time.RFC3339))
+	client := k.getWorkspaceClient(ctx)
+	req, err := client.NewRequest(http.MethodPatch, fmt.Sprintf("/%s/%s", collection, credentialID), nil,
+		map[string]int{"ttl": common.CredentialTTL(expiresAt, time.Now())})
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, credential); err != nil {
+		log.WithError(err).Error("failed to renew credential ttl")
+		return err
+	}
+	log.Info("credential ttl renewed")
+	return nil
+}
+
+func (k KongClient) tagCredentialExpiry(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error {
+	log := k.logger.WithField("credentialID", credentialID).WithField("expiresAt", expiresAt.UTC().Format(time.RFC3339))
+	client := k.getWorkspaceClient(ctx)
+	endpoint := fmt.Sprintf("/%s/%s", collection, credentialID)
+
+	req, err := client.NewRequest(http.MethodGet, endpoint, nil, nil)
+	if err != nil {
+		return err
+	}
+	tagged := taggedCredential{}
+	if _, err := client.Do(ctx, req, &tagged); err != nil {
+		log.WithError(err).Error("failed to get credential")
+		return err
+	}
+
+	req, err = client.NewRequest(http.MethodPatch, endpoint, nil, taggedCredential{Tags: expiryTags(tagged.Tags, expiresAt)})
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, credential); err != nil {
+		log.WithError(err).Error("failed to tag credential expiry")
+		return err
+	}
+	log.Info("credential expiry scheduled")
+	return nil
+}
+
+// DeleteExpiredCredentials deletes the credentials of the workspace tagged to expire before now and returns the
+// number of credentials deleted. Collections of credential plugins not available on the gateway are skipped
+func (k KongClient) DeleteExpiredCredentials(ctx context.Context, now time.Time) (int, error) {
+	client := k.getWorkspaceClient(ctx)
+	deleted := 0
+	var errs []error
+	for _, collection := range expiringCredentialCollections {
+		log := k.logger.WithField("collection", collection)
+		credentials, err := k.listExpiringCredentials(ctx, collection)
+		if klib.IsNotFoundErr(err) {
+			log.Trace("credential collection not available")
+			continue
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to list expiring credentials")
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, credential := range credentials {
+			expiresAt, ok := credential.expiresAt()
+			if !ok || expiresAt.After(now) || credential.ID == nil {
+				continue
+			}
+			req, err := client.NewRequest(http.MethodDelete, fmt.Sprintf("/%s/%s", collection, *credential.ID), nil, nil)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if _, err := client.Do(ctx, req, nil); err != nil && !klib.IsNotFoundErr(err) {
+				log.WithError(err).WithField("credentialID", *credential.ID).Error("failed to delete expired credential")
+				errs = append(errs, err)
+				continue
+			}
+			log.WithField("credentialID", *credential.ID).Info("deleted expired credential")
+			deleted++
+		}
+	}
+	if len(errs) > 0 {
+		return deleted, fmt.Errorf("failed to delete expired credentials: %w", errs[0])
+	}
+	return deleted, nil
+}
+
+func (k KongClient) listExpiringCredentials(ctx context.Context, collection string) ([]taggedCredential, error) {
+	client := k.getWorkspaceClient(ctx)
+	opt := &credentialListQuery{
+		Size: expiredCredentialsPageSize,
+		Tags: credentialExpiringTag,
+	}
+	credentials := []taggedCredential{}
+	for {
+		req, err := client.NewRequest(http.MethodGet, "/"+collection, opt, nil)
+		if err != nil {
+			return nil, err
+		}
+		page := struct {
+			Data   []taggedCredential `json:"data"`
+			Offset string             `json:"offset"`
+		}{}
+		if _, err := client.Do(ctx, req, &page); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, page.Data...)
+		if page.Offset == "" {
+			return credentials, nil
+		}
+		opt.Offset = page.Offset
+	}
+}
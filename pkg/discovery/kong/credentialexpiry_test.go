@@ -0,0 +1,240 @@
+package kong
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+func expiresTag(t time.Time) *string {
+	return klib.String(fmt.Sprintf("%s%d", credentialExpiresTagPrefix, t.Unix()))
+}
+
+func TestExpireCredential(t *testing.T) {
+	expiresAt := time.Unix(1700000000, 0)
+	testCases := map[string]struct {
+		tags       []*string
+		getCode    int
+		patchCode  int
+		expectErr  bool
+		expectTags []string
+	}{
+		"adds the expiry tags and keeps the other tags": {
+			tags:       []*string{klib.String("amplify-agent")},
+			getCode:    http.StatusOK,
+			patchCode:  http.StatusOK,
+			expectTags: []string{"amplify-agent", credentialExpiringTag, *expiresTag(expiresAt)},
+		},
+		"replaces a previous expiry": {
+			tags:       []*string{klib.String(credentialExpiringTag), expiresTag(expiresAt.Add(time.Hour))},
+			getCode:    http.StatusOK,
+			patchCode:  http.StatusOK,
+			expectTags: []string{credentialExpiringTag, *expiresTag(expiresAt)},
+		},
+		"error when the credential does not exist": {
+			getCode:   http.StatusNotFound,
+			expectErr: true,
+		},
+		"error when the credential can not be tagged": {
+			getCode:   http.StatusOK,
+			patchCode: http.StatusInternalServerError,
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var patched []string
+			client := createHandlerClient(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/key-auths/credID" {
+					resp.WriteHeader(http.StatusNotFound)
+					return
+				}
+				switch req.Method {
+				case http.MethodGet:
+					resp.WriteHeader(tc.getCode)
+					data, _ := json.Marshal(taggedCredential{ID: klib.String("credID"), Tags: tc.tags})
+					resp.Write(data)
+				case http.MethodPatch:
+					body := taggedCredential{}
+					json.NewDecoder(req.Body).Decode(&body)
+					for _, tag := range body.Tags {
+						patched = append(patched, *tag)
+					}
+					resp.WriteHeader(tc.patchCode)
+					resp.Write([]byte("{}"))
+				}
+			}))
+
+			err := client.ExpireCredential(context.TODO(), common.KeyAuthCredentials, "credID", expiresAt)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, tc.expectTags, patched)
+		})
+	}
+}
+
+func TestRenewCredential(t *testing.T) {
+	expiresAt := time.Now().Add(24 * time.Hour)
+	testCases := map[string]struct {
+		collection  string
+		patchCode   int
+		expectErr   bool
+		expectTTL   bool
+		expectTags  []string
+		expectPatch string
+	}{
+		"key auth gets a new ttl": {
+			collection:  common.KeyAuthCredentials,
+			patchCode:   http.StatusOK,
+			expectTTL:   true,
+			expectPatch: "/key-auths/credID",
+		},
+		"other credentials are tagged to expire": {
+			collection:  common.HMACCredentials,
+			patchCode:   http.StatusOK,
+			expectTags:  []string{credentialExpiringTag, *expiresTag(expiresAt)},
+			expectPatch: "/hmac-auths/credID",
+		},
+		"error when the credential can not be renewed": {
+			collection: common.KeyAuthCredentials,
+			patchCode:  http.StatusNotFound,
+			expectErr:  true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			patched := ""
+			body := map[string]interface{}{}
+			client := createHandlerClient(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				switch req.Method {
+				case http.MethodGet:
+					resp.WriteHeader(http.StatusOK)
+					resp.Write([]byte(`{"id": "credID", "tags": []}`))
+				case http.MethodPatch:
+					patched = req.URL.Path
+					json.NewDecoder(req.Body).Decode(&body)
+					resp.WriteHeader(tc.patchCode)
+					resp.Write([]byte(`{"id": "credID", "username": "user", "secret": "secret"}`))
+				}
+			}))
+
+			hmac := &klib.HMACAuth{}
+			err := client.RenewCredential(context.TODO(), tc.collection, "credID", expiresAt, hmac)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectPatch, patched)
+			assert.Equal(t, "secret", *hmac.Secret)
+			if tc.expectTTL {
+				assert.InDelta(t, 24*60*60, body["ttl"], 60)
+				return
+			}
+			assert.NotContains(t, body, "ttl")
+			tags := []string{}
+			for _, tag := range body["tags"].([]interface{}) {
+				tags = append(tags, tag.(string))
+			}
+			assert.ElementsMatch(t, tc.expectTags, tags)
+		})
+	}
+}
+
+func TestDeleteExpiredCredentials(t *testing.T) {
+	now := time.Now()
+	expired := []*string{klib.String(credentialExpiringTag), expiresTag(now.Add(-time.Minute))}
+	valid := []*string{klib.String(credentialExpiringTag), expiresTag(now.Add(time.Hour))}
+	testCases := map[string]struct {
+		// pages of expiring credentials per collection, a missing collection is not available
+		pages         map[string][][]taggedCredential
+		deleteCode    int
+		expectErr     bool
+		expectDeleted []string
+	}{
+		"deletes the expired credentials of every collection": {
+			pages: map[string][][]taggedCredential{
+				common.KeyAuthCredentials: {
+					{{ID: klib.String("expiredKey"), Tags: expired}, {ID: klib.String("validKey"), Tags: valid}},
+					{{ID: klib.String("expiredKey2"), Tags: expired}},
+				},
+				common.BasicAuthCredentials: {{{ID: klib.String("expiredBasic"), Tags: expired}}},
+				common.OAuth2Credentials:    {{{ID: klib.String("untagged"), Tags: []*string{klib.String(credentialExpiringTag)}}}},
+				common.JWTCredentials:       {{}},
+				common.HMACCredentials:      {{}},
+			},
+			deleteCode:    http.StatusNoContent,
+			expectDeleted: []string{"/key-auths/expiredKey", "/key-auths/expiredKey2", "/basic-auths/expiredBasic"},
+		},
+		"credential already deleted": {
+			pages: map[string][][]taggedCredential{
+				common.KeyAuthCredentials: {{{ID: klib.String("expiredKey"), Tags: expired}}},
+			},
+			deleteCode:    http.StatusNotFound,
+			expectDeleted: []string{"/key-auths/expiredKey"},
+		},
+		"error when a credential can not be deleted": {
+			pages: map[string][][]taggedCredential{
+				common.KeyAuthCredentials:   {{{ID: klib.String("expiredKey"), Tags: expired}}},
+				common.BasicAuthCredentials: {{{ID: klib.String("expiredBasic"), Tags: expired}}},
+			},
+			deleteCode: http.StatusInternalServerError,
+			expectErr:  true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			deleted := []string{}
+			client := createHandlerClient(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				collection := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")[0]
+				pages, found := tc.pages[collection]
+				if !found {
+					resp.WriteHeader(http.StatusNotFound)
+					resp.Write([]byte(`{"message": "Not found"}`))
+					return
+				}
+				if req.Method == http.MethodDelete {
+					mu.Lock()
+					deleted = append(deleted, req.URL.Path)
+					mu.Unlock()
+					resp.WriteHeader(tc.deleteCode)
+					return
+				}
+
+				assert.Equal(t, credentialExpiringTag, req.URL.Query().Get("tags"))
+				page := 0
+				fmt.Sscanf(req.URL.Query().Get("offset"), "%d", &page)
+				body := map[string]interface{}{"data": pages[page]}
+				if page+1 < len(pages) {
+					body["offset"] = fmt.Sprintf("%d", page+1)
+				}
+				data, _ := json.Marshal(body)
+				resp.WriteHeader(http.StatusOK)
+				resp.Write(data)
+			}))
+
+			count, err := client.DeleteExpiredCredentials(context.TODO(), now)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, len(tc.expectDeleted), count)
+			assert.ElementsMatch(t, tc.expectDeleted, deleted)
+		})
+	}
+}
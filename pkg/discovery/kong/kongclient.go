@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"github.com/Axway/agent-sdk/pkg/util/log"
 
 	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
 	config "github.com/Axway/agents-kong/pkg/discovery/config"
 )
 
@@ -27,8 +29,21 @@ const unstructuredSpec = "Unstructured API Example"
 type KongAPIClient interface {
 	// Provisioning
 	CreateConsumer(ctx context.Context, id, name string) (*klib.Consumer, error)
+	EnsureConsumer(ctx context.Context, id, name string, tags []string) (*klib.Consumer, error)
 	AddConsumerACL(ctx context.Context, id string) error
+	AddConsumerACLGroup(ctx context.Context, id, group string) error
 	DeleteConsumer(ctx context.Context, id string) error
+	// Import
+	ListConsumers(ctx context.Context) ([]*klib.Consumer, error)
+	ListConsumerACLGroups(ctx context.Context, id string) ([]string, error)
+	ListConsumerCredentials(ctx context.Context, id string) ([]ConsumerCredential, error)
+	TagConsumer(ctx context.Context, id string, tags []string) error
+	TagCredential(ctx context.Context, collection, credentialID string, tags []string) error
+	// Orphans
+	ListAgentCredentials(ctx context.Context) ([]ConsumerCredential, error)
+	QuarantineEntity(ctx context.Context, collection, id string, since time.Time) error
+	ReleaseEntity(ctx context.Context, collection, id string) error
+	DeleteEntity(ctx context.Context, collection, id string) error
 	// Credential
 	DeleteOauth2(ctx context.Context, consumerID, clientID string) error
 	DeleteHttpBasic(ctx context.Context, consumerID, username string) error
@@ -36,10 +51,32 @@ type KongAPIClient interface {
 	CreateHttpBasic(ctx context.Context, consumerID string, basicAuth *klib.BasicAuth) (*klib.BasicAuth, error)
 	CreateOauth2(ctx context.Context, consumerID string, oauth2 *klib.Oauth2Credential) (*klib.Oauth2Credential, error)
 	CreateAuthKey(ctx context.Context, consumerID string, keyAuth *klib.KeyAuth) (*klib.KeyAuth, error)
+	AuthKeyExists(ctx context.Context, key string) (bool, error)
+	DeleteJWT(ctx context.Context, consumerID, jwtID string) error
+	CreateJWT(ctx context.Context, consumerID string, jwt *klib.JWTAuth) (*klib.JWTAuth, error)
+	DeleteHMAC(ctx context.Context, consumerID, hmacID string) error
+	CreateHMAC(ctx context.Context, consumerID string, hmac *klib.HMACAuth) (*klib.HMACAuth, error)
+	DeleteMTLS(ctx context.Context, consumerID, mtlsID string) error
+	CreateMTLS(ctx context.Context, consumerID string, mtls *klib.MTLSAuth) (*klib.MTLSAuth, error)
+	ListCACertificates(ctx context.Context) ([]*klib.CACertificate, error)
+	EnsureSuspendedConsumer(ctx context.Context, appConsumerID string) (*klib.Consumer, error)
+	DenyConsumer(ctx context.Context, consumerID string) error
+	AllowConsumer(ctx context.Context, consumerID string) error
+	MoveCredential(ctx context.Context, collection, credentialID, consumerID string, credential interface{}) error
+	ExpireCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time) error
+	RenewCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error
+	DeleteExpiredCredentials(ctx context.Context, now time.Time) (int, error)
 	// Access Request
 	AddRouteACL(ctx context.Context, routeID, allowedID string) error
 	RemoveRouteACL(ctx context.Context, routeID, revokedID string) error
 	AddQuota(ctx context.Context, routeID, allowedID, quotaInterval string, quotaLimit int) error
+	QuotaPlugin(ctx context.Context, quotaInterval string) (string, error)
+	RemoveQuota(ctx context.Context, routeID, allowedID string) error
+	// Consumer Groups
+	EnsureConsumerGroup(ctx context.Context, group, quotaInterval string, quotaLimit int) error
+	AddConsumerToGroup(ctx context.Context, group, consumerID string) error
+	RemoveConsumerFromGroup(ctx context.Context, group, consumerID string) error
+	ConsumerGroupsOfConsumer(ctx context.Context, consumerID string) ([]string, error)
 
 	ListServices(ctx context.Context) ([]*klib.Service, error)
 	ListRoutesForService(ctx context.Context, serviceId string) ([]*klib.Route, error)
@@ -65,6 +102,8 @@ type KongClient struct {
 	devPortalEnabled      bool
 	createUnstructuredAPI bool
 	clientTimeout         time.Duration
+	quota                 config.KongQuotaConfig
+	routeLocks            *routeLocks
 }
 
 func NewKongClient(kongConfig *config.KongGatewayConfig) (*KongClient, error) {
@@ -88,6 +127,14 @@ func NewKongClient(kongConfig *config.KongGatewayConfig) (*KongClient, error) {
 
 	logger := log.NewFieldLogger().WithComponent("client").WithPackage("kong")
 
+	if kongConfig.Audit.Enable {
+		adminURL, err := url.Parse(kongEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		baseClient.Transport = newAuditTransport(baseClient.Transport, audit.NewAuditor(kongConfig.Audit), adminURL.Path)
+	}
+
 	workspaceClients, err := createWorkspaceClients(baseClient, kongEndpoint, kongConfig.Workspaces)
 	if err != nil {
 		logger.WithError(err).Error("failed to create kong client")
@@ -104,6 +151,8 @@ func NewKongClient(kongConfig *config.KongGatewayConfig) (*KongClient, error) {
 		devPortalEnabled:      kongConfig.Spec.DevPortalEnabled,
 		createUnstructuredAPI: kongConfig.Spec.CreateUnstructuredAPI,
 		clientTimeout:         10 * time.Second,
+		quota:                 kongConfig.Quota,
+		routeLocks:            newRouteLocks(),
 	}, nil
 }
 
@@ -0,0 +1,149 @@
+package kong
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+)
+
+const (
+	// ConsumersCollection - the kong collection of consumers
+	ConsumersCollection = "consumers"
+	// orphanedTagPrefix - prefix of the tag holding the unix time an agent created entity was first found without
+	// its Central resource
+	orphanedTagPrefix = consumerTagPrefix + "orphaned:"
+)
+
+// OrphanedSince returns the time the entity with the tags was first found orphaned, false when it is not tagged orphaned
+func OrphanedSince(tags []*string) (time.Time, bool) {
+	for _, tag := range tags {
+		if tag == nil || !strings.HasPrefix(*tag, orphanedTagPrefix) {
+			continue
+		}
+		unix, err := strconv.ParseInt(strings.TrimPrefix(*tag, orphanedTagPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		return time.Unix(unix, 0), true
+	}
+	return time.Time{}, false
+}
+
+// SuspendedConsumerOf returns the id of the application consumer whose suspended credentials the consumer holds,
+// false when the consumer does not hold suspended credentials
+func SuspendedConsumerOf(consumer *klib.Consumer) (string, bool) {
+	if consumer.CustomID == nil || !strings.HasSuffix(*consumer.CustomID, suspendedConsumerSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(*consumer.CustomID, suspendedConsumerSuffix), true
+}
+
+// ListAgentCredentials returns the credentials of the workspace created by the agent, in every credential collection.
+// Collections of credential plugins not available on the gateway are skipped
+func (k KongClient) ListAgentCredentials(ctx context.Context) ([]ConsumerCredential, error) {
+	client := k.getWorkspaceClient(ctx)
+	credentials := []ConsumerCredential{}
+	for _, collection := range consumerCredentialCollections {
+		log := k.logger.WithField("collection", collection)
+		query := &credentialListQuery{Size: consumerPageSize, Tags: AgentCredentialTag}
+		for {
+			req, err := client.NewRequest(http.MethodGet, "/"+collection, query, nil)
+			if err != nil {
+				return nil, err
+			}
+			page := struct {
+				Data   []ConsumerCredential `json:"data"`
+				Offset string               `json:"offset"`
+			}{}
+			_, err = client.Do(ctx, req, &page)
+			if klib.IsNotFoundErr(err) {
+				log.Trace("credential collection not available")
+				break
+			}
+			if err != nil {
+				log.WithError(err).Error("failed to list agent credentials")
+				return nil, err
+			}
+			for _, credential := range page.Data {
+				credential.Collection = collection
+				credentials = append(credentials, credential)
+			}
+			if page.Offset == "" {
+				break
+			}
+			query.Offset = page.Offset
+		}
+	}
+	return credentials, nil
+}
+
+// QuarantineEntity tags the consumer, or credential, of the kong collection as orphaned since the time. The tag is
+// kept in kong, so the quarantine survives restarts
+func (k KongClient) QuarantineEntity(ctx context.Context, collection, id string, since time.Time) error {
+	return k.retagEntity(ctx, collection, id, func(tags []*string) []*string {
+		return append(withoutOrphanedTag(tags), klib.String(fmt.Sprintf("%s%d", orphanedTagPrefix, since.Unix())))
+	})
+}
+
+// ReleaseEntity removes the orphaned tag of the consumer, or credential, of the kong collection
+func (k KongClient) ReleaseEntity(ctx context.Context, collection, id string) error {
+	return k.retagEntity(ctx, collection, id, withoutOrphanedTag)
+}
+
+// DeleteEntity deletes the consumer, with its credentials, or the credential of the kong collection. An entity
+// that does not exist is left as is
+func (k KongClient) DeleteEntity(ctx context.Context, collection, id string) error {
+	log := k.logger.WithField("collection", collection).WithField("id", id)
+	client := k.getWorkspaceClient(ctx)
+	req, err := client.NewRequest(http.MethodDelete, fmt.Sprintf("/%s/%s", collection, id), nil, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, nil); err != nil && !klib.IsNotFoundErr(err) {
+		log.WithError(err).Error("failed to delete entity")
+		return err
+	}
+	return nil
+}
+
+func withoutOrphanedTag(tags []*string) []*string {
+	updated := []*string{}
+	for _, tag := range tags {
+		if tag == nil || strings.HasPrefix(*tag, orphanedTagPrefix) {
+			continue
+		}
+		updated = append(updated, tag)
+	}
+	return updated
+}
+
+func (k KongClient) retagEntity(ctx context.Context, collection, id string, retag func([]*string) []*string) error {
+	log := k.logger.WithField("collection", collection).WithField("id", id)
+	client := k.getWorkspaceClient(ctx)
+	endpoint := fmt.Sprintf("/%s/%s", collection, id)
+
+	req, err := client.NewRequest(http.MethodGet, endpoint, nil, nil)
+	if err != nil {
+		return err
+	}
+	tagged := taggedCredential{}
+	if _, err := client.Do(ctx, req, &tagged); err != nil {
+		log.WithError(err).Error("failed to get entity")
+		return err
+	}
+
+	req, err = client.NewRequest(http.MethodPatch, endpoint, nil, taggedCredential{Tags: retag(tagged.Tags)})
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, nil); err != nil {
+		log.WithError(err).Error("failed to tag entity")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package kong
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+func TestOrphanedSince(t *testing.T) {
+	since, ok := OrphanedSince(klib.StringSlice("axway-app:billing", "axway-orphaned:1700000000"))
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1700000000, 0), since)
+
+	_, ok = OrphanedSince(klib.StringSlice("axway-app:billing", "axway-orphaned:never"))
+	assert.False(t, ok)
+}
+
+func TestSuspendedConsumerOf(t *testing.T) {
+	id, ok := SuspendedConsumerOf(&klib.Consumer{CustomID: klib.String("consumerID-suspended")})
+	assert.True(t, ok)
+	assert.Equal(t, "consumerID", id)
+
+	_, ok = SuspendedConsumerOf(&klib.Consumer{CustomID: klib.String("appID")})
+	assert.False(t, ok)
+	_, ok = SuspendedConsumerOf(&klib.Consumer{})
+	assert.False(t, ok)
+}
+
+func TestListAgentCredentials(t *testing.T) {
+	client := createClient(map[string]response{
+		formatRequestKey(http.MethodGet, "/key-auths"): {
+			code: http.StatusOK,
+			dataIface: map[string]interface{}{"data": []map[string]interface{}{
+				{"id": "keyID", "consumer": map[string]string{"id": "consumerID"}, "tags": []string{AgentCredentialTag}},
+			}},
+		},
+		formatRequestKey(http.MethodGet, "/oauth2"): {
+			code: http.StatusOK,
+			dataIface: map[string]interface{}{"data": []map[string]interface{}{
+				{"id": "oauthID", "consumer": map[string]string{"id": "consumerID"}, "tags": []string{AgentCredentialTag}},
+			}},
+		},
+		formatRequestKey(http.MethodGet, "/basic-auths"): {code: http.StatusOK, dataIface: map[string]interface{}{"data": []interface{}{}}},
+		formatRequestKey(http.MethodGet, "/jwts"):        {code: http.StatusOK, dataIface: map[string]interface{}{"data": []interface{}{}}},
+		formatRequestKey(http.MethodGet, "/hmac-auths"):  {code: http.StatusOK, dataIface: map[string]interface{}{"data": []interface{}{}}},
+		// the mtls-auth plugin is not available on the gateway
+		formatRequestKey(http.MethodGet, "/mtls-auths"): {code: http.StatusNotFound},
+	})
+
+	credentials, err := client.ListAgentCredentials(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, credentials, 2)
+	assert.Equal(t, common.KeyAuthCredentials, credentials[0].Collection)
+	assert.Equal(t, "consumerID", *credentials[0].Consumer.ID)
+	assert.Equal(t, common.OAuth2Credentials, credentials[1].Collection)
+
+	client = createClient(map[string]response{
+		formatRequestKey(http.MethodGet, "/key-auths"): {code: http.StatusInternalServerError},
+	})
+	_, err = client.ListAgentCredentials(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestQuarantineEntity(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+	testCases := map[string]struct {
+		tags        []string
+		release     bool
+		patchCode   int
+		expectPatch []string
+		expectErr   bool
+	}{
+		"tags the entity orphaned": {
+			tags:        []string{"axway-app:billing"},
+			patchCode:   http.StatusOK,
+			expectPatch: []string{"axway-app:billing", "axway-orphaned:1700000000"},
+		},
+		"replaces the orphaned tag": {
+			tags:        []string{"axway-app:billing", "axway-orphaned:1600000000"},
+			patchCode:   http.StatusOK,
+			expectPatch: []string{"axway-app:billing", "axway-orphaned:1700000000"},
+		},
+		"releases the entity": {
+			tags:        []string{"axway-app:billing", "axway-orphaned:1600000000"},
+			release:     true,
+			patchCode:   http.StatusOK,
+			expectPatch: []string{"axway-app:billing"},
+		},
+		"error tagging": {
+			patchCode:   http.StatusInternalServerError,
+			expectPatch: []string{"axway-orphaned:1700000000"},
+			expectErr:   true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var patched []string
+			client := createHandlerClient(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/consumers/consumerID", req.URL.Path)
+				if req.Method == http.MethodPatch {
+					body := taggedCredential{}
+					data, _ := io.ReadAll(req.Body)
+					json.Unmarshal(data, &body)
+					patched = tagValues(body.Tags)
+					resp.WriteHeader(tc.patchCode)
+					return
+				}
+				data, _ := json.Marshal(taggedCredential{ID: klib.String("consumerID"), Tags: klib.StringSlice(tc.tags...)})
+				resp.Write(data)
+			}))
+
+			var err error
+			if tc.release {
+				err = client.ReleaseEntity(context.Background(), ConsumersCollection, "consumerID")
+			} else {
+				err = client.QuarantineEntity(context.Background(), ConsumersCollection, "consumerID", since)
+			}
+			if tc.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tc.expectPatch, patched)
+		})
+	}
+}
+
+func TestDeleteEntity(t *testing.T) {
+	testCases := map[string]struct {
+		code      int
+		expectErr bool
+	}{
+		"deleted":   {code: http.StatusNoContent},
+		"not found": {code: http.StatusNotFound},
+		"error":     {code: http.StatusInternalServerError, expectErr: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(map[string]response{
+				formatRequestKey(http.MethodDelete, "/key-auths/keyID"): {code: tc.code},
+			})
+			err := client.DeleteEntity(context.Background(), common.KeyAuthCredentials, "keyID")
+			if tc.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
@@ -14,6 +14,52 @@ type PluginLister interface {
 	ListAll(ctx context.Context) ([]*klib.Plugin, error)
 }
 
+// pluginScope describes which entities a plugin is attached to
+type pluginScope struct {
+	consumer      bool
+	consumerGroup bool
+	route         bool
+	service       bool
+}
+
+// pluginPrecedence lists the plugin scopes in the order Kong applies them, most specific first.
+// When the same plugin is configured on several scopes matching a request only the first one runs.
+var pluginPrecedence = []pluginScope{
+	{consumer: true, route: true, service: true},
+	{consumerGroup: true, route: true, service: true},
+	{consumer: true, route: true},
+	{consumer: true, service: true},
+	{consumerGroup: true, route: true},
+	{consumerGroup: true, service: true},
+	{route: true, service: true},
+	{consumer: true},
+	{consumerGroup: true},
+	{route: true},
+	{service: true},
+	{},
+}
+
+func scopeOf(plugin *klib.Plugin) pluginScope {
+	return pluginScope{
+		consumer:      plugin.Consumer != nil,
+		consumerGroup: plugin.ConsumerGroup != nil,
+		route:         plugin.Route != nil,
+		service:       plugin.Service != nil,
+	}
+}
+
+// precedence returns the rank of the plugin scope, lower ranks win
+func precedence(plugin *klib.Plugin) int {
+	scope := scopeOf(plugin)
+	for i, s := range pluginPrecedence {
+		if s == scope {
+			return i
+		}
+	}
+	// combinations Kong does not allow, e.g. consumer and consumer group, rank last
+	return len(pluginPrecedence)
+}
+
 // determines the most specific
 func mostSpecific(p1, p2 *klib.Plugin) *klib.Plugin {
 	if p1 == nil {
@@ -24,35 +70,45 @@ func mostSpecific(p1, p2 *klib.Plugin) *klib.Plugin {
 		return p1
 	}
 
-	if p1.Service != nil && p1.Route != nil { // can't be more specific than this
+	if precedence(p1) < precedence(p2) {
 		return p1
 	}
-	if p2.Service != nil && p2.Route != nil { // can't be more specific than this
-		return p2
-	}
+	return p2
+}
 
-	if p1.Route != nil { // route is more specific
-		return p1
-	}
+// pluginMatcher reports whether a plugin applies to the request being evaluated
+type pluginMatcher struct {
+	routeID          string
+	serviceID        string
+	consumerID       string
+	consumerGroupIDs map[string]struct{}
+}
 
-	if p2.Route != nil {
-		return p2
+func (m pluginMatcher) matches(plugin *klib.Plugin) bool {
+	if plugin.Enabled != nil && !*plugin.Enabled {
+		return false
 	}
-
-	if p1.Service != nil { //
-		return p1
+	if plugin.Route != nil && (plugin.Route.ID == nil || *plugin.Route.ID != m.routeID) {
+		return false
 	}
-
-	if p2.Service != nil { //
-		return p2
+	if plugin.Service != nil && (plugin.Service.ID == nil || *plugin.Service.ID != m.serviceID) {
+		return false
 	}
-
-	return p2
+	if plugin.Consumer != nil && (m.consumerID == "" || plugin.Consumer.ID == nil || *plugin.Consumer.ID != m.consumerID) {
+		return false
+	}
+	if plugin.ConsumerGroup != nil {
+		if plugin.ConsumerGroup.ID == nil {
+			return false
+		}
+		if _, ok := m.consumerGroupIDs[*plugin.ConsumerGroup.ID]; !ok {
+			return false
+		}
+	}
+	return true
 }
 
-// GetEffectivePlugins determines the effective plugin configuration for the route/service combination.
-// Returns a map containing effective Plugin configuration grouped by plugin type.
-func (p *Plugins) GetEffectivePlugins(routeID, serviceID string) (map[string]*klib.Plugin, error) {
+func (p *Plugins) effectivePlugins(m pluginMatcher) (map[string]*klib.Plugin, error) {
 	plugins, err := p.ListAll(context.Background())
 	if err != nil {
 		return nil, err
@@ -61,9 +117,7 @@ func (p *Plugins) GetEffectivePlugins(routeID, serviceID string) (map[string]*kl
 	pmap := map[string]*klib.Plugin{}
 
 	for _, plugin := range plugins {
-		if (plugin.Route != nil && (plugin.Route.ID == nil || *plugin.Route.ID != routeID)) ||
-			(plugin.Service != nil && (plugin.Service.ID == nil || *plugin.Service.ID != serviceID)) ||
-			!*plugin.Enabled {
+		if plugin.Name == nil || !m.matches(plugin) {
 			continue
 		}
 
@@ -72,3 +126,26 @@ func (p *Plugins) GetEffectivePlugins(routeID, serviceID string) (map[string]*kl
 
 	return pmap, nil
 }
+
+// GetEffectivePlugins determines the effective plugin configuration for the route/service combination.
+// Plugins scoped to a consumer or consumer group are ignored as they only apply to those consumers.
+// Returns a map containing effective Plugin configuration grouped by plugin type.
+func (p *Plugins) GetEffectivePlugins(routeID, serviceID string) (map[string]*klib.Plugin, error) {
+	return p.effectivePlugins(pluginMatcher{routeID: routeID, serviceID: serviceID})
+}
+
+// GetEffectiveConsumerPlugins determines the effective plugin configuration for requests made by a consumer,
+// member of the given consumer groups, to the route/service combination.
+// Returns a map containing effective Plugin configuration grouped by plugin type.
+func (p *Plugins) GetEffectiveConsumerPlugins(routeID, serviceID, consumerID string, consumerGroupIDs ...string) (map[string]*klib.Plugin, error) {
+	groups := make(map[string]struct{}, len(consumerGroupIDs))
+	for _, id := range consumerGroupIDs {
+		groups[id] = struct{}{}
+	}
+	return p.effectivePlugins(pluginMatcher{
+		routeID:          routeID,
+		serviceID:        serviceID,
+		consumerID:       consumerID,
+		consumerGroupIDs: groups,
+	})
+}
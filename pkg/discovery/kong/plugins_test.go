@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
 
 	"github.com/Axway/agents-kong/pkg/discovery/kong"
 )
@@ -97,6 +98,15 @@ func TestGetEffectivePlugins(t *testing.T) {
 			pwrs("5", "acl", "otherRoute", serviceID),
 		},
 		map[string]interface{}{"2": nil, "3": nil},
+	}, {
+		"consumer scoped plugins are ignored",
+		[]*klib.Plugin{
+			pws("1", "rate-limiting", serviceID),
+			scoped("2", "rate-limiting", "consumerID", "", routeID, serviceID),
+			scoped("3", "rate-limiting", "", "groupID", routeID, ""),
+			scoped("4", "acl", "consumerID", "", "", ""),
+		},
+		map[string]interface{}{"1": nil},
 	}}
 
 	for i := range testCases {
@@ -127,3 +137,129 @@ func TestGetEffectivePlugins(t *testing.T) {
 		})
 	}
 }
+
+// scoped creates a plugin attached to every non empty scope
+func scoped(id, name, consumerID, groupID, routeID, serviceID string) *klib.Plugin {
+	plugin := p(id, name)
+	if consumerID != "" {
+		plugin.Consumer = &klib.Consumer{ID: &consumerID}
+	}
+	if groupID != "" {
+		plugin.ConsumerGroup = &klib.ConsumerGroup{ID: &groupID}
+	}
+	if routeID != "" {
+		plugin.Route = &klib.Route{ID: &routeID}
+	}
+	if serviceID != "" {
+		plugin.Service = &klib.Service{ID: &serviceID}
+	}
+	return plugin
+}
+
+func TestGetEffectiveConsumerPlugins(t *testing.T) {
+	const (
+		routeID    = "routeID"
+		serviceID  = "serviceID"
+		consumerID = "consumerID"
+		groupID    = "groupID"
+	)
+
+	// every scope combination in Kong precedence order, most specific first
+	precedence := []*klib.Plugin{
+		scoped("consumer-route-service", "rate-limiting", consumerID, "", routeID, serviceID),
+		scoped("group-route-service", "rate-limiting", "", groupID, routeID, serviceID),
+		scoped("consumer-route", "rate-limiting", consumerID, "", routeID, ""),
+		scoped("consumer-service", "rate-limiting", consumerID, "", "", serviceID),
+		scoped("group-route", "rate-limiting", "", groupID, routeID, ""),
+		scoped("group-service", "rate-limiting", "", groupID, "", serviceID),
+		scoped("route-service", "rate-limiting", "", "", routeID, serviceID),
+		scoped("consumer", "rate-limiting", consumerID, "", "", ""),
+		scoped("group", "rate-limiting", "", groupID, "", ""),
+		scoped("route", "rate-limiting", "", "", routeID, ""),
+		scoped("service", "rate-limiting", "", "", "", serviceID),
+		scoped("global", "rate-limiting", "", "", "", ""),
+	}
+
+	testCases := map[string]struct {
+		plugins    []*klib.Plugin
+		consumerID string
+		groupIDs   []string
+		expected   map[string]string
+	}{
+		"no plugins": {
+			consumerID: consumerID,
+			expected:   map[string]string{},
+		},
+		"plugins on other consumers and groups are ignored": {
+			plugins: []*klib.Plugin{
+				scoped("other-consumer", "rate-limiting", "otherConsumer", "", routeID, serviceID),
+				scoped("other-group", "rate-limiting", "", "otherGroup", routeID, serviceID),
+				scoped("service", "rate-limiting", "", "", "", serviceID),
+			},
+			consumerID: consumerID,
+			groupIDs:   []string{groupID},
+			expected:   map[string]string{"rate-limiting": "service"},
+		},
+		"consumer group plugins require membership": {
+			plugins: []*klib.Plugin{
+				scoped("group", "rate-limiting", "", groupID, "", ""),
+				scoped("global", "rate-limiting", "", "", "", ""),
+			},
+			consumerID: consumerID,
+			expected:   map[string]string{"rate-limiting": "global"},
+		},
+		"disabled plugins are ignored": {
+			plugins: func() []*klib.Plugin {
+				disabled := scoped("consumer", "rate-limiting", consumerID, "", "", "")
+				disabled.Enabled = new(bool)
+				return []*klib.Plugin{disabled, scoped("route", "rate-limiting", "", "", routeID, "")}
+			}(),
+			consumerID: consumerID,
+			expected:   map[string]string{"rate-limiting": "route"},
+		},
+		"plugin types are resolved independently": {
+			plugins: []*klib.Plugin{
+				scoped("consumer", "rate-limiting", consumerID, "", "", ""),
+				scoped("route-acl", "acl", "", "", routeID, ""),
+				scoped("global-acl", "acl", "", "", "", ""),
+			},
+			consumerID: consumerID,
+			groupIDs:   []string{groupID},
+			expected:   map[string]string{"rate-limiting": "consumer", "acl": "route-acl"},
+		},
+	}
+
+	// each scope wins over every scope that follows it, regardless of listing order
+	for i := range precedence {
+		remaining := append([]*klib.Plugin{}, precedence[i:]...)
+		for l, r := 0, len(remaining)-1; l < r; l, r = l+1, r-1 {
+			remaining[l], remaining[r] = remaining[r], remaining[l]
+		}
+		testCases[*precedence[i].ID+" takes precedence"] = struct {
+			plugins    []*klib.Plugin
+			consumerID string
+			groupIDs   []string
+			expected   map[string]string
+		}{
+			plugins:    remaining,
+			consumerID: consumerID,
+			groupIDs:   []string{"otherGroup", groupID},
+			expected:   map[string]string{"rate-limiting": *precedence[i].ID},
+		}
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			plugins := kong.Plugins{pluginsMock(tc.plugins)}
+
+			res, err := plugins.GetEffectiveConsumerPlugins(routeID, serviceID, tc.consumerID, tc.groupIDs...)
+			assert.Nil(t, err)
+
+			actual := map[string]string{}
+			for name, plugin := range res {
+				actual[name] = *plugin.ID
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -2,15 +2,20 @@ package kong
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"unicode"
 
-	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
 	"github.com/Axway/agents-kong/pkg/common"
 	klib "github.com/kong/go-kong/kong"
 	"github.com/mitchellh/mapstructure"
 )
 
+const consumerTagPrefix = "axway-"
+
 type ACLConfig struct {
 	AllowedGroups    []string `json:"allow,omitempty" yaml:"allow,omitempty"`
 	DeniedGroups     []string `json:"deny,omitempty" yaml:"deny,omitempty"`
@@ -39,8 +44,106 @@ func (k KongClient) CreateConsumer(ctx context.Context, id, name string) (*klib.
 	return consumer, nil
 }
 
+// ConsumerTags returns the tags of the consumer of a managed application, i.e. axway-team:finance,
+// axway-app:billing and axway-env:kong, the team tag is left out for applications without a team
+func ConsumerTags(teamName, appName, envName string) []string {
+	tags := []string{}
+	if teamName != "" {
+		tags = append(tags, consumerTagPrefix+"team:"+tagValue(teamName))
+	}
+	return append(tags, consumerTagPrefix+"app:"+tagValue(appName), consumerTagPrefix+"env:"+tagValue(envName))
+}
+
+// tagValue replaces the characters kong does not allow in tags
+func tagValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ',' || r == '/' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return '-'
+		}
+		return r
+	}, value)
+}
+
+// EnsureConsumer returns the consumer of the custom id, or the existing consumer imported for the application name,
+// which is created with the tags when it does not exist, the missing tags are added to an existing consumer
+func (k KongClient) EnsureConsumer(ctx context.Context, id, name string, tags []string) (*klib.Consumer, error) {
+	log := k.logger.WithField("customID", id).WithField("consumerName", name)
+	consumer, err := k.getWorkspaceClient(ctx).Consumers.GetByCustomID(ctx, klib.String(id))
+	if err != nil && !klib.IsNotFoundErr(err) {
+		log.WithError(err).Error("failed to get consumer")
+		return nil, err
+	}
+
+	if err != nil {
+		consumer, err = k.getImportedConsumer(ctx, name)
+		if err != nil {
+			log.WithError(err).Error("failed to get imported consumer")
+			return nil, err
+		}
+	}
+
+	if consumer == nil {
+		log.Debug("creating new consumer")
+		consumer, err = k.getWorkspaceClient(ctx).Consumers.Create(ctx, &klib.Consumer{
+			CustomID: klib.String(id),
+			Username: klib.String(name),
+			Tags:     klib.StringSlice(tags...),
+		})
+		if err != nil {
+			log.WithError(err).Error("creating consumer")
+			return nil, err
+		}
+		return consumer, nil
+	}
+
+	missing := missingTags(consumer.Tags, tags)
+	if len(missing) == 0 {
+		log.Debug("found existing consumer")
+		return consumer, nil
+	}
+	log.WithField("tags", missing).Debug("tagging existing consumer")
+	consumer.Tags = append(consumer.Tags, klib.StringSlice(missing...)...)
+	consumer, err = k.getWorkspaceClient(ctx).Consumers.Update(ctx, consumer)
+	if err != nil {
+		log.WithError(err).Error("tagging consumer")
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// getImportedConsumer returns the consumer tagged to be linked to the application, nil when there is none
+func (k KongClient) getImportedConsumer(ctx context.Context, name string) (*klib.Consumer, error) {
+	consumers, _, err := k.getWorkspaceClient(ctx).Consumers.List(ctx, &klib.ListOpt{Size: 1, Tags: []*string{klib.String(ImportTag(name))}})
+	if err != nil || len(consumers) == 0 {
+		return nil, err
+	}
+	k.logger.WithField("consumerID", *consumers[0].ID).WithField("consumerName", name).Info("using imported consumer")
+	return consumers[0], nil
+}
+
+func missingTags(current []*string, tags []string) []string {
+	existing := map[string]bool{}
+	for _, tag := range current {
+		if tag != nil {
+			existing[*tag] = true
+		}
+	}
+	missing := []string{}
+	for _, tag := range tags {
+		if !existing[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
 func (k KongClient) AddConsumerACL(ctx context.Context, id string) error {
-	log := k.logger.WithField("consumerID", id)
+	return k.AddConsumerACLGroup(ctx, id, id)
+}
+
+// AddConsumerACLGroup adds the consumer to the acl group, used to grant a consumer the access of another consumer
+func (k KongClient) AddConsumerACLGroup(ctx context.Context, id, group string) error {
+	log := k.logger.WithField("consumerID", id).WithField("group", group)
 	consumer, err := k.getWorkspaceClient(ctx).Consumers.Get(ctx, klib.String(id))
 	if err != nil {
 		log.Debug("could not find consumer")
@@ -50,9 +153,13 @@ func (k KongClient) AddConsumerACL(ctx context.Context, id string) error {
 	log.Debug("adding consumer acl")
 	_, err = k.getWorkspaceClient(ctx).ACLs.Create(ctx, consumer.ID, &klib.ACLGroup{
 		Consumer: consumer,
-		Group:    klib.String(id),
+		Group:    klib.String(group),
 	})
 
+	if isConflictErr(err) {
+		log.Debug("consumer already in acl group")
+		return nil
+	}
 	if err != nil {
 		log.WithError(err).Error("adding acl to consumer")
 		return err
@@ -60,6 +167,12 @@ func (k KongClient) AddConsumerACL(ctx context.Context, id string) error {
 	return nil
 }
 
+// isConflictErr checks if the kong api rejected a create as the entity already exists
+func isConflictErr(err error) bool {
+	var apiErr *klib.APIError
+	return errors.As(err, &apiErr) && apiErr.Code() == http.StatusConflict
+}
+
 func (k KongClient) DeleteConsumer(ctx context.Context, id string) error {
 	// validate that the consumer has not already been removed
 	log := k.logger.WithField("consumerID", id)
@@ -124,100 +237,170 @@ func (k KongClient) CreateAuthKey(ctx context.Context, consumerID string, keyAut
 	return keyAuth, nil
 }
 
-func (k KongClient) AddRouteACL(ctx context.Context, routeID, allowedID string) error {
-	log := k.logger.WithField("consumerID", allowedID).WithField("routeID", routeID)
-	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAll(ctx)
+// AuthKeyExists returns true when a key-auth credential of the workspace has the key, kong finds key-auth
+// credentials by their id or key
+func (k KongClient) AuthKeyExists(ctx context.Context, key string) (bool, error) {
+	client := k.getWorkspaceClient(ctx)
+	req, err := client.NewRequest(http.MethodGet, fmt.Sprintf("/%s/%s", common.KeyAuthCredentials, url.PathEscape(key)), nil, nil)
 	if err != nil {
-		log.WithError(err).Error("failed to get plugins")
-		return err
+		return false, err
+	}
+	_, err = client.Do(ctx, req, nil)
+	if klib.IsNotFoundErr(err) {
+		return false, nil
 	}
-
-	log = log.WithField("plugin", common.AclPlugin)
-	aclPlugin, err := getSpecificPlugin(plugins, "", routeID, "", common.AclPlugin)
 	if err != nil {
-		log.WithError(err).Debug("no acl for route")
-		aclConfig := ACLConfig{
-			AllowedGroups: []string{allowedID},
-		}
-		err = k.createACL(ctx, aclConfig, routeID)
-		if err != nil {
-			log.WithError(err).Error("failed to create acl")
-			return err
-		}
+		k.logger.WithError(err).Error("failed to look up the api key")
+		return false, err
+	}
+	return true, nil
+}
 
-		log.Info("acl created, access granted")
-		return nil
+func (k KongClient) CreateJWT(ctx context.Context, consumerID string, jwt *klib.JWTAuth) (*klib.JWTAuth, error) {
+	jwt, err := k.getWorkspaceClient(ctx).JWTAuths.Create(ctx, &consumerID, jwt)
+	if err != nil {
+		k.logger.Errorf("failed to create jwt credential for consumerID %s. Reason: %w", consumerID, err)
+		return nil, err
 	}
+	return jwt, nil
+}
 
-	// verify if access is granted
-	var aclCfg ACLConfig
-	_, hasAccess := aclCfg.checkAccess(aclPlugin, allowedID)
-	if hasAccess {
-		log.Info("access is already granted")
-		return nil
+func (k KongClient) DeleteJWT(ctx context.Context, consumerID, jwtID string) error {
+	if err := k.getWorkspaceClient(ctx).JWTAuths.Delete(ctx, &consumerID, &jwtID); err != nil {
+		k.logger.Errorf("failed to delete jwt credential: %s for consumerID %s. Reason: %w", jwtID, consumerID, err)
+		return err
 	}
+	return nil
+}
 
-	// provide access to managed application
-	aclCfg.AllowedGroups = append(aclCfg.AllowedGroups, allowedID)
-	err = k.updateOrDeleteACL(ctx, aclPlugin, aclCfg, routeID)
+func (k KongClient) CreateHMAC(ctx context.Context, consumerID string, hmac *klib.HMACAuth) (*klib.HMACAuth, error) {
+	hmac, err := k.getWorkspaceClient(ctx).HMACAuths.Create(ctx, &consumerID, hmac)
 	if err != nil {
-		log.WithError(err).Error("failed to grant access")
+		k.logger.Errorf("failed to create hmac-auth credential for consumerID %s. Reason: %w", consumerID, err)
+		return nil, err
+	}
+	return hmac, nil
+}
+
+func (k KongClient) DeleteHMAC(ctx context.Context, consumerID, hmacID string) error {
+	if err := k.getWorkspaceClient(ctx).HMACAuths.Delete(ctx, &consumerID, &hmacID); err != nil {
+		k.logger.Errorf("failed to delete hmac-auth credential: %s for consumerID %s. Reason: %w", hmacID, consumerID, err)
 		return err
 	}
+	return nil
+}
+
+func (k KongClient) CreateMTLS(ctx context.Context, consumerID string, mtls *klib.MTLSAuth) (*klib.MTLSAuth, error) {
+	mtls, err := k.getWorkspaceClient(ctx).MTLSAuths.Create(ctx, &consumerID, mtls)
+	if err != nil {
+		k.logger.Errorf("failed to create mtls-auth credential for consumerID %s. Reason: %w", consumerID, err)
+		return nil, err
+	}
+	return mtls, nil
+}
 
-	log.Info("granted access")
+func (k KongClient) DeleteMTLS(ctx context.Context, consumerID, mtlsID string) error {
+	if err := k.getWorkspaceClient(ctx).MTLSAuths.Delete(ctx, &consumerID, &mtlsID); err != nil {
+		k.logger.Errorf("failed to delete mtls-auth credential: %s for consumerID %s. Reason: %w", mtlsID, consumerID, err)
+		return err
+	}
 	return nil
 }
 
+func (k KongClient) ListCACertificates(ctx context.Context) ([]*klib.CACertificate, error) {
+	return k.getWorkspaceClient(ctx).CACertificates.ListAll(ctx)
+}
+
+func (k KongClient) AddRouteACL(ctx context.Context, routeID, allowedID string) error {
+	_, err := k.changeRouteACL(ctx, routeID, aclChange{group: allowedID, allow: true})
+	return err
+}
+
 func (k KongClient) RemoveRouteACL(ctx context.Context, routeID, revokedID string) error {
 	log := k.logger.WithField("consumerID", revokedID).WithField("routeID", routeID)
-	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAll(ctx)
+	plugins, err := k.changeRouteACL(ctx, routeID, aclChange{group: revokedID})
 	if err != nil {
-		log.WithError(err).Error("failed to get plugins")
 		return err
 	}
 
-	log = log.WithField("plugin", common.AclPlugin)
-	aclPlugin, err := getSpecificPlugin(plugins, "", routeID, "", common.AclPlugin)
+	// delete the rate limiting plugins
+	for _, plugin := range getQuotaPlugins(plugins, routeID, revokedID) {
+		if err := k.deleteQuotaPlugin(ctx, routeID, plugin); err != nil {
+			log.WithError(err).WithField("plugin", *plugin.Name).Error("failed to delete plugin")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddQuota creates, or updates, the rate limiting plugin enforcing the quota of the consumer on the route
+func (k KongClient) AddQuota(ctx context.Context, routeID, managedAppID, quotaInterval string, quotaLimit int) error {
+	log := k.logger.WithField("consumerID", managedAppID).WithField("routeID", routeID)
+	pluginName, err := k.QuotaPlugin(ctx, quotaInterval)
 	if err != nil {
-		log.WithError(err).Error("failed to get plugin")
+		log.WithError(err).Error("quota not supported")
 		return err
 	}
 
-	// verify if access is granted
-	var aclCfg ACLConfig
-	i, hasAccess := aclCfg.checkAccess(aclPlugin, revokedID)
-	if !hasAccess {
-		log.Info("access is already denied")
-		return nil
+	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAll(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to get plugins")
+		return err
 	}
 
-	aclCfg.AllowedGroups = append(aclCfg.AllowedGroups[:i], aclCfg.AllowedGroups[i+1:]...)
-	err = k.updateOrDeleteACL(ctx, aclPlugin, aclCfg, routeID)
+	settings, err := k.quotaSettings(ctx, routeID)
 	if err != nil {
-		log.WithError(err).Error("failed to deny access")
+		log.WithError(err).Error("failed to get quota settings")
 		return err
 	}
+	config := quotaConfig(pluginName, quotaInterval, quotaLimit, settings)
 
-	// disable rate limiting plugin
-	log = log.WithField("plugin", common.RateLimitingPlugin)
-	rateLimitingPlugin, err := getSpecificPlugin(plugins, "", routeID, revokedID, common.RateLimitingPlugin)
-	if err != nil {
-		log.WithError(err).Debug("no plugin to disable")
+	// remove the quota plugins of the consumer that can not enforce the quota, i.e. after a change to a weekly quota
+	var rateLimitPlugin *klib.Plugin
+	for _, plugin := range getQuotaPlugins(plugins, routeID, managedAppID) {
+		if *plugin.Name == pluginName && rateLimitPlugin == nil {
+			rateLimitPlugin = plugin
+			continue
+		}
+		if err := k.deleteQuotaPlugin(ctx, routeID, plugin); err != nil {
+			log.WithError(err).WithField("plugin", *plugin.Name).Error("failed to delete plugin")
+			return err
+		}
+	}
+
+	log = log.WithField("plugin", pluginName)
+	if rateLimitPlugin == nil {
+		err = k.addRateLimitingPlugin(ctx, pluginName, config, routeID, managedAppID)
+		if err != nil {
+			log.WithError(err).Error("failed to add quota")
+			return err
+		}
+		log.Info("added quota")
+		return nil
+	}
+
+	// update the existing plugin when it does not enforce the quota
+	enabled := rateLimitPlugin.Enabled == nil || *rateLimitPlugin.Enabled
+	if enabled && QuotaMatches(rateLimitPlugin, quotaInterval, quotaLimit) &&
+		configContains(rateLimitPlugin.Config, quotaSettingsConfig(pluginName, settings)) {
+		log.Info("quota already enforced")
 		return nil
 	}
 
-	rateLimitingPlugin.Enabled = klib.Bool(false)
-	_, err = k.getWorkspaceClient(ctx).Plugins.UpdateForRoute(ctx, &routeID, rateLimitingPlugin)
+	rateLimitPlugin.Config = updatedQuotaConfig(pluginName, rateLimitPlugin.Config, config)
+	rateLimitPlugin.Enabled = klib.Bool(true)
+	_, err = k.getWorkspaceClient(ctx).Plugins.UpdateForRoute(ctx, &routeID, rateLimitPlugin)
 	if err != nil {
-		log.WithError(err).Error("failed to disable plugin")
+		log.WithError(err).Error("failed to update plugin")
 		return err
 	}
-
+	log.Info("updated quota")
 	return nil
 }
 
-func (k KongClient) AddQuota(ctx context.Context, routeID, managedAppID, quotaInterval string, quotaLimit int) error {
+// RemoveQuota deletes the rate limiting plugins of the consumer on the route
+func (k KongClient) RemoveQuota(ctx context.Context, routeID, managedAppID string) error {
 	log := k.logger.WithField("consumerID", managedAppID).WithField("routeID", routeID)
 	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAll(ctx)
 	if err != nil {
@@ -225,33 +408,27 @@ func (k KongClient) AddQuota(ctx context.Context, routeID, managedAppID, quotaIn
 		return err
 	}
 
-	// enable the rate limiting plugin if it already exists
-	log = log.WithField("plugin", common.RateLimitingPlugin)
-	rateLimitPlugin, err := getSpecificPlugin(plugins, "", routeID, managedAppID, common.RateLimitingPlugin)
-	if err == nil {
-		// plugin was found
-		if *rateLimitPlugin.Enabled {
-			log.Info("plugin already enabled")
-			return nil
-		} else {
-			rateLimitPlugin.Enabled = klib.Bool(true)
-			_, err := k.getWorkspaceClient(ctx).Plugins.UpdateForRoute(ctx, &routeID, rateLimitPlugin)
-			if err != nil {
-				log.WithError(err).Error("failed to update plugin")
-				return err
-			}
-			return nil
+	rateLimitPlugins := getQuotaPlugins(plugins, routeID, managedAppID)
+	if len(rateLimitPlugins) == 0 {
+		log.Info("no quota to remove")
+		return nil
+	}
+	for _, plugin := range rateLimitPlugins {
+		if err := k.deleteQuotaPlugin(ctx, routeID, plugin); err != nil {
+			log.WithError(err).WithField("plugin", *plugin.Name).Error("failed to delete plugin")
+			return err
 		}
 	}
 
-	// create plugin
-	config := setQuota(quotaInterval, quotaLimit)
-	err = k.addRateLimitingPlugin(ctx, config, routeID, managedAppID)
-	if err != nil {
-		log.WithError(err).Error("failed to add quota")
+	log.Info("removed quota")
+	return nil
+}
+
+func (k KongClient) deleteQuotaPlugin(ctx context.Context, routeID string, plugin *klib.Plugin) error {
+	err := k.getWorkspaceClient(ctx).Plugins.DeleteForRoute(ctx, &routeID, plugin.ID)
+	if err != nil && !klib.IsNotFoundErr(err) {
 		return err
 	}
-
 	return nil
 }
 
@@ -319,9 +496,9 @@ func (k KongClient) updateOrDeleteACL(ctx context.Context, aclPlugin *klib.Plugi
 	return nil
 }
 
-func (k KongClient) addRateLimitingPlugin(ctx context.Context, config map[string]interface{}, routeID, managedAppID string) error {
+func (k KongClient) addRateLimitingPlugin(ctx context.Context, pluginName string, config map[string]interface{}, routeID, managedAppID string) error {
 	rateLimitPlugin := klib.Plugin{
-		Name:   klib.String(common.RateLimitingPlugin),
+		Name:   klib.String(pluginName),
 		Config: config,
 		Consumer: &klib.Consumer{
 			ID: &managedAppID,
@@ -336,30 +513,14 @@ func (k KongClient) addRateLimitingPlugin(ctx context.Context, config map[string
 	return nil
 }
 
-func setQuota(quotaInterval string, quotaLimit int) klib.Configuration {
-	config := klib.Configuration{
-		"policy": "local",
-	}
-
-	switch strings.ToLower(quotaInterval) {
-	case provisioning.Daily.String():
-		config["day"] = quotaLimit
-	case provisioning.Monthly.String():
-		config["month"] = quotaLimit
-	case provisioning.Annually.String():
-		config["year"] = quotaLimit
-	}
-
-	return config
-}
-
 func getSpecificPlugin(plugins []*klib.Plugin, serviceID, routeID, consumerID, pluginName string) (*klib.Plugin, error) {
-	serviceMatch, routeMatch, consumerMatch := false, false, false
 	for _, plugin := range plugins {
 		if *plugin.Name != pluginName {
 			continue
 		}
 
+		serviceMatch, routeMatch, consumerMatch := false, false, false
+
 		if (consumerID == "" && plugin.Consumer == nil) || (consumerID != "" && plugin.Consumer != nil && *plugin.Consumer.ID == consumerID) {
 			consumerMatch = true
 		}
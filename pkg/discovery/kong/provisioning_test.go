@@ -78,7 +78,7 @@ func (mockKeyAuthService) ListForConsumer(ctx context.Context, consumerUsernameO
 }
 
 func createClient(responses map[string]response) KongAPIClient {
-	s := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+	return createHandlerClient(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		if res, found := responses[formatRequestKey(req.Method, req.URL.Path)]; found {
 			resp.WriteHeader(res.code)
 			if res.dataIface != nil {
@@ -90,6 +90,11 @@ func createClient(responses map[string]response) KongAPIClient {
 			return
 		}
 	}))
+}
+
+// createHandlerClient returns a client of a kong admin api served by the handler
+func createHandlerClient(handler http.Handler) *KongClient {
+	s := httptest.NewServer(handler)
 	u, _ := url.Parse(s.URL)
 	port, _ := strconv.Atoi(u.Port())
 	cfg := &config.KongGatewayConfig{
@@ -216,6 +221,110 @@ func TestCreateCredentials(t *testing.T) {
 	}
 }
 
+func TestEnsureConsumer(t *testing.T) {
+	tags := []string{"axway-app:app", "axway-env:env"}
+	testCases := map[string]struct {
+		expectErr  bool
+		expectTags []string
+		responses  map[string]response
+	}{
+		"create consumer": {
+			expectTags: tags,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Consumer{}},
+				},
+				formatRequestKey(http.MethodPost, "/consumers"): {
+					code: http.StatusCreated,
+					dataIface: &klib.Consumer{
+						ID:       klib.String("consumerID"),
+						CustomID: klib.String("appID"),
+						Tags:     klib.StringSlice(tags...),
+					},
+				},
+			},
+		},
+		"existing consumer with tags": {
+			expectTags: append([]string{"other"}, tags...),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers"): {
+					code: http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Consumer{{
+						ID:       klib.String("consumerID"),
+						CustomID: klib.String("appID"),
+						Tags:     klib.StringSlice(append(tags, "other")...),
+					}}},
+				},
+				formatRequestKey(http.MethodPatch, "/consumers/consumerID"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"existing consumer tagged": {
+			expectTags: append([]string{"other"}, tags...),
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers"): {
+					code: http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Consumer{{
+						ID:       klib.String("consumerID"),
+						CustomID: klib.String("appID"),
+						Tags:     klib.StringSlice("other"),
+					}}},
+				},
+				formatRequestKey(http.MethodPatch, "/consumers/consumerID"): {
+					code: http.StatusOK,
+					dataIface: &klib.Consumer{
+						ID:       klib.String("consumerID"),
+						CustomID: klib.String("appID"),
+						Tags:     klib.StringSlice(append([]string{"other"}, tags...)...),
+					},
+				},
+			},
+		},
+		"error getting consumer": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"error creating consumer": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Consumer{}},
+				},
+				formatRequestKey(http.MethodPost, "/consumers"): {
+					code: http.StatusConflict,
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			c, err := client.EnsureConsumer(context.TODO(), "appID", "app", tags)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "consumerID", *c.ID)
+			assert.ElementsMatch(t, klib.StringSlice(tc.expectTags...), c.Tags)
+		})
+	}
+}
+
+func TestConsumerTags(t *testing.T) {
+	assert.Equal(t,
+		[]string{"axway-team:finance-team", "axway-app:billing-app-v1", "axway-env:kong"},
+		ConsumerTags("finance team", "billing,app/v1", "kong"))
+	assert.Equal(t, []string{"axway-app:billing", "axway-env:kong"}, ConsumerTags("", "billing", "kong"))
+}
+
 func TestAddConsumerACL(t *testing.T) {
 	testCases := map[string]struct {
 		expectErr bool
@@ -245,6 +354,22 @@ func TestAddConsumerACL(t *testing.T) {
 				},
 			},
 		},
+		"consumer already in acl group": {
+			expectErr: false,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers/id"): {
+					code: http.StatusOK,
+					dataIface: &klib.Consumer{
+						ID:       klib.String("id"),
+						Username: klib.String("name"),
+					},
+				},
+				formatRequestKey(http.MethodPost, "/consumers/id/acls"): {
+					code:      http.StatusConflict,
+					dataIface: map[string]string{"message": "unique constraint violation"},
+				},
+			},
+		},
 		"add consumer acl error": {
 			expectErr: true,
 			responses: map[string]response{
@@ -331,6 +456,52 @@ func TestDeleteConsumer(t *testing.T) {
 	}
 }
 
+func TestAuthKeyExists(t *testing.T) {
+	testCases := map[string]struct {
+		expectErr    bool
+		expectExists bool
+		responses    map[string]response
+	}{
+		"key in use": {
+			expectExists: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/key-auths/my-key"): {
+					code:      http.StatusOK,
+					dataIface: &klib.KeyAuth{ID: klib.String("id"), Key: klib.String("my-key")},
+				},
+			},
+		},
+		"key not in use": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/key-auths/my-key"): {
+					code:      http.StatusNotFound,
+					dataIface: map[string]string{"message": "Not found"},
+				},
+			},
+		},
+		"lookup error": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/key-auths/my-key"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			exists, err := client.AuthKeyExists(context.TODO(), "my-key")
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectExists, exists)
+		})
+	}
+}
+
 func TestAddRouteACL(t *testing.T) {
 	testCases := map[string]struct {
 		expectErr  bool
@@ -426,6 +597,15 @@ func TestAddRouteACL(t *testing.T) {
 						},
 					},
 				},
+				formatRequestKey(http.MethodGet, "/plugins/aclPluginID"): {
+					code: http.StatusOK,
+					dataIface: &klib.Plugin{
+						ID:     klib.String("aclPluginID"),
+						Name:   klib.String(common.AclPlugin),
+						Route:  &klib.Route{ID: klib.String("routeID")},
+						Config: klib.Configuration{"allow": []string{"consumerID"}},
+					},
+				},
 			},
 		},
 	}
@@ -442,6 +622,42 @@ func TestAddRouteACL(t *testing.T) {
 	}
 }
 
+// revokedQuotaResponses returns the responses revoking the route access of consumerID, which has a quota
+func revokedQuotaResponses(deleteQuotaCode int) map[string]response {
+	return map[string]response{
+		formatRequestKey(http.MethodGet, "/plugins"): {
+			code: http.StatusOK,
+			dataIface: map[string]interface{}{
+				"data": []*klib.Plugin{
+					{
+						ID:     klib.String("aclPluginID"),
+						Name:   klib.String(common.AclPlugin),
+						Route:  &klib.Route{ID: klib.String("routeID")},
+						Config: klib.Configuration{"allow": []string{"consumerID"}},
+					},
+					{
+						ID:       klib.String("rateLimitingID"),
+						Name:     klib.String(common.RateLimitingPlugin),
+						Route:    &klib.Route{ID: klib.String("routeID")},
+						Consumer: &klib.Consumer{ID: klib.String("consumerID")},
+						Enabled:  klib.Bool(true),
+					},
+				},
+				"next": "null",
+			},
+		},
+		formatRequestKey(http.MethodDelete, "/routes/routeID/plugins/aclPluginID"): {
+			code: http.StatusNoContent,
+		},
+		formatRequestKey(http.MethodPatch, "/routes/routeID/plugins/rateLimitingID"): {
+			code: http.StatusInternalServerError,
+		},
+		formatRequestKey(http.MethodDelete, "/routes/routeID/plugins/rateLimitingID"): {
+			code: deleteQuotaCode,
+		},
+	}
+}
+
 func TestRemoveRouteACL(t *testing.T) {
 	testCases := map[string]struct {
 		expectErr  bool
@@ -502,52 +718,17 @@ func TestRemoveRouteACL(t *testing.T) {
 				},
 			},
 		},
-		"access revoked, rate limiting plugin disabled": {
+		"access revoked, rate limiting plugin deleted": {
 			expectErr:  false,
 			consumerID: "consumerID",
 			routeID:    "routeID",
-			responses: map[string]response{
-				formatRequestKey(http.MethodGet, "/plugins"): {
-					code: http.StatusOK,
-					dataIface: map[string]interface{}{
-						"data": []*klib.Plugin{
-							{
-								ID:   klib.String("aclPluginID"),
-								Name: klib.String(common.AclPlugin),
-								Route: &klib.Route{
-									ID: klib.String("routeID"),
-								},
-								Config: klib.Configuration{
-									"allow": []string{"consumerID"},
-								},
-							},
-							{
-								ID:   klib.String("rateLimitingID"),
-								Name: klib.String(common.RateLimitingPlugin),
-								Route: &klib.Route{
-									ID: klib.String("routeID"),
-								},
-								Enabled: klib.Bool(true),
-							},
-						},
-						"next": "null",
-					},
-				},
-				formatRequestKey(http.MethodDelete, "/routes/routeID/plugins/aclPluginID"): {
-					code: http.StatusNoContent,
-				},
-				formatRequestKey(http.MethodPatch, "/routes/routeID/plugins/rateLimitingID"): {
-					code: http.StatusOK,
-					dataIface: &klib.Plugin{
-						ID:   klib.String("rateLimitingID"),
-						Name: klib.String(common.RateLimitingPlugin),
-						Route: &klib.Route{
-							ID: klib.String("routeID"),
-						},
-						Enabled: klib.Bool(false),
-					},
-				},
-			},
+			responses:  revokedQuotaResponses(http.StatusNoContent),
+		},
+		"access revoked, error deleting rate limiting plugin": {
+			expectErr:  true,
+			consumerID: "consumerID",
+			routeID:    "routeID",
+			responses:  revokedQuotaResponses(http.StatusInternalServerError),
 		},
 	}
 	for name, tc := range testCases {
@@ -563,6 +744,23 @@ func TestRemoveRouteACL(t *testing.T) {
 	}
 }
 
+// consumerQuotaPlugins returns the plugins response with a quota plugin of consumerID on routeID
+func consumerQuotaPlugins(pluginName string, enabled bool, config klib.Configuration) map[string]interface{} {
+	return map[string]interface{}{
+		"data": []*klib.Plugin{
+			{
+				ID:       klib.String("rateLimitingID"),
+				Name:     klib.String(pluginName),
+				Route:    &klib.Route{ID: klib.String("routeID")},
+				Consumer: &klib.Consumer{ID: klib.String("consumerID")},
+				Enabled:  klib.Bool(enabled),
+				Config:   config,
+			},
+		},
+		"next": "null",
+	}
+}
+
 func TestAddQuota(t *testing.T) {
 	testCases := map[string]struct {
 		expectErr     bool
@@ -573,35 +771,101 @@ func TestAddQuota(t *testing.T) {
 		responses     map[string]response
 	}{
 		"rate limiting already enabled": {
-			expectErr:  false,
-			consumerID: "consumerID",
-			routeID:    "routeID",
+			expectErr:     false,
+			consumerID:    "consumerID",
+			routeID:       "routeID",
+			quotaInterval: provisioning.Daily.String(),
+			quotaLimit:    7,
 			responses: map[string]response{
 				formatRequestKey(http.MethodGet, "/plugins"): {
-					code: http.StatusOK,
-					dataIface: map[string]interface{}{
-						"data": []*klib.Plugin{
-							{
-								ID:   klib.String("rateLimitingID"),
-								Name: klib.String(common.RateLimitingPlugin),
-								Route: &klib.Route{
-									ID: klib.String("routeID"),
-								},
-								Enabled: klib.Bool(true),
-								Consumer: &klib.Consumer{
-									ID: klib.String("consumerID"),
-								},
-							},
-						},
-						"next": "null",
-					},
+					code:      http.StatusOK,
+					dataIface: consumerQuotaPlugins(common.RateLimitingPlugin, true, klib.Configuration{"day": 7, "policy": "local", "fault_tolerant": false, "hide_client_headers": false}),
+				},
+				formatRequestKey(http.MethodPatch, "/routes/routeID/plugins/rateLimitingID"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"rate limiting limit changed": {
+			consumerID:    "consumerID",
+			routeID:       "routeID",
+			quotaInterval: provisioning.Daily.String(),
+			quotaLimit:    7,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: consumerQuotaPlugins(common.RateLimitingPlugin, true, klib.Configuration{"hour": 5, "policy": "local", "fault_tolerant": false, "hide_client_headers": false}),
+				},
+				formatRequestKey(http.MethodPatch, "/routes/routeID/plugins/rateLimitingID"): {
+					code:      http.StatusOK,
+					dataIface: &klib.Plugin{ID: klib.String("rateLimitingID"), Name: klib.String(common.RateLimitingPlugin)},
+				},
+			},
+		},
+		"rate limiting policy changed": {
+			expectErr:     true,
+			consumerID:    "consumerID",
+			routeID:       "routeID",
+			quotaInterval: provisioning.Daily.String(),
+			quotaLimit:    7,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: consumerQuotaPlugins(common.RateLimitingPlugin, true, klib.Configuration{"day": 7, "policy": "cluster", "fault_tolerant": false, "hide_client_headers": false}),
+				},
+				formatRequestKey(http.MethodPatch, "/routes/routeID/plugins/rateLimitingID"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"quota changed to weekly": {
+			consumerID:    "consumerID",
+			routeID:       "routeID",
+			quotaInterval: provisioning.Weekly.String(),
+			quotaLimit:    7,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/schemas/plugins/"+RateLimitingAdvancedPlugin): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"fields": []interface{}{}},
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: consumerQuotaPlugins(common.RateLimitingPlugin, true, klib.Configuration{"day": 7, "policy": "local"}),
+				},
+				formatRequestKey(http.MethodDelete, "/routes/routeID/plugins/rateLimitingID"): {
+					code: http.StatusNoContent,
+				},
+				formatRequestKey(http.MethodPost, "/routes/routeID/plugins"): {
+					code:      http.StatusCreated,
+					dataIface: &klib.Plugin{ID: klib.String("rlaID"), Name: klib.String(RateLimitingAdvancedPlugin)},
+				},
+			},
+		},
+		"error removing previous quota plugin": {
+			expectErr:     true,
+			consumerID:    "consumerID",
+			routeID:       "routeID",
+			quotaInterval: provisioning.Weekly.String(),
+			quotaLimit:    7,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/schemas/plugins/"+RateLimitingAdvancedPlugin): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"fields": []interface{}{}},
+				},
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: consumerQuotaPlugins(common.RateLimitingPlugin, true, klib.Configuration{"day": 7, "policy": "local"}),
+				},
+				formatRequestKey(http.MethodDelete, "/routes/routeID/plugins/rateLimitingID"): {
+					code: http.StatusInternalServerError,
 				},
 			},
 		},
 		"enable rate limiting": {
-			expectErr:  false,
-			consumerID: "consumerID",
-			routeID:    "routeID",
+			expectErr:     false,
+			consumerID:    "consumerID",
+			routeID:       "routeID",
+			quotaInterval: provisioning.Daily.String(),
 			responses: map[string]response{
 				formatRequestKey(http.MethodGet, "/plugins"): {
 					code: http.StatusOK,
@@ -678,3 +942,73 @@ func TestAddQuota(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveQuota(t *testing.T) {
+	rateLimitingPlugins := map[string]interface{}{
+		"data": []*klib.Plugin{
+			{
+				ID:       klib.String("rateLimitingID"),
+				Name:     klib.String(common.RateLimitingPlugin),
+				Route:    &klib.Route{ID: klib.String("routeID")},
+				Consumer: &klib.Consumer{ID: klib.String("consumerID")},
+				Enabled:  klib.Bool(false),
+			},
+		},
+		"next": "null",
+	}
+	testCases := map[string]struct {
+		expectErr bool
+		responses map[string]response
+	}{
+		"no rate limiting plugin": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Plugin{}, "next": "null"},
+				},
+			},
+		},
+		"rate limiting plugin deleted": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: rateLimitingPlugins,
+				},
+				formatRequestKey(http.MethodDelete, "/routes/routeID/plugins/rateLimitingID"): {
+					code: http.StatusNoContent,
+				},
+			},
+		},
+		"delete fails": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code:      http.StatusOK,
+					dataIface: rateLimitingPlugins,
+				},
+				formatRequestKey(http.MethodDelete, "/routes/routeID/plugins/rateLimitingID"): {
+					code: http.StatusBadRequest,
+				},
+			},
+		},
+		"list plugins fails": {
+			expectErr: true,
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/plugins"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			err := client.RemoveQuota(context.TODO(), "routeID", "consumerID")
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
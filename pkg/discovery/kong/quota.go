@@ -0,0 +1,288 @@
+package kong
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/config"
+)
+
+// the rate limit periods of the central quota intervals
+var quotaIntervalPeriods = map[string]string{
+	provisioning.Minute.String():   "minute",
+	provisioning.Hourly.String():   "hour",
+	provisioning.Daily.String():    "day",
+	provisioning.Weekly.String():   "week",
+	provisioning.Monthly.String():  "month",
+	provisioning.Annually.String(): "year",
+}
+
+// QuotaPeriod returns the rate-limiting config field limiting the quota interval, empty when not supported
+func QuotaPeriod(quotaInterval string) string {
+	period := quotaIntervalPeriods[strings.ToLower(quotaInterval)]
+	if period == "week" {
+		// the rate-limiting plugin has no weekly limit
+		return ""
+	}
+	return period
+}
+
+// quotaWindow returns the period and length in seconds of the quota interval, 0 when not supported
+func quotaWindow(quotaInterval string) (string, int64) {
+	period := quotaIntervalPeriods[strings.ToLower(quotaInterval)]
+	return period, periodSeconds(period)
+}
+
+// QuotaPlugin returns the plugin enforcing quotas of the interval, rate-limiting when it has a field for the interval
+// and otherwise rate-limiting-advanced, when available on the gateway, with a sliding window of the interval length
+func (k KongClient) QuotaPlugin(ctx context.Context, quotaInterval string) (string, error) {
+	if QuotaPeriod(quotaInterval) != "" {
+		return common.RateLimitingPlugin, nil
+	}
+	if _, seconds := quotaWindow(quotaInterval); seconds == 0 {
+		return "", fmt.Errorf("%s quota interval is not supported", quotaInterval)
+	}
+
+	_, err := k.getWorkspaceClient(ctx).Plugins.GetFullSchema(ctx, klib.String(RateLimitingAdvancedPlugin))
+	if err != nil {
+		k.logger.WithError(err).WithField("plugin", RateLimitingAdvancedPlugin).Debug("plugin not available")
+		return "", fmt.Errorf("%s quota interval requires the %s plugin", quotaInterval, RateLimitingAdvancedPlugin)
+	}
+	return RateLimitingAdvancedPlugin, nil
+}
+
+// quotaConfig returns the config of the quota plugin limiting each consumer to the quota
+func quotaConfig(pluginName, quotaInterval string, quotaLimit int, settings config.KongQuotaConfig) klib.Configuration {
+	if pluginName == RateLimitingAdvancedPlugin {
+		_, seconds := quotaWindow(quotaInterval)
+		config := rateLimitingAdvancedSettings(settings)
+		config["limit"] = []interface{}{quotaLimit}
+		config["window_size"] = []interface{}{seconds}
+		config["window_type"] = "sliding"
+		config["identifier"] = "consumer"
+		return config
+	}
+
+	config := rateLimitingSettings(settings)
+	if period := QuotaPeriod(quotaInterval); period != "" {
+		config[period] = quotaLimit
+	}
+	return config
+}
+
+func quotaPolicy(settings config.KongQuotaConfig) string {
+	if settings.Policy == "" {
+		return config.QuotaPolicyLocal
+	}
+	return settings.Policy
+}
+
+// rateLimitingSettings returns the rate-limiting plugin config of the quota settings
+func rateLimitingSettings(settings config.KongQuotaConfig) klib.Configuration {
+	policy := quotaPolicy(settings)
+	cfg := klib.Configuration{
+		"policy":              policy,
+		"fault_tolerant":      settings.FaultTolerant,
+		"hide_client_headers": settings.HideClientHeaders,
+	}
+	if policy != config.QuotaPolicyRedis {
+		return cfg
+	}
+
+	redis := settings.Redis
+	cfg["redis_host"] = redis.Host
+	cfg["redis_port"] = redis.Port
+	cfg["redis_database"] = redis.Database
+	cfg["redis_timeout"] = redis.Timeout
+	cfg["redis_ssl"] = redis.SSL
+	cfg["redis_ssl_verify"] = redis.SSLVerify
+	if redis.Username != "" {
+		cfg["redis_username"] = redis.Username
+	}
+	if redis.Password != "" {
+		cfg["redis_password"] = redis.Password
+	}
+	if redis.ServerName != "" {
+		cfg["redis_server_name"] = redis.ServerName
+	}
+	return cfg
+}
+
+// rateLimitingAdvancedSettings returns the rate-limiting-advanced plugin config of the quota settings, counters of
+// the cluster and redis strategies are synchronized on every request
+func rateLimitingAdvancedSettings(settings config.KongQuotaConfig) klib.Configuration {
+	policy := quotaPolicy(settings)
+	cfg := klib.Configuration{
+		"strategy":            policy,
+		"sync_rate":           0,
+		"hide_client_headers": settings.HideClientHeaders,
+	}
+	if policy == config.QuotaPolicyLocal {
+		cfg["sync_rate"] = -1
+	}
+	if policy != config.QuotaPolicyRedis {
+		return cfg
+	}
+
+	redis := settings.Redis
+	redisCfg := map[string]interface{}{
+		"host":       redis.Host,
+		"port":       redis.Port,
+		"database":   redis.Database,
+		"timeout":    redis.Timeout,
+		"ssl":        redis.SSL,
+		"ssl_verify": redis.SSLVerify,
+	}
+	if redis.Username != "" {
+		redisCfg["username"] = redis.Username
+	}
+	if redis.Password != "" {
+		redisCfg["password"] = redis.Password
+	}
+	if redis.ServerName != "" {
+		redisCfg["server_name"] = redis.ServerName
+	}
+	cfg["redis"] = redisCfg
+	return cfg
+}
+
+// policyMatches checks that the rate-limiting-advanced plugin config enforces the policy of the quota settings
+func policyMatches(pluginConfig klib.Configuration, settings config.KongQuotaConfig) bool {
+	return configContains(pluginConfig, rateLimitingAdvancedSettings(settings))
+}
+
+// configContains checks that the plugin config has the values, nested configs may have other values
+func configContains(pluginConfig, values map[string]interface{}) bool {
+	for key, value := range values {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			if !sameValue(pluginConfig[key], value) {
+				return false
+			}
+			continue
+		}
+		pluginNested, _ := pluginConfig[key].(map[string]interface{})
+		if !configContains(pluginNested, nested) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameValue compares config values, numbers of the kong api are decoded as floats
+func sameValue(current, desired interface{}) bool {
+	currentNumber, currentIsNumber := toFloat(current)
+	desiredNumber, desiredIsNumber := toFloat(desired)
+	if currentIsNumber && desiredIsNumber {
+		return currentNumber == desiredNumber
+	}
+	return fmt.Sprint(current) == fmt.Sprint(desired)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// quotaSettings returns the quota settings of the workspace, and of the tags of the route service when there are
+// tag overrides
+func (k KongClient) quotaSettings(ctx context.Context, routeID string) (config.KongQuotaConfig, error) {
+	workspace := common.GetStringValueFromCtx(ctx, common.ContextWorkspace)
+	if workspace == "" {
+		workspace = common.DefaultWorkspace
+	}
+	if routeID == "" || !k.quota.HasTagOverrides() {
+		return k.quota.Settings(workspace, nil)
+	}
+
+	route, err := k.getWorkspaceClient(ctx).Routes.Get(ctx, klib.String(routeID))
+	if err != nil {
+		return k.quota, err
+	}
+	tags := []string{}
+	if route != nil && route.Service != nil && route.Service.ID != nil {
+		service, err := k.getWorkspaceClient(ctx).Services.Get(ctx, route.Service.ID)
+		if err != nil {
+			return k.quota, err
+		}
+		if service == nil {
+			return k.quota.Settings(workspace, nil)
+		}
+		for _, tag := range service.Tags {
+			if tag != nil {
+				tags = append(tags, *tag)
+			}
+		}
+	}
+	return k.quota.Settings(workspace, tags)
+}
+
+// QuotaMatches checks that the rate-limiting, or rate-limiting-advanced, plugin enforces only the quota
+func QuotaMatches(plugin *klib.Plugin, quotaInterval string, quotaLimit int) bool {
+	if plugin == nil || plugin.Name == nil {
+		return false
+	}
+	limits, err := NewRateLimitsFromPlugin(*plugin.Name, plugin.Config)
+	if err != nil || len(limits) != 1 {
+		return false
+	}
+	period, _ := quotaWindow(quotaInterval)
+	return limits[0].Period == period && limits[0].Limit == int64(quotaLimit)
+}
+
+// getQuotaPlugins returns the rate-limiting, and rate-limiting-advanced, plugins of the consumer on the route
+func getQuotaPlugins(plugins []*klib.Plugin, routeID, consumerID string) []*klib.Plugin {
+	quotaPlugins := []*klib.Plugin{}
+	for _, plugin := range plugins {
+		if plugin.Name == nil || (*plugin.Name != common.RateLimitingPlugin && *plugin.Name != RateLimitingAdvancedPlugin) {
+			continue
+		}
+		if plugin.Service != nil || plugin.Route == nil || plugin.Route.ID == nil || *plugin.Route.ID != routeID {
+			continue
+		}
+		if plugin.Consumer == nil || plugin.Consumer.ID == nil || *plugin.Consumer.ID != consumerID {
+			continue
+		}
+		quotaPlugins = append(quotaPlugins, plugin)
+	}
+	return quotaPlugins
+}
+
+// quotaSettingsConfig returns the plugin config of the quota settings, without the limits
+func quotaSettingsConfig(pluginName string, settings config.KongQuotaConfig) klib.Configuration {
+	if pluginName == RateLimitingAdvancedPlugin {
+		return rateLimitingAdvancedSettings(settings)
+	}
+	return rateLimitingSettings(settings)
+}
+
+// updatedQuotaConfig returns the plugin config enforcing the quota, keeping the other settings of the current config
+func updatedQuotaConfig(pluginName string, current, desired klib.Configuration) klib.Configuration {
+	updated := klib.Configuration{}
+	for key, value := range current {
+		updated[key] = value
+	}
+	if pluginName == common.RateLimitingPlugin {
+		// clear the limits of the previous quota
+		for period := range (RateLimitPeriodsConfig{}).limits() {
+			updated[period] = nil
+		}
+	}
+	for key, value := range desired {
+		updated[key] = value
+	}
+	return updated
+}
@@ -0,0 +1,373 @@
+package kong
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/config"
+)
+
+func TestQuotaPeriod(t *testing.T) {
+	testCases := map[string]string{
+		provisioning.Minute.String():   "minute",
+		provisioning.Hourly.String():   "hour",
+		provisioning.Daily.String():    "day",
+		provisioning.Weekly.String():   "",
+		provisioning.Monthly.String():  "month",
+		provisioning.Annually.String(): "year",
+		"Daily":                        "day",
+		"fortnightly":                  "",
+	}
+	for interval, expected := range testCases {
+		t.Run(interval, func(t *testing.T) {
+			assert.Equal(t, expected, QuotaPeriod(interval))
+		})
+	}
+}
+
+func TestQuotaPlugin(t *testing.T) {
+	testCases := map[string]struct {
+		quotaInterval string
+		schemaCode    int
+		expected      string
+		expectErr     bool
+	}{
+		"hourly quota": {
+			quotaInterval: provisioning.Hourly.String(),
+			schemaCode:    http.StatusNotFound,
+			expected:      common.RateLimitingPlugin,
+		},
+		"weekly quota": {
+			quotaInterval: provisioning.Weekly.String(),
+			schemaCode:    http.StatusOK,
+			expected:      RateLimitingAdvancedPlugin,
+		},
+		"weekly quota without rate-limiting-advanced": {
+			quotaInterval: provisioning.Weekly.String(),
+			schemaCode:    http.StatusNotFound,
+			expectErr:     true,
+		},
+		"unknown quota interval": {
+			quotaInterval: "fortnightly",
+			schemaCode:    http.StatusOK,
+			expectErr:     true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(map[string]response{
+				formatRequestKey(http.MethodGet, "/schemas/plugins/"+RateLimitingAdvancedPlugin): {
+					code:      tc.schemaCode,
+					dataIface: map[string]interface{}{"fields": []interface{}{}},
+				},
+			})
+			plugin, err := client.QuotaPlugin(context.TODO(), tc.quotaInterval)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, plugin)
+		})
+	}
+}
+
+func TestQuotaConfig(t *testing.T) {
+	redis := config.KongQuotaRedisConfig{Host: "redis", Port: 6379, Timeout: 2000, Password: "secret"}
+	testCases := map[string]struct {
+		pluginName string
+		interval   string
+		settings   config.KongQuotaConfig
+		expected   klib.Configuration
+	}{
+		"rate-limiting default policy": {
+			pluginName: common.RateLimitingPlugin,
+			interval:   provisioning.Minute.String(),
+			expected: klib.Configuration{
+				"policy":              "local",
+				"fault_tolerant":      false,
+				"hide_client_headers": false,
+				"minute":              5,
+			},
+		},
+		"rate-limiting cluster policy": {
+			pluginName: common.RateLimitingPlugin,
+			interval:   provisioning.Daily.String(),
+			settings:   config.KongQuotaConfig{Policy: config.QuotaPolicyCluster, FaultTolerant: true, HideClientHeaders: true},
+			expected: klib.Configuration{
+				"policy":              "cluster",
+				"fault_tolerant":      true,
+				"hide_client_headers": true,
+				"day":                 5,
+			},
+		},
+		"rate-limiting redis policy": {
+			pluginName: common.RateLimitingPlugin,
+			interval:   provisioning.Hourly.String(),
+			settings:   config.KongQuotaConfig{Policy: config.QuotaPolicyRedis, Redis: redis},
+			expected: klib.Configuration{
+				"policy":              "redis",
+				"fault_tolerant":      false,
+				"hide_client_headers": false,
+				"redis_host":          "redis",
+				"redis_port":          6379,
+				"redis_password":      "secret",
+				"redis_database":      0,
+				"redis_timeout":       2000,
+				"redis_ssl":           false,
+				"redis_ssl_verify":    false,
+				"hour":                5,
+			},
+		},
+		"rate-limiting-advanced local policy": {
+			pluginName: RateLimitingAdvancedPlugin,
+			interval:   provisioning.Weekly.String(),
+			expected: klib.Configuration{
+				"strategy":            "local",
+				"sync_rate":           -1,
+				"hide_client_headers": false,
+				"limit":               []interface{}{5},
+				"window_size":         []interface{}{int64(604800)},
+				"window_type":         "sliding",
+				"identifier":          "consumer",
+			},
+		},
+		"rate-limiting-advanced redis policy": {
+			pluginName: RateLimitingAdvancedPlugin,
+			interval:   provisioning.Weekly.String(),
+			settings:   config.KongQuotaConfig{Policy: config.QuotaPolicyRedis, Redis: redis},
+			expected: klib.Configuration{
+				"strategy":            "redis",
+				"sync_rate":           0,
+				"hide_client_headers": false,
+				"redis": map[string]interface{}{
+					"host":       "redis",
+					"port":       6379,
+					"password":   "secret",
+					"database":   0,
+					"timeout":    2000,
+					"ssl":        false,
+					"ssl_verify": false,
+				},
+				"limit":       []interface{}{5},
+				"window_size": []interface{}{int64(604800)},
+				"window_type": "sliding",
+				"identifier":  "consumer",
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, quotaConfig(tc.pluginName, tc.interval, 5, tc.settings))
+		})
+	}
+}
+
+func TestQuotaSettings(t *testing.T) {
+	quota := config.KongQuotaConfig{
+		Policy:    config.QuotaPolicyLocal,
+		Overrides: `{"workspaces":{"team":{"policy":"cluster"}},"tags":{"shared":{"policy":"redis","redis":{"host":"redis"}}}}`,
+	}
+	testCases := map[string]struct {
+		workspace   string
+		routeID     string
+		serviceTags []*string
+		routeCode   int
+		expected    string
+		expectErr   bool
+	}{
+		"global policy": {
+			routeID:  "route",
+			expected: config.QuotaPolicyLocal,
+		},
+		"workspace policy": {
+			workspace: "team",
+			routeID:   "route",
+			expected:  config.QuotaPolicyCluster,
+		},
+		"service tag policy": {
+			workspace:   "team",
+			routeID:     "route",
+			serviceTags: []*string{klib.String("other"), klib.String("shared")},
+			expected:    config.QuotaPolicyRedis,
+		},
+		"consumer group without route": {
+			workspace: "team",
+			expected:  config.QuotaPolicyCluster,
+		},
+		"route not found": {
+			routeID:   "route",
+			routeCode: http.StatusNotFound,
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			routeCode := http.StatusOK
+			if tc.routeCode != 0 {
+				routeCode = tc.routeCode
+			}
+			client := createClient(map[string]response{
+				formatRequestKey(http.MethodGet, "/routes/route"): {
+					code:      routeCode,
+					dataIface: &klib.Route{ID: klib.String("route"), Service: &klib.Service{ID: klib.String("service")}},
+				},
+				formatRequestKey(http.MethodGet, "/services/service"): {
+					code:      http.StatusOK,
+					dataIface: &klib.Service{ID: klib.String("service"), Tags: tc.serviceTags},
+				},
+			}).(*KongClient)
+			client.quota = quota
+			client.workspaceClients["team"] = client.workspaceClients[common.DefaultWorkspace]
+
+			ctx := context.TODO()
+			if tc.workspace != "" {
+				ctx = context.WithValue(ctx, common.ContextWorkspace, tc.workspace)
+			}
+			settings, err := client.quotaSettings(ctx, tc.routeID)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, settings.Policy)
+		})
+	}
+}
+
+func TestPolicyMatches(t *testing.T) {
+	settings := config.KongQuotaConfig{Policy: config.QuotaPolicyRedis, Redis: config.KongQuotaRedisConfig{Host: "redis", Port: 6379}}
+	pluginConfig := klib.Configuration{
+		"strategy":            "redis",
+		"sync_rate":           float64(0),
+		"hide_client_headers": false,
+		"redis": map[string]interface{}{
+			"host":            "redis",
+			"port":            float64(6379),
+			"database":        float64(0),
+			"timeout":         float64(0),
+			"ssl":             false,
+			"ssl_verify":      false,
+			"sentinel_master": nil,
+		},
+	}
+	assert.True(t, policyMatches(pluginConfig, settings))
+
+	settings.Redis.Host = "other"
+	assert.False(t, policyMatches(pluginConfig, settings))
+	assert.False(t, policyMatches(pluginConfig, config.KongQuotaConfig{}))
+}
+
+func TestQuotaMatches(t *testing.T) {
+	testCases := map[string]struct {
+		plugin   *klib.Plugin
+		interval string
+		limit    int
+		expected bool
+	}{
+		"rate-limiting matches": {
+			plugin: &klib.Plugin{
+				Name:   klib.String(common.RateLimitingPlugin),
+				Config: klib.Configuration{"hour": float64(1e6), "policy": "local"},
+			},
+			interval: provisioning.Hourly.String(),
+			limit:    1000000,
+			expected: true,
+		},
+		"rate-limiting limit differs": {
+			plugin: &klib.Plugin{
+				Name:   klib.String(common.RateLimitingPlugin),
+				Config: klib.Configuration{"hour": float64(10)},
+			},
+			interval: provisioning.Hourly.String(),
+			limit:    5,
+		},
+		"rate-limiting has other limits": {
+			plugin: &klib.Plugin{
+				Name:   klib.String(common.RateLimitingPlugin),
+				Config: klib.Configuration{"hour": float64(10), "day": float64(100)},
+			},
+			interval: provisioning.Hourly.String(),
+			limit:    10,
+		},
+		"rate-limiting-advanced matches": {
+			plugin: &klib.Plugin{
+				Name:   klib.String(RateLimitingAdvancedPlugin),
+				Config: klib.Configuration{"limit": []interface{}{float64(10)}, "window_size": []interface{}{float64(604800)}},
+			},
+			interval: provisioning.Weekly.String(),
+			limit:    10,
+			expected: true,
+		},
+		"rate-limiting-advanced window differs": {
+			plugin: &klib.Plugin{
+				Name:   klib.String(RateLimitingAdvancedPlugin),
+				Config: klib.Configuration{"limit": []interface{}{float64(10)}, "window_size": []interface{}{float64(86400)}},
+			},
+			interval: provisioning.Weekly.String(),
+			limit:    10,
+		},
+		"no plugin": {
+			interval: provisioning.Weekly.String(),
+			limit:    10,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, QuotaMatches(tc.plugin, tc.interval, tc.limit))
+		})
+	}
+}
+
+func TestGetQuotaPlugins(t *testing.T) {
+	plugins := []*klib.Plugin{
+		{
+			ID:       klib.String("otherRoute"),
+			Name:     klib.String(common.RateLimitingPlugin),
+			Route:    &klib.Route{ID: klib.String("route2")},
+			Consumer: &klib.Consumer{ID: klib.String("consumer1")},
+		},
+		{
+			ID:       klib.String("otherConsumer"),
+			Name:     klib.String(common.RateLimitingPlugin),
+			Route:    &klib.Route{ID: klib.String("route1")},
+			Consumer: &klib.Consumer{ID: klib.String("consumer2")},
+		},
+		{
+			ID:       klib.String("weekly"),
+			Name:     klib.String(RateLimitingAdvancedPlugin),
+			Route:    &klib.Route{ID: klib.String("route1")},
+			Consumer: &klib.Consumer{ID: klib.String("consumer1")},
+		},
+	}
+
+	quotaPlugins := getQuotaPlugins(plugins, "route1", "consumer1")
+	assert.Len(t, quotaPlugins, 1)
+	assert.Equal(t, "weekly", *quotaPlugins[0].ID)
+
+	assert.Len(t, getQuotaPlugins(plugins, "route2", "consumer2"), 0)
+}
+
+func TestUpdatedQuotaConfig(t *testing.T) {
+	current := klib.Configuration{"hour": float64(10), "day": float64(100), "policy": "local", "limit_by": "consumer"}
+	desired := quotaConfig(common.RateLimitingPlugin, provisioning.Monthly.String(), 500, config.KongQuotaConfig{})
+	updated := updatedQuotaConfig(common.RateLimitingPlugin, current, desired)
+	assert.Nil(t, updated["hour"])
+	assert.Nil(t, updated["day"])
+	assert.Equal(t, 500, updated["month"])
+	assert.Equal(t, "consumer", updated["limit_by"])
+	assert.Equal(t, float64(10), current["hour"])
+
+	current = klib.Configuration{"limit": []interface{}{float64(10)}, "window_size": []interface{}{float64(604800)}, "namespace": "ns"}
+	desired = quotaConfig(RateLimitingAdvancedPlugin, provisioning.Weekly.String(), 20, config.KongQuotaConfig{})
+	updated = updatedQuotaConfig(RateLimitingAdvancedPlugin, current, desired)
+	assert.Equal(t, []interface{}{20}, updated["limit"])
+	assert.Equal(t, "ns", updated["namespace"])
+}
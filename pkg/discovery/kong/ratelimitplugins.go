@@ -0,0 +1,180 @@
+package kong
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+const (
+	RateLimitingAdvancedPlugin = "rate-limiting-advanced"
+	ResponseRateLimitingPlugin = "response-ratelimiting"
+)
+
+// RateLimitPlugins - the plugins limiting the request rate, in the order they are published
+var RateLimitPlugins = []string{common.RateLimitingPlugin, RateLimitingAdvancedPlugin, ResponseRateLimitingPlugin}
+
+// rate limit periods and their length in seconds, shortest first
+var rateLimitPeriods = []struct {
+	name    string
+	seconds int64
+}{
+	{"second", 1},
+	{"minute", 60},
+	{"hour", 3600},
+	{"day", 86400},
+	{"week", 604800},
+	{"month", 2592000},
+	{"year", 31536000},
+}
+
+// RateLimit - a single limit enforced by a rate limiting plugin
+type RateLimit struct {
+	Plugin string
+	// Name - the response-ratelimiting limit name, empty for the other plugins
+	Name       string
+	Period     string
+	Limit      int64
+	Policy     string
+	LimitBy    string
+	WindowType string
+}
+
+// RateLimitPeriodsConfig - the limits per period of the rate-limiting and response-ratelimiting plugins
+type RateLimitPeriodsConfig struct {
+	Second *float64 `json:"second,omitempty"`
+	Minute *float64 `json:"minute,omitempty"`
+	Hour   *float64 `json:"hour,omitempty"`
+	Day    *float64 `json:"day,omitempty"`
+	Month  *float64 `json:"month,omitempty"`
+	Year   *float64 `json:"year,omitempty"`
+}
+
+func (c RateLimitPeriodsConfig) limits() map[string]*float64 {
+	return map[string]*float64{
+		"second": c.Second,
+		"minute": c.Minute,
+		"hour":   c.Hour,
+		"day":    c.Day,
+		"month":  c.Month,
+		"year":   c.Year,
+	}
+}
+
+type RateLimitingPluginConfig struct {
+	RateLimitPeriodsConfig
+	LimitBy string `json:"limit_by,omitempty"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+type RateLimitingAdvancedPluginConfig struct {
+	Limit      []float64 `json:"limit,omitempty"`
+	WindowSize []float64 `json:"window_size,omitempty"`
+	WindowType string    `json:"window_type,omitempty"`
+	Identifier string    `json:"identifier,omitempty"`
+	Strategy   string    `json:"strategy,omitempty"`
+}
+
+type ResponseRateLimitingPluginConfig struct {
+	Limits  map[string]RateLimitPeriodsConfig `json:"limits,omitempty"`
+	LimitBy string                            `json:"limit_by,omitempty"`
+	Policy  string                            `json:"policy,omitempty"`
+}
+
+func decodePluginConfig(mapData map[string]interface{}, config interface{}) error {
+	// Convert map to json string
+	jsonStr, err := json.Marshal(mapData)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonStr, config)
+}
+
+// NewRateLimitsFromPlugin returns the limits configured on one of the RateLimitPlugins, shortest period first
+func NewRateLimitsFromPlugin(pluginName string, mapData map[string]interface{}) ([]RateLimit, error) {
+	switch pluginName {
+	case common.RateLimitingPlugin:
+		config := &RateLimitingPluginConfig{}
+		if err := decodePluginConfig(mapData, config); err != nil {
+			return nil, err
+		}
+		base := RateLimit{Plugin: pluginName, Policy: config.Policy, LimitBy: config.LimitBy}
+		return periodRateLimits(base, config.RateLimitPeriodsConfig), nil
+	case RateLimitingAdvancedPlugin:
+		config := &RateLimitingAdvancedPluginConfig{}
+		if err := decodePluginConfig(mapData, config); err != nil {
+			return nil, err
+		}
+		if len(config.Limit) != len(config.WindowSize) {
+			return nil, fmt.Errorf("%s limit and window_size lengths differ", pluginName)
+		}
+		limits := make([]RateLimit, 0, len(config.Limit))
+		for i := range config.Limit {
+			limits = append(limits, RateLimit{
+				Plugin:     pluginName,
+				Period:     windowPeriod(int64(config.WindowSize[i])),
+				Limit:      int64(config.Limit[i]),
+				Policy:     config.Strategy,
+				LimitBy:    config.Identifier,
+				WindowType: config.WindowType,
+			})
+		}
+		return limits, nil
+	case ResponseRateLimitingPlugin:
+		config := &ResponseRateLimitingPluginConfig{}
+		if err := decodePluginConfig(mapData, config); err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(config.Limits))
+		for name := range config.Limits {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		limits := []RateLimit{}
+		for _, name := range names {
+			base := RateLimit{Plugin: pluginName, Name: name, Policy: config.Policy, LimitBy: config.LimitBy}
+			limits = append(limits, periodRateLimits(base, config.Limits[name])...)
+		}
+		return limits, nil
+	}
+	return nil, fmt.Errorf("%s is not a rate limiting plugin", pluginName)
+}
+
+func periodRateLimits(base RateLimit, config RateLimitPeriodsConfig) []RateLimit {
+	limits := []RateLimit{}
+	configured := config.limits()
+	for _, period := range rateLimitPeriods {
+		limit := configured[period.name]
+		if limit == nil {
+			continue
+		}
+		rl := base
+		rl.Period = period.name
+		rl.Limit = int64(*limit)
+		limits = append(limits, rl)
+	}
+	return limits
+}
+
+// periodSeconds returns the length of the period in seconds, 0 for unknown periods
+func periodSeconds(period string) int64 {
+	for _, p := range rateLimitPeriods {
+		if p.name == period {
+			return p.seconds
+		}
+	}
+	return 0
+}
+
+// windowPeriod names the rate-limiting-advanced window, windows not matching a period are named by their size
+func windowPeriod(seconds int64) string {
+	for _, period := range rateLimitPeriods {
+		if period.seconds == seconds {
+			return period.name
+		}
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
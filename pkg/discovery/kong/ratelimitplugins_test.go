@@ -0,0 +1,87 @@
+package kong
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+func TestNewRateLimitsFromPlugin(t *testing.T) {
+	testCases := map[string]struct {
+		plugin       string
+		config       map[string]interface{}
+		expectErr    bool
+		expectLimits []RateLimit
+	}{
+		"rate-limiting periods shortest first": {
+			plugin: common.RateLimitingPlugin,
+			config: map[string]interface{}{
+				"day":      1000,
+				"second":   5,
+				"minute":   nil,
+				"policy":   "redis",
+				"limit_by": "consumer",
+			},
+			expectLimits: []RateLimit{
+				{Plugin: common.RateLimitingPlugin, Period: "second", Limit: 5, Policy: "redis", LimitBy: "consumer"},
+				{Plugin: common.RateLimitingPlugin, Period: "day", Limit: 1000, Policy: "redis", LimitBy: "consumer"},
+			},
+		},
+		"rate-limiting-advanced windows": {
+			plugin: RateLimitingAdvancedPlugin,
+			config: map[string]interface{}{
+				"limit":       []interface{}{10, 500},
+				"window_size": []interface{}{60, 7200},
+				"window_type": "sliding",
+				"identifier":  "ip",
+				"strategy":    "cluster",
+			},
+			expectLimits: []RateLimit{
+				{Plugin: RateLimitingAdvancedPlugin, Period: "minute", Limit: 10, Policy: "cluster", LimitBy: "ip", WindowType: "sliding"},
+				{Plugin: RateLimitingAdvancedPlugin, Period: "7200s", Limit: 500, Policy: "cluster", LimitBy: "ip", WindowType: "sliding"},
+			},
+		},
+		"rate-limiting-advanced mismatched windows": {
+			plugin: RateLimitingAdvancedPlugin,
+			config: map[string]interface{}{
+				"limit":       []interface{}{10, 500},
+				"window_size": []interface{}{60},
+			},
+			expectErr: true,
+		},
+		"response-ratelimiting limits by name": {
+			plugin: ResponseRateLimitingPlugin,
+			config: map[string]interface{}{
+				"limits": map[string]interface{}{
+					"videos": map[string]interface{}{"minute": 10},
+					"images": map[string]interface{}{"hour": 100, "second": 2},
+				},
+				"policy": "local",
+			},
+			expectLimits: []RateLimit{
+				{Plugin: ResponseRateLimitingPlugin, Name: "images", Period: "second", Limit: 2, Policy: "local"},
+				{Plugin: ResponseRateLimitingPlugin, Name: "images", Period: "hour", Limit: 100, Policy: "local"},
+				{Plugin: ResponseRateLimitingPlugin, Name: "videos", Period: "minute", Limit: 10, Policy: "local"},
+			},
+		},
+		"not a rate limiting plugin": {
+			plugin:    KeyAuthPlugin,
+			config:    map[string]interface{}{},
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			limits, err := NewRateLimitsFromPlugin(tc.plugin, tc.config)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectLimits, limits)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package kong
+
+import (
+	"strings"
+)
+
+// RedactedValue - replaces secret values in redacted plugin configurations
+const RedactedValue = "<redacted>"
+
+// parts of the config field and header names that hold secrets
+var secretNameParts = []string{"password", "secret", "token", "private", "credential", "apikey", "api_key", "authorization", "cookie", "session"}
+
+// config fields holding the names of secrets, not their values
+var secretNameFields = []string{"key_names", "header_names", "cookie_names", "uri_param_names", "session_cookie_name", "token_endpoint_auth_method"}
+
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range secretNameFields {
+		if name == field {
+			return false
+		}
+	}
+	if name == "key" || strings.HasSuffix(name, "_key") || strings.HasSuffix(name, "-key") {
+		return true
+	}
+	for _, part := range secretNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactPluginConfig returns a copy of the plugin config without empty fields, with secret values replaced
+func RedactPluginConfig(config map[string]interface{}) map[string]interface{} {
+	redacted := map[string]interface{}{}
+	for name, value := range config {
+		if value == nil {
+			continue
+		}
+		if isSecretName(name) {
+			redacted[name] = RedactedValue
+			continue
+		}
+		redacted[name] = redactValue(value)
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return RedactPluginConfig(v)
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, redactValue(item))
+		}
+		return list
+	case []string:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, redactValue(item))
+		}
+		return list
+	case string:
+		return redactHeader(v)
+	}
+	return value
+}
+
+// redactHeader redacts the value of header entries, i.e. "Authorization:Bearer abc" in request-transformer configs
+func redactHeader(value string) string {
+	name, _, found := strings.Cut(value, ":")
+	if !found || strings.ContainsAny(name, " /") || !isSecretName(name) {
+		return value
+	}
+	return name + ":" + RedactedValue
+}
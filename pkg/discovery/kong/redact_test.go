@@ -0,0 +1,67 @@
+package kong
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactPluginConfig(t *testing.T) {
+	testCases := map[string]struct {
+		config map[string]interface{}
+		expect map[string]interface{}
+	}{
+		"empty fields are removed": {
+			config: map[string]interface{}{"origins": []interface{}{"*"}, "max_age": nil},
+			expect: map[string]interface{}{"origins": []interface{}{"*"}},
+		},
+		"secret fields are redacted": {
+			config: map[string]interface{}{
+				"client_secret":  "abc",
+				"redis_password": "abc",
+				"key":            "abc",
+				"private_key":    "abc",
+				"provision_key":  "abc",
+				"key_names":      []interface{}{"apikey"},
+				"policy":         "redis",
+			},
+			expect: map[string]interface{}{
+				"client_secret":  RedactedValue,
+				"redis_password": RedactedValue,
+				"key":            RedactedValue,
+				"private_key":    RedactedValue,
+				"provision_key":  RedactedValue,
+				"key_names":      []interface{}{"apikey"},
+				"policy":         "redis",
+			},
+		},
+		"nested secret fields are redacted": {
+			config: map[string]interface{}{
+				"redis": map[string]interface{}{"host": "redis", "password": "abc", "username": nil},
+			},
+			expect: map[string]interface{}{
+				"redis": map[string]interface{}{"host": "redis", "password": RedactedValue},
+			},
+		},
+		"secret header values are redacted": {
+			config: map[string]interface{}{
+				"add": map[string]interface{}{
+					"headers": []string{"Authorization:Bearer abc", "X-Api-Key:abc", "X-Request-Source:kong"},
+					"body":    []interface{}{"path:/v1/pets"},
+				},
+			},
+			expect: map[string]interface{}{
+				"add": map[string]interface{}{
+					"headers": []interface{}{"Authorization:" + RedactedValue, "X-Api-Key:" + RedactedValue, "X-Request-Source:kong"},
+					"body":    []interface{}{"path:/v1/pets"},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, RedactPluginConfig(tc.config))
+		})
+	}
+}
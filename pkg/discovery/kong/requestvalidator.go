@@ -0,0 +1,173 @@
+package kong
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const RequestValidatorPlugin = "request-validator"
+
+// request-validator schema versions
+const (
+	RequestValidatorKongSchema   = "kong"
+	RequestValidatorDraft4Schema = "draft4"
+)
+
+const defaultValidatorContentType = "application/json"
+
+// RequestValidatorParameter - a parameter validated by the request-validator plugin
+type RequestValidatorParameter struct {
+	In       string `json:"in,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Required bool   `json:"required,omitempty"`
+	Style    string `json:"style,omitempty"`
+	Explode  bool   `json:"explode,omitempty"`
+	Schema   string `json:"schema,omitempty"`
+}
+
+// JSONSchema - the parameter schema, parameter schemas are always draft4 json schemas
+func (p RequestValidatorParameter) JSONSchema() (map[string]interface{}, error) {
+	schema := map[string]interface{}{}
+	if p.Schema == "" {
+		return schema, nil
+	}
+	if err := json.Unmarshal([]byte(p.Schema), &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema for %s parameter %s: %w", p.In, p.Name, err)
+	}
+	return schema, nil
+}
+
+type RequestValidatorPluginConfig struct {
+	BodySchema          string                      `json:"body_schema,omitempty"`
+	AllowedContentTypes []string                    `json:"allowed_content_types,omitempty"`
+	ParameterSchema     []RequestValidatorParameter `json:"parameter_schema,omitempty"`
+	Version             string                      `json:"version,omitempty"`
+}
+
+func NewRequestValidatorPluginConfigFromMap(mapData map[string]interface{}) (*RequestValidatorPluginConfig, error) {
+	// Convert map to json string
+	jsonStr, err := json.Marshal(mapData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &RequestValidatorPluginConfig{}
+	if err := json.Unmarshal(jsonStr, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ContentTypes - the body content types the plugin accepts
+func (c *RequestValidatorPluginConfig) ContentTypes() []string {
+	if len(c.AllowedContentTypes) == 0 {
+		return []string{defaultValidatorContentType}
+	}
+	return c.AllowedContentTypes
+}
+
+// BodyJSONSchema - the body schema as json schema, nil when the plugin does not validate the body
+func (c *RequestValidatorPluginConfig) BodyJSONSchema() (map[string]interface{}, error) {
+	if c.BodySchema == "" {
+		return nil, nil
+	}
+
+	if c.Version == RequestValidatorDraft4Schema {
+		schema := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(c.BodySchema), &schema); err != nil {
+			return nil, fmt.Errorf("invalid body schema: %w", err)
+		}
+		return schema, nil
+	}
+
+	// the kong schema format is a list of single field records
+	fields := []map[string]map[string]interface{}{}
+	if err := json.Unmarshal([]byte(c.BodySchema), &fields); err != nil {
+		return nil, fmt.Errorf("invalid kong body schema: %w", err)
+	}
+	return kongRecordSchema(fields), nil
+}
+
+func kongRecordSchema(fields []map[string]map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []interface{}{}
+	for _, field := range fields {
+		for name, def := range field {
+			properties[name] = kongFieldSchema(def)
+			if r, ok := def["required"].(bool); ok && r {
+				required = append(required, name)
+			}
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// kongFieldSchema converts a kong schema field definition to json schema
+func kongFieldSchema(def map[string]interface{}) map[string]interface{} {
+	schema := map[string]interface{}{}
+	switch t, _ := def["type"].(string); t {
+	case "string", "number", "integer", "boolean":
+		schema["type"] = t
+	case "array", "set":
+		schema["type"] = "array"
+		if elements, ok := def["elements"].(map[string]interface{}); ok {
+			schema["items"] = kongFieldSchema(elements)
+		}
+		if t == "set" {
+			schema["uniqueItems"] = true
+		}
+	case "record":
+		schema = kongRecordSchema(recordFields(def["fields"]))
+	case "map":
+		schema["type"] = "object"
+		if values, ok := def["values"].(map[string]interface{}); ok {
+			schema["additionalProperties"] = kongFieldSchema(values)
+		}
+	}
+
+	if d, ok := def["default"]; ok {
+		schema["default"] = d
+	}
+	if oneOf, ok := def["one_of"].([]interface{}); ok {
+		schema["enum"] = oneOf
+	}
+	if between, ok := def["between"].([]interface{}); ok && len(between) == 2 {
+		schema["minimum"] = between[0]
+		schema["maximum"] = between[1]
+	}
+	if l, ok := def["len_min"]; ok {
+		schema["minLength"] = l
+	}
+	if l, ok := def["len_max"]; ok {
+		schema["maxLength"] = l
+	}
+	return schema
+}
+
+func recordFields(value interface{}) []map[string]map[string]interface{} {
+	fields := []map[string]map[string]interface{}{}
+	list, _ := value.([]interface{})
+	for _, item := range list {
+		field, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		converted := map[string]map[string]interface{}{}
+		for name, def := range field {
+			if d, ok := def.(map[string]interface{}); ok {
+				converted[name] = d
+			}
+		}
+		fields = append(fields, converted)
+	}
+	return fields
+}
@@ -0,0 +1,93 @@
+package kong
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestValidatorBodyJSONSchema(t *testing.T) {
+	testCases := map[string]struct {
+		config       map[string]interface{}
+		expectErr    bool
+		expectSchema map[string]interface{}
+	}{
+		"no body schema": {
+			config: map[string]interface{}{},
+		},
+		"draft4 body schema": {
+			config: map[string]interface{}{
+				"version":     RequestValidatorDraft4Schema,
+				"body_schema": `{"type":"object","properties":{"name":{"type":"string"}}}`,
+			},
+			expectSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+			},
+		},
+		"invalid draft4 body schema": {
+			config: map[string]interface{}{
+				"version":     RequestValidatorDraft4Schema,
+				"body_schema": `{"type":`,
+			},
+			expectErr: true,
+		},
+		"kong body schema": {
+			config: map[string]interface{}{
+				"body_schema": `[
+					{"name": {"type": "string", "required": true, "len_min": 1}},
+					{"age": {"type": "integer", "between": [0, 150]}},
+					{"kind": {"type": "string", "one_of": ["cat", "dog"], "default": "cat"}},
+					{"tags": {"type": "set", "elements": {"type": "string"}}},
+					{"labels": {"type": "map", "keys": {"type": "string"}, "values": {"type": "number"}}},
+					{"owner": {"type": "record", "fields": [{"email": {"type": "string", "required": true}}]}}
+				]`,
+			},
+			expectSchema: map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"name"},
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string", "minLength": float64(1)},
+					"age":  map[string]interface{}{"type": "integer", "minimum": float64(0), "maximum": float64(150)},
+					"kind": map[string]interface{}{"type": "string", "enum": []interface{}{"cat", "dog"}, "default": "cat"},
+					"tags": map[string]interface{}{
+						"type":        "array",
+						"uniqueItems": true,
+						"items":       map[string]interface{}{"type": "string"},
+					},
+					"labels": map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": map[string]interface{}{"type": "number"},
+					},
+					"owner": map[string]interface{}{
+						"type":       "object",
+						"required":   []interface{}{"email"},
+						"properties": map[string]interface{}{"email": map[string]interface{}{"type": "string"}},
+					},
+				},
+			},
+		},
+		"invalid kong body schema": {
+			config: map[string]interface{}{
+				"version":     RequestValidatorKongSchema,
+				"body_schema": `{"name": {"type": "string"}}`,
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config, err := NewRequestValidatorPluginConfigFromMap(tc.config)
+			assert.Nil(t, err)
+
+			schema, err := config.BodyJSONSchema()
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectSchema, schema)
+		})
+	}
+}
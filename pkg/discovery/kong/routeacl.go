@@ -0,0 +1,182 @@
+package kong
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+// the attempts to change a route acl that other processes change concurrently
+const aclChangeAttempts = 5
+
+var errACLConflict = errors.New("route acl changed concurrently")
+
+// routeLocks serializes the acl changes of the agent per route, a lock is removed once no change holds or waits on it
+type routeLocks struct {
+	mu    sync.Mutex
+	locks map[string]*routeLock
+}
+
+// routeLock - the lock of a route, refs counts the changes holding or waiting on the lock
+type routeLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newRouteLocks() *routeLocks {
+	return &routeLocks{locks: map[string]*routeLock{}}
+}
+
+// lock locks the route of the workspace and returns the func unlocking it
+func (r *routeLocks) lock(workspace, routeID string) func() {
+	key := workspace + "/" + routeID
+	r.mu.Lock()
+	l, ok := r.locks[key]
+	if !ok {
+		l = &routeLock{}
+		r.locks[key] = l
+	}
+	l.refs++
+	r.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		r.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(r.locks, key)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// aclChange - a group to allow, or revoke, on a route acl
+type aclChange struct {
+	group string
+	allow bool
+}
+
+// changeRouteACL applies the change to the route acl and returns the plugins read before the change. The changes of
+// the agent are serialized per route, the change is read back and applied again to the latest acl when another process
+// changed the acl concurrently. Kong has no plugin versions, a change written right after the read back is not
+// detected, the drift reconciliation repairs it.
+func (k KongClient) changeRouteACL(ctx context.Context, routeID string, change aclChange) ([]*klib.Plugin, error) {
+	workspace := common.GetStringValueFromCtx(ctx, common.ContextWorkspace)
+	if workspace == "" {
+		workspace = common.DefaultWorkspace
+	}
+	unlock := k.routeLocks.lock(workspace, routeID)
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		plugins, err := k.tryChangeRouteACL(ctx, routeID, change)
+		if err == nil || !errors.Is(err, errACLConflict) || attempt == aclChangeAttempts {
+			return plugins, err
+		}
+		k.logger.
+			WithField("consumerID", change.group).
+			WithField("routeID", routeID).
+			WithField("attempt", attempt).
+			Warn("acl changed concurrently, retrying")
+	}
+}
+
+func (k KongClient) tryChangeRouteACL(ctx context.Context, routeID string, change aclChange) ([]*klib.Plugin, error) {
+	log := k.logger.WithField("consumerID", change.group).WithField("routeID", routeID)
+	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAll(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to get plugins")
+		return nil, err
+	}
+
+	log = log.WithField("plugin", common.AclPlugin)
+	aclPlugin, err := getSpecificPlugin(plugins, "", routeID, "", common.AclPlugin)
+	if err != nil && !change.allow {
+		log.WithError(err).Error("failed to get plugin")
+		return plugins, err
+	}
+	if err != nil {
+		log.WithError(err).Debug("no acl for route")
+		aclConfig := ACLConfig{
+			AllowedGroups: []string{change.group},
+		}
+		err = k.createACL(ctx, aclConfig, routeID)
+		if isACLConflict(err) {
+			// another process created the acl
+			return plugins, errACLConflict
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to create acl")
+			return plugins, err
+		}
+
+		log.Info("acl created, access granted")
+		return plugins, nil
+	}
+
+	// verify if access is already granted, or denied
+	var aclCfg ACLConfig
+	i, hasAccess := aclCfg.checkAccess(aclPlugin, change.group)
+	if hasAccess && change.allow {
+		log.Info("access is already granted")
+		return plugins, nil
+	}
+	if !hasAccess && !change.allow {
+		log.Info("access is already denied")
+		return plugins, nil
+	}
+
+	if change.allow {
+		aclCfg.AllowedGroups = append(aclCfg.AllowedGroups, change.group)
+	} else {
+		aclCfg.AllowedGroups = append(aclCfg.AllowedGroups[:i], aclCfg.AllowedGroups[i+1:]...)
+	}
+	err = k.updateOrDeleteACL(ctx, aclPlugin, aclCfg, routeID)
+	if isACLConflict(err) {
+		// another process deleted the acl
+		return plugins, errACLConflict
+	}
+	if err != nil && change.allow {
+		log.WithError(err).Error("failed to grant access")
+		return plugins, err
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to deny access")
+		return plugins, err
+	}
+	if len(aclCfg.AllowedGroups) == 0 {
+		log.Info("acl deleted, access denied")
+		return plugins, nil
+	}
+
+	// read back the acl to detect changes of other processes overwriting the change
+	current, err := k.getWorkspaceClient(ctx).Plugins.Get(ctx, aclPlugin.ID)
+	if isACLConflict(err) {
+		return plugins, errACLConflict
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to read back acl")
+		return plugins, err
+	}
+	var currentCfg ACLConfig
+	if _, hasAccess = currentCfg.checkAccess(current, change.group); hasAccess != change.allow {
+		return plugins, errACLConflict
+	}
+
+	if change.allow {
+		log.Info("granted access")
+	} else {
+		log.Info("denied access")
+	}
+	return plugins, nil
+}
+
+// isACLConflict checks if the kong api rejected an acl change due to a change of another process
+func isACLConflict(err error) bool {
+	return isConflictErr(err) || klib.IsNotFoundErr(err)
+}
@@ -0,0 +1,280 @@
+package kong
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+// fakeACLAdmin - a kong admin api keeping the acl plugin of a single route
+type fakeACLAdmin struct {
+	mu      sync.Mutex
+	acl     *klib.Plugin
+	nextID  int
+	patches int
+	// interfere is called after each acl update, to change the acl as another process would
+	interfere func(acl *klib.Plugin)
+	// racedCreate - the groups of an acl another process creates right before the agent
+	racedCreate []string
+}
+
+func newFakeACLAdmin(allowed ...string) *fakeACLAdmin {
+	f := &fakeACLAdmin{}
+	if len(allowed) > 0 {
+		f.acl = f.newACL(allowed)
+	}
+	return f
+}
+
+func (f *fakeACLAdmin) newACL(allowed []string) *klib.Plugin {
+	f.nextID++
+	return &klib.Plugin{
+		ID:      klib.String(fmt.Sprintf("acl%d", f.nextID)),
+		Name:    klib.String(common.AclPlugin),
+		Route:   &klib.Route{ID: klib.String("routeID")},
+		Enabled: klib.Bool(true),
+		Config:  klib.Configuration{"allow": toInterfaces(allowed)},
+	}
+}
+
+// allowed returns the groups allowed on the route
+func (f *fakeACLAdmin) allowed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.acl == nil {
+		return []string{}
+	}
+	return allowedGroups(f.acl)
+}
+
+func (f *fakeACLAdmin) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	// widen the window between reading and writing the acl
+	time.Sleep(time.Millisecond)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	write := func(code int, data interface{}) {
+		resp.WriteHeader(code)
+		if data != nil {
+			body, _ := json.Marshal(data)
+			resp.Write(body)
+		}
+	}
+	aclPath := func(prefix string) bool {
+		return f.acl != nil && req.URL.Path == prefix+*f.acl.ID
+	}
+
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/plugins":
+		plugins := []*klib.Plugin{}
+		if f.acl != nil {
+			plugins = append(plugins, f.acl)
+		}
+		write(http.StatusOK, map[string]interface{}{"data": plugins, "next": nil})
+	case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/plugins/"):
+		if !aclPath("/plugins/") {
+			write(http.StatusNotFound, map[string]string{"message": "Not found"})
+			return
+		}
+		write(http.StatusOK, f.acl)
+	case req.Method == http.MethodPost && req.URL.Path == "/routes/routeID/plugins":
+		if f.racedCreate != nil {
+			f.acl = f.newACL(f.racedCreate)
+			f.racedCreate = nil
+		}
+		if f.acl != nil {
+			write(http.StatusConflict, map[string]string{"message": "unique constraint violation"})
+			return
+		}
+		plugin := &klib.Plugin{}
+		json.NewDecoder(req.Body).Decode(plugin)
+		f.acl = f.newACL(allowedGroups(plugin))
+		write(http.StatusCreated, f.acl)
+	case req.Method == http.MethodPatch:
+		if !aclPath("/routes/routeID/plugins/") {
+			write(http.StatusNotFound, map[string]string{"message": "Not found"})
+			return
+		}
+		plugin := &klib.Plugin{}
+		json.NewDecoder(req.Body).Decode(plugin)
+		f.acl.Config = plugin.Config
+		f.patches++
+		if f.interfere != nil {
+			f.interfere(f.acl)
+		}
+		write(http.StatusOK, f.acl)
+	case req.Method == http.MethodDelete:
+		if !aclPath("/routes/routeID/plugins/") {
+			write(http.StatusNotFound, map[string]string{"message": "Not found"})
+			return
+		}
+		f.acl = nil
+		write(http.StatusNoContent, nil)
+	default:
+		write(http.StatusNotFound, map[string]string{"message": "Not found"})
+	}
+}
+
+func allowedGroups(plugin *klib.Plugin) []string {
+	var acl ACLConfig
+	acl.checkAccess(plugin, "")
+	return acl.AllowedGroups
+}
+
+func toInterfaces(values []string) []interface{} {
+	items := make([]interface{}, len(values))
+	for i, value := range values {
+		items[i] = value
+	}
+	return items
+}
+
+func TestChangeRouteACLConcurrently(t *testing.T) {
+	testCases := map[string]struct {
+		initial []string
+		grants  int
+		revokes int
+	}{
+		"grants without acl": {
+			grants: 20,
+		},
+		"grants and revokes": {
+			initial: []string{"keep", "revoke0", "revoke1", "revoke2", "revoke3", "revoke4", "revoke5", "revoke6", "revoke7", "revoke8", "revoke9"},
+			grants:  20,
+			revokes: 10,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			admin := newFakeACLAdmin(tc.initial...)
+			client := createHandlerClient(admin)
+
+			expected := []string{}
+			for _, group := range tc.initial {
+				if !strings.HasPrefix(group, "revoke") {
+					expected = append(expected, group)
+				}
+			}
+
+			wg := sync.WaitGroup{}
+			errs := make(chan error, tc.grants+tc.revokes)
+			for i := 0; i < tc.grants; i++ {
+				group := fmt.Sprintf("grant%d", i)
+				expected = append(expected, group)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- client.AddRouteACL(context.TODO(), "routeID", group)
+				}()
+			}
+			for i := 0; i < tc.revokes; i++ {
+				group := fmt.Sprintf("revoke%d", i)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- client.RemoveRouteACL(context.TODO(), "routeID", group)
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				assert.Nil(t, err)
+			}
+			assert.ElementsMatch(t, expected, admin.allowed())
+			assert.Empty(t, client.routeLocks.locks)
+		})
+	}
+}
+
+func TestRouteLocks(t *testing.T) {
+	locks := newRouteLocks()
+	unlock := locks.lock("default", "routeID")
+	assert.Len(t, locks.locks, 1)
+
+	// a waiting change keeps the lock of the route
+	locked := make(chan struct{})
+	go func() {
+		defer close(locked)
+		locks.lock("default", "routeID")()
+	}()
+	assert.Eventually(t, func() bool {
+		locks.mu.Lock()
+		defer locks.mu.Unlock()
+		return locks.locks["default/routeID"].refs == 2
+	}, time.Second, time.Millisecond)
+
+	// routes of other workspaces have their own lock
+	locks.lock("other", "routeID")()
+
+	unlock()
+	<-locked
+	assert.Empty(t, locks.locks)
+}
+
+func TestChangeRouteACLRetry(t *testing.T) {
+	testCases := map[string]struct {
+		// the updates of the acl the other process overwrites
+		overwrites    int
+		expectErr     bool
+		expectPatches int
+	}{
+		"no concurrent change": {
+			expectPatches: 1,
+		},
+		"change overwritten once": {
+			overwrites:    1,
+			expectPatches: 2,
+		},
+		"change always overwritten": {
+			overwrites:    aclChangeAttempts,
+			expectErr:     true,
+			expectPatches: aclChangeAttempts,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			admin := newFakeACLAdmin("existing")
+			overwrites := tc.overwrites
+			admin.interfere = func(acl *klib.Plugin) {
+				if overwrites == 0 {
+					return
+				}
+				overwrites--
+				// another process writes the acl it read before the change
+				acl.Config = klib.Configuration{"allow": toInterfaces([]string{"existing", "other"})}
+			}
+			client := createHandlerClient(admin)
+
+			err := client.AddRouteACL(context.TODO(), "routeID", "consumerID")
+			assert.Equal(t, tc.expectPatches, admin.patches)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Contains(t, admin.allowed(), "consumerID")
+		})
+	}
+}
+
+func TestChangeRouteACLCreateConflict(t *testing.T) {
+	admin := newFakeACLAdmin()
+	admin.racedCreate = []string{"other"}
+	client := createHandlerClient(admin)
+
+	err := client.AddRouteACL(context.TODO(), "routeID", "consumerID")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"other", "consumerID"}, admin.allowed())
+}
@@ -0,0 +1,105 @@
+package kong
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	klib "github.com/kong/go-kong/kong"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+const (
+	// suspendedConsumerSuffix - suffix of the custom id of the consumer holding the suspended credentials of an
+	// application consumer
+	suspendedConsumerSuffix = "-suspended"
+	suspendedStatusCode     = http.StatusForbidden
+	suspendedMessage        = "The credential has been suspended"
+)
+
+// EnsureSuspendedConsumer returns the consumer holding the suspended credentials of the application consumer, it is
+// created when it does not exist. The consumer is not a member of any acl group and a request-termination plugin
+// denies all of its requests, also on routes without an acl
+func (k KongClient) EnsureSuspendedConsumer(ctx context.Context, appConsumerID string) (*klib.Consumer, error) {
+	id := appConsumerID + suspendedConsumerSuffix
+	consumer, err := k.CreateConsumer(ctx, id, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.DenyConsumer(ctx, *consumer.ID); err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// DenyConsumer adds a request-termination plugin to the consumer, rejecting its requests once authenticated
+func (k KongClient) DenyConsumer(ctx context.Context, consumerID string) error {
+	log := k.logger.WithField("consumerID", consumerID).WithField("plugin", common.RequestTerminationPlugin)
+	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAllForConsumer(ctx, klib.String(consumerID))
+	if err != nil {
+		log.WithError(err).Error("failed to get consumer plugins")
+		return err
+	}
+	if _, err := getSpecificPlugin(plugins, "", "", consumerID, common.RequestTerminationPlugin); err == nil {
+		log.Debug("consumer requests are already denied")
+		return nil
+	}
+
+	_, err = k.getWorkspaceClient(ctx).Plugins.Create(ctx, &klib.Plugin{
+		Name:     klib.String(common.RequestTerminationPlugin),
+		Consumer: &klib.Consumer{ID: klib.String(consumerID)},
+		Enabled:  klib.Bool(true),
+		Config: klib.Configuration{
+			"status_code": suspendedStatusCode,
+			"message":     suspendedMessage,
+		},
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to deny consumer requests")
+		return err
+	}
+	log.Info("denied consumer requests")
+	return nil
+}
+
+// AllowConsumer removes the request-termination plugins denying the requests of the consumer
+func (k KongClient) AllowConsumer(ctx context.Context, consumerID string) error {
+	log := k.logger.WithField("consumerID", consumerID).WithField("plugin", common.RequestTerminationPlugin)
+	plugins, err := k.getWorkspaceClient(ctx).Plugins.ListAllForConsumer(ctx, klib.String(consumerID))
+	if err != nil {
+		log.WithError(err).Error("failed to get consumer plugins")
+		return err
+	}
+
+	for _, plugin := range plugins {
+		if *plugin.Name != common.RequestTerminationPlugin || plugin.Route != nil || plugin.Service != nil {
+			continue
+		}
+		err := k.getWorkspaceClient(ctx).Plugins.Delete(ctx, plugin.ID)
+		if err != nil && !klib.IsNotFoundErr(err) {
+			log.WithError(err).Error("failed to allow consumer requests")
+			return err
+		}
+	}
+	log.Info("allowed consumer requests")
+	return nil
+}
+
+// MoveCredential moves the credential, of the kong credential collection i.e. key-auths, to the consumer. The
+// credential keeps its id and secrets, the moved credential is decoded into credential
+func (k KongClient) MoveCredential(ctx context.Context, collection, credentialID, consumerID string, credential interface{}) error {
+	log := k.logger.WithField("credentialID", credentialID).WithField("consumerID", consumerID)
+	client := k.getWorkspaceClient(ctx)
+	req, err := client.NewRequest(http.MethodPatch, fmt.Sprintf("/%s/%s", collection, credentialID), nil,
+		map[string]interface{}{"consumer": map[string]string{"id": consumerID}})
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, credential); err != nil {
+		log.WithError(err).Error("failed to move credential")
+		return err
+	}
+	log.Info("moved credential")
+	return nil
+}
@@ -0,0 +1,187 @@
+package kong
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+func denyPlugin(consumerID string) *klib.Plugin {
+	return &klib.Plugin{
+		ID:       klib.String("denyPluginID"),
+		Name:     klib.String(common.RequestTerminationPlugin),
+		Consumer: &klib.Consumer{ID: klib.String(consumerID)},
+	}
+}
+
+func TestEnsureSuspendedConsumer(t *testing.T) {
+	suspendedConsumer := &klib.Consumer{
+		ID:       klib.String("suspendedID"),
+		CustomID: klib.String("appConsumerID" + suspendedConsumerSuffix),
+	}
+	testCases := map[string]struct {
+		responses map[string]response
+		expectErr bool
+	}{
+		"creates the consumer and denies its requests": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers/appConsumerID-suspended"): {
+					code: http.StatusNotFound,
+				},
+				formatRequestKey(http.MethodPost, "/consumers"): {
+					code:      http.StatusCreated,
+					dataIface: suspendedConsumer,
+				},
+				formatRequestKey(http.MethodGet, "/consumers/suspendedID/plugins"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Plugin{}, "next": nil},
+				},
+				formatRequestKey(http.MethodPost, "/plugins"): {
+					code:      http.StatusCreated,
+					dataIface: denyPlugin("suspendedID"),
+				},
+			},
+		},
+		"existing consumer already denied": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers/appConsumerID-suspended"): {
+					code:      http.StatusOK,
+					dataIface: suspendedConsumer,
+				},
+				formatRequestKey(http.MethodGet, "/consumers/suspendedID/plugins"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Plugin{denyPlugin("suspendedID")}, "next": nil},
+				},
+				formatRequestKey(http.MethodPost, "/plugins"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+		},
+		"error when requests can not be denied": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers/appConsumerID-suspended"): {
+					code:      http.StatusOK,
+					dataIface: suspendedConsumer,
+				},
+				formatRequestKey(http.MethodGet, "/consumers/suspendedID/plugins"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Plugin{}, "next": nil},
+				},
+				formatRequestKey(http.MethodPost, "/plugins"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			consumer, err := client.EnsureSuspendedConsumer(context.TODO(), "appConsumerID")
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "suspendedID", *consumer.ID)
+		})
+	}
+}
+
+func TestAllowConsumer(t *testing.T) {
+	testCases := map[string]struct {
+		responses map[string]response
+		expectErr bool
+	}{
+		"removes the deny plugin": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers/consumerID/plugins"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Plugin{denyPlugin("consumerID")}, "next": nil},
+				},
+				formatRequestKey(http.MethodDelete, "/plugins/denyPluginID"): {
+					code: http.StatusNoContent,
+				},
+			},
+		},
+		"deny plugin already removed": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers/consumerID/plugins"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Plugin{denyPlugin("consumerID")}, "next": nil},
+				},
+				formatRequestKey(http.MethodDelete, "/plugins/denyPluginID"): {
+					code:      http.StatusNotFound,
+					dataIface: map[string]string{"message": "Not found"},
+				},
+			},
+		},
+		"error when the deny plugin can not be removed": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodGet, "/consumers/consumerID/plugins"): {
+					code:      http.StatusOK,
+					dataIface: map[string]interface{}{"data": []*klib.Plugin{denyPlugin("consumerID")}, "next": nil},
+				},
+				formatRequestKey(http.MethodDelete, "/plugins/denyPluginID"): {
+					code: http.StatusInternalServerError,
+				},
+			},
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			err := client.AllowConsumer(context.TODO(), "consumerID")
+			assert.Equal(t, tc.expectErr, err != nil)
+		})
+	}
+}
+
+func TestMoveCredential(t *testing.T) {
+	testCases := map[string]struct {
+		responses map[string]response
+		expectErr bool
+	}{
+		"moves the credential": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodPatch, "/key-auths/credID"): {
+					code: http.StatusOK,
+					dataIface: &klib.KeyAuth{
+						ID:       klib.String("credID"),
+						Key:      klib.String("key"),
+						Consumer: &klib.Consumer{ID: klib.String("suspendedID")},
+					},
+				},
+			},
+		},
+		"error when the credential does not exist": {
+			responses: map[string]response{
+				formatRequestKey(http.MethodPatch, "/key-auths/credID"): {
+					code:      http.StatusNotFound,
+					dataIface: map[string]string{"message": "Not found"},
+				},
+			},
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client := createClient(tc.responses)
+			keyAuth := &klib.KeyAuth{}
+			err := client.MoveCredential(context.TODO(), common.KeyAuthCredentials, "credID", "suspendedID", keyAuth)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "key", *keyAuth.Key)
+			assert.Equal(t, "suspendedID", *keyAuth.Consumer.ID)
+		})
+	}
+}
@@ -3,6 +3,8 @@ package access
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/Axway/agent-sdk/pkg/agent"
 	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
@@ -12,6 +14,7 @@ import (
 	sdkUtil "github.com/Axway/agent-sdk/pkg/util"
 	"github.com/Axway/agent-sdk/pkg/util/log"
 	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
 	klib "github.com/kong/go-kong/kong"
 )
 
@@ -20,6 +23,14 @@ const (
 	logFieldAppName   = "appName"
 	logFieldServiceID = "serviceID"
 	logFieldRouteID   = "routeID"
+
+	logFieldConsumerGroup = "consumerGroup"
+)
+
+// the access request status properties
+const (
+	propertyQuotaPlugin   = "quotaPlugin"
+	propertyConsumerGroup = "consumerGroup"
 )
 
 type accessClient interface {
@@ -29,9 +40,17 @@ type accessClient interface {
 	AddRouteACL(ctx context.Context, routeID, allowedID string) error
 	RemoveRouteACL(ctx context.Context, routeID, revokedID string) error
 	AddQuota(ctx context.Context, routeID, allowedID, quotaInterval string, quotaLimit int) error
+	RemoveQuota(ctx context.Context, routeID, allowedID string) error
+	QuotaPlugin(ctx context.Context, quotaInterval string) (string, error)
+
+	EnsureConsumerGroup(ctx context.Context, group, quotaInterval string, quotaLimit int) error
+	AddConsumerToGroup(ctx context.Context, group, consumerID string) error
+	RemoveConsumerFromGroup(ctx context.Context, group, consumerID string) error
+	ConsumerGroupsOfConsumer(ctx context.Context, consumerID string) ([]string, error)
 }
 
 type accessRequest interface {
+	GetID() string
 	GetApplicationName() string
 	GetApplicationDetailsValue(key string) string
 	GetInstanceDetails() map[string]interface{}
@@ -43,21 +62,32 @@ type centralClient interface {
 	CreateSubResource(rm v1.ResourceMeta, subs map[string]interface{}) error
 }
 
+// accessRequestCache - the access requests and instances the agent has cached
+type accessRequestCache interface {
+	ListAccessRequests() []*v1.ResourceInstance
+	GetAPIServiceInstanceByName(name string) (*v1.ResourceInstance, error)
+	GetWatchResourceCacheKeys(group, kind string) []string
+	GetWatchResourceByKey(key string) *v1.ResourceInstance
+}
+
 type AccessProvisioner struct {
-	ctx           context.Context
-	logger        log.FieldLogger
-	client        accessClient
-	quota         provisioning.Quota
-	workspace     string
-	routeID       string
-	appID         string
-	appName       string
-	aclDisable    bool
-	centralClient centralClient
-	envName       string
-}
-
-func NewAccessProvisioner(ctx context.Context, client accessClient, request accessRequest, aclDisable bool, envName string) AccessProvisioner {
+	ctx            context.Context
+	logger         log.FieldLogger
+	client         accessClient
+	quota          provisioning.Quota
+	requestID      string
+	workspace      string
+	routeID        string
+	appID          string
+	appName        string
+	aclDisable     bool
+	consumerGroups bool
+	centralClient  centralClient
+	cache          accessRequestCache
+	envName        string
+}
+
+func NewAccessProvisioner(ctx context.Context, client accessClient, request accessRequest, aclDisable, consumerGroups bool, envName string) AccessProvisioner {
 	instDetails := request.GetInstanceDetails()
 	workspace := sdkUtil.ToString(instDetails[common.AttrWorkspaceName])
 	routeID := sdkUtil.ToString(instDetails[common.AttrRouteID])
@@ -66,17 +96,19 @@ func NewAccessProvisioner(ctx context.Context, client accessClient, request acce
 		WithPackage("access")
 
 	a := AccessProvisioner{
-		ctx:           context.WithValue(context.Background(), common.ContextWorkspace, workspace),
-		logger:        logger,
-		client:        client,
-		quota:         request.GetQuota(),
-		workspace:     workspace,
-		routeID:       routeID,
-		appID:         request.GetApplicationDetailsValue(common.WksPrefixName(workspace, common.AttrAppID)),
-		appName:       request.GetApplicationName(),
-		aclDisable:    aclDisable,
-		centralClient: agent.GetCentralClient(),
-		envName:       envName,
+		ctx:            context.WithValue(ctx, common.ContextWorkspace, workspace),
+		logger:         logger,
+		client:         client,
+		quota:          request.GetQuota(),
+		requestID:      request.GetID(),
+		workspace:      workspace,
+		routeID:        routeID,
+		appID:          request.GetApplicationDetailsValue(common.WksPrefixName(workspace, common.AttrAppID)),
+		appName:        request.GetApplicationName(),
+		aclDisable:     aclDisable,
+		consumerGroups: consumerGroups,
+		centralClient:  agent.GetCentralClient(),
+		envName:        envName,
 	}
 
 	if a.routeID != "" {
@@ -102,6 +134,7 @@ func (a AccessProvisioner) Provision() (provisioning.RequestStatus, provisioning
 	}
 
 	if a.appID == "" {
+		// applications provisioned before their consumers were created with the application get one now
 		appID, err := a.provisionApp()
 		if err != nil {
 			return rs.SetMessage(err.Error()).Failed(), nil
@@ -119,9 +152,23 @@ func (a AccessProvisioner) Provision() (provisioning.RequestStatus, provisioning
 		return rs.Success(), nil
 	}
 
-	if a.quota != nil && a.quota.GetInterval().String() == provisioning.Weekly.String() {
-		a.logger.Debug("weekly quota interval is not supported")
-		return rs.SetMessage("weekly quota is not supported by kong").Failed(), nil
+	if a.quota != nil && a.appHasIDPCredentials() {
+		a.logger.Info("the application has identity provider credentials, the quota can not be applied to their clients")
+		return rs.SetMessage("quotas are not supported for applications with identity provider credentials, kong can not apply the quota to the identity provider clients").Failed(), nil
+	}
+
+	if a.consumerGroups {
+		return a.provisionConsumerGroup(rs), nil
+	}
+
+	quotaPlugin := ""
+	if a.quota != nil {
+		var err error
+		quotaPlugin, err = a.client.QuotaPlugin(a.ctx, a.quota.GetIntervalString())
+		if err != nil {
+			a.logger.WithError(err).Debug("quota interval is not supported")
+			return rs.SetMessage(fmt.Sprintf("%s quota is not supported by kong", a.quota.GetIntervalString())).Failed(), nil
+		}
 	}
 
 	err := a.client.AddRouteACL(a.ctx, a.routeID, a.appID)
@@ -131,6 +178,11 @@ func (a AccessProvisioner) Provision() (provisioning.RequestStatus, provisioning
 	}
 
 	if a.quota == nil {
+		// the access request may have had a quota, i.e. when its plan moved to an unlimited tier
+		if err := a.client.RemoveQuota(a.ctx, a.routeID, a.appID); err != nil {
+			a.logger.WithError(err).Error("failed to remove quota of consumer")
+			return rs.SetMessage("could not remove limits of consumer in kong").Failed(), nil
+		}
 		a.logger.Info("provisioned access")
 		return rs.Success(), nil
 	}
@@ -143,8 +195,17 @@ func (a AccessProvisioner) Provision() (provisioning.RequestStatus, provisioning
 		return rs.SetMessage("could not create limits for consumer in kong").Failed(), nil
 	}
 
-	a.logger.Info("provisioned access")
-	return rs.Success(), nil
+	a.logger.WithField(propertyQuotaPlugin, quotaPlugin).Info("provisioned access")
+	return a.quotaStatus(rs, quotaPlugin).Success(), nil
+}
+
+// quotaStatus reports the plugin enforcing the quota on the access request
+func (a AccessProvisioner) quotaStatus(rs provisioning.RequestStatusBuilder, quotaPlugin string) provisioning.RequestStatusBuilder {
+	if a.quota == nil || quotaPlugin == "" {
+		return rs
+	}
+	return rs.AddProperty(propertyQuotaPlugin, quotaPlugin).
+		SetMessage(fmt.Sprintf("%d requests %s quota enforced by the %s plugin", a.quota.GetLimit(), a.quota.GetIntervalString(), quotaPlugin))
 }
 
 func (a AccessProvisioner) Deprovision() provisioning.RequestStatus {
@@ -171,6 +232,10 @@ func (a AccessProvisioner) Deprovision() provisioning.RequestStatus {
 		return rs.Success()
 	}
 
+	if a.consumerGroups {
+		return a.deprovisionConsumerGroup(rs)
+	}
+
 	err := a.client.RemoveRouteACL(a.ctx, a.routeID, a.appID)
 	if err != nil {
 		a.logger.WithError(err).Error("failed to remove managed app from ACL")
@@ -181,6 +246,157 @@ func (a AccessProvisioner) Deprovision() provisioning.RequestStatus {
 	return rs.Success()
 }
 
+// provisionConsumerGroup allows the consumer on the route acl, as when provisioning per consumer, and adds the
+// consumer to the consumer group of the plan, or access tier, applying the quota. The group is not allowed on the
+// route, the consumers of a plan share its quota but not the routes each of them was granted
+func (a AccessProvisioner) provisionConsumerGroup(rs provisioning.RequestStatusBuilder) provisioning.RequestStatus {
+	if err := a.client.AddRouteACL(a.ctx, a.routeID, a.appID); err != nil {
+		a.logger.WithError(err).Error("failed to provide access to managed application")
+		return rs.SetMessage("could not provide access to consumer in kong").Failed()
+	}
+
+	if a.quota == nil {
+		// the access request may have had a quota, i.e. when its plan moved to an unlimited tier
+		if err := a.leaveOtherGroups(""); err != nil {
+			return rs.SetMessage("could not remove consumer from its previous consumer group").Failed()
+		}
+		a.logger.Info("provisioned access")
+		return rs.Success()
+	}
+
+	group, quotaInterval, quotaLimit := consumerGroup(a.quota)
+	logger := a.logger.WithField(logFieldConsumerGroup, group)
+	if err := a.leaveOtherGroups(group); err != nil {
+		return rs.SetMessage("could not remove consumer from its previous consumer group").Failed()
+	}
+	if err := a.client.EnsureConsumerGroup(a.ctx, group, quotaInterval, quotaLimit); err != nil {
+		logger.WithError(err).Error("failed to create consumer group")
+		return rs.SetMessage("could not create the consumer group in kong").Failed()
+	}
+	if err := a.client.AddConsumerToGroup(a.ctx, group, a.appID); err != nil {
+		logger.WithError(err).Error("failed to add consumer to consumer group")
+		return rs.SetMessage("could not add consumer to the consumer group in kong").Failed()
+	}
+
+	logger.Info("provisioned access")
+	return a.quotaStatus(rs, kong.RateLimitingAdvancedPlugin).AddProperty(propertyConsumerGroup, group).Success()
+}
+
+// leaveOtherGroups removes the consumer from the agent managed consumer groups other than the group, i.e. the group of
+// the plan before a plan change, keeping the groups other access requests of the application in the workspace use
+func (a AccessProvisioner) leaveOtherGroups(group string) error {
+	groups, err := a.client.ConsumerGroupsOfConsumer(a.ctx, a.appID)
+	if err != nil {
+		a.logger.WithError(err).Error("failed to get consumer groups of consumer")
+		return err
+	}
+	for _, other := range groups {
+		if other == group || a.groupInUse(other) {
+			continue
+		}
+		logger := a.logger.WithField(logFieldConsumerGroup, other)
+		if err := a.client.RemoveConsumerFromGroup(a.ctx, other, a.appID); err != nil {
+			logger.WithError(err).Error("failed to remove consumer from previous consumer group")
+			return err
+		}
+		logger.Info("removed consumer from previous consumer group")
+	}
+	return nil
+}
+
+// deprovisionConsumerGroup revokes the consumer on the route acl and removes the consumer from the consumer group of
+// the quota, unless another access request of the application in the workspace uses the group
+func (a AccessProvisioner) deprovisionConsumerGroup(rs provisioning.RequestStatusBuilder) provisioning.RequestStatus {
+	if err := a.client.RemoveRouteACL(a.ctx, a.routeID, a.appID); err != nil {
+		a.logger.WithError(err).Error("failed to remove managed app from ACL")
+		return rs.SetMessage("could not remove consumer from ACL").Failed()
+	}
+	if a.quota == nil {
+		a.logger.Info("deprovisioned access")
+		return rs.Success()
+	}
+
+	group, _, _ := consumerGroup(a.quota)
+	logger := a.logger.WithField(logFieldConsumerGroup, group)
+	if a.groupInUse(group) {
+		logger.Info("consumer group is used by other access requests of the application")
+		return rs.Success()
+	}
+	if err := a.client.RemoveConsumerFromGroup(a.ctx, group, a.appID); err != nil {
+		logger.WithError(err).Error("failed to remove consumer from consumer group")
+		return rs.SetMessage("could not remove consumer from the consumer group").Failed()
+	}
+
+	logger.Info("deprovisioned access")
+	return rs.Success()
+}
+
+// groupInUse checks the other provisioned access requests of the application in the workspace for the group
+func (a AccessProvisioner) groupInUse(group string) bool {
+	cache := a.cache
+	if cache == nil {
+		cache = agent.GetCacheManager()
+	}
+	for _, ri := range cache.ListAccessRequests() {
+		ar := management.NewAccessRequest("", "")
+		if err := ar.FromInstance(ri); err != nil || ar.Metadata.ID == a.requestID {
+			continue
+		}
+		if ar.Spec.ManagedApplication != a.appName || ar.Metadata.State == v1.ResourceDeleting ||
+			ar.Status == nil || ar.Status.Level != provisioning.Success.String() {
+			continue
+		}
+		instance, err := cache.GetAPIServiceInstanceByName(ar.Spec.ApiServiceInstance)
+		if err != nil || instance == nil {
+			continue
+		}
+		if sdkUtil.ToString(sdkUtil.GetAgentDetails(instance)[common.AttrWorkspaceName]) != a.workspace {
+			continue
+		}
+		quota := provisioning.NewQuotaFromAccessRequest(ar)
+		if quota == nil {
+			continue
+		}
+		if arGroup, _, _ := consumerGroup(quota); arGroup == group {
+			return true
+		}
+	}
+	return false
+}
+
+// appHasIDPCredentials checks the credentials of the application in the workspace for identity provider
+// credentials, their client consumers get the access of the application consumer but not its quotas
+func (a AccessProvisioner) appHasIDPCredentials() bool {
+	cache := a.cache
+	if cache == nil {
+		cache = agent.GetCacheManager()
+	}
+	for _, key := range cache.GetWatchResourceCacheKeys(management.CredentialGVK().Group, management.CredentialGVK().Kind) {
+		ri := cache.GetWatchResourceByKey(key)
+		if ri == nil {
+			continue
+		}
+		cred := management.NewCredential("", "")
+		if err := cred.FromInstance(ri); err != nil {
+			continue
+		}
+		if cred.Spec.ManagedApplication != a.appName || cred.Metadata.State == v1.ResourceDeleting ||
+			!strings.HasSuffix(cred.Spec.CredentialRequestDefinition, "-"+provisioning.OAuthIDPCRD) {
+			continue
+		}
+		if sdkUtil.ToString(sdkUtil.GetAgentDetails(ri)[common.AttrWorkspaceName]) == a.workspace {
+			return true
+		}
+	}
+	return false
+}
+
+// consumerGroup returns the consumer group of the quota, with the quota interval and limit of the group
+func consumerGroup(quota provisioning.Quota) (string, string, int) {
+	interval, limit := quota.GetIntervalString(), int(quota.GetLimit())
+	return kong.ConsumerGroupName(quota.GetPlanName(), interval, limit), interval, limit
+}
+
 func (a AccessProvisioner) provisionApp() (string, error) {
 	a.logger.Info("provisioning application")
 	app, err := a.getManagedApplication()
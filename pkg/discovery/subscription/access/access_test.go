@@ -8,9 +8,11 @@ import (
 
 	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
 	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/definitions"
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
 	"github.com/Axway/agent-sdk/pkg/util/log"
 	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
 	"github.com/google/uuid"
 	klib "github.com/kong/go-kong/kong"
 	"github.com/stretchr/testify/assert"
@@ -22,9 +24,20 @@ type mockAccessClient struct {
 	addManagedAppErr    bool
 	removeManagedAppErr bool
 	addQuotaErr         bool
+	removeQuotaErr      bool
+	removedQuota        *bool
 	createAppErr        bool
 	addACLErr           bool
 	consumer            *klib.Consumer
+	consumerGroupErr    bool
+	addToGroupErr       bool
+	removeFromGroupErr  bool
+	removedFromGroup    *bool
+	consumerGroupsErr   bool
+	// routeACLs - the groups allowed per route, groupMembers - the consumers per consumer group
+	routeACLs      map[string]map[string]bool
+	groupMembers   map[string]map[string]bool
+	quotaPluginErr bool
 }
 
 func (m mockAccessClient) CreateConsumer(ctx context.Context, id, name string) (*klib.Consumer, error) {
@@ -45,6 +58,12 @@ func (c mockAccessClient) AddRouteACL(ctx context.Context, routeID, allowedID st
 	if c.addManagedAppErr {
 		return fmt.Errorf("error")
 	}
+	if c.routeACLs != nil {
+		if c.routeACLs[routeID] == nil {
+			c.routeACLs[routeID] = map[string]bool{}
+		}
+		c.routeACLs[routeID][allowedID] = true
+	}
 	return nil
 }
 
@@ -52,6 +71,9 @@ func (c mockAccessClient) RemoveRouteACL(ctx context.Context, routeID, revokedID
 	if c.removeManagedAppErr {
 		return fmt.Errorf("error")
 	}
+	if c.routeACLs != nil {
+		delete(c.routeACLs[routeID], revokedID)
+	}
 	return nil
 }
 
@@ -62,13 +84,84 @@ func (c mockAccessClient) AddQuota(ctx context.Context, routeID, managedAppID, q
 	return nil
 }
 
+func (c mockAccessClient) RemoveQuota(ctx context.Context, routeID, managedAppID string) error {
+	if c.removeQuotaErr {
+		return fmt.Errorf("error")
+	}
+	if c.removedQuota != nil {
+		*c.removedQuota = true
+	}
+	return nil
+}
+
+func (c mockAccessClient) QuotaPlugin(ctx context.Context, quotaInterval string) (string, error) {
+	if c.quotaPluginErr {
+		return "", fmt.Errorf("error")
+	}
+	if quotaInterval == provisioning.Weekly.String() {
+		return kong.RateLimitingAdvancedPlugin, nil
+	}
+	return common.RateLimitingPlugin, nil
+}
+
+func (c mockAccessClient) EnsureConsumerGroup(ctx context.Context, group, quotaInterval string, quotaLimit int) error {
+	if c.consumerGroupErr {
+		return fmt.Errorf("error")
+	}
+	return nil
+}
+
+func (c mockAccessClient) AddConsumerToGroup(ctx context.Context, group, consumerID string) error {
+	if c.addToGroupErr {
+		return fmt.Errorf("error")
+	}
+	if c.groupMembers != nil {
+		if c.groupMembers[group] == nil {
+			c.groupMembers[group] = map[string]bool{}
+		}
+		c.groupMembers[group][consumerID] = true
+	}
+	return nil
+}
+
+func (c mockAccessClient) RemoveConsumerFromGroup(ctx context.Context, group, consumerID string) error {
+	if c.removeFromGroupErr {
+		return fmt.Errorf("error")
+	}
+	if c.removedFromGroup != nil {
+		*c.removedFromGroup = true
+	}
+	if c.groupMembers != nil {
+		delete(c.groupMembers[group], consumerID)
+	}
+	return nil
+}
+
+func (c mockAccessClient) ConsumerGroupsOfConsumer(ctx context.Context, consumerID string) ([]string, error) {
+	if c.consumerGroupsErr {
+		return nil, fmt.Errorf("error")
+	}
+	groups := []string{}
+	for group, members := range c.groupMembers {
+		if members[consumerID] {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
 type mockAccessRequest struct {
+	id      string
 	appName string
 	values  map[string]string
 	details map[string]interface{}
 	quota   provisioning.Quota
 }
 
+func (a mockAccessRequest) GetID() string {
+	return a.id
+}
+
 func (a mockAccessRequest) GetApplicationName() string {
 	return a.appName
 }
@@ -139,11 +232,13 @@ func (c *mockCentralClient) CreateSubResource(rm v1.ResourceMeta, subs map[strin
 func TestProvision(t *testing.T) {
 	appIDAttr := common.WksPrefixName("default", common.AttrAppID)
 	cases := map[string]struct {
-		client     mockAccessClient
-		request    mockAccessRequest
-		result     provisioning.Status
-		aclDisable bool
-		app        *management.ManagedApplication
+		client         mockAccessClient
+		request        mockAccessRequest
+		result         provisioning.Status
+		aclDisable     bool
+		consumerGroups bool
+		app            *management.ManagedApplication
+		quotaPlugin    string
 	}{
 		"no app id configured failure with create consumer": {
 			client: mockAccessClient{
@@ -231,6 +326,9 @@ func TestProvision(t *testing.T) {
 			aclDisable: true,
 		},
 		"unsupported quota interval": {
+			client: mockAccessClient{
+				quotaPluginErr: true,
+			},
 			request: mockAccessRequest{
 				values: map[string]string{
 					appIDAttr: "appID",
@@ -303,18 +401,261 @@ func TestProvision(t *testing.T) {
 					planName: "planName",
 				},
 			},
-			result: provisioning.Success,
+			result:      provisioning.Success,
+			quotaPlugin: common.RateLimitingPlugin,
+		},
+		"success granting access with weekly quota": {
+			client: mockAccessClient{},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Weekly,
+					limit:    4,
+					planName: "planName",
+				},
+			},
+			result:      provisioning.Success,
+			quotaPlugin: kong.RateLimitingAdvancedPlugin,
+		},
+		"success granting access with hourly quota": {
+			client: mockAccessClient{},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Hourly,
+					limit:    4,
+				},
+			},
+			result:      provisioning.Success,
+			quotaPlugin: common.RateLimitingPlugin,
+		},
+		"consumer group error creating group": {
+			client: mockAccessClient{
+				consumerGroupErr: true,
+			},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Daily,
+					limit:    7,
+					planName: "planName",
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Error,
+		},
+		"consumer group error adding consumer": {
+			client: mockAccessClient{
+				addToGroupErr: true,
+			},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Daily,
+					limit:    7,
+					planName: "planName",
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Error,
+		},
+		"consumer group error allowing consumer on route": {
+			client: mockAccessClient{
+				addManagedAppErr: true,
+			},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Error,
+		},
+		"consumer group without quota": {
+			client: mockAccessClient{
+				consumerGroupErr: true,
+				addToGroupErr:    true,
+			},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Success,
+		},
+		"consumer group does not use per consumer quotas": {
+			client: mockAccessClient{
+				addQuotaErr: true,
+			},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Daily,
+					limit:    7,
+					planName: "planName",
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Success,
+			quotaPlugin:    kong.RateLimitingAdvancedPlugin,
 		},
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
 			ctx := context.WithValue(context.Background(), testName, name)
-			prov := NewAccessProvisioner(ctx, tc.client, &tc.request, tc.aclDisable, "test")
+			prov := NewAccessProvisioner(ctx, tc.client, &tc.request, tc.aclDisable, tc.consumerGroups, "test")
+			prov.cache = &mockCache{}
 			prov.centralClient = &mockCentralClient{
 				app: tc.app,
 			}
 			result, _ := prov.Provision()
 			assert.Equal(t, tc.result, result.GetStatus())
+			if tc.quotaPlugin != "" {
+				assert.Equal(t, tc.quotaPlugin, result.GetProperties()[propertyQuotaPlugin])
+				assert.Contains(t, result.GetMessage(), tc.quotaPlugin)
+			}
+		})
+	}
+}
+
+func TestProvisionWithoutQuota(t *testing.T) {
+	appIDAttr := common.WksPrefixName("default", common.AttrAppID)
+	cases := map[string]struct {
+		client mockAccessClient
+		quota  provisioning.Quota
+		result provisioning.Status
+		remove bool
+	}{
+		"quota removed when the access request has no quota": {
+			result: provisioning.Success,
+			remove: true,
+		},
+		"error removing quota": {
+			client: mockAccessClient{removeQuotaErr: true},
+			result: provisioning.Error,
+		},
+		"quota kept when the access request has a quota": {
+			quota:  &mockQuota{interval: provisioning.Daily, limit: 7},
+			result: provisioning.Success,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			removed := false
+			tc.client.removedQuota = &removed
+			request := &mockAccessRequest{
+				values: map[string]string{appIDAttr: "appID"},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: tc.quota,
+			}
+			prov := NewAccessProvisioner(context.Background(), tc.client, request, false, false, "test")
+			prov.cache = &mockCache{}
+			result, _ := prov.Provision()
+			assert.Equal(t, tc.result, result.GetStatus())
+			if tc.result == provisioning.Success {
+				assert.Equal(t, tc.remove, removed)
+			}
+		})
+	}
+}
+
+func TestProvisionQuotaWithIDPCredentials(t *testing.T) {
+	appIDAttr := common.WksPrefixName("default", common.AttrAppID)
+	idpCRD := common.WksPrefixName("default", common.IDPCRDName("keycloak"))
+	cases := map[string]struct {
+		credentials    map[string]*v1.ResourceInstance
+		quota          provisioning.Quota
+		consumerGroups bool
+		result         provisioning.Status
+	}{
+		"quota provisioned when the application has no identity provider credentials": {
+			credentials: map[string]*v1.ResourceInstance{"apikey": cachedCredential("test-app", "default-api-key", "default")},
+			quota:       &mockQuota{interval: provisioning.Daily, limit: 7},
+			result:      provisioning.Success,
+		},
+		"quota provisioned when the identity provider credentials are in another workspace": {
+			credentials: map[string]*v1.ResourceInstance{"idp": cachedCredential("test-app", idpCRD, "other")},
+			quota:       &mockQuota{interval: provisioning.Daily, limit: 7},
+			result:      provisioning.Success,
+		},
+		"quota provisioned when the identity provider credentials are for another application": {
+			credentials: map[string]*v1.ResourceInstance{"idp": cachedCredential("other-app", idpCRD, "default")},
+			quota:       &mockQuota{interval: provisioning.Daily, limit: 7},
+			result:      provisioning.Success,
+		},
+		"access without a quota provisioned with identity provider credentials": {
+			credentials: map[string]*v1.ResourceInstance{"idp": cachedCredential("test-app", idpCRD, "default")},
+			result:      provisioning.Success,
+		},
+		"quota rejected with identity provider credentials": {
+			credentials: map[string]*v1.ResourceInstance{"idp": cachedCredential("test-app", idpCRD, "default")},
+			quota:       &mockQuota{interval: provisioning.Daily, limit: 7},
+			result:      provisioning.Error,
+		},
+		"consumer group quota rejected with identity provider credentials": {
+			credentials:    map[string]*v1.ResourceInstance{"idp": cachedCredential("test-app", idpCRD, "default")},
+			quota:          &mockQuota{interval: provisioning.Daily, limit: 7},
+			consumerGroups: true,
+			result:         provisioning.Error,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			request := &mockAccessRequest{
+				appName: "test-app",
+				values:  map[string]string{appIDAttr: "appID"},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: tc.quota,
+			}
+			prov := NewAccessProvisioner(context.Background(), mockAccessClient{}, request, false, tc.consumerGroups, "test")
+			prov.cache = &mockCache{credentials: tc.credentials}
+			result, _ := prov.Provision()
+			assert.Equal(t, tc.result, result.GetStatus())
 		})
 	}
 }
@@ -322,10 +663,11 @@ func TestProvision(t *testing.T) {
 func TestDeprovision(t *testing.T) {
 	appIDAttr := common.WksPrefixName("default", common.AttrAppID)
 	cases := map[string]struct {
-		client     mockAccessClient
-		request    mockAccessRequest
-		result     provisioning.Status
-		aclDisable bool
+		client         mockAccessClient
+		request        mockAccessRequest
+		result         provisioning.Status
+		aclDisable     bool
+		consumerGroups bool
 	}{
 		"no app id configured": {
 			result: provisioning.Error,
@@ -389,13 +731,326 @@ func TestDeprovision(t *testing.T) {
 			},
 			result: provisioning.Success,
 		},
+		"consumer group error removing consumer": {
+			client: mockAccessClient{
+				removeFromGroupErr: true,
+			},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Daily,
+					limit:    7,
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Error,
+		},
+		"consumer group error revoking consumer on route": {
+			client: mockAccessClient{
+				removeManagedAppErr: true,
+			},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Error,
+		},
+		"consumer group success removing consumer": {
+			client: mockAccessClient{},
+			request: mockAccessRequest{
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Daily,
+					limit:    7,
+				},
+			},
+			consumerGroups: true,
+			result:         provisioning.Success,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), testName, name)
+
+			prov := NewAccessProvisioner(ctx, tc.client, &tc.request, tc.aclDisable, tc.consumerGroups, "test")
+			prov.cache = &mockCache{}
+			result := prov.Deprovision()
+			assert.Equal(t, tc.result, result.GetStatus())
+		})
+	}
+}
+
+type mockCache struct {
+	accessRequests []*v1.ResourceInstance
+	instances      map[string]*v1.ResourceInstance
+	credentials    map[string]*v1.ResourceInstance
+}
+
+func (c *mockCache) ListAccessRequests() []*v1.ResourceInstance {
+	return c.accessRequests
+}
+
+func (c *mockCache) GetAPIServiceInstanceByName(name string) (*v1.ResourceInstance, error) {
+	if instance, ok := c.instances[name]; ok {
+		return instance, nil
+	}
+	return nil, fmt.Errorf("instance %s not found", name)
+}
+
+func (c *mockCache) GetWatchResourceCacheKeys(group, kind string) []string {
+	keys := []string{}
+	for key := range c.credentials {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (c *mockCache) GetWatchResourceByKey(key string) *v1.ResourceInstance {
+	return c.credentials[key]
+}
+
+func cachedCredential(appName, crdName, workspace string) *v1.ResourceInstance {
+	cred := management.NewCredential(appName+"-"+crdName, "test")
+	cred.Spec.ManagedApplication = appName
+	cred.Spec.CredentialRequestDefinition = crdName
+	ri, _ := cred.AsInstance()
+	ri.SetSubResource(definitions.XAgentDetails, map[string]interface{}{common.AttrWorkspaceName: workspace})
+	return ri
+}
+
+func cachedAccessRequest(id, appName, instanceName, level string, quota *management.AccessRequestSpecQuota) *v1.ResourceInstance {
+	ar := management.NewAccessRequest(id, "test")
+	ar.Metadata.ID = id
+	ar.Spec.ManagedApplication = appName
+	ar.Spec.ApiServiceInstance = instanceName
+	ar.Spec.Quota = quota
+	ar.Status = &v1.ResourceStatus{Level: level}
+	ri, _ := ar.AsInstance()
+	return ri
+}
+
+func cachedInstance(name, workspace string) *v1.ResourceInstance {
+	ri, _ := management.NewAPIServiceInstance(name, "test").AsInstance()
+	ri.SetSubResource(definitions.XAgentDetails, map[string]interface{}{common.AttrWorkspaceName: workspace})
+	return ri
+}
+
+func TestDeprovisionConsumerGroupInUse(t *testing.T) {
+	appIDAttr := common.WksPrefixName("default", common.AttrAppID)
+	daily := &management.AccessRequestSpecQuota{Interval: provisioning.Daily.String(), Limit: 7}
+	instances := map[string]*v1.ResourceInstance{
+		"inst":       cachedInstance("inst", "default"),
+		"other-inst": cachedInstance("other-inst", "other"),
+	}
+	cases := map[string]struct {
+		accessRequests []*v1.ResourceInstance
+		removed        bool
+	}{
+		"no other access requests": {
+			accessRequests: []*v1.ResourceInstance{
+				cachedAccessRequest("ar1", "test-app", "inst", provisioning.Success.String(), daily),
+			},
+			removed: true,
+		},
+		"other access request in the same group": {
+			accessRequests: []*v1.ResourceInstance{
+				cachedAccessRequest("ar1", "test-app", "inst", provisioning.Success.String(), daily),
+				cachedAccessRequest("ar2", "test-app", "inst", provisioning.Success.String(), daily),
+			},
+		},
+		"other access request in another group": {
+			accessRequests: []*v1.ResourceInstance{
+				cachedAccessRequest("ar2", "test-app", "inst", provisioning.Success.String(), &management.AccessRequestSpecQuota{Interval: provisioning.Monthly.String(), Limit: 7}),
+			},
+			removed: true,
+		},
+		"other access request of another application": {
+			accessRequests: []*v1.ResourceInstance{
+				cachedAccessRequest("ar2", "other-app", "inst", provisioning.Success.String(), daily),
+			},
+			removed: true,
+		},
+		"other access request in another workspace": {
+			accessRequests: []*v1.ResourceInstance{
+				cachedAccessRequest("ar2", "test-app", "other-inst", provisioning.Success.String(), daily),
+			},
+			removed: true,
+		},
+		"other access request not provisioned": {
+			accessRequests: []*v1.ResourceInstance{
+				cachedAccessRequest("ar2", "test-app", "inst", provisioning.Error.String(), daily),
+			},
+			removed: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), testName, name)
+			removed := false
+			request := &mockAccessRequest{
+				id:      "ar1",
+				appName: "test-app",
+				values: map[string]string{
+					appIDAttr: "appID",
+				},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: &mockQuota{
+					interval: provisioning.Daily,
+					limit:    7,
+				},
+			}
+			prov := NewAccessProvisioner(ctx, mockAccessClient{removedFromGroup: &removed}, request, false, true, "test")
+			prov.cache = &mockCache{accessRequests: tc.accessRequests, instances: instances}
+
+			result := prov.Deprovision()
+			assert.Equal(t, provisioning.Success, result.GetStatus())
+			assert.Equal(t, tc.removed, removed)
+		})
+	}
+}
+
+func TestConsumerGroupRouteAccess(t *testing.T) {
+	appIDAttr := common.WksPrefixName("default", common.AttrAppID)
+	client := mockAccessClient{
+		routeACLs:    map[string]map[string]bool{},
+		groupMembers: map[string]map[string]bool{},
+	}
+	request := func(id, consumerID, routeID string) *mockAccessRequest {
+		return &mockAccessRequest{
+			id:      id,
+			appName: id,
+			values:  map[string]string{appIDAttr: consumerID},
+			details: map[string]interface{}{
+				common.AttrRouteID:       routeID,
+				common.AttrWorkspaceName: "default",
+			},
+			quota: &mockQuota{interval: provisioning.Daily, limit: 7, planName: "gold"},
+		}
+	}
+	// canCall checks the route acl for the consumer, or a consumer group of the consumer
+	canCall := func(consumerID, routeID string) bool {
+		for allowed := range client.routeACLs[routeID] {
+			if allowed == consumerID || client.groupMembers[allowed][consumerID] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, r := range []*mockAccessRequest{request("arA", "consumerA", "routeX"), request("arB", "consumerB", "routeY")} {
+		prov := NewAccessProvisioner(context.Background(), client, r, false, true, "test")
+		prov.cache = &mockCache{}
+		result, _ := prov.Provision()
+		assert.Equal(t, provisioning.Success, result.GetStatus())
+	}
+
+	// both consumers share the quota of the plan group
+	assert.True(t, client.groupMembers["axway-gold-daily-7"]["consumerA"])
+	assert.True(t, client.groupMembers["axway-gold-daily-7"]["consumerB"])
+	assert.True(t, canCall("consumerA", "routeX"))
+	assert.True(t, canCall("consumerB", "routeY"))
+	assert.False(t, canCall("consumerA", "routeY"), "app A must not reach the route granted to app B")
+	assert.False(t, canCall("consumerB", "routeX"), "app B must not reach the route granted to app A")
+
+	prov := NewAccessProvisioner(context.Background(), client, request("arA", "consumerA", "routeX"), false, true, "test")
+	prov.cache = &mockCache{}
+	assert.Equal(t, provisioning.Success, prov.Deprovision().GetStatus())
+	assert.False(t, canCall("consumerA", "routeX"))
+	assert.True(t, canCall("consumerB", "routeY"))
+}
+
+func TestConsumerGroupPlanChange(t *testing.T) {
+	appIDAttr := common.WksPrefixName("default", common.AttrAppID)
+	instances := map[string]*v1.ResourceInstance{"inst": cachedInstance("inst", "default")}
+	cases := map[string]struct {
+		quota          provisioning.Quota
+		groups         []string
+		accessRequests []*v1.ResourceInstance
+		groupsErr      bool
+		result         provisioning.Status
+		expectGroups   []string
+	}{
+		"plan change": {
+			quota:        &mockQuota{interval: provisioning.Daily, limit: 100, planName: "silver"},
+			groups:       []string{"axway-gold-daily-7"},
+			result:       provisioning.Success,
+			expectGroups: []string{"axway-silver-daily-100"},
+		},
+		"move to an unlimited plan": {
+			groups:       []string{"axway-gold-daily-7"},
+			result:       provisioning.Success,
+			expectGroups: []string{},
+		},
+		"group of another access request kept": {
+			quota:  &mockQuota{interval: provisioning.Daily, limit: 100, planName: "silver"},
+			groups: []string{"axway-gold-daily-7", "axway-daily-7"},
+			accessRequests: []*v1.ResourceInstance{
+				cachedAccessRequest("ar2", "test-app", "inst", provisioning.Success.String(), &management.AccessRequestSpecQuota{Interval: provisioning.Daily.String(), Limit: 7}),
+			},
+			result:       provisioning.Success,
+			expectGroups: []string{"axway-daily-7", "axway-silver-daily-100"},
+		},
+		"current group kept": {
+			quota:        &mockQuota{interval: provisioning.Daily, limit: 7, planName: "gold"},
+			groups:       []string{"axway-gold-daily-7"},
+			result:       provisioning.Success,
+			expectGroups: []string{"axway-gold-daily-7"},
+		},
+		"error getting the groups of the consumer": {
+			quota:     &mockQuota{interval: provisioning.Daily, limit: 100, planName: "silver"},
+			groups:    []string{"axway-gold-daily-7"},
+			groupsErr: true,
+			result:    provisioning.Error,
+		},
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
 			ctx := context.WithValue(context.Background(), testName, name)
+			client := mockAccessClient{groupMembers: map[string]map[string]bool{}, consumerGroupsErr: tc.groupsErr}
+			for _, group := range tc.groups {
+				client.groupMembers[group] = map[string]bool{"appID": true}
+			}
+			request := &mockAccessRequest{
+				id:      "ar1",
+				appName: "test-app",
+				values:  map[string]string{appIDAttr: "appID"},
+				details: map[string]interface{}{
+					common.AttrRouteID:       "routeID",
+					common.AttrWorkspaceName: "default",
+				},
+				quota: tc.quota,
+			}
+			prov := NewAccessProvisioner(ctx, client, request, false, true, "test")
+			prov.cache = &mockCache{accessRequests: tc.accessRequests, instances: instances}
 
-			result := NewAccessProvisioner(ctx, tc.client, &tc.request, tc.aclDisable, "test").Deprovision()
+			result, _ := prov.Provision()
 			assert.Equal(t, tc.result, result.GetStatus())
+			if tc.result != provisioning.Success {
+				return
+			}
+			groups, _ := client.ConsumerGroupsOfConsumer(ctx, "appID")
+			assert.ElementsMatch(t, tc.expectGroups, groups)
 		})
 	}
 }
@@ -2,10 +2,14 @@ package application
 
 import (
 	"context"
+	"fmt"
+
+	klib "github.com/kong/go-kong/kong"
 
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
 	"github.com/Axway/agent-sdk/pkg/util/log"
 	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
 )
 
 const (
@@ -15,6 +19,8 @@ const (
 )
 
 type appClient interface {
+	EnsureConsumer(ctx context.Context, id, name string, tags []string) (*klib.Consumer, error)
+	AddConsumerACL(ctx context.Context, id string) error
 	DeleteConsumer(ctx context.Context, id string) error
 }
 
@@ -22,6 +28,8 @@ type appRequest interface {
 	GetApplicationDetailsValue(key string) string
 	// GetManagedApplicationName returns the name of the managed application for this credential
 	GetManagedApplicationName() string
+	// GetTeamName gets the owning team name for the managed application
+	GetTeamName() string
 	// GetID returns the ID of the resource for the request
 	GetID() string
 }
@@ -32,18 +40,24 @@ type AppProvisioner struct {
 	client      appClient
 	appName     string
 	appID       string
+	teamName    string
+	envName     string
+	workspaces  []string
 	consumerIDs map[string]string
 }
 
-func NewApplicationProvisioner(ctx context.Context, client appClient, request appRequest, workspaces []string) AppProvisioner {
+func NewApplicationProvisioner(ctx context.Context, client appClient, request appRequest, workspaces []string, envName string) AppProvisioner {
 	a := AppProvisioner{
-		ctx: context.Background(),
+		ctx: ctx,
 		logger: log.NewFieldLogger().
 			WithComponent("AppProvisioner").
 			WithPackage("application"),
-		client:  client,
-		appName: request.GetManagedApplicationName(),
-		appID:   request.GetID(),
+		client:     client,
+		appName:    request.GetManagedApplicationName(),
+		appID:      request.GetID(),
+		teamName:   request.GetTeamName(),
+		envName:    envName,
+		workspaces: workspaces,
 	}
 	if a.appName != "" {
 		a.logger = a.logger.WithField(logFieldAppName, a.appName)
@@ -63,10 +77,33 @@ func NewApplicationProvisioner(ctx context.Context, client appClient, request ap
 	return a
 }
 
+// Provision creates the consumer of the application, and its acl group, in every workspace. The consumer ids are saved
+// in the agent details of the application, consumers created before a failure are saved too to be removed on deletion
 func (a AppProvisioner) Provision() provisioning.RequestStatus {
-	// No op for app provisioning, consumer to represent application will
-	// be created while provisioning access request
-	return provisioning.NewRequestStatusBuilder().Success()
+	a.logger.Info("provisioning application")
+
+	rs := provisioning.NewRequestStatusBuilder()
+	tags := kong.ConsumerTags(a.teamName, a.appName, a.envName)
+	for _, workspace := range a.workspaces {
+		log := a.logger.WithField(common.AttrWorkspaceName, workspace)
+		ctx := context.WithValue(a.ctx, common.ContextWorkspace, workspace)
+		consumer, err := a.client.EnsureConsumer(ctx, a.appID, a.appName, tags)
+		if err != nil {
+			log.WithError(err).Error("error creating kong consumer")
+			return rs.SetMessage(fmt.Sprintf("could not create a consumer in kong workspace %s", workspace)).Failed()
+		}
+		log = log.WithField(logFieldConsumerID, *consumer.ID)
+		rs.AddProperty(common.WksPrefixName(workspace, common.AttrAppID), *consumer.ID)
+
+		if err := a.client.AddConsumerACL(ctx, *consumer.ID); err != nil {
+			log.WithError(err).Error("error adding acl group to kong consumer")
+			return rs.SetMessage(fmt.Sprintf("could not add the consumer acl group in kong workspace %s", workspace)).Failed()
+		}
+		log.Debug("provisioned consumer")
+	}
+	a.logger.Info("provisioned application")
+
+	return rs.Success()
 }
 
 func (a AppProvisioner) Deprovision() provisioning.RequestStatus {
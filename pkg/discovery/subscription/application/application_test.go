@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"testing"
 
+	klib "github.com/kong/go-kong/kong"
+
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
 	"github.com/Axway/agent-sdk/pkg/util/log"
 	"github.com/Axway/agents-kong/pkg/common"
@@ -15,6 +17,29 @@ const testName log.ContextField = "testName"
 
 type mockAppClient struct {
 	deleteErr bool
+	// ensureErrWorkspace - the workspace failing to create the consumer
+	ensureErrWorkspace string
+	aclErr             bool
+	// consumerTags - the tags of the consumers created, per workspace
+	consumerTags map[string][]string
+}
+
+func (m mockAppClient) EnsureConsumer(ctx context.Context, id, name string, tags []string) (*klib.Consumer, error) {
+	workspace := common.GetStringValueFromCtx(ctx, common.ContextWorkspace)
+	if workspace == m.ensureErrWorkspace {
+		return nil, fmt.Errorf("error")
+	}
+	if m.consumerTags != nil {
+		m.consumerTags[workspace] = tags
+	}
+	return &klib.Consumer{ID: klib.String(workspace + "-consumer"), CustomID: klib.String(id), Username: klib.String(name)}, nil
+}
+
+func (m mockAppClient) AddConsumerACL(ctx context.Context, id string) error {
+	if m.aclErr {
+		return fmt.Errorf("error")
+	}
+	return nil
 }
 
 func (m mockAppClient) DeleteConsumer(ctx context.Context, id string) error {
@@ -28,6 +53,7 @@ type mockApplicationRequest struct {
 	values map[string]string
 	name   string
 	id     string
+	team   string
 }
 
 func (m mockApplicationRequest) GetApplicationDetailsValue(key string) string {
@@ -44,26 +70,60 @@ func (m mockApplicationRequest) GetManagedApplicationName() string {
 	return m.name
 }
 
+func (m mockApplicationRequest) GetTeamName() string {
+	return m.team
+}
+
 func (m mockApplicationRequest) GetID() string {
 	return m.id
 }
 
 func TestProvision(t *testing.T) {
+	workspaces := []string{common.DefaultWorkspace, "team"}
+	request := mockApplicationRequest{name: "appName", id: "appID", team: "finance"}
 	testCases := map[string]struct {
-		client       mockAppClient
-		request      mockApplicationRequest
-		expectStatus provisioning.Status
+		client           mockAppClient
+		expectStatus     provisioning.Status
+		expectProperties map[string]string
 	}{
-		"success when provisioning a managed application with no op": {
+		"consumers provisioned in every workspace": {
+			client:       mockAppClient{consumerTags: map[string][]string{}},
 			expectStatus: provisioning.Success,
+			expectProperties: map[string]string{
+				common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID): "default-consumer",
+				common.WksPrefixName("team", common.AttrAppID):                  "team-consumer",
+			},
+		},
+		"error creating the consumer of a workspace": {
+			client:       mockAppClient{ensureErrWorkspace: "team"},
+			expectStatus: provisioning.Error,
+			expectProperties: map[string]string{
+				common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID): "default-consumer",
+			},
+		},
+		"error adding the consumer acl group": {
+			client:       mockAppClient{aclErr: true},
+			expectStatus: provisioning.Error,
+			expectProperties: map[string]string{
+				common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID): "default-consumer",
+			},
 		},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
 			ctx := context.WithValue(context.Background(), testName, name)
 
-			result := NewApplicationProvisioner(ctx, tc.client, &tc.request, []string{common.DefaultWorkspace}).Provision()
+			result := NewApplicationProvisioner(ctx, tc.client, &request, workspaces, "env").Provision()
 			assert.Equal(t, tc.expectStatus, result.GetStatus())
+			assert.Equal(t, tc.expectProperties, result.GetProperties())
+			if tc.expectStatus == provisioning.Error {
+				assert.Contains(t, result.GetMessage(), "kong workspace")
+			}
+			for _, workspace := range workspaces {
+				if tags, ok := tc.client.consumerTags[workspace]; ok {
+					assert.Equal(t, []string{"axway-team:finance", "axway-app:appName", "axway-env:env"}, tags)
+				}
+			}
 		})
 	}
 }
@@ -108,7 +168,7 @@ func TestDeleteConsumer(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			ctx := context.WithValue(context.Background(), testName, name)
 
-			result := NewApplicationProvisioner(ctx, tc.client, &tc.request, []string{common.DefaultWorkspace}).Deprovision()
+			result := NewApplicationProvisioner(ctx, tc.client, &tc.request, []string{common.DefaultWorkspace}, "env").Deprovision()
 			assert.Equal(t, tc.expectStatus, result.GetStatus())
 		})
 	}
@@ -0,0 +1,82 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// errAPIKeyInUse - the supplied api key is the key of another consumer, reported like a rejected create
+var errAPIKeyInUse = errors.New("failed to create api-key credential")
+
+// APIKeyRules - the rules a consumer supplied api key must follow, a zero maximum length or an empty charset does
+// not restrict the api key
+type APIKeyRules struct {
+	MinLength int
+	MaxLength int
+	// Charset - the characters allowed in the api key, as the content of a regular expression character class
+	Charset string
+}
+
+// validate returns the reason the api key does not follow the rules
+func (r APIKeyRules) validate(key string) error {
+	if len(key) < r.MinLength {
+		return fmt.Errorf("the api key must have at least %d characters", r.MinLength)
+	}
+	if r.MaxLength > 0 && len(key) > r.MaxLength {
+		return fmt.Errorf("the api key must not have more than %d characters", r.MaxLength)
+	}
+	if r.Charset == "" {
+		return nil
+	}
+	charset, err := regexp.Compile(fmt.Sprintf("^[%s]+$", r.Charset))
+	if err != nil {
+		return fmt.Errorf("the api key charset %s is invalid", r.Charset)
+	}
+	if !charset.MatchString(key) {
+		return fmt.Errorf("the api key may only contain the characters %s", r.Charset)
+	}
+	return nil
+}
+
+// Description returns the rules in the description of the api key request property
+func (r APIKeyRules) Description() string {
+	rules := []string{}
+	if r.MinLength > 0 {
+		rules = append(rules, fmt.Sprintf("at least %d characters", r.MinLength))
+	}
+	if r.MaxLength > 0 {
+		rules = append(rules, fmt.Sprintf("at most %d characters", r.MaxLength))
+	}
+	if r.Charset != "" {
+		rules = append(rules, fmt.Sprintf("only characters from %s", r.Charset))
+	}
+	desc := "Leave empty to generate the key. A supplied key must be unique in the workspace"
+	if len(rules) > 0 {
+		desc += " and have " + strings.Join(rules, ", ")
+	}
+	return desc
+}
+
+// consumerAPIKey returns the api key supplied with the credential request once validated, an empty key is generated
+func (p credentialProvisioner) consumerAPIKey(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	if err := p.apiKeyRules.validate(key); err != nil {
+		return "", err
+	}
+	exists, err := p.client.AuthKeyExists(ctx, key)
+	if err != nil {
+		p.logger.WithError(err).Error("could not check the supplied api key is unique")
+		return "", fmt.Errorf("could not check the api key is unique")
+	}
+	if exists {
+		// the request fails like a rejected create, saying the key is in use would reveal the key of another consumer
+		p.logger.Info("the supplied api key is already in use")
+		return "", errAPIKeyInUse
+	}
+	return key, nil
+}
@@ -1,6 +1,8 @@
 package credential
 
 import (
+	"strings"
+
 	"github.com/Axway/agents-kong/pkg/common"
 	"github.com/google/uuid"
 	klib "github.com/kong/go-kong/kong"
@@ -12,13 +14,21 @@ type kongCredentialBuilder struct {
 	name         *string
 	createdAt    *int
 	authKey      *string
+	ttl          *int
 	consumerTags []*string
 	username     *string
 	password     *string
 	clientID     *string
 	clientSecret *string
 	clientType   *string
+	hashSecret   *bool
 	redirectURIs []*string
+	jwtKey       *string
+	secret       *string
+	algorithm    *string
+	rsaPublicKey *string
+	subjectName  *string
+	caCert       *klib.CACertificate
 }
 
 type credentialMetaData struct {
@@ -27,6 +37,10 @@ type credentialMetaData struct {
 	oauthServerName string
 	appType         string
 	audience        string
+	jwtAlgorithm    string
+	jwtPublicKey    string
+	mtlsCertificate string
+	apiKey          string
 }
 
 func NewKongCredentialBuilder() *kongCredentialBuilder {
@@ -66,6 +80,14 @@ func (b *kongCredentialBuilder) WithAuthKey(authKey string) *kongCredentialBuild
 	return b
 }
 
+// WithTTL sets the seconds a key auth credential is valid for, 0 never expires
+func (b *kongCredentialBuilder) WithTTL(ttl int) *kongCredentialBuilder {
+	if ttl > 0 {
+		b.ttl = &ttl
+	}
+	return b
+}
+
 func (b *kongCredentialBuilder) WithConsumerTags(consumerTags []*string) *kongCredentialBuilder {
 	b.consumerTags = consumerTags
 	return b
@@ -115,16 +137,66 @@ func (b *kongCredentialBuilder) WithClientSecret(clientSecret string) *kongCrede
 	return b
 }
 
+// WithJWTKey adds a random UUID if passed an empty string
+func (b *kongCredentialBuilder) WithJWTKey(key string) *kongCredentialBuilder {
+	if key == "" {
+		randomKey := uuid.New().String()
+		b.jwtKey = &randomKey
+		return b
+	}
+	b.jwtKey = &key
+	return b
+}
+
+// WithSecret adds a random UUID if passed an empty string
+func (b *kongCredentialBuilder) WithSecret(secret string) *kongCredentialBuilder {
+	if secret == "" {
+		randomSecret := uuid.New().String()
+		b.secret = &randomSecret
+		return b
+	}
+	b.secret = &secret
+	return b
+}
+
+func (b *kongCredentialBuilder) WithAlgorithm(algorithm string) *kongCredentialBuilder {
+	b.algorithm = &algorithm
+	return b
+}
+
+func (b *kongCredentialBuilder) WithRSAPublicKey(publicKey string) *kongCredentialBuilder {
+	b.rsaPublicKey = &publicKey
+	return b
+}
+
+func (b *kongCredentialBuilder) WithSubjectName(subjectName string) *kongCredentialBuilder {
+	b.subjectName = &subjectName
+	return b
+}
+
+// WithCACertificate sets the ca certificate reference, nil allows any ca trusted by the mtls-auth plugin
+func (b *kongCredentialBuilder) WithCACertificate(caCert *klib.CACertificate) *kongCredentialBuilder {
+	if caCert != nil {
+		b.caCert = &klib.CACertificate{ID: caCert.ID}
+	}
+	return b
+}
+
+// WithProvData applies the redirect urls and application type of the credential request to an oauth2 credential.
+// Kong generates a secret for every client, the secret of a public client is hashed so it can not be retrieved
 func (b *kongCredentialBuilder) WithProvData(provData map[string]interface{}) *kongCredentialBuilder {
 	pData := getCredProvData(provData)
-	if len(pData.cors) > 0 {
+	if len(pData.redirectURLs) > 0 {
 		var redirectUris []*string
-		for i := range pData.cors {
-			redirectUris = append(redirectUris, &pData.cors[i])
+		for i := range pData.redirectURLs {
+			redirectUris = append(redirectUris, &pData.redirectURLs[i])
 		}
 		b.redirectURIs = redirectUris
 	}
 	b.clientType = &pData.appType
+	if pData.appType == common.OAuthClientTypePublic {
+		b.hashSecret = klib.Bool(true)
+	}
 
 	return b
 }
@@ -140,6 +212,7 @@ func (b *kongCredentialBuilder) ToOauth2() *klib.Oauth2Credential {
 		ClientSecret: b.clientSecret,
 		RedirectURIs: b.redirectURIs,
 		ClientType:   b.clientType,
+		HashSecret:   b.hashSecret,
 	}
 }
 
@@ -161,16 +234,53 @@ func (b *kongCredentialBuilder) ToKeyAuth() *klib.KeyAuth {
 		CreatedAt: b.createdAt,
 		Key:       b.authKey,
 		Tags:      b.consumerTags,
+		TTL:       b.ttl,
+	}
+}
+
+func (b *kongCredentialBuilder) ToJWT() *klib.JWTAuth {
+	return &klib.JWTAuth{
+		Consumer:     b.consumer,
+		ID:           b.id,
+		CreatedAt:    b.createdAt,
+		Tags:         b.consumerTags,
+		Key:          b.jwtKey,
+		Secret:       b.secret,
+		Algorithm:    b.algorithm,
+		RSAPublicKey: b.rsaPublicKey,
+	}
+}
+
+func (b *kongCredentialBuilder) ToHMAC() *klib.HMACAuth {
+	return &klib.HMACAuth{
+		Consumer:  b.consumer,
+		ID:        b.id,
+		CreatedAt: b.createdAt,
+		Tags:      b.consumerTags,
+		Username:  b.username,
+		Secret:    b.secret,
+	}
+}
+
+func (b *kongCredentialBuilder) ToMTLS() *klib.MTLSAuth {
+	return &klib.MTLSAuth{
+		Consumer:      b.consumer,
+		ID:            b.id,
+		CreatedAt:     b.createdAt,
+		Tags:          b.consumerTags,
+		SubjectName:   b.subjectName,
+		CACertificate: b.caCert,
 	}
 }
 
 func getCredProvData(credData map[string]interface{}) credentialMetaData {
 	// defaults
 	credMetaData := credentialMetaData{
-		cors:         []string{"*"},
+		cors:         []string{},
 		redirectURLs: []string{},
-		appType:      "Confidential",
+		appType:      common.OAuthClientTypeConfidential,
 		audience:     "",
+		jwtAlgorithm: common.JWTAlgorithmHS256,
 	}
 
 	// get cors from credential request
@@ -193,7 +303,22 @@ func getCredProvData(credData map[string]interface{}) credentialMetaData {
 	}
 	// credential type field
 	if data, ok := credData[common.ApplicationTypeField]; ok && data != nil {
-		credMetaData.appType = data.(string)
+		credMetaData.appType = strings.ToLower(data.(string))
+	}
+	// jwt algorithm and consumer supplied public key
+	if data, ok := credData[common.JWTAlgorithmField]; ok && data != nil {
+		credMetaData.jwtAlgorithm = data.(string)
+	}
+	if data, ok := credData[common.JWTPublicKeyField]; ok && data != nil {
+		credMetaData.jwtPublicKey = data.(string)
+	}
+	// consumer supplied certificate or csr for mtls
+	if data, ok := credData[common.MTLSCertificateField]; ok && data != nil {
+		credMetaData.mtlsCertificate = data.(string)
+	}
+	// consumer supplied api key
+	if data, ok := credData[common.APIKeyField]; ok && data != nil {
+		credMetaData.apiKey = data.(string)
 	}
 
 	return credMetaData
@@ -2,10 +2,13 @@ package credential
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agent-sdk/pkg/authz/oauth"
 	"github.com/Axway/agent-sdk/pkg/util/log"
 	"github.com/Axway/agents-kong/pkg/common"
 	"github.com/google/uuid"
@@ -13,19 +16,39 @@ import (
 )
 
 type credentialProvisioner struct {
-	ctx     context.Context
-	client  credentialClient
-	logger  log.FieldLogger
-	request credRequest
+	ctx                 context.Context
+	client              credentialClient
+	logger              log.FieldLogger
+	request             credRequest
+	rotationGracePeriod time.Duration
+	apiKeyRules         APIKeyRules
+	cache               accessRequestCache
 }
 
 type credentialClient interface {
+	CreateConsumer(ctx context.Context, id, name string) (*klib.Consumer, error)
+	AddConsumerACLGroup(ctx context.Context, id, group string) error
+	DeleteConsumer(ctx context.Context, id string) error
 	DeleteOauth2(ctx context.Context, consumerID, clientID string) error
 	DeleteHttpBasic(ctx context.Context, consumerID, username string) error
 	DeleteAuthKey(ctx context.Context, consumerID, authKey string) error
 	CreateHttpBasic(ctx context.Context, consumerID string, basicAuth *klib.BasicAuth) (*klib.BasicAuth, error)
 	CreateOauth2(ctx context.Context, consumerID string, oauth2 *klib.Oauth2Credential) (*klib.Oauth2Credential, error)
 	CreateAuthKey(ctx context.Context, consumerID string, keyAuth *klib.KeyAuth) (*klib.KeyAuth, error)
+	AuthKeyExists(ctx context.Context, key string) (bool, error)
+	DeleteJWT(ctx context.Context, consumerID, jwtID string) error
+	CreateJWT(ctx context.Context, consumerID string, jwt *klib.JWTAuth) (*klib.JWTAuth, error)
+	DeleteHMAC(ctx context.Context, consumerID, hmacID string) error
+	CreateHMAC(ctx context.Context, consumerID string, hmac *klib.HMACAuth) (*klib.HMACAuth, error)
+	DeleteMTLS(ctx context.Context, consumerID, mtlsID string) error
+	CreateMTLS(ctx context.Context, consumerID string, mtls *klib.MTLSAuth) (*klib.MTLSAuth, error)
+	ListCACertificates(ctx context.Context) ([]*klib.CACertificate, error)
+	EnsureSuspendedConsumer(ctx context.Context, appConsumerID string) (*klib.Consumer, error)
+	DenyConsumer(ctx context.Context, consumerID string) error
+	AllowConsumer(ctx context.Context, consumerID string) error
+	MoveCredential(ctx context.Context, collection, credentialID, consumerID string, credential interface{}) error
+	ExpireCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time) error
+	RenewCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error
 }
 
 type credRequest interface {
@@ -34,16 +57,23 @@ type credRequest interface {
 	GetCredentialDetailsValue(key string) string
 	GetCredentialData() map[string]interface{}
 	GetCredentialType() string
+	IsIDPCredential() bool
+	GetIDPProvider() oauth.Provider
+	GetIDPCredentialData() provisioning.IDPCredentialData
+	GetCredentialAction() provisioning.CredentialAction
+	GetCredentialExpirationDays() int
 }
 
-func NewCredentialProvisioner(ctx context.Context, client credentialClient, req credRequest) credentialProvisioner {
+func NewCredentialProvisioner(ctx context.Context, client credentialClient, req credRequest, rotationGracePeriod time.Duration, apiKeyRules APIKeyRules) credentialProvisioner {
 	a := credentialProvisioner{
-		ctx: context.Background(),
+		ctx: ctx,
 		logger: log.NewFieldLogger().
 			WithComponent("credentialProvisioner").
 			WithPackage("credential"),
-		client:  client,
-		request: req,
+		client:              client,
+		request:             req,
+		rotationGracePeriod: rotationGracePeriod,
+		apiKeyRules:         apiKeyRules,
 	}
 	return a
 }
@@ -52,21 +82,45 @@ func parseWorkspace(crdName, crdType string) string {
 	return strings.TrimSuffix(crdName, fmt.Sprintf("-%s", crdType))
 }
 
+// credentialTypes - the credential request definitions the agent registers, their names are the workspace followed by
+// the type, i.e. default-api-key
+var credentialTypes = []string{
+	provisioning.APIKeyCRD,
+	provisioning.BasicAuthCRD,
+	provisioning.OAuthSecretCRD,
+	common.JWTCRD,
+	common.HMACCRD,
+	provisioning.MtlsCRD,
+}
+
+// parseCredentialType returns the workspace and type of the credential request definition, the type is matched on
+// the end of the name as workspaces may contain the name of another type, i.e. jwt-team-mtls-key
 func parseCredentialType(crdName string) (string, string) {
-	switch {
-	case strings.Contains(crdName, provisioning.APIKeyCRD):
-		return parseWorkspace(crdName, provisioning.APIKeyCRD), provisioning.APIKeyCRD
-	case strings.Contains(crdName, provisioning.BasicAuthARD):
-		return parseWorkspace(crdName, provisioning.BasicAuthCRD), provisioning.BasicAuthCRD
-	case strings.Contains(crdName, provisioning.OAuthSecretCRD):
-		return parseWorkspace(crdName, provisioning.OAuthSecretCRD), provisioning.OAuthSecretCRD
+	for _, crdType := range credentialTypes {
+		if strings.HasSuffix(crdName, "-"+crdType) {
+			return parseWorkspace(crdName, crdType), crdType
+		}
 	}
 	return "", ""
 }
 
+// credentialType returns the workspace and type of the credential request. The workspace of an external identity
+// provider credential is found by removing the provider specific suffix from the definition name
+func (p credentialProvisioner) credentialType() (string, string) {
+	if p.request.IsIDPCredential() {
+		crdName := p.request.GetCredentialType()
+		idpCRD := common.IDPCRDName(p.request.GetIDPProvider().GetName())
+		if !strings.HasSuffix(crdName, "-"+idpCRD) {
+			return "", ""
+		}
+		return parseWorkspace(crdName, idpCRD), provisioning.OAuthIDPCRD
+	}
+	return parseCredentialType(p.request.GetCredentialType())
+}
+
 func (p credentialProvisioner) Deprovision() provisioning.RequestStatus {
 	rs := provisioning.NewRequestStatusBuilder()
-	workspace, credentialType := parseCredentialType(p.request.GetCredentialType())
+	workspace, credentialType := p.credentialType()
 	if workspace == "" {
 		p.logger.Error("could not identify the workspace for the credential resource")
 		return rs.SetMessage("workspace not found").Failed()
@@ -83,15 +137,18 @@ func (p credentialProvisioner) Deprovision() provisioning.RequestStatus {
 		return rs.SetMessage("CredentialID cannot be empty").Failed()
 	}
 
-	ctx := context.WithValue(context.Background(), common.ContextWorkspace, workspace)
+	ctx := context.WithValue(p.ctx, common.ContextWorkspace, workspace)
 	log := p.logger.WithField("credentialID", credentialID).
 		WithField("consumerID", consumerID)
 	log.Info("Started credential de-provisioning")
 
+	owner := p.credentialOwner(consumerID)
+	p.deleteRotatedCredential(ctx, credentialType, owner)
+
 	switch credentialType {
 	case provisioning.APIKeyARD:
 		{
-			if err := p.client.DeleteAuthKey(ctx, consumerID, credentialID); err != nil {
+			if err := p.client.DeleteAuthKey(ctx, owner, credentialID); err != nil {
 				log.Info("API Key credential does not exist or it has already been deleted")
 				return rs.SetMessage("API Key credential does not exist or it has already been deleted").Success()
 			}
@@ -100,7 +157,7 @@ func (p credentialProvisioner) Deprovision() provisioning.RequestStatus {
 		}
 	case provisioning.BasicAuthARD:
 		{
-			if err := p.client.DeleteHttpBasic(ctx, consumerID, credentialID); err != nil {
+			if err := p.client.DeleteHttpBasic(ctx, owner, credentialID); err != nil {
 				log.Info("Basic auth credential does not exist or it has already been deleted")
 				return rs.SetMessage("Basic auth credential does not exist or it has already been deleted").Success()
 			}
@@ -109,20 +166,56 @@ func (p credentialProvisioner) Deprovision() provisioning.RequestStatus {
 		}
 	case provisioning.OAuthSecretCRD:
 		{
-			if err := p.client.DeleteOauth2(ctx, consumerID, credentialID); err != nil {
+			if err := p.client.DeleteOauth2(ctx, owner, credentialID); err != nil {
 				log.Info("OAuth2 credential does not exist or it has already been deleted")
 				return rs.SetMessage("OAuth2 credential does not exist or it has already been deleted").Success()
 			}
 			log.Info("OAuth2 successful de-provision")
 			return rs.SetMessage("OAuth2 credential successfully deleted.").Success()
 		}
+	case common.JWTCRD:
+		{
+			if err := p.client.DeleteJWT(ctx, owner, credentialID); err != nil {
+				log.Info("JWT credential does not exist or it has already been deleted")
+				return rs.SetMessage("JWT credential does not exist or it has already been deleted").Success()
+			}
+			log.Info("JWT successful de-provision")
+			return rs.SetMessage("JWT credential successfully deleted.").Success()
+		}
+	case common.HMACCRD:
+		{
+			if err := p.client.DeleteHMAC(ctx, owner, credentialID); err != nil {
+				log.Info("HMAC credential does not exist or it has already been deleted")
+				return rs.SetMessage("HMAC credential does not exist or it has already been deleted").Success()
+			}
+			log.Info("HMAC successful de-provision")
+			return rs.SetMessage("HMAC credential successfully deleted.").Success()
+		}
+	case provisioning.MtlsCRD:
+		{
+			if err := p.client.DeleteMTLS(ctx, owner, credentialID); err != nil {
+				log.Info("MTLS credential does not exist or it has already been deleted")
+				return rs.SetMessage("MTLS credential does not exist or it has already been deleted").Success()
+			}
+			log.Info("MTLS successful de-provision")
+			return rs.SetMessage("MTLS credential successfully deleted.").Success()
+		}
+	case provisioning.OAuthIDPCRD:
+		{
+			if err := p.client.DeleteConsumer(ctx, credentialID); err != nil {
+				log.WithError(err).Error("Could not delete the identity provider client consumer")
+				return rs.SetMessage("Failed to delete the identity provider client consumer").Failed()
+			}
+			log.Info("Identity provider client successful de-provision")
+			return rs.SetMessage("Identity provider client consumer successfully deleted.").Success()
+		}
 	}
 	return rs.SetMessage("Failed to identify credential type").Failed()
 }
 
 func (p credentialProvisioner) Provision() (provisioning.RequestStatus, provisioning.Credential) {
 	rs := provisioning.NewRequestStatusBuilder()
-	workspace, credentialType := parseCredentialType(p.request.GetCredentialType())
+	workspace, credentialType := p.credentialType()
 	if workspace == "" {
 		p.logger.Error("could not identify the workspace for the credential resource")
 		return rs.SetMessage("workspace not found").Failed(), nil
@@ -134,15 +227,32 @@ func (p credentialProvisioner) Provision() (provisioning.RequestStatus, provisio
 	kongBuilder := NewKongCredentialBuilder().
 		WithConsumerTags(consumerTags)
 
-	ctx := context.WithValue(context.Background(), common.ContextWorkspace, workspace)
+	ctx := context.WithValue(p.ctx, common.ContextWorkspace, workspace)
+	expiresAt := p.credentialExpiry()
 
 	log := p.logger.WithField("consumerID", consumerID)
 	log.Info("Started credential provisioning")
+	if origins := getCredProvData(p.request.GetCredentialData()).cors; len(origins) > 0 {
+		// kong does not allow the cors plugin on a consumer, preflight requests carry no credentials. The credential is
+		// provisioned, its status says the origins were not applied
+		log.WithField("origins", origins).Warn("The javascript origins of the credential are not applied, configure the cors plugin on the service or route")
+		rs.SetMessage(fmt.Sprintf("The javascript origins %s were not applied, kong can not apply cors to a consumer", strings.Join(origins, ", ")))
+	}
 
 	switch credentialType {
 	case provisioning.APIKeyARD:
 		{
-			keyAuth := kongBuilder.WithAuthKey("").
+			key, err := p.consumerAPIKey(ctx, getCredProvData(p.request.GetCredentialData()).apiKey)
+			if errors.Is(err, errAPIKeyInUse) {
+				log.WithError(err).Info("API key unsuccessful provisioning")
+				return rs.SetMessage("Failed to create api-key credential").Failed(), nil
+			}
+			if err != nil {
+				log.WithError(err).Info("API key unsuccessful provisioning")
+				return rs.SetMessage(err.Error()).Failed(), nil
+			}
+			keyAuth := kongBuilder.WithAuthKey(key).
+				WithTTL(keyAuthTTL(expiresAt)).
 				ToKeyAuth()
 			resp, err := p.client.CreateAuthKey(ctx, consumerID, keyAuth)
 			if err != nil {
@@ -152,8 +262,10 @@ func (p credentialProvisioner) Provision() (provisioning.RequestStatus, provisio
 			rs.AddProperty(common.AttrWorkspaceName, workspace)
 			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
 			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrSuppliedSecretHash, secretHash(key))
 			log.Info("API key successful provisioning")
-			return rs.Success(), provisioning.NewCredentialBuilder().SetAPIKey(*resp.Key)
+			cred := withExpiry(rs, provisioning.NewCredentialBuilder().SetAPIKey(*resp.Key), expiresAt)
+			return rs.Success(), cred
 		}
 	case provisioning.BasicAuthARD:
 		{
@@ -167,30 +279,136 @@ func (p credentialProvisioner) Provision() (provisioning.RequestStatus, provisio
 				log.Info("Basic auth unsuccessful provisioning")
 				return rs.SetMessage("Failed to create basic auth credential").Failed(), nil
 			}
+			err = p.scheduleExpiry(ctx, common.BasicAuthCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteHttpBasic(ctx, consumerID, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Info("Basic auth unsuccessful provisioning")
+				return rs.SetMessage("Failed to schedule the basic auth credential expiry").Failed(), nil
+			}
 			rs.AddProperty(common.AttrWorkspaceName, workspace)
 			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
 			rs.AddProperty(common.AttrCredentialID, *resp.ID)
 			rs.AddProperty(common.AttrCredUpdater, *resp.Username)
 			log.Info("Basic auth successful provisioning")
-			return rs.Success(), provisioning.NewCredentialBuilder().SetHTTPBasic(user, pass)
+			cred := withExpiry(rs, provisioning.NewCredentialBuilder().SetHTTPBasic(user, pass), expiresAt)
+			return rs.Success(), cred
 		}
 	case provisioning.OAuthSecretCRD:
 		{
-			oauth2 := kongBuilder.WithClientID("").
-				WithClientSecret("").
-				WithName("").
-				ToOauth2()
+			oauth2 := buildOauth2(kongBuilder, p.request.GetCredentialData())
 			resp, err := p.client.CreateOauth2(ctx, consumerID, oauth2)
 			if err != nil {
 				log.Info("Oauth2 unsuccessful provisioning")
 				return rs.SetMessage("Failed to create oauth2 credential").Failed(), nil
 			}
+			err = p.scheduleExpiry(ctx, common.OAuth2Credentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteOauth2(ctx, consumerID, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Info("Oauth2 unsuccessful provisioning")
+				return rs.SetMessage("Failed to schedule the oauth2 credential expiry").Failed(), nil
+			}
 			rs.AddProperty(common.AttrWorkspaceName, workspace)
 			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
 			rs.AddProperty(common.AttrCredentialID, *resp.ID)
 			rs.AddProperty(common.AttrCredUpdater, *resp.ClientID)
 			log.Info("OAuth2 successful provisioning")
-			return rs.Success(), provisioning.NewCredentialBuilder().SetOAuthIDAndSecret(*resp.ClientID, *resp.ClientSecret)
+			cred := withExpiry(rs, oauth2Credential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case common.JWTCRD:
+		{
+			jwt, err := buildJWT(kongBuilder, "", getCredProvData(p.request.GetCredentialData()))
+			if err != nil {
+				log.WithError(err).Info("JWT unsuccessful provisioning")
+				return rs.SetMessage(err.Error()).Failed(), nil
+			}
+			resp, err := p.client.CreateJWT(ctx, consumerID, jwt)
+			if err != nil {
+				log.Info("JWT unsuccessful provisioning")
+				return rs.SetMessage("Failed to create jwt credential").Failed(), nil
+			}
+			err = p.scheduleExpiry(ctx, common.JWTCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteJWT(ctx, consumerID, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Info("JWT unsuccessful provisioning")
+				return rs.SetMessage("Failed to schedule the jwt credential expiry").Failed(), nil
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrCredUpdater, *resp.Key)
+			rs.AddProperty(common.AttrSuppliedSecretHash, secretHash(suppliedSecret(credentialType, getCredProvData(p.request.GetCredentialData()))))
+			log.Info("JWT successful provisioning")
+			cred := withExpiry(rs, jwtCredential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case common.HMACCRD:
+		{
+			hmac := kongBuilder.WithUsername("").
+				WithSecret("").
+				ToHMAC()
+			resp, err := p.client.CreateHMAC(ctx, consumerID, hmac)
+			if err != nil {
+				log.Info("HMAC unsuccessful provisioning")
+				return rs.SetMessage("Failed to create hmac credential").Failed(), nil
+			}
+			err = p.scheduleExpiry(ctx, common.HMACCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteHMAC(ctx, consumerID, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Info("HMAC unsuccessful provisioning")
+				return rs.SetMessage("Failed to schedule the hmac credential expiry").Failed(), nil
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrCredUpdater, *resp.Username)
+			log.Info("HMAC successful provisioning")
+			cred := withExpiry(rs, hmacCredential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case provisioning.MtlsCRD:
+		{
+			mtls, err := p.buildMTLS(ctx, kongBuilder, getCredProvData(p.request.GetCredentialData()))
+			if err != nil {
+				log.WithError(err).Info("MTLS unsuccessful provisioning")
+				return rs.SetMessage(err.Error()).Failed(), nil
+			}
+			resp, err := p.client.CreateMTLS(ctx, consumerID, mtls)
+			if err != nil {
+				log.Info("MTLS unsuccessful provisioning")
+				return rs.SetMessage("Failed to create mtls credential").Failed(), nil
+			}
+			err = p.scheduleExpiry(ctx, common.MTLSCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteMTLS(ctx, consumerID, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Info("MTLS unsuccessful provisioning")
+				return rs.SetMessage("Failed to schedule the mtls credential expiry").Failed(), nil
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrSuppliedSecretHash, secretHash(suppliedSecret(credentialType, getCredProvData(p.request.GetCredentialData()))))
+			log.Info("MTLS successful provisioning")
+			cred := withExpiry(rs, mtlsCredential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case provisioning.OAuthIDPCRD:
+		{
+			if p.appHasQuota(workspace) {
+				log.Info("Identity provider client unsuccessful provisioning, the application has a quota")
+				return rs.SetMessage("Identity provider credentials are not supported for applications with a quota, kong can not apply the quota to the identity provider client").Failed(), nil
+			}
+			resp, err := p.bindIDPClient(ctx, consumerID)
+			if err != nil {
+				log.WithError(err).Info("Identity provider client unsuccessful provisioning")
+				return rs.SetMessage("Failed to create the identity provider client consumer").Failed(), nil
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, consumerID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrCredUpdater, *resp.CustomID)
+			log.Info("Identity provider client successful provisioning")
+			return rs.Success(), idpCredential(p.request.GetIDPCredentialData())
 		}
 	}
 	return rs.Failed(), nil
@@ -198,14 +416,14 @@ func (p credentialProvisioner) Provision() (provisioning.RequestStatus, provisio
 
 func (p credentialProvisioner) Update() (provisioning.RequestStatus, provisioning.Credential) {
 	rs := provisioning.NewRequestStatusBuilder()
-	workspace, credentialType := parseCredentialType(p.request.GetCredentialType())
+	workspace, credentialType := p.credentialType()
 	if workspace == "" {
 		p.logger.Error("could not identify the workspace for the credential resource")
 		return rs.SetMessage("workspace not found").Failed(), nil
 	}
 
 	consumerID := p.request.GetCredentialDetailsValue(common.AttrAppID)
-	if workspace == "" {
+	if consumerID == "" {
 		p.logger.Error("could not find the managed application ID on the resource")
 		return rs.SetMessage("managed application ID not found").Failed(), nil
 	}
@@ -215,80 +433,384 @@ func (p credentialProvisioner) Update() (provisioning.RequestStatus, provisionin
 	kongBuilder := NewKongCredentialBuilder().
 		WithConsumerTags(consumerTags)
 
-	ctx := context.Background()
+	ctx := context.WithValue(p.ctx, common.ContextWorkspace, workspace)
 	credentialID := p.request.GetCredentialDetailsValue(common.AttrCredentialID)
-	key := p.request.GetCredentialDetailsValue(common.AttrCredUpdater)
 	if credentialID == "" {
 		return rs.SetMessage("kongCredentialId cannot be empty").Failed(), nil
 	}
 
+	switch p.request.GetCredentialAction() {
+	case provisioning.Suspend:
+		return p.suspend(ctx, credentialType, consumerID, credentialID)
+	case provisioning.Enable:
+		return p.enable(ctx, credentialType, consumerID, credentialID)
+	}
+
+	// a suspended credential is rotated on the suspended consumer, it remains suspended
+	owner := p.credentialOwner(consumerID)
+	expiresAt := p.credentialExpiry()
+	if p.isRenewal(credentialType, expiresAt) {
+		// renewing a credential with a limited lifetime extends it, the credential keeps its secret
+		return p.renew(ctx, credentialType, owner, credentialID, expiresAt)
+	}
 	log := p.logger.WithField("credentialID", credentialID).
-		WithField("consumerID", consumerID)
+		WithField("consumerID", owner)
 	log.Info("Started credential update")
 
 	switch credentialType {
 	case provisioning.APIKeyARD:
 		{
-			if err := p.client.DeleteAuthKey(ctx, consumerID, credentialID); err != nil {
-				log.WithError(err).Error("Could not delete api-key credential")
-				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", consumerID, credentialID)).Failed(), nil
-			}
 			keyAuth := kongBuilder.WithAuthKey("").
+				WithTTL(keyAuthTTL(expiresAt)).
 				ToKeyAuth()
-			resp, err := p.client.CreateAuthKey(ctx, consumerID, keyAuth)
+			resp, err := p.client.CreateAuthKey(ctx, owner, keyAuth)
 			if err != nil {
 				log.WithError(err).Error("Could not create api-key credential")
 				return rs.SetMessage("Failed to create api-key credential").Failed(), nil
 			}
+			rotatedID, err := p.retireCredential(ctx, common.KeyAuthCredentials, credentialID,
+				func() error { return p.client.DeleteAuthKey(ctx, owner, credentialID) },
+				func() error { return p.client.DeleteAuthKey(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not delete api-key credential")
+				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", credentialID, consumerID)).Failed(), nil
+			}
 			rs.AddProperty(common.AttrWorkspaceName, workspace)
-			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
+			rs.AddProperty(common.AttrAppID, consumerID)
 			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrRotatedCredentialID, rotatedID)
+			rs.AddProperty(common.AttrSuppliedSecretHash, "")
+			if getCredProvData(p.request.GetCredentialData()).apiKey != "" {
+				rs.SetMessage("The supplied api key was not used, rotating an api key generates the new key")
+			}
 			log.Info("API Key successful update")
-			return rs.Success(), provisioning.NewCredentialBuilder().SetAPIKey(*resp.Key)
+			cred := withExpiry(rs, provisioning.NewCredentialBuilder().SetAPIKey(*resp.Key), expiresAt)
+			return rs.Success(), cred
 		}
 	case provisioning.BasicAuthARD:
 		{
-			if err := p.client.DeleteHttpBasic(ctx, consumerID, credentialID); err != nil {
-				log.WithError(err).Error("Could not delete basic auth credential")
-				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", consumerID, credentialID)).Failed(), nil
-			}
-			basicAuth := kongBuilder.WithUsername(key).
-				WithPassword("").
+			// the username of the replaced credential stays in use during the grace period
+			user := uuid.NewString()
+			pass := uuid.NewString()
+			basicAuth := kongBuilder.WithUsername(user).
+				WithPassword(pass).
 				ToBasicAuth()
-			resp, err := p.client.CreateHttpBasic(ctx, consumerID, basicAuth)
+			resp, err := p.client.CreateHttpBasic(ctx, owner, basicAuth)
 			if err != nil {
 				log.WithError(err).Error("Could not create basic auth credential")
 				return rs.SetMessage("Failed to create basic auth credential").Failed(), nil
 			}
+			err = p.scheduleExpiry(ctx, common.BasicAuthCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteHttpBasic(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not schedule the basic auth credential expiry")
+				return rs.SetMessage("Failed to schedule the basic auth credential expiry").Failed(), nil
+			}
+			rotatedID, err := p.retireCredential(ctx, common.BasicAuthCredentials, credentialID,
+				func() error { return p.client.DeleteHttpBasic(ctx, owner, credentialID) },
+				func() error { return p.client.DeleteHttpBasic(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not delete basic auth credential")
+				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", credentialID, consumerID)).Failed(), nil
+			}
 			rs.AddProperty(common.AttrWorkspaceName, workspace)
-			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
+			rs.AddProperty(common.AttrAppID, consumerID)
 			rs.AddProperty(common.AttrCredentialID, *resp.ID)
 			rs.AddProperty(common.AttrCredUpdater, *resp.Username)
+			rs.AddProperty(common.AttrRotatedCredentialID, rotatedID)
 			log.Info("Basic Auth successful update")
-			return rs.Success(), provisioning.NewCredentialBuilder().SetHTTPBasic(*resp.Username, *resp.Password)
+			cred := withExpiry(rs, provisioning.NewCredentialBuilder().SetHTTPBasic(user, pass), expiresAt)
+			return rs.Success(), cred
 		}
 	case provisioning.OAuthSecretCRD:
 		{
-			if err := p.client.DeleteOauth2(ctx, consumerID, credentialID); err != nil {
-				log.WithError(err).Error("Could not delete oauth2 credential")
-				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", consumerID, credentialID)).Failed(), nil
-			}
-			oauth2 := kongBuilder.WithClientID(key).
-				WithClientSecret("").
-				WithName("").
-				ToOauth2()
-			resp, err := p.client.CreateOauth2(ctx, consumerID, oauth2)
+			// the client id of the replaced credential stays in use during the grace period
+			oauth2 := buildOauth2(kongBuilder, p.request.GetCredentialData())
+			resp, err := p.client.CreateOauth2(ctx, owner, oauth2)
 			if err != nil {
 				log.WithError(err).Error("Could not create oauth2 credential")
 				return rs.SetMessage("Failed to create oauth2 credential").Failed(), nil
 			}
+			err = p.scheduleExpiry(ctx, common.OAuth2Credentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteOauth2(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not schedule the oauth2 credential expiry")
+				return rs.SetMessage("Failed to schedule the oauth2 credential expiry").Failed(), nil
+			}
+			rotatedID, err := p.retireCredential(ctx, common.OAuth2Credentials, credentialID,
+				func() error { return p.client.DeleteOauth2(ctx, owner, credentialID) },
+				func() error { return p.client.DeleteOauth2(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not delete oauth2 credential")
+				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", credentialID, consumerID)).Failed(), nil
+			}
 			rs.AddProperty(common.AttrWorkspaceName, workspace)
-			rs.AddProperty(common.AttrAppID, *resp.Consumer.ID)
+			rs.AddProperty(common.AttrAppID, consumerID)
 			rs.AddProperty(common.AttrCredentialID, *resp.ID)
 			rs.AddProperty(common.AttrCredUpdater, *resp.ClientID)
+			rs.AddProperty(common.AttrRotatedCredentialID, rotatedID)
 			log.Info("Oauth2 successful update")
-			return rs.Success(), provisioning.NewCredentialBuilder().SetOAuthIDAndSecret(*resp.ClientID, *resp.ClientSecret)
+			cred := withExpiry(rs, oauth2Credential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case common.JWTCRD:
+		{
+			// kong requires unique jwt keys, the replacement gets a new key while the replaced key stays in use
+			// during the grace period
+			jwt, err := buildJWT(kongBuilder, "", getCredProvData(p.request.GetCredentialData()))
+			if err != nil {
+				log.WithError(err).Error("Could not build jwt credential")
+				return rs.SetMessage(err.Error()).Failed(), nil
+			}
+			resp, err := p.client.CreateJWT(ctx, owner, jwt)
+			if err != nil {
+				log.WithError(err).Error("Could not create jwt credential")
+				return rs.SetMessage("Failed to create jwt credential").Failed(), nil
+			}
+			err = p.scheduleExpiry(ctx, common.JWTCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteJWT(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not schedule the jwt credential expiry")
+				return rs.SetMessage("Failed to schedule the jwt credential expiry").Failed(), nil
+			}
+			rotatedID, err := p.retireCredential(ctx, common.JWTCredentials, credentialID,
+				func() error { return p.client.DeleteJWT(ctx, owner, credentialID) },
+				func() error { return p.client.DeleteJWT(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not delete jwt credential")
+				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", credentialID, consumerID)).Failed(), nil
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, consumerID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrCredUpdater, *resp.Key)
+			rs.AddProperty(common.AttrRotatedCredentialID, rotatedID)
+			rs.AddProperty(common.AttrSuppliedSecretHash, secretHash(suppliedSecret(credentialType, getCredProvData(p.request.GetCredentialData()))))
+			log.Info("JWT successful update")
+			cred := withExpiry(rs, jwtCredential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case common.HMACCRD:
+		{
+			// kong requires unique hmac usernames, the replacement gets a new username while the replaced username
+			// stays in use during the grace period
+			hmac := kongBuilder.WithUsername("").
+				WithSecret("").
+				ToHMAC()
+			resp, err := p.client.CreateHMAC(ctx, owner, hmac)
+			if err != nil {
+				log.WithError(err).Error("Could not create hmac credential")
+				return rs.SetMessage("Failed to create hmac credential").Failed(), nil
+			}
+			err = p.scheduleExpiry(ctx, common.HMACCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteHMAC(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not schedule the hmac credential expiry")
+				return rs.SetMessage("Failed to schedule the hmac credential expiry").Failed(), nil
+			}
+			rotatedID, err := p.retireCredential(ctx, common.HMACCredentials, credentialID,
+				func() error { return p.client.DeleteHMAC(ctx, owner, credentialID) },
+				func() error { return p.client.DeleteHMAC(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not delete hmac credential")
+				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", credentialID, consumerID)).Failed(), nil
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, consumerID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrCredUpdater, *resp.Username)
+			rs.AddProperty(common.AttrRotatedCredentialID, rotatedID)
+			log.Info("HMAC successful update")
+			cred := withExpiry(rs, hmacCredential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case provisioning.MtlsCRD:
+		{
+			// kong requires a unique subject name for each ca certificate, the certificate of the replacement needs
+			// a new subject while the replaced certificate stays in use during the grace period
+			mtls, err := p.buildMTLS(ctx, kongBuilder, getCredProvData(p.request.GetCredentialData()))
+			if err != nil {
+				log.WithError(err).Error("Could not build mtls credential")
+				return rs.SetMessage(err.Error()).Failed(), nil
+			}
+			resp, err := p.client.CreateMTLS(ctx, owner, mtls)
+			if err != nil {
+				log.WithError(err).Error("Could not create mtls credential")
+				return rs.SetMessage("Failed to create mtls credential").Failed(), nil
+			}
+			err = p.scheduleExpiry(ctx, common.MTLSCredentials, *resp.ID, expiresAt,
+				func() error { return p.client.DeleteMTLS(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not schedule the mtls credential expiry")
+				return rs.SetMessage("Failed to schedule the mtls credential expiry").Failed(), nil
+			}
+			rotatedID, err := p.retireCredential(ctx, common.MTLSCredentials, credentialID,
+				func() error { return p.client.DeleteMTLS(ctx, owner, credentialID) },
+				func() error { return p.client.DeleteMTLS(ctx, owner, *resp.ID) })
+			if err != nil {
+				log.WithError(err).Error("Could not delete mtls credential")
+				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", credentialID, consumerID)).Failed(), nil
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, consumerID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrRotatedCredentialID, rotatedID)
+			rs.AddProperty(common.AttrSuppliedSecretHash, secretHash(suppliedSecret(credentialType, getCredProvData(p.request.GetCredentialData()))))
+			log.Info("MTLS successful update")
+			cred := withExpiry(rs, mtlsCredential(resp), expiresAt)
+			return rs.Success(), cred
+		}
+	case provisioning.OAuthIDPCRD:
+		{
+			// the client has been registered again with the identity provider, bind the new client id
+			if err := p.client.DeleteConsumer(ctx, credentialID); err != nil {
+				log.WithError(err).Error("Could not delete the identity provider client consumer")
+				return rs.SetMessage(fmt.Sprintf("Could not delete credential %s for consumer %s", credentialID, consumerID)).Failed(), nil
+			}
+			resp, err := p.bindIDPClient(ctx, consumerID)
+			if err != nil {
+				log.WithError(err).Error("Could not create the identity provider client consumer")
+				return rs.SetMessage("Failed to create the identity provider client consumer").Failed(), nil
+			}
+			if owner != consumerID {
+				// keep the new client consumer of a suspended credential suspended
+				if err := p.client.DenyConsumer(ctx, *resp.ID); err != nil {
+					log.WithError(err).Error("Could not suspend the identity provider client consumer")
+					return rs.SetMessage("Failed to suspend the identity provider client consumer").Failed(), nil
+				}
+				rs.AddProperty(common.AttrSuspendedConsumerID, *resp.ID)
+			}
+			rs.AddProperty(common.AttrWorkspaceName, workspace)
+			rs.AddProperty(common.AttrAppID, consumerID)
+			rs.AddProperty(common.AttrCredentialID, *resp.ID)
+			rs.AddProperty(common.AttrCredUpdater, *resp.CustomID)
+			log.Info("Identity provider client successful update")
+			return rs.Success(), idpCredential(p.request.GetIDPCredentialData())
 		}
 	}
 	return rs.SetMessage("Failed to identify credential type").Failed(), nil
 }
+
+// buildOauth2 creates the oauth2 credential with the redirect urls and application type of the request, kong
+// generates the secret of confidential clients
+func buildOauth2(builder *kongCredentialBuilder, credData map[string]interface{}) *klib.Oauth2Credential {
+	builder = builder.WithClientID("").
+		WithName("").
+		WithProvData(credData)
+	if getCredProvData(credData).appType != common.OAuthClientTypePublic {
+		builder = builder.WithClientSecret("")
+	}
+	return builder.ToOauth2()
+}
+
+// oauth2Credential returns the oauth2 credential data to central, public clients only get their client id
+func oauth2Credential(oauth2 *klib.Oauth2Credential) provisioning.Credential {
+	if oauth2.ClientType != nil && *oauth2.ClientType == common.OAuthClientTypePublic {
+		return provisioning.NewCredentialBuilder().SetOAuthID(*oauth2.ClientID)
+	}
+	return provisioning.NewCredentialBuilder().SetOAuthIDAndSecret(*oauth2.ClientID, *oauth2.ClientSecret)
+}
+
+// buildJWT creates the kong jwt credential. HS256 credentials get a generated secret, while
+// RS256 and ES256 credentials are verified using the public key supplied by the consumer
+func buildJWT(builder *kongCredentialBuilder, key string, provData credentialMetaData) (*klib.JWTAuth, error) {
+	builder = builder.WithJWTKey(key).
+		WithAlgorithm(provData.jwtAlgorithm)
+
+	switch provData.jwtAlgorithm {
+	case common.JWTAlgorithmHS256:
+		return builder.WithSecret("").ToJWT(), nil
+	case common.JWTAlgorithmRS256, common.JWTAlgorithmES256:
+		if provData.jwtPublicKey == "" {
+			return nil, fmt.Errorf("a public key is required for the %s algorithm", provData.jwtAlgorithm)
+		}
+		return builder.WithRSAPublicKey(provData.jwtPublicKey).ToJWT(), nil
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm %s", provData.jwtAlgorithm)
+}
+
+// jwtCredential returns the jwt credential data to central, the secret is only returned for HS256 credentials
+func jwtCredential(jwt *klib.JWTAuth) provisioning.Credential {
+	data := map[string]interface{}{
+		common.JWTKeyField:       *jwt.Key,
+		common.JWTAlgorithmField: *jwt.Algorithm,
+	}
+	if *jwt.Algorithm == common.JWTAlgorithmHS256 && jwt.Secret != nil {
+		data[common.JWTSecretField] = *jwt.Secret
+	}
+	return provisioning.NewCredentialBuilder().SetCredential(data)
+}
+
+// hmacCredential returns the hmac-auth username and secret to central
+func hmacCredential(hmac *klib.HMACAuth) provisioning.Credential {
+	return provisioning.NewCredentialBuilder().SetCredential(map[string]interface{}{
+		common.HMACUsernameField: *hmac.Username,
+		common.HMACSecretField:   *hmac.Secret,
+	})
+}
+
+// buildMTLS maps the consumer supplied certificate, or csr, to a kong mtls-auth credential. The issuing kong
+// ca certificate is referenced when it can be determined from a supplied certificate
+func (p credentialProvisioner) buildMTLS(ctx context.Context, builder *kongCredentialBuilder, provData credentialMetaData) (*klib.MTLSAuth, error) {
+	if provData.mtlsCertificate == "" {
+		return nil, fmt.Errorf("a certificate or certificate signing request is required")
+	}
+	subject, err := parseMTLSSubject(provData.mtlsCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	var caCert *klib.CACertificate
+	if subject.cert != nil {
+		caCerts, err := p.client.ListCACertificates(ctx)
+		if err != nil {
+			p.logger.WithError(err).Warn("could not list ca certificates, credential will not reference a ca")
+		}
+		caCert = findIssuingCA(subject.cert, caCerts)
+	}
+
+	return builder.WithSubjectName(subject.subjectName).
+		WithCACertificate(caCert).
+		ToMTLS(), nil
+}
+
+// mtlsCredential returns the subject name, and ca reference, kong will match the client certificate against
+func mtlsCredential(mtls *klib.MTLSAuth) provisioning.Credential {
+	data := map[string]interface{}{
+		common.MTLSSubjectNameField: *mtls.SubjectName,
+	}
+	if mtls.CACertificate != nil && mtls.CACertificate.ID != nil {
+		data[common.MTLSCACertificateField] = *mtls.CACertificate.ID
+	}
+	return provisioning.NewCredentialBuilder().SetCredential(data)
+}
+
+// bindIDPClient creates a consumer for the client registered with the identity provider, the openid-connect plugin
+// finds it by the client id in the consumer claim. Membership of the application acl group grants it the access
+// of the application consumer, but not its quotas
+func (p credentialProvisioner) bindIDPClient(ctx context.Context, appConsumerID string) (*klib.Consumer, error) {
+	if appConsumerID == "" {
+		return nil, errors.New("the application consumer has not been created")
+	}
+	clientID := p.request.GetIDPCredentialData().GetClientID()
+	if clientID == "" {
+		return nil, errors.New("the identity provider did not return a client id")
+	}
+
+	consumer, err := p.client.CreateConsumer(ctx, clientID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.client.AddConsumerACLGroup(ctx, *consumer.ID, appConsumerID); err != nil {
+		if delErr := p.client.DeleteConsumer(ctx, *consumer.ID); delErr != nil {
+			p.logger.WithError(delErr).Warn("could not remove the identity provider client consumer")
+		}
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// idpCredential returns the client registered with the identity provider to central
+func idpCredential(data provisioning.IDPCredentialData) provisioning.Credential {
+	return provisioning.NewCredentialBuilder().SetOAuthIDAndSecret(data.GetClientID(), data.GetClientSecret())
+}
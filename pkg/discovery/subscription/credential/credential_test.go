@@ -2,16 +2,77 @@ package credential
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/definitions"
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning/mock"
+	"github.com/Axway/agent-sdk/pkg/authz/oauth"
+	corecfg "github.com/Axway/agent-sdk/pkg/config"
 	"github.com/Axway/agent-sdk/pkg/util/log"
+	"github.com/Axway/agents-kong/pkg/common"
 	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
 )
 
 const testName log.ContextField = "testName"
 
-type mockCredentialClient struct{}
+type mockCredentialClient struct {
+	createJWTErr  bool
+	jwt           *klib.JWTAuth
+	createHMACErr bool
+	hmac          *klib.HMACAuth
+	caCerts       []*klib.CACertificate
+	mtls          *klib.MTLSAuth
+	aclGroupErr   bool
+	aclGroup      *string
+	deleted       *[]string
+	moveErr       bool
+	moved         *[]string
+	denied        *[]string
+	allowed       *[]string
+	expireErr     bool
+	expiring      *[]string
+	deleteErr     bool
+	renewErr      bool
+	renewed       *[]string
+	keyAuth       *klib.KeyAuth
+	oauth2        *klib.Oauth2Credential
+	existingKey   string
+	keyLookupErr  bool
+}
+
+func (mockCredentialClient) CreateConsumer(ctx context.Context, id, name string) (*klib.Consumer, error) {
+	return &klib.Consumer{ID: klib.String("idpConsumerID"), CustomID: &id, Username: &name}, nil
+}
+
+func (m mockCredentialClient) AddConsumerACLGroup(ctx context.Context, id, group string) error {
+	if m.aclGroupErr {
+		return fmt.Errorf("error")
+	}
+	if m.aclGroup != nil {
+		*m.aclGroup = group
+	}
+	return nil
+}
+
+func (m mockCredentialClient) DeleteConsumer(ctx context.Context, id string) error {
+	if m.deleted != nil {
+		*m.deleted = append(*m.deleted, id)
+	}
+	return nil
+}
 
 func (mockCredentialClient) DeleteOauth2(ctx context.Context, consumerID, clientID string) error {
 	return nil
@@ -21,39 +82,231 @@ func (mockCredentialClient) DeleteHttpBasic(ctx context.Context, consumerID, use
 	return nil
 }
 
-func (mockCredentialClient) DeleteAuthKey(ctx context.Context, consumerID, authKey string) error {
+func (m mockCredentialClient) DeleteAuthKey(ctx context.Context, consumerID, authKey string) error {
+	if m.deleteErr && authKey == "credID" {
+		return fmt.Errorf("error")
+	}
+	if m.deleted != nil {
+		*m.deleted = append(*m.deleted, consumerID+"/"+authKey)
+	}
 	return nil
 }
 
 func (mockCredentialClient) CreateHttpBasic(ctx context.Context, consumerID string, basicAuth *klib.BasicAuth) (*klib.BasicAuth, error) {
-	return &klib.BasicAuth{}, nil
+	resp := *basicAuth
+	resp.ID = klib.String("basicID")
+	resp.Consumer = &klib.Consumer{ID: &consumerID}
+	return &resp, nil
+}
+
+func (m mockCredentialClient) CreateOauth2(ctx context.Context, consumerID string, oauth2 *klib.Oauth2Credential) (*klib.Oauth2Credential, error) {
+	resp := *oauth2
+	resp.ID = klib.String("oauth2ID")
+	resp.Consumer = &klib.Consumer{ID: &consumerID}
+	if resp.ClientSecret == nil {
+		resp.ClientSecret = klib.String("generatedSecret")
+	}
+	if m.oauth2 != nil {
+		*m.oauth2 = *oauth2
+	}
+	return &resp, nil
+}
+
+func (m mockCredentialClient) CreateAuthKey(ctx context.Context, consumerID string, keyAuth *klib.KeyAuth) (*klib.KeyAuth, error) {
+	resp := *keyAuth
+	resp.ID = klib.String("keyID")
+	resp.Key = klib.String("key")
+	resp.Consumer = &klib.Consumer{ID: &consumerID}
+	if m.keyAuth != nil {
+		*m.keyAuth = *keyAuth
+	}
+	return &resp, nil
+}
+
+func (m mockCredentialClient) AuthKeyExists(ctx context.Context, key string) (bool, error) {
+	if m.keyLookupErr {
+		return false, fmt.Errorf("error")
+	}
+	return key == m.existingKey, nil
+}
+
+func (m mockCredentialClient) DeleteJWT(ctx context.Context, consumerID, jwtID string) error {
+	if m.deleted != nil {
+		*m.deleted = append(*m.deleted, consumerID+"/"+jwtID)
+	}
+	return nil
+}
+
+func (m mockCredentialClient) CreateJWT(ctx context.Context, consumerID string, jwt *klib.JWTAuth) (*klib.JWTAuth, error) {
+	if m.createJWTErr {
+		return nil, fmt.Errorf("error")
+	}
+	resp := *jwt
+	resp.ID = klib.String("jwtID")
+	resp.Consumer = &klib.Consumer{ID: &consumerID}
+	if m.jwt != nil {
+		*m.jwt = resp
+	}
+	return &resp, nil
+}
+
+func (m mockCredentialClient) DeleteHMAC(ctx context.Context, consumerID, hmacID string) error {
+	if m.deleted != nil {
+		*m.deleted = append(*m.deleted, consumerID+"/"+hmacID)
+	}
+	return nil
+}
+
+func (m mockCredentialClient) CreateHMAC(ctx context.Context, consumerID string, hmac *klib.HMACAuth) (*klib.HMACAuth, error) {
+	if m.createHMACErr {
+		return nil, fmt.Errorf("error")
+	}
+	resp := *hmac
+	resp.ID = klib.String("hmacID")
+	resp.Consumer = &klib.Consumer{ID: &consumerID}
+	if m.hmac != nil {
+		*m.hmac = resp
+	}
+	return &resp, nil
+}
+
+func (m mockCredentialClient) DeleteMTLS(ctx context.Context, consumerID, mtlsID string) error {
+	if m.deleted != nil {
+		*m.deleted = append(*m.deleted, consumerID+"/"+mtlsID)
+	}
+	return nil
+}
+
+func (m mockCredentialClient) CreateMTLS(ctx context.Context, consumerID string, mtls *klib.MTLSAuth) (*klib.MTLSAuth, error) {
+	resp := *mtls
+	resp.ID = klib.String("mtlsID")
+	resp.Consumer = &klib.Consumer{ID: &consumerID}
+	if m.mtls != nil {
+		*m.mtls = resp
+	}
+	return &resp, nil
+}
+
+func (m mockCredentialClient) ListCACertificates(ctx context.Context) ([]*klib.CACertificate, error) {
+	return m.caCerts, nil
 }
 
-func (mockCredentialClient) CreateOauth2(ctx context.Context, consumerID string, oauth2 *klib.Oauth2Credential) (*klib.Oauth2Credential, error) {
-	return &klib.Oauth2Credential{}, nil
+func (m mockCredentialClient) EnsureSuspendedConsumer(ctx context.Context, appConsumerID string) (*klib.Consumer, error) {
+	return &klib.Consumer{ID: klib.String("suspendedConsumerID")}, nil
 }
 
-func (mockCredentialClient) CreateAuthKey(ctx context.Context, consumerID string, keyAuth *klib.KeyAuth) (*klib.KeyAuth, error) {
-	return &klib.KeyAuth{}, nil
+func (m mockCredentialClient) DenyConsumer(ctx context.Context, consumerID string) error {
+	if m.denied != nil {
+		*m.denied = append(*m.denied, consumerID)
+	}
+	return nil
+}
+
+func (m mockCredentialClient) ExpireCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time) error {
+	if m.expireErr {
+		return fmt.Errorf("error")
+	}
+	if m.expiring != nil {
+		*m.expiring = append(*m.expiring, collection+"/"+credentialID)
+	}
+	return nil
 }
 
-type mockCredentialRequest struct{}
+func (m mockCredentialClient) AllowConsumer(ctx context.Context, consumerID string) error {
+	if m.allowed != nil {
+		*m.allowed = append(*m.allowed, consumerID)
+	}
+	return nil
+}
+
+func (m mockCredentialClient) MoveCredential(ctx context.Context, collection, credentialID, consumerID string, credential interface{}) error {
+	if m.moveErr {
+		return fmt.Errorf("error")
+	}
+	if m.moved != nil {
+		*m.moved = append(*m.moved, fmt.Sprintf("%s/%s:%s", collection, credentialID, consumerID))
+	}
+	fillCredential(credential, credentialID, consumerID)
+	return nil
+}
+
+func (m mockCredentialClient) RenewCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error {
+	if m.renewErr {
+		return fmt.Errorf("error")
+	}
+	if m.renewed != nil {
+		*m.renewed = append(*m.renewed, collection+"/"+credentialID)
+	}
+	fillCredential(credential, credentialID, "consumerID")
+	return nil
+}
+
+// fillCredential sets the fields kong returns for an updated credential
+func fillCredential(credential interface{}, credentialID, consumerID string) {
+	consumer := &klib.Consumer{ID: &consumerID}
+	switch c := credential.(type) {
+	case *klib.KeyAuth:
+		c.ID, c.Consumer, c.Key = &credentialID, consumer, klib.String("key")
+	case *klib.BasicAuth:
+		c.ID, c.Consumer, c.Username = &credentialID, consumer, klib.String("username")
+	case *klib.Oauth2Credential:
+		c.ID, c.Consumer, c.ClientID, c.ClientSecret = &credentialID, consumer, klib.String("clientID"), klib.String("secret")
+	case *klib.JWTAuth:
+		c.ID, c.Consumer, c.Key, c.Algorithm, c.Secret = &credentialID, consumer, klib.String("key"), klib.String(common.JWTAlgorithmHS256), klib.String("secret")
+	case *klib.HMACAuth:
+		c.ID, c.Consumer, c.Username, c.Secret = &credentialID, consumer, klib.String("username"), klib.String("secret")
+	case *klib.MTLSAuth:
+		c.ID, c.Consumer, c.SubjectName = &credentialID, consumer, klib.String("subject")
+	}
+}
+
+type mockCredentialRequest struct {
+	appName     string
+	credType    string
+	appDetails  map[string]string
+	credDetails map[string]string
+	data        map[string]interface{}
+	idpProvider oauth.Provider
+	idpData     provisioning.IDPCredentialData
+	action      provisioning.CredentialAction
+	days        int
+}
 
 func (m *mockCredentialRequest) GetApplicationDetailsValue(key string) string {
-	return ""
+	return m.appDetails[key]
 }
 
 func (m *mockCredentialRequest) GetApplicationName() string {
-	return ""
+	return m.appName
 }
 func (m *mockCredentialRequest) GetCredentialDetailsValue(key string) string {
-	return ""
+	return m.credDetails[key]
 }
 func (m *mockCredentialRequest) GetCredentialData() map[string]interface{} {
-	return nil
+	return m.data
 }
 func (m *mockCredentialRequest) GetCredentialType() string {
-	return ""
+	return m.credType
+}
+
+func (m *mockCredentialRequest) IsIDPCredential() bool {
+	return m.idpProvider != nil
+}
+
+func (m *mockCredentialRequest) GetIDPProvider() oauth.Provider {
+	return m.idpProvider
+}
+
+func (m *mockCredentialRequest) GetIDPCredentialData() provisioning.IDPCredentialData {
+	return m.idpData
+}
+
+func (m *mockCredentialRequest) GetCredentialAction() provisioning.CredentialAction {
+	return m.action
+}
+
+func (m *mockCredentialRequest) GetCredentialExpirationDays() int {
+	return m.days
 }
 
 func TestProvision(t *testing.T) {
@@ -71,7 +324,1302 @@ func TestProvision(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			ctx := context.WithValue(context.Background(), testName, name)
 
-			_, _ = NewCredentialProvisioner(ctx, tc.client, &tc.request).Provision()
+			_, _ = NewCredentialProvisioner(ctx, tc.client, &tc.request, 0, APIKeyRules{}).Provision()
+		})
+	}
+}
+
+func TestParseCredentialType(t *testing.T) {
+	cases := map[string]struct {
+		crdName           string
+		expectedWorkspace string
+		expectedType      string
+	}{
+		"api key": {
+			crdName:           common.WksPrefixName(common.DefaultWorkspace, provisioning.APIKeyCRD),
+			expectedWorkspace: common.DefaultWorkspace,
+			expectedType:      provisioning.APIKeyCRD,
+		},
+		"mtls in a workspace named after jwt": {
+			crdName:           common.WksPrefixName("jwt-team", provisioning.MtlsCRD),
+			expectedWorkspace: "jwt-team",
+			expectedType:      provisioning.MtlsCRD,
+		},
+		"jwt in a workspace named after hmac": {
+			crdName:           common.WksPrefixName("hmac-team", common.JWTCRD),
+			expectedWorkspace: "hmac-team",
+			expectedType:      common.JWTCRD,
+		},
+		"hmac in a workspace named after jwt": {
+			crdName:           common.WksPrefixName("jwt-team", common.HMACCRD),
+			expectedWorkspace: "jwt-team",
+			expectedType:      common.HMACCRD,
+		},
+		"mtls in a workspace named after hmac": {
+			crdName:           common.WksPrefixName("hmac-team", provisioning.MtlsCRD),
+			expectedWorkspace: "hmac-team",
+			expectedType:      provisioning.MtlsCRD,
+		},
+		"basic auth in a workspace named after api keys": {
+			crdName:           common.WksPrefixName("api-key-team", provisioning.BasicAuthCRD),
+			expectedWorkspace: "api-key-team",
+			expectedType:      provisioning.BasicAuthCRD,
+		},
+		"unknown type": {
+			crdName: common.WksPrefixName("jwt-team", "unknown"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			workspace, crdType := parseCredentialType(tc.crdName)
+			assert.Equal(t, tc.expectedWorkspace, workspace)
+			assert.Equal(t, tc.expectedType, crdType)
+		})
+	}
+}
+
+func TestJWTCredential(t *testing.T) {
+	jwtCRD := common.WksPrefixName(common.DefaultWorkspace, common.JWTCRD)
+	appIDAttr := common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID)
+	testCases := map[string]struct {
+		client       mockCredentialClient
+		request      mockCredentialRequest
+		update       bool
+		expectStatus provisioning.Status
+		expectAlg    string
+		expectSecret bool
+		expectPubKey string
+		replacedKey  string
+	}{
+		"HS256 credential gets a generated secret": {
+			request: mockCredentialRequest{
+				credType:   jwtCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+			},
+			expectStatus: provisioning.Success,
+			expectAlg:    common.JWTAlgorithmHS256,
+			expectSecret: true,
+		},
+		"RS256 credential uses the consumer public key": {
+			request: mockCredentialRequest{
+				credType:   jwtCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				data: map[string]interface{}{
+					common.JWTAlgorithmField: common.JWTAlgorithmRS256,
+					common.JWTPublicKeyField: "rsa-public-key",
+				},
+			},
+			expectStatus: provisioning.Success,
+			expectAlg:    common.JWTAlgorithmRS256,
+			expectPubKey: "rsa-public-key",
+		},
+		"ES256 credential without a public key fails": {
+			request: mockCredentialRequest{
+				credType:   jwtCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				data: map[string]interface{}{
+					common.JWTAlgorithmField: common.JWTAlgorithmES256,
+				},
+			},
+			expectStatus: provisioning.Error,
+		},
+		"unsupported algorithm fails": {
+			request: mockCredentialRequest{
+				credType:   jwtCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				data: map[string]interface{}{
+					common.JWTAlgorithmField: "none",
+				},
+			},
+			expectStatus: provisioning.Error,
+		},
+		"kong error fails provisioning": {
+			client: mockCredentialClient{createJWTErr: true},
+			request: mockCredentialRequest{
+				credType:   jwtCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+			},
+			expectStatus: provisioning.Error,
+		},
+		"rotate creates a new key and secret": {
+			update: true,
+			request: mockCredentialRequest{
+				credType: jwtCRD,
+				credDetails: map[string]string{
+					common.AttrAppID:        "consumerID",
+					common.AttrCredentialID: "jwtID",
+					common.AttrCredUpdater:  "existingKey",
+				},
+			},
+			expectStatus: provisioning.Success,
+			expectAlg:    common.JWTAlgorithmHS256,
+			expectSecret: true,
+			replacedKey:  "existingKey",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			created := &klib.JWTAuth{}
+			tc.client.jwt = created
+			p := NewCredentialProvisioner(context.Background(), tc.client, &tc.request, 0, APIKeyRules{})
+
+			var rs provisioning.RequestStatus
+			var cred provisioning.Credential
+			if tc.update {
+				rs, cred = p.Update()
+			} else {
+				rs, cred = p.Provision()
+			}
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				return
+			}
+
+			assert.Equal(t, tc.expectAlg, *created.Algorithm)
+			assert.NotEmpty(t, *created.Key)
+			if tc.replacedKey != "" {
+				assert.NotEqual(t, tc.replacedKey, *created.Key)
+			}
+			assert.Equal(t, *created.Key, rs.GetProperties()[common.AttrCredUpdater])
+			assert.Equal(t, *created.Key, cred.GetData()[common.JWTKeyField])
+			if tc.expectSecret {
+				assert.NotEmpty(t, *created.Secret)
+				assert.Equal(t, *created.Secret, cred.GetData()[common.JWTSecretField])
+			} else {
+				assert.Nil(t, created.Secret)
+				assert.NotContains(t, cred.GetData(), common.JWTSecretField)
+			}
+			if tc.expectPubKey != "" {
+				assert.Equal(t, tc.expectPubKey, *created.RSAPublicKey)
+			}
+		})
+	}
+}
+
+func TestHMACCredential(t *testing.T) {
+	hmacCRD := common.WksPrefixName(common.DefaultWorkspace, common.HMACCRD)
+	appIDAttr := common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID)
+	testCases := map[string]struct {
+		client       mockCredentialClient
+		request      mockCredentialRequest
+		update       bool
+		expectStatus provisioning.Status
+		replacedUser string
+	}{
+		"generates username and secret": {
+			request: mockCredentialRequest{
+				credType:   hmacCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+			},
+			expectStatus: provisioning.Success,
+		},
+		"kong error fails provisioning": {
+			client: mockCredentialClient{createHMACErr: true},
+			request: mockCredentialRequest{
+				credType:   hmacCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+			},
+			expectStatus: provisioning.Error,
+		},
+		"rotate creates a new username": {
+			update: true,
+			request: mockCredentialRequest{
+				credType: hmacCRD,
+				credDetails: map[string]string{
+					common.AttrAppID:        "consumerID",
+					common.AttrCredentialID: "hmacID",
+					common.AttrCredUpdater:  "existingUser",
+				},
+			},
+			expectStatus: provisioning.Success,
+			replacedUser: "existingUser",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			created := &klib.HMACAuth{}
+			tc.client.hmac = created
+			p := NewCredentialProvisioner(context.Background(), tc.client, &tc.request, 0, APIKeyRules{})
+
+			var rs provisioning.RequestStatus
+			var cred provisioning.Credential
+			if tc.update {
+				rs, cred = p.Update()
+			} else {
+				rs, cred = p.Provision()
+			}
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				return
+			}
+
+			assert.NotEmpty(t, *created.Username)
+			assert.NotEmpty(t, *created.Secret)
+			if tc.replacedUser != "" {
+				assert.NotEqual(t, tc.replacedUser, *created.Username)
+			}
+			assert.Equal(t, "hmacID", rs.GetProperties()[common.AttrCredentialID])
+			assert.Equal(t, *created.Username, rs.GetProperties()[common.AttrCredUpdater])
+			assert.Equal(t, *created.Username, cred.GetData()[common.HMACUsernameField])
+			assert.Equal(t, *created.Secret, cred.GetData()[common.HMACSecretField])
+		})
+	}
+}
+
+func TestMTLSCredential(t *testing.T) {
+	mtlsCRD := common.WksPrefixName(common.DefaultWorkspace, provisioning.MtlsCRD)
+	appIDAttr := common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID)
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "partner.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	clientDER, _ := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	clientPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDER}))
+
+	csrDER, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "csr.example.com"},
+	}, clientKey)
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+
+	testCases := map[string]struct {
+		caCerts      []*klib.CACertificate
+		certificate  string
+		expectStatus provisioning.Status
+		expectSubj   string
+		expectCA     string
+	}{
+		"certificate references the issuing ca": {
+			caCerts: []*klib.CACertificate{
+				{ID: klib.String("caID"), Cert: &caPEM},
+			},
+			certificate:  clientPEM,
+			expectStatus: provisioning.Success,
+			expectSubj:   "partner.example.com",
+			expectCA:     "caID",
+		},
+		"certificate with unknown issuer has no ca reference": {
+			certificate:  clientPEM,
+			expectStatus: provisioning.Success,
+			expectSubj:   "partner.example.com",
+		},
+		"csr subject is used": {
+			caCerts: []*klib.CACertificate{
+				{ID: klib.String("caID"), Cert: &caPEM},
+			},
+			certificate:  csrPEM,
+			expectStatus: provisioning.Success,
+			expectSubj:   "csr.example.com",
+		},
+		"invalid pem fails": {
+			certificate:  "not a certificate",
+			expectStatus: provisioning.Error,
+		},
+		"missing certificate fails": {
+			expectStatus: provisioning.Error,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			created := &klib.MTLSAuth{}
+			client := mockCredentialClient{caCerts: tc.caCerts, mtls: created}
+			req := &mockCredentialRequest{
+				credType:   mtlsCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				data:       map[string]interface{}{},
+			}
+			if tc.certificate != "" {
+				req.data[common.MTLSCertificateField] = tc.certificate
+			}
+
+			rs, cred := NewCredentialProvisioner(context.Background(), client, req, 0, APIKeyRules{}).Provision()
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				return
+			}
+
+			assert.Equal(t, tc.expectSubj, *created.SubjectName)
+			assert.Equal(t, tc.expectSubj, cred.GetData()[common.MTLSSubjectNameField])
+			if tc.expectCA == "" {
+				assert.Nil(t, created.CACertificate)
+				return
+			}
+			assert.Equal(t, tc.expectCA, *created.CACertificate.ID)
+			assert.Equal(t, tc.expectCA, cred.GetData()[common.MTLSCACertificateField])
+		})
+	}
+}
+
+func TestIDPCredential(t *testing.T) {
+	idpServer := oauth.NewMockIDPServer()
+	defer idpServer.Close()
+	idpCfg := &corecfg.IDPConfiguration{
+		Name:        "test-idp",
+		Type:        "generic",
+		MetadataURL: idpServer.GetMetadataURL(),
+		AuthConfig: &corecfg.IDPAuthConfiguration{
+			Type:        corecfg.AccessToken,
+			AccessToken: "token",
+		},
+	}
+	provider, err := oauth.NewProvider(idpCfg, corecfg.NewTLSConfig(), "", 30*time.Second)
+	assert.Nil(t, err)
+
+	idpCRD := common.WksPrefixName(common.DefaultWorkspace, common.IDPCRDName(provider.GetName()))
+	appIDAttr := common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID)
+	idpData := mock.MockIDPCredentialData{ClientID: "clientID", ClientSecret: "clientSecret"}
+	quota := &management.AccessRequestSpecQuota{Limit: 10, Interval: "daily"}
+	testCases := map[string]struct {
+		client         mockCredentialClient
+		request        mockCredentialRequest
+		accessRequests []*v1.ResourceInstance
+		update         bool
+		deprovision    bool
+		expectStatus   provisioning.Status
+		expectDeleted  []string
+		expectDenied   []string
+		expectAllowed  []string
+	}{
+		"binds the client id to a consumer in the application acl group": {
+			request: mockCredentialRequest{
+				credType:   idpCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				idpData:    idpData,
+			},
+			expectStatus: provisioning.Success,
+		},
+		"binds the client id when the application quota is in another workspace": {
+			request: mockCredentialRequest{
+				appName:    "app",
+				credType:   idpCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				idpData:    idpData,
+			},
+			accessRequests: []*v1.ResourceInstance{cachedAccessRequest("app", "otherInstance", quota)},
+			expectStatus:   provisioning.Success,
+		},
+		"binds the client id when the application access has no quota": {
+			request: mockCredentialRequest{
+				appName:    "app",
+				credType:   idpCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				idpData:    idpData,
+			},
+			accessRequests: []*v1.ResourceInstance{cachedAccessRequest("app", "instance", nil)},
+			expectStatus:   provisioning.Success,
+		},
+		"fails when the application has a quota": {
+			request: mockCredentialRequest{
+				appName:    "app",
+				credType:   idpCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				idpData:    idpData,
+			},
+			accessRequests: []*v1.ResourceInstance{cachedAccessRequest("app", "instance", quota)},
+			expectStatus:   provisioning.Error,
+		},
+		"fails when the application consumer does not exist": {
+			request: mockCredentialRequest{
+				credType: idpCRD,
+				idpData:  idpData,
+			},
+			expectStatus: provisioning.Error,
+		},
+		"removes the client consumer when the acl group can not be added": {
+			client: mockCredentialClient{aclGroupErr: true},
+			request: mockCredentialRequest{
+				credType:   idpCRD,
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				idpData:    idpData,
+			},
+			expectStatus:  provisioning.Error,
+			expectDeleted: []string{"idpConsumerID"},
+		},
+		"fails when the definition is not for the provider": {
+			request: mockCredentialRequest{
+				credType:   common.IDPCRDName(provider.GetName()),
+				appDetails: map[string]string{appIDAttr: "consumerID"},
+				idpData:    idpData,
+			},
+			expectStatus: provisioning.Error,
+		},
+		"update binds the new client id": {
+			update: true,
+			request: mockCredentialRequest{
+				credType: idpCRD,
+				credDetails: map[string]string{
+					common.AttrAppID:        "consumerID",
+					common.AttrCredentialID: "oldConsumerID",
+				},
+				idpData: idpData,
+			},
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"oldConsumerID"},
+		},
+		"update keeps the new client consumer of a suspended credential suspended": {
+			update: true,
+			request: mockCredentialRequest{
+				credType: idpCRD,
+				credDetails: map[string]string{
+					common.AttrAppID:               "consumerID",
+					common.AttrCredentialID:        "oldConsumerID",
+					common.AttrSuspendedConsumerID: "oldConsumerID",
+				},
+				idpData: idpData,
+			},
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"oldConsumerID"},
+			expectDenied:  []string{"idpConsumerID"},
+		},
+		"suspend denies the client consumer": {
+			update: true,
+			request: mockCredentialRequest{
+				credType: idpCRD,
+				credDetails: map[string]string{
+					common.AttrAppID:        "consumerID",
+					common.AttrCredentialID: "idpConsumerID",
+				},
+				action: provisioning.Suspend,
+			},
+			expectStatus: provisioning.Success,
+			expectDenied: []string{"idpConsumerID"},
+		},
+		"enable allows the client consumer": {
+			update: true,
+			request: mockCredentialRequest{
+				credType: idpCRD,
+				credDetails: map[string]string{
+					common.AttrAppID:               "consumerID",
+					common.AttrCredentialID:        "idpConsumerID",
+					common.AttrSuspendedConsumerID: "idpConsumerID",
+				},
+				action: provisioning.Enable,
+			},
+			expectStatus:  provisioning.Success,
+			expectAllowed: []string{"idpConsumerID"},
+		},
+		"deprovision removes the client consumer": {
+			deprovision: true,
+			request: mockCredentialRequest{
+				credType: idpCRD,
+				credDetails: map[string]string{
+					common.AttrAppID:        "consumerID",
+					common.AttrCredentialID: "idpConsumerID",
+				},
+				idpData: idpData,
+			},
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"idpConsumerID"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			group := ""
+			deleted := []string{}
+			tc.client.aclGroup = &group
+			denied := []string{}
+			allowed := []string{}
+			tc.client.deleted = &deleted
+			tc.client.denied = &denied
+			tc.client.allowed = &allowed
+			tc.request.idpProvider = provider
+			p := NewCredentialProvisioner(context.Background(), tc.client, &tc.request, 0, APIKeyRules{})
+			p.cache = &mockCache{
+				accessRequests: tc.accessRequests,
+				instances: map[string]*v1.ResourceInstance{
+					"instance":      cachedInstance("instance", common.DefaultWorkspace),
+					"otherInstance": cachedInstance("otherInstance", "other"),
+				},
+			}
+
+			if tc.deprovision {
+				rs := p.Deprovision()
+				assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+				assert.ElementsMatch(t, tc.expectDeleted, deleted)
+				return
+			}
+
+			var rs provisioning.RequestStatus
+			var cred provisioning.Credential
+			if tc.update {
+				rs, cred = p.Update()
+			} else {
+				rs, cred = p.Provision()
+			}
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			assert.ElementsMatch(t, tc.expectDeleted, deleted)
+			assert.ElementsMatch(t, tc.expectDenied, denied)
+			assert.ElementsMatch(t, tc.expectAllowed, allowed)
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				return
+			}
+			if tc.request.action == provisioning.Suspend || tc.request.action == provisioning.Enable {
+				return
+			}
+
+			assert.Equal(t, "consumerID", group)
+			assert.Equal(t, "idpConsumerID", rs.GetProperties()[common.AttrCredentialID])
+			assert.Equal(t, "clientID", rs.GetProperties()[common.AttrCredUpdater])
+			assert.Equal(t, "clientID", cred.GetData()[provisioning.OauthClientID])
+			assert.Equal(t, "clientSecret", cred.GetData()[provisioning.OauthClientSecret])
+		})
+	}
+}
+
+type mockCache struct {
+	accessRequests []*v1.ResourceInstance
+	instances      map[string]*v1.ResourceInstance
+}
+
+func (c *mockCache) ListAccessRequests() []*v1.ResourceInstance {
+	return c.accessRequests
+}
+
+func (c *mockCache) GetAPIServiceInstanceByName(name string) (*v1.ResourceInstance, error) {
+	if instance, ok := c.instances[name]; ok {
+		return instance, nil
+	}
+	return nil, fmt.Errorf("instance %s not found", name)
+}
+
+func cachedAccessRequest(appName, instanceName string, quota *management.AccessRequestSpecQuota) *v1.ResourceInstance {
+	ar := management.NewAccessRequest("accessRequest", "test")
+	ar.Spec.ManagedApplication = appName
+	ar.Spec.ApiServiceInstance = instanceName
+	ar.Spec.Quota = quota
+	ar.Status = &v1.ResourceStatus{Level: provisioning.Success.String()}
+	ri, _ := ar.AsInstance()
+	return ri
+}
+
+func cachedInstance(name, workspace string) *v1.ResourceInstance {
+	ri, _ := management.NewAPIServiceInstance(name, "test").AsInstance()
+	ri.SetSubResource(definitions.XAgentDetails, map[string]interface{}{common.AttrWorkspaceName: workspace})
+	return ri
+}
+
+func TestSuspendCredential(t *testing.T) {
+	suspended := map[string]string{
+		common.AttrAppID:               "consumerID",
+		common.AttrCredentialID:        "credID",
+		common.AttrSuspendedConsumerID: "suspendedConsumerID",
+	}
+	active := map[string]string{
+		common.AttrAppID:        "consumerID",
+		common.AttrCredentialID: "credID",
+	}
+	testCases := map[string]struct {
+		client          mockCredentialClient
+		credType        string
+		credDetails     map[string]string
+		action          provisioning.CredentialAction
+		deprovision     bool
+		expectStatus    provisioning.Status
+		expectMoved     []string
+		expectDeleted   []string
+		expectSuspended string
+		expectData      bool
+	}{
+		"suspend moves the api key to the suspended consumer": {
+			credType:        provisioning.APIKeyCRD,
+			credDetails:     active,
+			action:          provisioning.Suspend,
+			expectStatus:    provisioning.Success,
+			expectMoved:     []string{"key-auths/credID:suspendedConsumerID"},
+			expectSuspended: "suspendedConsumerID",
+			expectData:      true,
+		},
+		"enable moves the api key back to the application consumer": {
+			credType:     provisioning.APIKeyCRD,
+			credDetails:  suspended,
+			action:       provisioning.Enable,
+			expectStatus: provisioning.Success,
+			expectMoved:  []string{"key-auths/credID:consumerID"},
+			expectData:   true,
+		},
+		"suspend basic auth returns no credential data": {
+			credType:        provisioning.BasicAuthCRD,
+			credDetails:     active,
+			action:          provisioning.Suspend,
+			expectStatus:    provisioning.Success,
+			expectMoved:     []string{"basic-auths/credID:suspendedConsumerID"},
+			expectSuspended: "suspendedConsumerID",
+		},
+		"suspend oauth2": {
+			credType:        provisioning.OAuthSecretCRD,
+			credDetails:     active,
+			action:          provisioning.Suspend,
+			expectStatus:    provisioning.Success,
+			expectMoved:     []string{"oauth2/credID:suspendedConsumerID"},
+			expectSuspended: "suspendedConsumerID",
+			expectData:      true,
+		},
+		"suspend jwt": {
+			credType:        common.JWTCRD,
+			credDetails:     active,
+			action:          provisioning.Suspend,
+			expectStatus:    provisioning.Success,
+			expectMoved:     []string{"jwts/credID:suspendedConsumerID"},
+			expectSuspended: "suspendedConsumerID",
+			expectData:      true,
+		},
+		"enable hmac": {
+			credType:     common.HMACCRD,
+			credDetails:  suspended,
+			action:       provisioning.Enable,
+			expectStatus: provisioning.Success,
+			expectMoved:  []string{"hmac-auths/credID:consumerID"},
+			expectData:   true,
+		},
+		"suspend mtls": {
+			credType:        provisioning.MtlsCRD,
+			credDetails:     active,
+			action:          provisioning.Suspend,
+			expectStatus:    provisioning.Success,
+			expectMoved:     []string{"mtls-auths/credID:suspendedConsumerID"},
+			expectSuspended: "suspendedConsumerID",
+			expectData:      true,
+		},
+		"suspend fails when the credential can not be moved": {
+			client:       mockCredentialClient{moveErr: true},
+			credType:     provisioning.APIKeyCRD,
+			credDetails:  active,
+			action:       provisioning.Suspend,
+			expectStatus: provisioning.Error,
+		},
+		"suspend fails without the application consumer": {
+			credType:     provisioning.APIKeyCRD,
+			credDetails:  map[string]string{common.AttrCredentialID: "credID"},
+			action:       provisioning.Suspend,
+			expectStatus: provisioning.Error,
+		},
+		"rotate keeps a suspended credential on the suspended consumer": {
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   suspended,
+			action:        provisioning.Rotate,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"suspendedConsumerID/credID"},
+			expectData:    true,
+		},
+		"deprovision deletes a suspended credential from the suspended consumer": {
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   suspended,
+			deprovision:   true,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"suspendedConsumerID/credID"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			moved := []string{}
+			deleted := []string{}
+			tc.client.moved = &moved
+			tc.client.deleted = &deleted
+			request := &mockCredentialRequest{
+				credType:    common.WksPrefixName(common.DefaultWorkspace, tc.credType),
+				credDetails: tc.credDetails,
+				action:      tc.action,
+			}
+			p := NewCredentialProvisioner(context.Background(), tc.client, request, 0, APIKeyRules{})
+
+			if tc.deprovision {
+				rs := p.Deprovision()
+				assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+				assert.ElementsMatch(t, tc.expectDeleted, deleted)
+				return
+			}
+
+			rs, cred := p.Update()
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			assert.ElementsMatch(t, tc.expectMoved, moved)
+			assert.ElementsMatch(t, tc.expectDeleted, deleted)
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				return
+			}
+			assert.Equal(t, tc.expectSuspended, rs.GetProperties()[common.AttrSuspendedConsumerID])
+			if tc.action == provisioning.Rotate {
+				assert.Equal(t, "consumerID", rs.GetProperties()[common.AttrAppID])
+			}
+			if tc.expectData {
+				assert.NotNil(t, cred)
+			} else {
+				assert.Nil(t, cred)
+			}
+		})
+	}
+}
+
+func TestRotateCredential(t *testing.T) {
+	details := map[string]string{
+		common.AttrAppID:        "consumerID",
+		common.AttrCredentialID: "credID",
+		common.AttrCredUpdater:  "existing",
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csrDER, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "renewed.example.com"},
+	}, key)
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+	testCases := map[string]struct {
+		client        mockCredentialClient
+		credType      string
+		credDetails   map[string]string
+		data          map[string]interface{}
+		gracePeriod   time.Duration
+		action        provisioning.CredentialAction
+		deprovision   bool
+		expectStatus  provisioning.Status
+		expectExpiry  []string
+		expectDeleted []string
+		expectRotated string
+		expectMsg     string
+	}{
+		"replaced api key stays valid during the grace period": {
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   details,
+			gracePeriod:   time.Hour,
+			expectStatus:  provisioning.Success,
+			expectExpiry:  []string{"key-auths/credID"},
+			expectRotated: "credID",
+		},
+		"replaced api key is deleted without a grace period": {
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   details,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/credID"},
+		},
+		"replaced api key is deleted when its expiry can not be scheduled": {
+			client:        mockCredentialClient{expireErr: true},
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   details,
+			gracePeriod:   time.Hour,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/credID"},
+		},
+		"replacement is deleted when the replaced api key can not be": {
+			client:        mockCredentialClient{deleteErr: true},
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   details,
+			expectStatus:  provisioning.Error,
+			expectDeleted: []string{"consumerID/keyID"},
+		},
+		"rotation reports the supplied api key was not used": {
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   details,
+			data:          map[string]interface{}{common.APIKeyField: "partner-key-01"},
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/credID"},
+			expectMsg:     "The supplied api key was not used, rotating an api key generates the new key",
+		},
+		"replaced basic auth stays valid during the grace period": {
+			credType:      provisioning.BasicAuthCRD,
+			credDetails:   details,
+			gracePeriod:   time.Hour,
+			expectStatus:  provisioning.Success,
+			expectExpiry:  []string{"basic-auths/credID"},
+			expectRotated: "credID",
+		},
+		"replaced oauth2 stays valid during the grace period": {
+			credType:      provisioning.OAuthSecretCRD,
+			credDetails:   details,
+			gracePeriod:   time.Hour,
+			expectStatus:  provisioning.Success,
+			expectExpiry:  []string{"oauth2/credID"},
+			expectRotated: "credID",
+		},
+		"replaced jwt stays valid during the grace period": {
+			credType:      common.JWTCRD,
+			credDetails:   details,
+			gracePeriod:   time.Hour,
+			expectStatus:  provisioning.Success,
+			expectExpiry:  []string{"jwts/credID"},
+			expectRotated: "credID",
+		},
+		"replaced jwt is deleted without a grace period": {
+			credType:      common.JWTCRD,
+			credDetails:   details,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/credID"},
+		},
+		"replaced hmac stays valid during the grace period": {
+			credType:      common.HMACCRD,
+			credDetails:   details,
+			gracePeriod:   time.Hour,
+			expectStatus:  provisioning.Success,
+			expectExpiry:  []string{"hmac-auths/credID"},
+			expectRotated: "credID",
+		},
+		"replaced hmac is deleted without a grace period": {
+			credType:      common.HMACCRD,
+			credDetails:   details,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/credID"},
+		},
+		"replaced mtls stays valid during the grace period": {
+			credType:      provisioning.MtlsCRD,
+			credDetails:   details,
+			data:          map[string]interface{}{common.MTLSCertificateField: csrPEM},
+			gracePeriod:   time.Hour,
+			expectStatus:  provisioning.Success,
+			expectExpiry:  []string{"mtls-auths/credID"},
+			expectRotated: "credID",
+		},
+		"mtls rotation without a certificate keeps the replaced credential": {
+			credType:     provisioning.MtlsCRD,
+			credDetails:  details,
+			gracePeriod:  time.Hour,
+			expectStatus: provisioning.Error,
+		},
+		"deprovision deletes the replaced jwt": {
+			credType: common.JWTCRD,
+			credDetails: map[string]string{
+				common.AttrAppID:               "consumerID",
+				common.AttrCredentialID:        "credID",
+				common.AttrRotatedCredentialID: "rotatedID",
+			},
+			deprovision:   true,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/rotatedID", "consumerID/credID"},
+		},
+		"deprovision deletes the replaced credential": {
+			credType: provisioning.APIKeyCRD,
+			credDetails: map[string]string{
+				common.AttrAppID:               "consumerID",
+				common.AttrCredentialID:        "credID",
+				common.AttrRotatedCredentialID: "rotatedID",
+			},
+			deprovision:   true,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/rotatedID", "consumerID/credID"},
+		},
+		"suspend deletes the replaced credential": {
+			credType: provisioning.APIKeyCRD,
+			credDetails: map[string]string{
+				common.AttrAppID:               "consumerID",
+				common.AttrCredentialID:        "credID",
+				common.AttrRotatedCredentialID: "rotatedID",
+			},
+			action:        provisioning.Suspend,
+			expectStatus:  provisioning.Success,
+			expectDeleted: []string{"consumerID/rotatedID"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expiring := []string{}
+			deleted := []string{}
+			tc.client.expiring = &expiring
+			tc.client.deleted = &deleted
+			request := &mockCredentialRequest{
+				credType:    common.WksPrefixName(common.DefaultWorkspace, tc.credType),
+				credDetails: tc.credDetails,
+				data:        tc.data,
+				action:      tc.action,
+			}
+			p := NewCredentialProvisioner(context.Background(), tc.client, request, tc.gracePeriod, APIKeyRules{})
+
+			if tc.deprovision {
+				rs := p.Deprovision()
+				assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+				assert.ElementsMatch(t, tc.expectDeleted, deleted)
+				return
+			}
+
+			rs, cred := p.Update()
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			assert.ElementsMatch(t, tc.expectExpiry, expiring)
+			assert.ElementsMatch(t, tc.expectDeleted, deleted)
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				return
+			}
+			assert.Equal(t, tc.expectRotated, rs.GetProperties()[common.AttrRotatedCredentialID])
+			if tc.action == provisioning.Suspend {
+				return
+			}
+			assert.Equal(t, tc.expectMsg, rs.GetMessage())
+			assert.NotEqual(t, "credID", rs.GetProperties()[common.AttrCredentialID])
+			assert.NotEqual(t, "existing", rs.GetProperties()[common.AttrCredUpdater])
+			assert.NotNil(t, cred)
+		})
+	}
+}
+
+func TestCredentialExpiry(t *testing.T) {
+	details := map[string]string{
+		common.AttrAppID:        "consumerID",
+		common.AttrCredentialID: "credID",
+	}
+	expiring := func(secret string) map[string]string {
+		return map[string]string{
+			common.AttrAppID:               "consumerID",
+			common.AttrCredentialID:        "credID",
+			common.AttrCredentialExpiresAt: time.Now().UTC().Format(time.RFC3339),
+			common.AttrSuppliedSecretHash:  secretHash(secret),
+		}
+	}
+	rs256 := map[string]interface{}{
+		common.JWTAlgorithmField: common.JWTAlgorithmRS256,
+		common.JWTPublicKeyField: "rsa-public-key",
+	}
+	testCases := map[string]struct {
+		client        mockCredentialClient
+		credType      string
+		credDetails   map[string]string
+		data          map[string]interface{}
+		days          int
+		action        provisioning.CredentialAction
+		expectStatus  provisioning.Status
+		expectTTL     bool
+		expectExpiry  []string
+		expectRenewed []string
+		expectData    map[string]interface{}
+	}{
+		"api key without a lifetime never expires": {
+			credType:     provisioning.APIKeyCRD,
+			expectStatus: provisioning.Success,
+		},
+		"api key gets a ttl": {
+			credType:     provisioning.APIKeyCRD,
+			days:         30,
+			expectStatus: provisioning.Success,
+			expectTTL:    true,
+		},
+		"hmac credential expiry is scheduled": {
+			credType:     common.HMACCRD,
+			days:         30,
+			expectStatus: provisioning.Success,
+			expectExpiry: []string{"hmac-auths/hmacID"},
+		},
+		"credential is not provisioned when its expiry can not be scheduled": {
+			client:       mockCredentialClient{expireErr: true},
+			credType:     common.HMACCRD,
+			days:         30,
+			expectStatus: provisioning.Error,
+		},
+		"rotated api key gets a new key with a ttl": {
+			credType:     provisioning.APIKeyCRD,
+			credDetails:  expiring(""),
+			days:         30,
+			action:       provisioning.Rotate,
+			expectStatus: provisioning.Success,
+			expectTTL:    true,
+		},
+		"rotated oauth2 gets a new secret with a scheduled expiry": {
+			credType:     provisioning.OAuthSecretCRD,
+			credDetails:  expiring(""),
+			days:         30,
+			action:       provisioning.Rotate,
+			expectStatus: provisioning.Success,
+			expectExpiry: []string{"oauth2/oauth2ID"},
+		},
+		"rotated hs256 jwt gets a new secret with a scheduled expiry": {
+			credType:     common.JWTCRD,
+			credDetails:  expiring(""),
+			days:         30,
+			action:       provisioning.Rotate,
+			expectStatus: provisioning.Success,
+			expectExpiry: []string{"jwts/jwtID"},
+		},
+		"renewed api key keeps the supplied key": {
+			credType:      provisioning.APIKeyCRD,
+			credDetails:   expiring("supplied-key"),
+			data:          map[string]interface{}{common.APIKeyField: "supplied-key"},
+			days:          30,
+			action:        provisioning.Rotate,
+			expectStatus:  provisioning.Success,
+			expectRenewed: []string{"key-auths/credID"},
+			expectData:    map[string]interface{}{provisioning.APIKey: "key"},
+		},
+		"api key with a changed supplied key is rotated": {
+			credType:     provisioning.APIKeyCRD,
+			credDetails:  expiring("supplied-key"),
+			data:         map[string]interface{}{common.APIKeyField: "changed-key"},
+			days:         30,
+			action:       provisioning.Rotate,
+			expectStatus: provisioning.Success,
+			expectTTL:    true,
+		},
+		"supplied key without an expiry is rotated": {
+			credType: provisioning.APIKeyCRD,
+			credDetails: map[string]string{
+				common.AttrAppID:              "consumerID",
+				common.AttrCredentialID:       "credID",
+				common.AttrSuppliedSecretHash: secretHash("supplied-key"),
+			},
+			data:         map[string]interface{}{common.APIKeyField: "supplied-key"},
+			days:         30,
+			action:       provisioning.Rotate,
+			expectStatus: provisioning.Success,
+			expectTTL:    true,
+		},
+		"renewed rs256 jwt keeps its public key": {
+			credType:      common.JWTCRD,
+			credDetails:   expiring("rsa-public-key"),
+			data:          rs256,
+			days:          30,
+			action:        provisioning.Rotate,
+			expectStatus:  provisioning.Success,
+			expectRenewed: []string{"jwts/credID"},
+		},
+		"renewal fails": {
+			client:       mockCredentialClient{renewErr: true},
+			credType:     common.JWTCRD,
+			credDetails:  expiring("rsa-public-key"),
+			data:         rs256,
+			days:         30,
+			action:       provisioning.Rotate,
+			expectStatus: provisioning.Error,
+		},
+		"rotated basic auth gets a new password": {
+			credType:     provisioning.BasicAuthCRD,
+			credDetails:  expiring(""),
+			days:         30,
+			action:       provisioning.Rotate,
+			expectStatus: provisioning.Success,
+			expectExpiry: []string{"basic-auths/basicID"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expiring := []string{}
+			renewed := []string{}
+			keyAuth := klib.KeyAuth{}
+			tc.client.expiring = &expiring
+			tc.client.renewed = &renewed
+			tc.client.keyAuth = &keyAuth
+			request := &mockCredentialRequest{
+				credType:    common.WksPrefixName(common.DefaultWorkspace, tc.credType),
+				appDetails:  map[string]string{common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID): "consumerID"},
+				credDetails: tc.credDetails,
+				data:        tc.data,
+				action:      tc.action,
+				days:        tc.days,
+			}
+			if request.credDetails == nil {
+				request.credDetails = details
+			}
+			p := NewCredentialProvisioner(context.Background(), tc.client, request, 0, APIKeyRules{})
+
+			var rs provisioning.RequestStatus
+			var cred provisioning.Credential
+			if tc.action == provisioning.Rotate {
+				rs, cred = p.Update()
+			} else {
+				rs, cred = p.Provision()
+			}
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			assert.ElementsMatch(t, tc.expectExpiry, expiring)
+			assert.ElementsMatch(t, tc.expectRenewed, renewed)
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				return
+			}
+
+			expiresAt := rs.GetProperties()[common.AttrCredentialExpiresAt]
+			if tc.days == 0 {
+				assert.Empty(t, expiresAt)
+				assert.True(t, cred.GetExpirationTime().IsZero())
+				assert.Nil(t, keyAuth.TTL)
+				return
+			}
+			expected := time.Now().AddDate(0, 0, tc.days)
+			assert.WithinDuration(t, expected, cred.GetExpirationTime(), time.Minute)
+			assert.Equal(t, cred.GetExpirationTime().UTC().Format(time.RFC3339), expiresAt)
+			if tc.expectTTL {
+				assert.InDelta(t, tc.days*24*60*60, *keyAuth.TTL, 60)
+			}
+			if tc.expectData != nil {
+				assert.Equal(t, tc.expectData, cred.GetData())
+			}
+		})
+	}
+}
+
+func TestConsumerAPIKey(t *testing.T) {
+	rules := APIKeyRules{MinLength: 8, MaxLength: 16, Charset: "A-Za-z0-9-"}
+	testCases := map[string]struct {
+		client       mockCredentialClient
+		key          interface{}
+		expectStatus provisioning.Status
+		expectKey    string
+		expectMsg    string
+	}{
+		"key is generated when none is supplied": {
+			expectStatus: provisioning.Success,
+		},
+		"supplied key is used": {
+			key:          "partner-key-01",
+			expectStatus: provisioning.Success,
+			expectKey:    "partner-key-01",
+		},
+		"supplied key too short": {
+			key:          "short",
+			expectStatus: provisioning.Error,
+		},
+		"supplied key too long": {
+			key:          "partner-key-0123456789",
+			expectStatus: provisioning.Error,
+		},
+		"supplied key with characters outside the charset": {
+			key:          "partner_key_01",
+			expectStatus: provisioning.Error,
+		},
+		"supplied key in use": {
+			client:       mockCredentialClient{existingKey: "partner-key-01"},
+			key:          "partner-key-01",
+			expectStatus: provisioning.Error,
+			expectMsg:    "Failed to create api-key credential",
+		},
+		"uniqueness can not be checked": {
+			client:       mockCredentialClient{keyLookupErr: true},
+			key:          "partner-key-01",
+			expectStatus: provisioning.Error,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			keyAuth := klib.KeyAuth{}
+			tc.client.keyAuth = &keyAuth
+			data := map[string]interface{}{}
+			if tc.key != nil {
+				data[common.APIKeyField] = tc.key
+			}
+			request := &mockCredentialRequest{
+				credType:   common.WksPrefixName(common.DefaultWorkspace, provisioning.APIKeyCRD),
+				appDetails: map[string]string{common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID): "consumerID"},
+				data:       data,
+			}
+			rs, cred := NewCredentialProvisioner(context.Background(), tc.client, request, 0, rules).Provision()
+			assert.Equal(t, tc.expectStatus.String(), rs.GetStatus().String())
+			if tc.expectMsg != "" {
+				assert.Equal(t, tc.expectMsg, rs.GetMessage())
+			}
+			if tc.expectStatus != provisioning.Success {
+				assert.Nil(t, cred)
+				assert.Nil(t, keyAuth.Key)
+				return
+			}
+			assert.NotNil(t, keyAuth.Key)
+			if tc.expectKey != "" {
+				assert.Equal(t, tc.expectKey, *keyAuth.Key)
+			} else {
+				assert.NotEmpty(t, *keyAuth.Key)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRulesDescription(t *testing.T) {
+	assert.Equal(t, "Leave empty to generate the key. A supplied key must be unique in the workspace and have at least 16 characters, at most 128 characters, only characters from A-Z",
+		APIKeyRules{MinLength: 16, MaxLength: 128, Charset: "A-Z"}.Description())
+	assert.Equal(t, "Leave empty to generate the key. A supplied key must be unique in the workspace",
+		APIKeyRules{}.Description())
+}
+
+func TestOauth2Credential(t *testing.T) {
+	testCases := map[string]struct {
+		data             map[string]interface{}
+		update           bool
+		expectClientType string
+		expectRedirects  []string
+		expectSecret     bool
+		expectMsg        string
+	}{
+		"confidential client by default": {
+			data:             map[string]interface{}{},
+			expectClientType: common.OAuthClientTypeConfidential,
+			expectSecret:     true,
+		},
+		"confidential client with redirect urls": {
+			data: map[string]interface{}{
+				common.ApplicationTypeField: "Confidential",
+				common.RedirectURLsField:    []interface{}{"https://app.example.com/callback", "https://app.example.com/silent"},
+				common.CorsField:            []interface{}{"https://app.example.com"},
+			},
+			expectClientType: common.OAuthClientTypeConfidential,
+			expectRedirects:  []string{"https://app.example.com/callback", "https://app.example.com/silent"},
+			expectSecret:     true,
+			expectMsg:        "The javascript origins https://app.example.com were not applied, kong can not apply cors to a consumer",
+		},
+		"public client gets no secret": {
+			data: map[string]interface{}{
+				common.ApplicationTypeField: common.OAuthClientTypePublic,
+				common.RedirectURLsField:    []interface{}{"https://spa.example.com/callback"},
+			},
+			expectClientType: common.OAuthClientTypePublic,
+			expectRedirects:  []string{"https://spa.example.com/callback"},
+		},
+		"public client keeps its type on rotation": {
+			data: map[string]interface{}{
+				common.ApplicationTypeField: common.OAuthClientTypePublic,
+			},
+			update:           true,
+			expectClientType: common.OAuthClientTypePublic,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			created := klib.Oauth2Credential{}
+			client := mockCredentialClient{oauth2: &created}
+			request := &mockCredentialRequest{
+				credType:    common.WksPrefixName(common.DefaultWorkspace, provisioning.OAuthSecretCRD),
+				appDetails:  map[string]string{common.WksPrefixName(common.DefaultWorkspace, common.AttrAppID): "consumerID"},
+				credDetails: map[string]string{common.AttrAppID: "consumerID", common.AttrCredentialID: "oauth2ID"},
+				data:        tc.data,
+				action:      provisioning.Rotate,
+			}
+			provisioner := NewCredentialProvisioner(context.Background(), client, request, 0, APIKeyRules{})
+
+			var rs provisioning.RequestStatus
+			var cred provisioning.Credential
+			if tc.update {
+				rs, cred = provisioner.Update()
+			} else {
+				rs, cred = provisioner.Provision()
+			}
+			assert.Equal(t, provisioning.Success.String(), rs.GetStatus().String())
+			assert.Equal(t, tc.expectMsg, rs.GetMessage())
+			assert.NotNil(t, cred)
+
+			assert.Equal(t, tc.expectClientType, *created.ClientType)
+			var redirects []string
+			for _, uri := range created.RedirectURIs {
+				redirects = append(redirects, *uri)
+			}
+			assert.Equal(t, tc.expectRedirects, redirects)
+			assert.NotEmpty(t, cred.GetData()[provisioning.OauthClientID])
+			if tc.expectSecret {
+				assert.NotNil(t, created.ClientSecret)
+				assert.Nil(t, created.HashSecret)
+				assert.NotEmpty(t, cred.GetData()[provisioning.OauthClientSecret])
+			} else {
+				assert.Nil(t, created.ClientSecret)
+				assert.True(t, *created.HashSecret)
+				assert.NotContains(t, cred.GetData(), provisioning.OauthClientSecret)
+			}
 		})
 	}
 }
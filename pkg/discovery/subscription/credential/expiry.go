@@ -0,0 +1,121 @@
+package credential
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+// expiringCredential returns the credential data to central with the time the credential expires at
+type expiringCredential struct {
+	provisioning.Credential
+	expiresAt time.Time
+}
+
+func (c expiringCredential) GetExpirationTime() time.Time {
+	return c.expiresAt
+}
+
+// credentialExpiry returns the time a credential provisioned now expires at, the zero time when the credential
+// request definition does not limit the lifetime of its credentials
+func (p credentialProvisioner) credentialExpiry() time.Time {
+	days := p.request.GetCredentialExpirationDays()
+	if days <= 0 {
+		return time.Time{}
+	}
+	return time.Now().AddDate(0, 0, days)
+}
+
+// keyAuthTTL returns the ttl, in seconds, of a key auth credential expiring at the time, 0 never expires
+func keyAuthTTL(expiresAt time.Time) int {
+	if expiresAt.IsZero() {
+		return 0
+	}
+	return common.CredentialTTL(expiresAt, time.Now())
+}
+
+// scheduleExpiry tags a credential of a type without a native ttl to be deleted by the credential expiry job once
+// its lifetime has passed. The credential is deleted when its expiry can not be scheduled, it would never expire
+func (p credentialProvisioner) scheduleExpiry(ctx context.Context, collection, credentialID string, expiresAt time.Time, deleteCredential func() error) error {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	err := p.client.ExpireCredential(ctx, collection, credentialID, expiresAt)
+	if err == nil {
+		return nil
+	}
+	if delErr := deleteCredential(); delErr != nil {
+		p.logger.WithError(delErr).WithField("credentialID", credentialID).Warn("could not remove the credential without expiry")
+	}
+	return err
+}
+
+// withExpiry adds the time the credential expires at to the status and the credential data returned to central
+func withExpiry(rs provisioning.RequestStatusBuilder, cred provisioning.Credential, expiresAt time.Time) provisioning.Credential {
+	if expiresAt.IsZero() {
+		return cred
+	}
+	rs.AddProperty(common.AttrCredentialExpiresAt, expiresAt.UTC().Format(time.RFC3339))
+	if cred == nil {
+		return nil
+	}
+	return expiringCredential{Credential: cred, expiresAt: expiresAt}
+}
+
+// suppliedSecret returns the secret of the credential supplied by the consumer, an empty string when kong
+// generates the secret of the credential
+func suppliedSecret(credentialType string, provData credentialMetaData) string {
+	switch credentialType {
+	case provisioning.APIKeyARD:
+		return provData.apiKey
+	case common.JWTCRD:
+		if provData.jwtAlgorithm != common.JWTAlgorithmHS256 {
+			return provData.jwtPublicKey
+		}
+	case provisioning.MtlsCRD:
+		return provData.mtlsCertificate
+	}
+	return ""
+}
+
+// secretHash returns the hash of the secret saved with the credential, an empty string for a generated secret
+func secretHash(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))
+}
+
+// isRenewal returns true when the rotation of a credential with a limited lifetime only moves its expiry. Central
+// renews a credential with a rotation, the secret is unchanged when the consumer supplied it and supplies it again.
+// Generated secrets, and changed consumer secrets, are rotated
+func (p credentialProvisioner) isRenewal(credentialType string, expiresAt time.Time) bool {
+	if expiresAt.IsZero() || p.request.GetCredentialDetailsValue(common.AttrCredentialExpiresAt) == "" {
+		return false
+	}
+	hash := secretHash(suppliedSecret(credentialType, getCredProvData(p.request.GetCredentialData())))
+	return hash != "" && hash == p.request.GetCredentialDetailsValue(common.AttrSuppliedSecretHash)
+}
+
+// renew extends the lifetime of the credential to the time, the credential keeps its secret
+func (p credentialProvisioner) renew(ctx context.Context, credentialType, consumerID, credentialID string, expiresAt time.Time) (provisioning.RequestStatus, provisioning.Credential) {
+	rs := provisioning.NewRequestStatusBuilder()
+	log := p.logger.WithField("credentialID", credentialID).
+		WithField("consumerID", consumerID)
+	log.Info("Started credential renewal")
+
+	cred, err := decodeCredential(credentialType, func(collection string, credential interface{}) error {
+		return p.client.RenewCredential(ctx, collection, credentialID, expiresAt, credential)
+	})
+	if err != nil {
+		log.WithError(err).Error("Could not renew credential")
+		return rs.SetMessage(fmt.Sprintf("Failed to renew credential %s", credentialID)).Failed(), nil
+	}
+	cred = withExpiry(rs, cred, expiresAt)
+	log.Info("Credential successful renewal")
+	return rs.SetMessage("Credential renewed.").Success(), cred
+}
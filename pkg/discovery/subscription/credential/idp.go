@@ -0,0 +1,50 @@
+package credential
+
+import (
+	"github.com/Axway/agent-sdk/pkg/agent"
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	sdkUtil "github.com/Axway/agent-sdk/pkg/util"
+
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+// accessRequestCache - the access requests and instances the agent has cached
+type accessRequestCache interface {
+	ListAccessRequests() []*v1.ResourceInstance
+	GetAPIServiceInstanceByName(name string) (*v1.ResourceInstance, error)
+}
+
+// appHasQuota checks the access requests of the application in the workspace for a quota. The quotas of the
+// application consumer are not applied to the consumers of identity provider clients, the access requests being
+// removed, or that failed, are not checked
+func (p credentialProvisioner) appHasQuota(workspace string) bool {
+	cache := p.cache
+	if cache == nil {
+		cache = agent.GetCacheManager()
+	}
+	for _, ri := range cache.ListAccessRequests() {
+		ar := management.NewAccessRequest("", "")
+		if err := ar.FromInstance(ri); err != nil {
+			continue
+		}
+		if ar.Spec.ManagedApplication != p.request.GetApplicationName() || ar.Metadata.State == v1.ResourceDeleting {
+			continue
+		}
+		if ar.Status != nil && ar.Status.Level == provisioning.Error.String() {
+			continue
+		}
+		if provisioning.NewQuotaFromAccessRequest(ar) == nil {
+			continue
+		}
+		instance, err := cache.GetAPIServiceInstanceByName(ar.Spec.ApiServiceInstance)
+		if err != nil || instance == nil {
+			continue
+		}
+		if sdkUtil.ToString(sdkUtil.GetAgentDetails(instance)[common.AttrWorkspaceName]) == workspace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package credential
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	klib "github.com/kong/go-kong/kong"
+)
+
+const (
+	pemTypeCertificate    = "CERTIFICATE"
+	pemTypeCSR            = "CERTIFICATE REQUEST"
+	pemTypeNewCSR         = "NEW CERTIFICATE REQUEST"
+	errNoSubjectName      = "the certificate does not contain a common name or subject alternative name"
+	errUnsupportedPEMType = "unsupported PEM block type %s, expected a certificate or certificate signing request"
+)
+
+// mtlsSubject - the identity kong uses to map a client certificate to a consumer
+type mtlsSubject struct {
+	subjectName string
+	// cert is only set when a certificate, rather than a CSR, was supplied
+	cert *x509.Certificate
+}
+
+// parseMTLSSubject reads the subject name from a PEM encoded certificate or certificate signing request
+func parseMTLSSubject(pemData string) (*mtlsSubject, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("could not decode the PEM certificate data")
+	}
+
+	switch block.Type {
+	case pemTypeCertificate:
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		name := subjectName(cert.Subject, cert.DNSNames, cert.EmailAddresses)
+		if name == "" {
+			return nil, errors.New(errNoSubjectName)
+		}
+		return &mtlsSubject{subjectName: name, cert: cert}, nil
+	case pemTypeCSR, pemTypeNewCSR:
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if err := csr.CheckSignature(); err != nil {
+			return nil, fmt.Errorf("invalid certificate signing request signature: %w", err)
+		}
+		name := subjectName(csr.Subject, csr.DNSNames, csr.EmailAddresses)
+		if name == "" {
+			return nil, errors.New(errNoSubjectName)
+		}
+		return &mtlsSubject{subjectName: name}, nil
+	}
+	return nil, fmt.Errorf(errUnsupportedPEMType, block.Type)
+}
+
+// subjectName returns the common name, falling back to the first DNS or email subject alternative name,
+// matching the values kong compares against the subject_name of the credential
+func subjectName(subject pkix.Name, dnsNames, emails []string) string {
+	if subject.CommonName != "" {
+		return subject.CommonName
+	}
+	if len(dnsNames) > 0 {
+		return dnsNames[0]
+	}
+	if len(emails) > 0 {
+		return emails[0]
+	}
+	return ""
+}
+
+// findIssuingCA returns the kong ca certificate that signed the client certificate, nil if none did
+func findIssuingCA(cert *x509.Certificate, caCerts []*klib.CACertificate) *klib.CACertificate {
+	if cert == nil {
+		return nil
+	}
+	for _, ca := range caCerts {
+		if ca.Cert == nil {
+			continue
+		}
+		block, _ := pem.Decode([]byte(*ca.Cert))
+		if block == nil {
+			continue
+		}
+		caCert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if cert.CheckSignatureFrom(caCert) == nil {
+			return ca
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package credential
+
+import (
+	"context"
+	"time"
+
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agents-kong/pkg/common"
+)
+
+// retireCredential removes the credential replaced by a rotation and returns its id when it stays valid for the
+// rotation grace period, the credential expiry job deletes it once the grace period has passed. Without a grace
+// period, or when its expiry can not be scheduled, the replaced credential is deleted right away. The replacement is
+// deleted when the replaced credential can not be removed, leaving the credential unchanged
+func (p credentialProvisioner) retireCredential(ctx context.Context, collection, credentialID string, deleteReplaced, deleteReplacement func() error) (string, error) {
+	log := p.logger.WithField("credentialID", credentialID)
+	if p.rotationGracePeriod > 0 {
+		err := p.client.ExpireCredential(ctx, collection, credentialID, time.Now().Add(p.rotationGracePeriod))
+		if err == nil {
+			return credentialID, nil
+		}
+		log.WithError(err).Warn("could not schedule the expiry of the rotated credential, deleting it")
+	}
+
+	err := deleteReplaced()
+	if err == nil {
+		return "", nil
+	}
+	if delErr := deleteReplacement(); delErr != nil {
+		log.WithError(delErr).Warn("could not remove the replacement credential")
+	}
+	return "", err
+}
+
+// deleteRotatedCredential deletes the credential replaced by the last rotation of the consumer, ending its grace period
+func (p credentialProvisioner) deleteRotatedCredential(ctx context.Context, credentialType, consumerID string) {
+	rotatedID := p.request.GetCredentialDetailsValue(common.AttrRotatedCredentialID)
+	if rotatedID == "" {
+		return
+	}
+
+	var err error
+	switch credentialType {
+	case provisioning.APIKeyARD:
+		err = p.client.DeleteAuthKey(ctx, consumerID, rotatedID)
+	case provisioning.BasicAuthARD:
+		err = p.client.DeleteHttpBasic(ctx, consumerID, rotatedID)
+	case provisioning.OAuthSecretCRD:
+		err = p.client.DeleteOauth2(ctx, consumerID, rotatedID)
+	case common.JWTCRD:
+		err = p.client.DeleteJWT(ctx, consumerID, rotatedID)
+	case common.HMACCRD:
+		err = p.client.DeleteHMAC(ctx, consumerID, rotatedID)
+	case provisioning.MtlsCRD:
+		err = p.client.DeleteMTLS(ctx, consumerID, rotatedID)
+	default:
+		return
+	}
+	if err != nil {
+		p.logger.WithField("credentialID", rotatedID).Debug("rotated credential does not exist or it has already been deleted")
+	}
+}
@@ -0,0 +1,130 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agents-kong/pkg/common"
+	klib "github.com/kong/go-kong/kong"
+)
+
+// credentialOwner returns the consumer holding the credential, while suspended the credential is held by the
+// suspended consumer of the application
+func (p credentialProvisioner) credentialOwner(consumerID string) string {
+	if suspendedID := p.request.GetCredentialDetailsValue(common.AttrSuspendedConsumerID); suspendedID != "" {
+		return suspendedID
+	}
+	return consumerID
+}
+
+// suspend makes the credential unusable without deleting it. The credential is moved to the suspended consumer of
+// the application, which is denied all requests, an identity provider client consumer is denied its requests
+func (p credentialProvisioner) suspend(ctx context.Context, credentialType, consumerID, credentialID string) (provisioning.RequestStatus, provisioning.Credential) {
+	rs := provisioning.NewRequestStatusBuilder()
+	log := p.logger.WithField("credentialID", credentialID).
+		WithField("consumerID", consumerID)
+	log.Info("Started credential suspension")
+
+	if credentialType == provisioning.OAuthIDPCRD {
+		if err := p.client.DenyConsumer(ctx, credentialID); err != nil {
+			log.WithError(err).Error("Could not suspend the identity provider client consumer")
+			return rs.SetMessage("Failed to suspend the identity provider client consumer").Failed(), nil
+		}
+		rs.AddProperty(common.AttrSuspendedConsumerID, credentialID)
+		log.Info("Identity provider client successful suspension")
+		return rs.SetMessage("Identity provider client consumer suspended.").Success(), nil
+	}
+
+	// the credential replaced by the last rotation is not suspended, its grace period ends
+	p.deleteRotatedCredential(ctx, credentialType, consumerID)
+	rs.AddProperty(common.AttrRotatedCredentialID, "")
+
+	suspended, err := p.client.EnsureSuspendedConsumer(ctx, consumerID)
+	if err != nil {
+		log.WithError(err).Error("Could not create the suspended consumer")
+		return rs.SetMessage("Failed to create the suspended consumer").Failed(), nil
+	}
+	cred, err := p.moveCredential(ctx, credentialType, credentialID, *suspended.ID)
+	if err != nil {
+		log.WithError(err).Error("Could not suspend credential")
+		return rs.SetMessage(fmt.Sprintf("Failed to suspend credential %s", credentialID)).Failed(), nil
+	}
+	rs.AddProperty(common.AttrSuspendedConsumerID, *suspended.ID)
+	log.Info("Credential successful suspension")
+	return rs.SetMessage("Credential suspended.").Success(), cred
+}
+
+// enable restores a suspended credential to the application consumer
+func (p credentialProvisioner) enable(ctx context.Context, credentialType, consumerID, credentialID string) (provisioning.RequestStatus, provisioning.Credential) {
+	rs := provisioning.NewRequestStatusBuilder()
+	log := p.logger.WithField("credentialID", credentialID).
+		WithField("consumerID", consumerID)
+	log.Info("Started credential enablement")
+
+	if credentialType == provisioning.OAuthIDPCRD {
+		if err := p.client.AllowConsumer(ctx, credentialID); err != nil {
+			log.WithError(err).Error("Could not enable the identity provider client consumer")
+			return rs.SetMessage("Failed to enable the identity provider client consumer").Failed(), nil
+		}
+		rs.AddProperty(common.AttrSuspendedConsumerID, "")
+		log.Info("Identity provider client successful enablement")
+		return rs.SetMessage("Identity provider client consumer enabled.").Success(), nil
+	}
+
+	cred, err := p.moveCredential(ctx, credentialType, credentialID, consumerID)
+	if err != nil {
+		log.WithError(err).Error("Could not enable credential")
+		return rs.SetMessage(fmt.Sprintf("Failed to enable credential %s", credentialID)).Failed(), nil
+	}
+	rs.AddProperty(common.AttrSuspendedConsumerID, "")
+	log.Info("Credential successful enablement")
+	return rs.SetMessage("Credential enabled.").Success(), cred
+}
+
+// moveCredential moves the credential to the consumer and returns its data to central
+func (p credentialProvisioner) moveCredential(ctx context.Context, credentialType, credentialID, consumerID string) (provisioning.Credential, error) {
+	return decodeCredential(credentialType, func(collection string, credential interface{}) error {
+		return p.client.MoveCredential(ctx, collection, credentialID, consumerID, credential)
+	})
+}
+
+// decodeCredential updates the credential in its kong credential collection and returns the updated credential data
+// to central. Kong only returns the hash of a basic auth password, no data is returned for basic auth credentials
+func decodeCredential(credentialType string, update func(collection string, credential interface{}) error) (provisioning.Credential, error) {
+	switch credentialType {
+	case provisioning.APIKeyARD:
+		keyAuth := &klib.KeyAuth{}
+		if err := update(common.KeyAuthCredentials, keyAuth); err != nil {
+			return nil, err
+		}
+		return provisioning.NewCredentialBuilder().SetAPIKey(*keyAuth.Key), nil
+	case provisioning.BasicAuthARD:
+		return nil, update(common.BasicAuthCredentials, &klib.BasicAuth{})
+	case provisioning.OAuthSecretCRD:
+		oauth2 := &klib.Oauth2Credential{}
+		if err := update(common.OAuth2Credentials, oauth2); err != nil {
+			return nil, err
+		}
+		return oauth2Credential(oauth2), nil
+	case common.JWTCRD:
+		jwt := &klib.JWTAuth{}
+		if err := update(common.JWTCredentials, jwt); err != nil {
+			return nil, err
+		}
+		return jwtCredential(jwt), nil
+	case common.HMACCRD:
+		hmac := &klib.HMACAuth{}
+		if err := update(common.HMACCredentials, hmac); err != nil {
+			return nil, err
+		}
+		return hmacCredential(hmac), nil
+	case provisioning.MtlsCRD:
+		mtls := &klib.MTLSAuth{}
+		if err := update(common.MTLSCredentials, mtls); err != nil {
+			return nil, err
+		}
+		return mtlsCredential(mtls), nil
+	}
+	return nil, fmt.Errorf("unsupported credential type %s", credentialType)
+}
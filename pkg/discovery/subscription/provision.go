@@ -2,13 +2,16 @@ package subscription
 
 import (
 	"context"
+	"time"
 
 	klib "github.com/kong/go-kong/kong"
 
 	"github.com/Axway/agent-sdk/pkg/agent"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
 	"github.com/Axway/agent-sdk/pkg/util/log"
 
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
 	"github.com/Axway/agents-kong/pkg/discovery/kong"
 	"github.com/Axway/agents-kong/pkg/discovery/subscription/access"
 	"github.com/Axway/agents-kong/pkg/discovery/subscription/application"
@@ -20,7 +23,9 @@ type ProvisionerOption func(*provisioner)
 type kongClient interface {
 	// Provisioning
 	CreateConsumer(ctx context.Context, id, name string) (*klib.Consumer, error)
+	EnsureConsumer(ctx context.Context, id, name string, tags []string) (*klib.Consumer, error)
 	AddConsumerACL(ctx context.Context, id string) error
+	AddConsumerACLGroup(ctx context.Context, id, group string) error
 	DeleteConsumer(ctx context.Context, id string) error
 	// Credential
 	DeleteOauth2(ctx context.Context, consumerID, clientID string) error
@@ -29,10 +34,31 @@ type kongClient interface {
 	CreateHttpBasic(ctx context.Context, consumerID string, basicAuth *klib.BasicAuth) (*klib.BasicAuth, error)
 	CreateOauth2(ctx context.Context, consumerID string, oauth2 *klib.Oauth2Credential) (*klib.Oauth2Credential, error)
 	CreateAuthKey(ctx context.Context, consumerID string, keyAuth *klib.KeyAuth) (*klib.KeyAuth, error)
+	AuthKeyExists(ctx context.Context, key string) (bool, error)
+	DeleteJWT(ctx context.Context, consumerID, jwtID string) error
+	CreateJWT(ctx context.Context, consumerID string, jwt *klib.JWTAuth) (*klib.JWTAuth, error)
+	DeleteHMAC(ctx context.Context, consumerID, hmacID string) error
+	CreateHMAC(ctx context.Context, consumerID string, hmac *klib.HMACAuth) (*klib.HMACAuth, error)
+	DeleteMTLS(ctx context.Context, consumerID, mtlsID string) error
+	CreateMTLS(ctx context.Context, consumerID string, mtls *klib.MTLSAuth) (*klib.MTLSAuth, error)
+	ListCACertificates(ctx context.Context) ([]*klib.CACertificate, error)
+	EnsureSuspendedConsumer(ctx context.Context, appConsumerID string) (*klib.Consumer, error)
+	DenyConsumer(ctx context.Context, consumerID string) error
+	AllowConsumer(ctx context.Context, consumerID string) error
+	MoveCredential(ctx context.Context, collection, credentialID, consumerID string, credential interface{}) error
+	ExpireCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time) error
+	RenewCredential(ctx context.Context, collection, credentialID string, expiresAt time.Time, credential interface{}) error
 	// Access Request
 	AddRouteACL(ctx context.Context, routeID, allowedID string) error
 	RemoveRouteACL(ctx context.Context, routeID, revokedID string) error
 	AddQuota(ctx context.Context, routeID, allowedID, quotaInterval string, quotaLimit int) error
+	RemoveQuota(ctx context.Context, routeID, allowedID string) error
+	QuotaPlugin(ctx context.Context, quotaInterval string) (string, error)
+	// Consumer Groups
+	EnsureConsumerGroup(ctx context.Context, group, quotaInterval string, quotaLimit int) error
+	AddConsumerToGroup(ctx context.Context, group, consumerID string) error
+	RemoveConsumerFromGroup(ctx context.Context, group, consumerID string) error
+	ConsumerGroupsOfConsumer(ctx context.Context, consumerID string) ([]string, error)
 	// Discovery
 	ListServices(ctx context.Context) ([]*klib.Service, error)
 	ListRoutesForService(ctx context.Context, serviceId string) ([]*klib.Route, error)
@@ -41,11 +67,14 @@ type kongClient interface {
 }
 
 type provisioner struct {
-	logger     log.FieldLogger
-	client     kongClient
-	aclDisable bool
-	envName    string
-	workspaces []string
+	logger              log.FieldLogger
+	client              kongClient
+	aclDisable          bool
+	consumerGroups      bool
+	envName             string
+	workspaces          []string
+	rotationGracePeriod time.Duration
+	apiKeyRules         credential.APIKeyRules
 }
 
 // NewProvisioner creates a type to implement the SDK Provisioning methods for handling subscriptions
@@ -65,7 +94,10 @@ func NewProvisioner(client kongClient, envName string, workspaces []string, opts
 	for _, workspace := range workspaces {
 		registerOauth2(workspace)
 		registerBasicAuth(workspace)
-		registerKeyAuth(workspace)
+		registerKeyAuth(workspace, provisioner.apiKeyRules)
+		registerJWT(workspace)
+		registerHMAC(workspace)
+		registerMTLS(workspace)
 	}
 
 }
@@ -76,30 +108,56 @@ func WithACLDisable() ProvisionerOption {
 	}
 }
 
+// WithRotationGracePeriod keeps rotated credentials valid for the grace period after their replacement is created
+func WithRotationGracePeriod(gracePeriod time.Duration) ProvisionerOption {
+	return func(p *provisioner) {
+		p.rotationGracePeriod = gracePeriod
+	}
+}
+
+// WithAPIKeyRules validates the api keys supplied with credential requests against the rules
+func WithAPIKeyRules(rules credential.APIKeyRules) ProvisionerOption {
+	return func(p *provisioner) {
+		p.apiKeyRules = rules
+	}
+}
+
+// WithConsumerGroups provisions access with consumer groups rather than per consumer acls and quotas
+func WithConsumerGroups() ProvisionerOption {
+	return func(p *provisioner) {
+		p.consumerGroups = true
+	}
+}
+
 func (p provisioner) ApplicationRequestProvision(request provisioning.ApplicationRequest) provisioning.RequestStatus {
-	return application.NewApplicationProvisioner(context.Background(), p.client, request, p.workspaces).Provision()
+	return application.NewApplicationProvisioner(requestContext(request.GetID(), management.ManagedApplicationGVK().Kind, audit.ActionProvision), p.client, request, p.workspaces, p.envName).Provision()
 }
 
 func (p provisioner) ApplicationRequestDeprovision(request provisioning.ApplicationRequest) provisioning.RequestStatus {
-	return application.NewApplicationProvisioner(context.Background(), p.client, request, p.workspaces).Deprovision()
+	return application.NewApplicationProvisioner(requestContext(request.GetID(), management.ManagedApplicationGVK().Kind, audit.ActionDeprovision), p.client, request, p.workspaces, p.envName).Deprovision()
 }
 
 func (p provisioner) CredentialProvision(request provisioning.CredentialRequest) (provisioning.RequestStatus, provisioning.Credential) {
-	return credential.NewCredentialProvisioner(context.Background(), p.client, request).Provision()
+	return credential.NewCredentialProvisioner(requestContext(request.GetID(), management.CredentialGVK().Kind, audit.ActionProvision), p.client, request, p.rotationGracePeriod, p.apiKeyRules).Provision()
 }
 
 func (p provisioner) CredentialDeprovision(request provisioning.CredentialRequest) provisioning.RequestStatus {
-	return credential.NewCredentialProvisioner(context.Background(), p.client, request).Deprovision()
+	return credential.NewCredentialProvisioner(requestContext(request.GetID(), management.CredentialGVK().Kind, audit.ActionDeprovision), p.client, request, p.rotationGracePeriod, p.apiKeyRules).Deprovision()
 }
 
 func (p provisioner) CredentialUpdate(request provisioning.CredentialRequest) (provisioning.RequestStatus, provisioning.Credential) {
-	return credential.NewCredentialProvisioner(context.Background(), p.client, request).Update()
+	return credential.NewCredentialProvisioner(requestContext(request.GetID(), management.CredentialGVK().Kind, audit.ActionUpdate), p.client, request, p.rotationGracePeriod, p.apiKeyRules).Update()
 }
 
 func (p provisioner) AccessRequestProvision(request provisioning.AccessRequest) (provisioning.RequestStatus, provisioning.AccessData) {
-	return access.NewAccessProvisioner(context.Background(), p.client, request, p.aclDisable, p.envName).Provision()
+	return access.NewAccessProvisioner(requestContext(request.GetID(), management.AccessRequestGVK().Kind, audit.ActionProvision), p.client, request, p.aclDisable, p.consumerGroups, p.envName).Provision()
 }
 
 func (p provisioner) AccessRequestDeprovision(request provisioning.AccessRequest) provisioning.RequestStatus {
-	return access.NewAccessProvisioner(context.Background(), p.client, request, p.aclDisable, p.envName).Deprovision()
+	return access.NewAccessProvisioner(requestContext(request.GetID(), management.AccessRequestGVK().Kind, audit.ActionDeprovision), p.client, request, p.aclDisable, p.consumerGroups, p.envName).Deprovision()
+}
+
+// requestContext returns the context of the kong changes made for the Central request, they are audited with the request
+func requestContext(id, kind, action string) context.Context {
+	return audit.WithRequest(context.Background(), audit.Request{ID: id, Type: kind, Action: action})
 }
@@ -1,18 +1,28 @@
 package subscription
 
 import (
+	"sync"
+
 	"github.com/Axway/agent-sdk/pkg/agent"
 	"github.com/Axway/agent-sdk/pkg/apic/provisioning"
+	"github.com/Axway/agent-sdk/pkg/authz/oauth"
 	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/subscription/credential"
 	"github.com/sirupsen/logrus"
 )
 
 const Oauth2Name = provisioning.OAuthSecretCRD
 const HttpBasicName = provisioning.BasicAuthARD
 const ApiKeyName = provisioning.APIKeyARD
+const JWTName = common.JWTCRD
+const HMACName = common.HMACCRD
+const MTLSName = provisioning.MtlsCRD
+
+// idpCRDs - the external identity provider credential request definitions registered by this agent
+var idpCRDs = sync.Map{}
 
 func getCredTypes() []string {
-	return []string{"confidential", "public"}
+	return []string{common.OAuthClientTypeConfidential, common.OAuthClientTypePublic}
 }
 
 func registerOauth2(workspace string) {
@@ -55,6 +65,7 @@ func registerBasicAuth(workspace string) {
 		agent.WithCRDRequestSchemaProperty(corsProp),
 	).
 		IsRenewable().
+		IsSuspendable().
 		SetName(common.WksPrefixName(workspace, HttpBasicName)).
 		Register()
 	if err != nil {
@@ -62,8 +73,7 @@ func registerBasicAuth(workspace string) {
 	}
 }
 
-func registerKeyAuth(workspace string) {
-	//"The api key. Leave empty for autogeneration"
+func registerKeyAuth(workspace string, rules credential.APIKeyRules) {
 	corsProp := getCorsSchemaPropertyBuilder()
 	_, err := agent.NewAPIKeyAccessRequestBuilder().SetName(ApiKeyName).Register()
 	if err != nil {
@@ -71,8 +81,15 @@ func registerKeyAuth(workspace string) {
 	}
 	_, err = agent.NewAPIKeyCredentialRequestBuilder(
 		agent.WithCRDRequestSchemaProperty(corsProp),
+		agent.WithCRDRequestSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.APIKeyField).
+				SetLabel("API Key").
+				SetDescription(rules.Description()).
+				IsString()),
 	).
 		IsRenewable().
+		IsSuspendable().
 		SetName(common.WksPrefixName(workspace, ApiKeyName)).
 		Register()
 	if err != nil {
@@ -80,6 +97,168 @@ func registerKeyAuth(workspace string) {
 	}
 }
 
+func registerJWT(workspace string) {
+	corsProp := getCorsSchemaPropertyBuilder()
+	_, err := agent.NewAccessRequestBuilder().SetName(JWTName).Register()
+	if err != nil {
+		logrus.Error("Error registering JWT Access Request")
+	}
+	_, err = agent.NewCredentialRequestBuilder(
+		agent.WithCRDTitle("JWT"),
+		agent.WithCRDRequestSchemaProperty(getJWTAlgorithmSchemaPropertyBuilder()),
+		agent.WithCRDRequestSchemaProperty(corsProp),
+		agent.WithCRDProvisionSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.JWTKeyField).
+				SetLabel("Key (iss claim)").
+				SetRequired().
+				IsString().
+				IsCopyable()),
+		agent.WithCRDProvisionSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.JWTAlgorithmField).
+				SetLabel("Algorithm").
+				IsString()),
+		agent.WithCRDProvisionSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.JWTSecretField).
+				SetLabel("Secret").
+				IsString().
+				IsEncrypted()),
+		agent.WithCRDIsRenewable(),
+		agent.WithCRDIsSuspendable(),
+	).
+		SetName(common.WksPrefixName(workspace, JWTName)).
+		Register()
+	if err != nil {
+		logrus.Error("Error registering JWT Credential Request")
+	}
+}
+
+func registerHMAC(workspace string) {
+	corsProp := getCorsSchemaPropertyBuilder()
+	_, err := agent.NewAccessRequestBuilder().SetName(HMACName).Register()
+	if err != nil {
+		logrus.Error("Error registering HMAC Access Request")
+	}
+	_, err = agent.NewCredentialRequestBuilder(
+		agent.WithCRDTitle("HMAC"),
+		agent.WithCRDRequestSchemaProperty(corsProp),
+		agent.WithCRDProvisionSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.HMACUsernameField).
+				SetLabel("Username").
+				SetRequired().
+				IsString().
+				IsCopyable()),
+		agent.WithCRDProvisionSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.HMACSecretField).
+				SetLabel("Secret").
+				SetRequired().
+				IsString().
+				IsEncrypted()),
+		agent.WithCRDIsRenewable(),
+		agent.WithCRDIsSuspendable(),
+	).
+		SetName(common.WksPrefixName(workspace, HMACName)).
+		Register()
+	if err != nil {
+		logrus.Error("Error registering HMAC Credential Request")
+	}
+}
+
+func registerMTLS(workspace string) {
+	_, err := agent.NewAccessRequestBuilder().SetName(MTLSName).Register()
+	if err != nil {
+		logrus.Error("Error registering MTLS Access Request")
+	}
+	_, err = agent.NewCredentialRequestBuilder(
+		agent.WithCRDTitle("Mutual TLS"),
+		agent.WithCRDRequestSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.MTLSCertificateField).
+				SetLabel("Client Certificate or CSR (PEM)").
+				SetDescription("The subject common name is used to identify the consumer").
+				SetRequired().
+				IsString().
+				SetAsTextArea()),
+		agent.WithCRDProvisionSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.MTLSSubjectNameField).
+				SetLabel("Subject Name").
+				SetRequired().
+				IsString().
+				IsCopyable()),
+		agent.WithCRDProvisionSchemaProperty(
+			provisioning.NewSchemaPropertyBuilder().
+				SetName(common.MTLSCACertificateField).
+				SetLabel("CA Certificate ID").
+				IsString()),
+		agent.WithCRDIsSuspendable(),
+	).
+		SetName(common.WksPrefixName(workspace, MTLSName)).
+		Register()
+	if err != nil {
+		logrus.Error("Error registering MTLS Credential Request")
+	}
+}
+
+// RegisterIDPCredential registers the credential request definition for an external identity provider in the
+// workspace, once, and returns its name. The identity provider registers the client, kong maps it to a consumer
+func RegisterIDPCredential(workspace string, p oauth.Provider) string {
+	name := common.WksPrefixName(workspace, common.IDPCRDName(p.GetName()))
+	if _, found := idpCRDs.Load(name); found {
+		return name
+	}
+
+	title := p.GetTitle()
+	if title == "" {
+		title = p.GetName()
+	}
+
+	_, err := agent.NewAccessRequestBuilder().SetName(Oauth2Name).Register()
+	if err != nil {
+		logrus.Errorf("Error registering Oauth2 Access Request %v", err)
+	}
+
+	_, err = agent.NewOAuthCredentialRequestBuilder(
+		agent.WithCRDName(name),
+		agent.WithCRDTitle("OAuth "+title),
+		agent.WithCRDForIDP(p, p.GetSupportedScopes()),
+		agent.WithCRDRequestSchemaProperty(getCorsSchemaPropertyBuilder()),
+		agent.WithCRDIsRenewable(),
+		agent.WithCRDIsSuspendable(),
+	).
+		SetName(name).
+		Register()
+	if err != nil {
+		logrus.Errorf("Error registering %s credential Request %v", p.GetName(), err)
+		return name
+	}
+	idpCRDs.Store(name, p.GetName())
+	return name
+}
+
+func getJWTAlgorithmSchemaPropertyBuilder() provisioning.PropertyBuilder {
+	publicKeyProp := provisioning.NewSchemaPropertyBuilder().
+		SetName(common.JWTPublicKeyField).
+		SetLabel("Public Key (PEM)").
+		SetRequired().
+		IsString().
+		SetAsTextArea()
+
+	return provisioning.NewSchemaPropertyBuilder().
+		SetName(common.JWTAlgorithmField).
+		SetRequired().
+		SetLabel("Algorithm").
+		IsString().
+		SetEnumValues([]string{common.JWTAlgorithmHS256, common.JWTAlgorithmRS256, common.JWTAlgorithmES256}).
+		SetDefaultValue(common.JWTAlgorithmHS256).
+		AddDependency(common.JWTAlgorithmRS256, publicKeyProp).
+		AddDependency(common.JWTAlgorithmES256, publicKeyProp)
+}
+
 func getAuthRedirectSchemaPropertyBuilder() provisioning.PropertyBuilder {
 	return provisioning.NewSchemaPropertyBuilder().
 		SetName(common.RedirectURLsField).
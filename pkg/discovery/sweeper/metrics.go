@@ -0,0 +1,94 @@
+package sweeper
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Axway/agent-sdk/pkg/util/healthcheck"
+)
+
+const healthcheckEndpoint = "kong-sweep"
+
+// Metrics - counters of the orphans the sweeper found and deleted
+type Metrics struct {
+	mutex sync.Mutex
+	// Runs - the number of sweeps
+	Runs int64 `json:"runs"`
+	// Failures - the number of workspaces that could not be swept
+	Failures int64 `json:"failures"`
+	// LastRun - the time of the last sweep
+	LastRun time.Time `json:"lastRun"`
+	// Current - the orphans found by the last sweep
+	Current map[Kind]int64 `json:"current"`
+	// Deleted - the orphans deleted by all sweeps
+	Deleted map[Kind]int64 `json:"deleted"`
+	// DeleteFailures - the orphans that could not be deleted
+	DeleteFailures map[Kind]int64 `json:"deleteFailures"`
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Current:        map[Kind]int64{},
+		Deleted:        map[Kind]int64{},
+		DeleteFailures: map[Kind]int64{},
+	}
+	for _, kind := range Kinds {
+		m.Current[kind] = 0
+		m.Deleted[kind] = 0
+		m.DeleteFailures[kind] = 0
+	}
+	return m
+}
+
+func (m *Metrics) swept(orphans []Orphan) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Runs++
+	m.LastRun = time.Now()
+	for _, kind := range Kinds {
+		m.Current[kind] = 0
+	}
+	for _, o := range orphans {
+		if o.Deleted {
+			m.Deleted[o.Kind]++
+			continue
+		}
+		m.Current[o.Kind]++
+	}
+}
+
+func (m *Metrics) failed() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Failures++
+}
+
+func (m *Metrics) deleteFailed(kind Kind) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.DeleteFailures[kind]++
+}
+
+// MarshalJSON - the metrics as json, safe for concurrent use
+func (m *Metrics) MarshalJSON() ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	type metrics Metrics
+	return json.Marshal((*metrics)(m))
+}
+
+// status reports the metrics as the details of a passing health check, orphans do not make the agent unhealthy
+func (m *Metrics) status(_ string) *healthcheck.Status {
+	details, err := json.Marshal(m)
+	if err != nil {
+		return &healthcheck.Status{Result: healthcheck.FAIL, Details: err.Error()}
+	}
+	return &healthcheck.Status{Result: healthcheck.OK, Details: string(details)}
+}
+
+// RegisterHealthcheck exposes the metrics on the status endpoint of the agent, i.e. /status/kong-sweep
+func (m *Metrics) RegisterHealthcheck() error {
+	_, err := healthcheck.RegisterHealthcheck("Kong orphaned consumers and credentials", healthcheckEndpoint, m.status)
+	return err
+}
@@ -0,0 +1,301 @@
+package sweeper
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	sdkUtil "github.com/Axway/agent-sdk/pkg/util"
+	"github.com/Axway/agent-sdk/pkg/util/log"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/audit"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+// Kind - the kind of kong entity left behind by the agent
+type Kind string
+
+const (
+	// OrphanedConsumer - a consumer the agent created for an application that is no longer in Central
+	OrphanedConsumer Kind = "orphanedConsumer"
+	// OrphanedSuspendedConsumer - a consumer holding the suspended credentials of a consumer that is gone
+	OrphanedSuspendedConsumer Kind = "orphanedSuspendedConsumer"
+	// OrphanedCredential - a credential the agent created for a credential that is no longer in Central
+	OrphanedCredential Kind = "orphanedCredential"
+)
+
+// Kinds - all kinds of orphans
+var Kinds = []Kind{OrphanedConsumer, OrphanedSuspendedConsumer, OrphanedCredential}
+
+// Orphan - a consumer, or credential, the agent created without its Central resource
+type Orphan struct {
+	Kind      Kind
+	Workspace string
+	// Collection - the kong collection of the entity, consumers or a credential collection
+	Collection string
+	ID         string
+	// Since - the time the entity was first found orphaned, zero when the sweeper only reports orphans
+	Since time.Time
+	// Deleted - true when the entity was deleted, after its quarantine
+	Deleted bool
+}
+
+type kongClient interface {
+	ListConsumers(ctx context.Context) ([]*klib.Consumer, error)
+	ListAgentCredentials(ctx context.Context) ([]kong.ConsumerCredential, error)
+	QuarantineEntity(ctx context.Context, collection, id string, since time.Time) error
+	ReleaseEntity(ctx context.Context, collection, id string) error
+	DeleteEntity(ctx context.Context, collection, id string) error
+}
+
+// centralCache - the Central resources the agent has cached
+type centralCache interface {
+	GetManagedApplicationCacheKeys() []string
+	GetManagedApplication(id string) *v1.ResourceInstance
+	GetWatchResourceCacheKeys(group, kind string) []string
+	GetWatchResourceByKey(key string) *v1.ResourceInstance
+}
+
+// centralState - the kong entities referenced by the Central resources
+type centralState struct {
+	// appIDs - the ids of the managed applications, the custom id of their consumers
+	appIDs map[string]bool
+	// consumers - the consumers of the managed applications, per workspace
+	consumers map[string]map[string]bool
+	// suspendedConsumers - the consumers holding suspended credentials
+	suspendedConsumers map[string]bool
+	// credentials - the kong credentials of the Central credentials, and the ones they replaced
+	credentials    map[string]bool
+	hasCredentials bool
+}
+
+type Sweeper struct {
+	logger     log.FieldLogger
+	client     kongClient
+	cache      centralCache
+	workspaces []string
+	quarantine time.Duration
+	reportOnly bool
+	metrics    *Metrics
+	mutex      sync.Mutex
+}
+
+func NewSweeper(client kongClient, cache centralCache, workspaces []string, quarantine time.Duration, reportOnly bool) *Sweeper {
+	return &Sweeper{
+		logger:     log.NewFieldLogger().WithComponent("Sweeper").WithPackage("sweeper"),
+		client:     client,
+		cache:      cache,
+		workspaces: workspaces,
+		quarantine: quarantine,
+		reportOnly: reportOnly,
+		metrics:    NewMetrics(),
+	}
+}
+
+// Metrics - the orphans found and deleted by the sweeper
+func (s *Sweeper) Metrics() *Metrics {
+	return s.metrics
+}
+
+// Sweep looks for the consumers and credentials the agent created without their Central application or credential.
+// Unless the sweeper only reports them, orphans are tagged with the time they were first found and deleted once
+// orphaned longer than the quarantine. Entities no longer orphaned lose their tag
+func (s *Sweeper) Sweep(now time.Time) []Orphan {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.centralState()
+	if len(state.appIDs) == 0 {
+		// an empty cache is more likely not synchronized than every application removed
+		s.logger.Warn("no managed applications cached, skipping the sweep")
+		return []Orphan{}
+	}
+
+	orphans := []Orphan{}
+	for _, workspace := range s.workspaces {
+		ctx := context.WithValue(audit.WithRequest(context.Background(), audit.Request{Type: audit.TypeSweep}), common.ContextWorkspace, workspace)
+		logger := s.logger.WithField(common.AttrWorkspaceName, workspace)
+
+		consumers, err := s.client.ListConsumers(ctx)
+		if err != nil {
+			logger.WithError(err).Error("could not list consumers")
+			s.metrics.failed()
+			continue
+		}
+		// the credentials are listed first, untagged consumers are only swept when they hold agent credentials
+		credentials, credErr := s.client.ListAgentCredentials(ctx)
+		credentialOwners := map[string]bool{}
+		for _, credential := range credentials {
+			if credential.Consumer != nil && credential.Consumer.ID != nil {
+				credentialOwners[*credential.Consumer.ID] = true
+			}
+		}
+
+		orphanedConsumers := map[string]bool{}
+		for _, consumer := range consumers {
+			kind, orphaned := state.consumerOrphan(workspace, consumer, credentialOwners)
+			if kind == "" {
+				continue
+			}
+			if orphaned {
+				orphanedConsumers[*consumer.ID] = true
+			}
+			if orphan, ok := s.handle(ctx, now, orphaned, Orphan{Kind: kind, Workspace: workspace, Collection: kong.ConsumersCollection, ID: *consumer.ID}, consumer.Tags); ok {
+				orphans = append(orphans, orphan)
+			}
+		}
+
+		if !state.hasCredentials {
+			logger.Warn("no credentials cached, skipping the credential sweep")
+			continue
+		}
+		if credErr != nil {
+			logger.WithError(credErr).Error("could not list credentials")
+			s.metrics.failed()
+			continue
+		}
+		for _, credential := range credentials {
+			if credential.ID == nil || credential.Expiring() {
+				continue
+			}
+			if credential.Consumer != nil && credential.Consumer.ID != nil && orphanedConsumers[*credential.Consumer.ID] {
+				// deleted with its consumer
+				continue
+			}
+			orphaned := !state.credentials[*credential.ID]
+			if orphan, ok := s.handle(ctx, now, orphaned, Orphan{Kind: OrphanedCredential, Workspace: workspace, Collection: credential.Collection, ID: *credential.ID}, credential.Tags); ok {
+				orphans = append(orphans, orphan)
+			}
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Workspace != orphans[j].Workspace {
+			return orphans[i].Workspace < orphans[j].Workspace
+		}
+		return orphans[i].ID < orphans[j].ID
+	})
+	s.metrics.swept(orphans)
+	return orphans
+}
+
+// handle quarantines, or deletes, an orphaned entity and releases an entity that is no longer orphaned. Returns
+// the orphan, false when the entity is not orphaned
+func (s *Sweeper) handle(ctx context.Context, now time.Time, orphaned bool, orphan Orphan, tags []*string) (Orphan, bool) {
+	logger := s.logger.
+		WithField(common.AttrWorkspaceName, orphan.Workspace).
+		WithField("collection", orphan.Collection).
+		WithField("id", orphan.ID).
+		WithField("orphan", orphan.Kind)
+	since, quarantined := kong.OrphanedSince(tags)
+
+	if !orphaned {
+		if quarantined && !s.reportOnly {
+			if err := s.client.ReleaseEntity(ctx, orphan.Collection, orphan.ID); err != nil {
+				logger.WithError(err).Error("could not release entity")
+				return Orphan{}, false
+			}
+			logger.Info("entity no longer orphaned")
+		}
+		return Orphan{}, false
+	}
+
+	if quarantined {
+		orphan.Since = since
+	}
+	logger = logger.WithField("since", orphan.Since)
+	logger.Warn("kong entity without its central resource")
+	if s.reportOnly {
+		return orphan, true
+	}
+
+	if !quarantined {
+		orphan.Since = now
+		if err := s.client.QuarantineEntity(ctx, orphan.Collection, orphan.ID, now); err != nil {
+			logger.WithError(err).Error("could not quarantine orphan")
+		}
+		return orphan, true
+	}
+	if now.Sub(orphan.Since) < s.quarantine {
+		return orphan, true
+	}
+	if err := s.client.DeleteEntity(ctx, orphan.Collection, orphan.ID); err != nil {
+		logger.WithError(err).Error("could not delete orphan")
+		s.metrics.deleteFailed(orphan.Kind)
+		return orphan, true
+	}
+	logger.Info("deleted orphan")
+	orphan.Deleted = true
+	return orphan, true
+}
+
+// consumerOrphan returns the kind of orphan the consumer can be, empty when it was not created by the agent, and
+// true when the consumer is orphaned. An untagged consumer is only taken as created by the agent when it holds
+// credentials the agent created
+func (state *centralState) consumerOrphan(workspace string, consumer *klib.Consumer, credentialOwners map[string]bool) (Kind, bool) {
+	if consumer.ID == nil {
+		return "", false
+	}
+	if !kong.IsAgentConsumer(consumer) && !(kong.IsUntaggedAgentConsumer(consumer) && credentialOwners[*consumer.ID]) {
+		return "", false
+	}
+	if appConsumerID, ok := kong.SuspendedConsumerOf(consumer); ok {
+		return OrphanedSuspendedConsumer, !state.consumers[workspace][appConsumerID] && !state.suspendedConsumers[*consumer.ID]
+	}
+	if consumer.CustomID != nil && state.appIDs[*consumer.CustomID] {
+		return OrphanedConsumer, false
+	}
+	return OrphanedConsumer, !state.consumers[workspace][*consumer.ID]
+}
+
+// centralState collects the consumers and credentials referenced by the cached applications and credentials
+func (s *Sweeper) centralState() *centralState {
+	state := &centralState{
+		appIDs:             map[string]bool{},
+		consumers:          map[string]map[string]bool{},
+		suspendedConsumers: map[string]bool{},
+		credentials:        map[string]bool{},
+	}
+	for _, workspace := range s.workspaces {
+		state.consumers[workspace] = map[string]bool{}
+	}
+
+	for _, key := range s.cache.GetManagedApplicationCacheKeys() {
+		app := s.cache.GetManagedApplication(key)
+		if app == nil {
+			continue
+		}
+		state.appIDs[app.Metadata.ID] = true
+		details := sdkUtil.GetAgentDetails(app)
+		for _, workspace := range s.workspaces {
+			if consumerID := sdkUtil.ToString(details[common.WksPrefixName(workspace, common.AttrAppID)]); consumerID != "" {
+				state.consumers[workspace][consumerID] = true
+			}
+		}
+	}
+
+	gvk := management.CredentialGVK()
+	for _, key := range s.cache.GetWatchResourceCacheKeys(gvk.Group, gvk.Kind) {
+		credential := s.cache.GetWatchResourceByKey(key)
+		if credential == nil {
+			continue
+		}
+		state.hasCredentials = true
+		details := sdkUtil.GetAgentDetails(credential)
+		for _, attr := range []string{common.AttrCredentialID, common.AttrRotatedCredentialID} {
+			if id := sdkUtil.ToString(details[attr]); id != "" {
+				state.credentials[id] = true
+			}
+		}
+		if id := sdkUtil.ToString(details[common.AttrSuspendedConsumerID]); id != "" {
+			state.suspendedConsumers[id] = true
+		}
+	}
+	return state
+}
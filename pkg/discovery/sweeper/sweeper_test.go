@@ -0,0 +1,283 @@
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	klib "github.com/kong/go-kong/kong"
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/api/v1"
+	management "github.com/Axway/agent-sdk/pkg/apic/apiserver/models/management/v1alpha1"
+	"github.com/Axway/agent-sdk/pkg/apic/definitions"
+
+	"github.com/Axway/agents-kong/pkg/common"
+	"github.com/Axway/agents-kong/pkg/discovery/kong"
+)
+
+const (
+	workspace = common.DefaultWorkspace
+	envName   = "env"
+	// the ids of central applications, the custom id of the untagged consumers
+	legacyAppID  = "8a2e8c8e8b6f4d2a018b7f3c2e1d0001"
+	removedAppID = "8a2e8c8e8b6f4d2a018b7f3c2e1d0002"
+)
+
+type mockCache struct {
+	apps        map[string]*v1.ResourceInstance
+	credentials map[string]*v1.ResourceInstance
+}
+
+func (c *mockCache) GetManagedApplicationCacheKeys() []string {
+	keys := []string{}
+	for id := range c.apps {
+		keys = append(keys, id)
+	}
+	return keys
+}
+
+func (c *mockCache) GetManagedApplication(id string) *v1.ResourceInstance {
+	return c.apps[id]
+}
+
+func (c *mockCache) GetWatchResourceCacheKeys(group, kind string) []string {
+	keys := []string{}
+	if group != management.CredentialGVK().Group || kind != management.CredentialGVK().Kind {
+		return keys
+	}
+	for id := range c.credentials {
+		keys = append(keys, id)
+	}
+	return keys
+}
+
+func (c *mockCache) GetWatchResourceByKey(key string) *v1.ResourceInstance {
+	return c.credentials[key]
+}
+
+type call struct {
+	method string
+	id     string
+}
+
+type mockClient struct {
+	consumers   []*klib.Consumer
+	credentials []kong.ConsumerCredential
+	listErr     error
+	calls       *[]call
+}
+
+func (m mockClient) ListConsumers(_ context.Context) ([]*klib.Consumer, error) {
+	return m.consumers, m.listErr
+}
+
+func (m mockClient) ListAgentCredentials(_ context.Context) ([]kong.ConsumerCredential, error) {
+	return m.credentials, nil
+}
+
+func (m mockClient) QuarantineEntity(_ context.Context, _, id string, _ time.Time) error {
+	*m.calls = append(*m.calls, call{"QuarantineEntity", id})
+	return nil
+}
+
+func (m mockClient) ReleaseEntity(_ context.Context, _, id string) error {
+	*m.calls = append(*m.calls, call{"ReleaseEntity", id})
+	return nil
+}
+
+func (m mockClient) DeleteEntity(_ context.Context, _, id string) error {
+	*m.calls = append(*m.calls, call{"DeleteEntity", id})
+	return nil
+}
+
+func app(id, consumerID string) *v1.ResourceInstance {
+	ri, _ := management.NewManagedApplication(id, envName).AsInstance()
+	ri.Metadata.ID = id
+	ri.SetSubResource(definitions.XAgentDetails, map[string]interface{}{common.WksPrefixName(workspace, common.AttrAppID): consumerID})
+	return ri
+}
+
+func credential(name string, details map[string]interface{}) *v1.ResourceInstance {
+	ri, _ := management.NewCredential(name, envName).AsInstance()
+	ri.SetSubResource(definitions.XAgentDetails, details)
+	return ri
+}
+
+func agentConsumer(id string, tags ...string) *klib.Consumer {
+	return &klib.Consumer{ID: klib.String(id), Tags: klib.StringSlice(append(kong.ConsumerTags("", id, envName), tags...)...)}
+}
+
+func agentCredential(id, consumerID string, tags ...string) kong.ConsumerCredential {
+	return kong.ConsumerCredential{
+		Collection: common.KeyAuthCredentials,
+		ID:         klib.String(id),
+		Consumer:   &klib.Consumer{ID: klib.String(consumerID)},
+		Tags:       klib.StringSlice(append([]string{kong.AgentCredentialTag}, tags...)...),
+	}
+}
+
+func orphanedTag(since time.Time) string {
+	return fmt.Sprintf("axway-orphaned:%d", since.Unix())
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	yesterday := now.Add(-25 * time.Hour)
+	lastHour := now.Add(-time.Hour)
+	cache := &mockCache{
+		apps: map[string]*v1.ResourceInstance{
+			"app1":      app("app1", "consumer1"),
+			"app2":      app("app2", ""),
+			legacyAppID: app(legacyAppID, ""),
+		},
+		credentials: map[string]*v1.ResourceInstance{
+			"cred1": credential("cred1", map[string]interface{}{
+				common.AttrCredentialID:        "key1",
+				common.AttrRotatedCredentialID: "rotated1",
+			}),
+			"cred2": credential("cred2", map[string]interface{}{
+				common.AttrCredentialID:        "key2",
+				common.AttrSuspendedConsumerID: "gone-suspendedID",
+			}),
+		},
+	}
+
+	testCases := map[string]struct {
+		consumers    []*klib.Consumer
+		credentials  []kong.ConsumerCredential
+		listErr      error
+		emptyCache   bool
+		reportOnly   bool
+		expectOrphan []Orphan
+		expectCalls  []call
+	}{
+		"no orphans": {
+			consumers: []*klib.Consumer{
+				agentConsumer("consumer1"),
+				// created before the consumer id was stored in the application details
+				{ID: klib.String("consumer2"), CustomID: klib.String("app2"), Tags: klib.StringSlice(kong.ConsumerTags("", "app2", envName)...)},
+				{ID: klib.String("consumer1-suspendedID"), CustomID: klib.String("consumer1-suspended")},
+				{ID: klib.String("gone-suspendedID"), CustomID: klib.String("gone-suspended")},
+				{ID: klib.String("manual"), Username: klib.String("manual")},
+				agentConsumer("imported", kong.ImportTag("billing")),
+			},
+			credentials: []kong.ConsumerCredential{
+				agentCredential("key1", "consumer1"),
+				agentCredential("rotated1", "consumer1"),
+				agentCredential("key2", "consumer1-suspendedID"),
+				agentCredential("expired", "consumer1", "axway-expiring"),
+			},
+			expectOrphan: []Orphan{},
+		},
+		"reports orphans": {
+			consumers: []*klib.Consumer{
+				agentConsumer("consumer1"),
+				agentConsumer("removed"),
+				{ID: klib.String("removed-suspendedID"), CustomID: klib.String("removed-suspended")},
+			},
+			credentials: []kong.ConsumerCredential{
+				agentCredential("key1", "consumer1"),
+				agentCredential("leaked", "consumer1"),
+				agentCredential("removedKey", "removed"),
+			},
+			reportOnly: true,
+			expectOrphan: []Orphan{
+				{Kind: OrphanedCredential, Workspace: workspace, Collection: common.KeyAuthCredentials, ID: "leaked"},
+				{Kind: OrphanedConsumer, Workspace: workspace, Collection: kong.ConsumersCollection, ID: "removed"},
+				{Kind: OrphanedSuspendedConsumer, Workspace: workspace, Collection: kong.ConsumersCollection, ID: "removed-suspendedID"},
+			},
+		},
+		"untagged consumers with agent credentials": {
+			consumers: []*klib.Consumer{
+				agentConsumer("consumer1"),
+				{ID: klib.String("legacy"), CustomID: klib.String(legacyAppID), Username: klib.String("legacy")},
+				{ID: klib.String("legacyRemoved"), CustomID: klib.String(removedAppID), Username: klib.String("removed")},
+				// without agent credentials the consumer may not have been created by the agent
+				{ID: klib.String("manual"), CustomID: klib.String(removedAppID), Username: klib.String("manual")},
+			},
+			credentials: []kong.ConsumerCredential{
+				agentCredential("key1", "consumer1"),
+				agentCredential("key2", "legacy"),
+				agentCredential("removedKey", "legacyRemoved"),
+			},
+			reportOnly: true,
+			expectOrphan: []Orphan{
+				{Kind: OrphanedConsumer, Workspace: workspace, Collection: kong.ConsumersCollection, ID: "legacyRemoved"},
+			},
+		},
+		"quarantines new orphans": {
+			consumers:   []*klib.Consumer{agentConsumer("consumer1"), agentConsumer("removed")},
+			credentials: []kong.ConsumerCredential{agentCredential("leaked", "consumer1")},
+			expectOrphan: []Orphan{
+				{Kind: OrphanedCredential, Workspace: workspace, Collection: common.KeyAuthCredentials, ID: "leaked", Since: now},
+				{Kind: OrphanedConsumer, Workspace: workspace, Collection: kong.ConsumersCollection, ID: "removed", Since: now},
+			},
+			expectCalls: []call{{"QuarantineEntity", "removed"}, {"QuarantineEntity", "leaked"}},
+		},
+		"deletes orphans after their quarantine": {
+			consumers:   []*klib.Consumer{agentConsumer("consumer1"), agentConsumer("removed", orphanedTag(yesterday))},
+			credentials: []kong.ConsumerCredential{agentCredential("leaked", "consumer1", orphanedTag(lastHour))},
+			expectOrphan: []Orphan{
+				{Kind: OrphanedCredential, Workspace: workspace, Collection: common.KeyAuthCredentials, ID: "leaked", Since: lastHour},
+				{Kind: OrphanedConsumer, Workspace: workspace, Collection: kong.ConsumersCollection, ID: "removed", Since: yesterday, Deleted: true},
+			},
+			expectCalls: []call{{"DeleteEntity", "removed"}},
+		},
+		"releases entities no longer orphaned": {
+			consumers:    []*klib.Consumer{agentConsumer("consumer1", orphanedTag(yesterday))},
+			credentials:  []kong.ConsumerCredential{agentCredential("key1", "consumer1", orphanedTag(yesterday))},
+			expectOrphan: []Orphan{},
+			expectCalls:  []call{{"ReleaseEntity", "consumer1"}, {"ReleaseEntity", "key1"}},
+		},
+		"skipped without cached applications": {
+			consumers:    []*klib.Consumer{agentConsumer("removed")},
+			emptyCache:   true,
+			expectOrphan: []Orphan{},
+		},
+		"error listing consumers": {
+			listErr:      fmt.Errorf("error"),
+			expectOrphan: []Orphan{},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			calls := []call{}
+			client := mockClient{consumers: tc.consumers, credentials: tc.credentials, listErr: tc.listErr, calls: &calls}
+			c := cache
+			if tc.emptyCache {
+				c = &mockCache{}
+			}
+			sweeper := NewSweeper(client, c, []string{workspace}, 24*time.Hour, tc.reportOnly)
+			orphans := sweeper.Sweep(now)
+			assert.Equal(t, tc.expectOrphan, orphans)
+			if tc.expectCalls == nil {
+				tc.expectCalls = []call{}
+			}
+			assert.Equal(t, tc.expectCalls, calls)
+		})
+	}
+}
+
+func TestSweepMetrics(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	calls := []call{}
+	client := mockClient{
+		consumers: []*klib.Consumer{
+			agentConsumer("consumer1"),
+			agentConsumer("removed", orphanedTag(now.Add(-48*time.Hour))),
+			agentConsumer("new"),
+		},
+		calls: &calls,
+	}
+	cache := &mockCache{apps: map[string]*v1.ResourceInstance{"app1": app("app1", "consumer1")}}
+	sweeper := NewSweeper(client, cache, []string{workspace}, 24*time.Hour, false)
+	sweeper.Sweep(now)
+
+	metrics := sweeper.Metrics()
+	assert.Equal(t, int64(1), metrics.Runs)
+	assert.Equal(t, int64(1), metrics.Current[OrphanedConsumer])
+	assert.Equal(t, int64(1), metrics.Deleted[OrphanedConsumer])
+	assert.Equal(t, int64(0), metrics.Current[OrphanedCredential])
+}